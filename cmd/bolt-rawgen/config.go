@@ -0,0 +1,133 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+)
+
+// configFile is the name of the project configuration file. It is found in
+// the directory being processed or the nearest parent directory.
+const configFile = ".rawgen.json"
+
+// findConfig returns the path of the configuration file in dir or its nearest
+// parent. Returns a blank path if there is none.
+func findConfig(dir string) (string, error) {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return "", err
+	}
+	for {
+		path := filepath.Join(dir, configFile)
+		if _, err := os.Stat(path); err == nil {
+			return path, nil
+		} else if !os.IsNotExist(err) {
+			return "", err
+		}
+
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return "", nil
+		}
+		dir = parent
+	}
+}
+
+// applyConfig sets flags of fs from a configuration file. The file is a JSON
+// object keyed by flag name, e.g. {"import": ["example.com/raw"], "endian":
+// "big"}. Repeatable flags take an array. Flags already set, such as on the
+// command line, take precedence over the file.
+func applyConfig(fs *flag.FlagSet, path string) error {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	var m map[string]json.RawMessage
+	if err := json.Unmarshal(b, &m); err != nil {
+		return fmt.Errorf("%s: %s", path, err)
+	}
+
+	set := make(map[string]bool)
+	fs.Visit(func(f *flag.Flag) { set[f.Name] = true })
+
+	var keys []string
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		f := fs.Lookup(k)
+		if k == "config" || k == "file" {
+			return fmt.Errorf("%s: %s cannot be set in a config file", path, k)
+		} else if f == nil {
+			return fmt.Errorf("%s: unknown option: %s", path, k)
+		}
+
+		// Values are checked even if the flag is already set.
+		values, err := configValues(f, m[k])
+		if err != nil {
+			return fmt.Errorf("%s: invalid value for %s: %s", path, k, err)
+		} else if set[k] {
+			continue
+		}
+		for _, v := range values {
+			if err := fs.Set(k, v); err != nil {
+				return fmt.Errorf("%s: %s: %s", path, k, err)
+			}
+		}
+	}
+	return nil
+}
+
+// configValues decodes the value of a flag in a configuration file into the
+// type of the flag and returns the values to set it to. Integers must be
+// whole JSON numbers and repeatable flags take an array of strings.
+func configValues(f *flag.Flag, raw json.RawMessage) ([]string, error) {
+	switch v := f.Value.(type) {
+	case *nameMapFlag, *importPathFlag, *globFlag:
+		var a []string
+		if err := json.Unmarshal(raw, &a); err != nil {
+			return nil, errors.New("expected an array of strings")
+		}
+		return a, nil
+	case *benchFlag:
+		var ok bool
+		if err := json.Unmarshal(raw, &ok); err == nil {
+			return []string{strconv.FormatBool(ok)}, nil
+		}
+		var s string
+		if err := json.Unmarshal(raw, &s); err != nil {
+			return nil, errors.New("expected a boolean or string")
+		}
+		return []string{s}, nil
+	case flag.Getter:
+		switch v.Get().(type) {
+		case bool:
+			var ok bool
+			if err := json.Unmarshal(raw, &ok); err != nil {
+				return nil, errors.New("expected a boolean")
+			}
+			return []string{strconv.FormatBool(ok)}, nil
+		case int:
+			var n int
+			if err := json.Unmarshal(raw, &n); err != nil {
+				return nil, errors.New("expected an integer")
+			}
+			return []string{strconv.Itoa(n)}, nil
+		case string:
+			var s string
+			if err := json.Unmarshal(raw, &s); err != nil {
+				return nil, errors.New("expected a string")
+			}
+			return []string{s}, nil
+		}
+	}
+	return nil, errors.New("cannot be set in a config file")
+}
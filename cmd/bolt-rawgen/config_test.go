@@ -0,0 +1,145 @@
+package main
+
+import (
+	"flag"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// testFlags returns a flag set with a flag of each kind that can be set in a
+// configuration file.
+func testFlags() *flag.FlagSet {
+	fs := flag.NewFlagSet("bolt-rawgen", flag.ContinueOnError)
+	fs.SetOutput(ioutil.Discard)
+	fs.Bool("inline", false, "")
+	fs.String("endian", "native", "")
+	fs.Int("jobs", 1, "")
+	fs.String("config", "", "")
+	fs.String("file", "", "")
+	fs.Var(new(importPathFlag), "import", "")
+	fs.Var(new(globFlag), "exclude", "")
+	fs.Var(new(nameMapFlag), "name-map", "")
+	fs.Var(new(benchFlag), "bench", "")
+	return fs
+}
+
+// Ensure that options are read from a configuration file, with flags set on
+// the command line taking precedence.
+func TestApplyConfig(t *testing.T) {
+	path := mustWriteConfig(t, `{
+	"endian": "little",
+	"inline": true,
+	"jobs": 4,
+	"import": ["a", "b"],
+	"exclude": ["internal/*"],
+	"name-map": ["Id$=ID"],
+	"bench": "compare"
+}`)
+
+	fs := testFlags()
+	if err := fs.Parse([]string{"-endian", "big", "-exclude", "old"}); err != nil {
+		t.Fatal(err)
+	} else if err := applyConfig(fs, path); err != nil {
+		t.Fatal(err)
+	}
+	for name, want := range map[string]string{
+		"endian":   "big",
+		"inline":   "true",
+		"jobs":     "4",
+		"import":   "a,b",
+		"exclude":  "old",
+		"name-map": "Id$=ID",
+		"bench":    "compare",
+	} {
+		if v := fs.Lookup(name).Value.String(); v != want {
+			t.Errorf("%s: expected %q, got %q", name, want, v)
+		}
+	}
+
+	// A boolean sets the benchmarks of the generated code.
+	fs = testFlags()
+	if err := applyConfig(fs, mustWriteConfig(t, `{"bench": true}`)); err != nil {
+		t.Fatal(err)
+	} else if v := fs.Lookup("bench").Value.String(); v != "raw" {
+		t.Fatalf("unexpected bench: %q", v)
+	}
+}
+
+// Ensure that unknown options and values not of the type of their flag are
+// rejected, even for flags set on the command line.
+func TestApplyConfig_Invalid(t *testing.T) {
+	for _, tt := range []struct {
+		config string
+		err    string
+	}{
+		{`{"endian": }`, "invalid character '}' looking for beginning of value"},
+		{`{"verbose": true}`, "unknown option: verbose"},
+		{`{"config": "other.json"}`, "config cannot be set in a config file"},
+		{`{"file": "a.go"}`, "file cannot be set in a config file"},
+		{`{"jobs": 1e+06}`, "invalid value for jobs: expected an integer"},
+		{`{"jobs": 1.5}`, "invalid value for jobs: expected an integer"},
+		{`{"jobs": "4"}`, "invalid value for jobs: expected an integer"},
+		{`{"inline": "yes"}`, "invalid value for inline: expected a boolean"},
+		{`{"inline": 1}`, "invalid value for inline: expected a boolean"},
+		{`{"endian": 1}`, "invalid value for endian: expected a string"},
+		{`{"import": "a"}`, "invalid value for import: expected an array of strings"},
+		{`{"import": [1]}`, "invalid value for import: expected an array of strings"},
+		{`{"bench": 1}`, "invalid value for bench: expected a boolean or string"},
+		{`{"bench": "fast"}`, "bench: invalid bench mode: fast"},
+		{`{"exclude": ["["]}`, `exclude: invalid glob: "["`},
+	} {
+		path := mustWriteConfig(t, tt.config)
+		if err := applyConfig(testFlags(), path); err == nil || err.Error() != path+": "+tt.err {
+			t.Errorf("%s: unexpected error: %v", tt.config, err)
+		}
+	}
+
+	fs := testFlags()
+	if err := fs.Parse([]string{"-jobs", "2"}); err != nil {
+		t.Fatal(err)
+	}
+	path := mustWriteConfig(t, `{"jobs": "4"}`)
+	if err := applyConfig(fs, path); err == nil || err.Error() != path+": invalid value for jobs: expected an integer" {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+// Ensure that the nearest configuration file is found.
+func TestFindConfig(t *testing.T) {
+	root := t.TempDir()
+	dir := filepath.Join(root, "a", "b")
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		t.Fatal(err)
+	}
+
+	if path, err := findConfig(dir); err != nil {
+		t.Fatal(err)
+	} else if strings.HasPrefix(path, root) {
+		t.Fatalf("unexpected config: %s", path)
+	}
+
+	for _, d := range []string{root, filepath.Join(root, "a")} {
+		want := filepath.Join(d, configFile)
+		if err := ioutil.WriteFile(want, []byte("{}"), 0600); err != nil {
+			t.Fatal(err)
+		}
+		if path, err := findConfig(dir); err != nil {
+			t.Fatal(err)
+		} else if path != want {
+			t.Fatalf("expected %s, got %s", want, path)
+		}
+	}
+}
+
+// mustWriteConfig writes a configuration file to a temporary directory and
+// returns its path.
+func mustWriteConfig(t *testing.T, config string) string {
+	path := filepath.Join(t.TempDir(), configFile)
+	if err := ioutil.WriteFile(path, []byte(config), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
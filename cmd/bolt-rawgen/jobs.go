@@ -0,0 +1,112 @@
+package main
+
+import (
+	"bytes"
+	"log"
+	"os"
+	"sync"
+)
+
+// job processes a single file. Its output is buffered so files processed
+// concurrently are reported in the order they were found.
+type job struct {
+	path   string
+	stdout bytes.Buffer
+	stderr bytes.Buffer
+	log    *log.Logger
+	done   chan struct{}
+	err    error
+
+	// Counts added to the totals once the job is flushed.
+	blockN, fileN, issueN, changeN int
+}
+
+// newJob returns a job for the file at path.
+func newJob(path string) *job {
+	j := &job{path: path, done: make(chan struct{})}
+	j.log = log.New(&j.stderr, "", 0)
+	return j
+}
+
+// flush writes the output of the job, adds its counts to the totals, and
+// returns its error.
+func (j *job) flush() error {
+	os.Stderr.Write(j.stderr.Bytes())
+	os.Stdout.Write(j.stdout.Bytes())
+	blockN += j.blockN
+	fileN += j.fileN
+	issueN += j.issueN
+	changeN += j.changeN
+	return j.err
+}
+
+func (j *job) traceln(v ...interface{}) {
+	if *verbose {
+		j.log.Println(v...)
+	}
+}
+
+// runJob processes a job. It is replaced in tests.
+var runJob = (*job).run
+
+// run processes each path with up to n files processed concurrently. Output
+// is written in path order and the first error in path order is returned.
+// No files are started after an error, although later files may already
+// have been processed by then, and run waits for every started file to
+// finish before returning so none is left partly written.
+func run(paths []string, n int) error {
+	jobs := make([]*job, len(paths))
+	for i, path := range paths {
+		jobs[i] = newJob(path)
+	}
+
+	// Process files one at a time so nothing is written after an error.
+	if n == 1 {
+		for _, j := range jobs {
+			j.err = runJob(j)
+			if err := j.flush(); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	// Jobs are sent in path order and stop being sent once any job fails,
+	// so every job before the first failure in path order is done.
+	ch := make(chan *job)
+	failed := make(chan struct{})
+	var once sync.Once
+	go func() {
+		defer close(ch)
+		for _, j := range jobs {
+			select {
+			case ch <- j:
+			case <-failed:
+				return
+			}
+		}
+	}()
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := range ch {
+				if j.err = runJob(j); j.err != nil {
+					once.Do(func() { close(failed) })
+				}
+				close(j.done)
+			}
+		}()
+	}
+
+	var err error
+	for _, j := range jobs {
+		<-j.done
+		if err = j.flush(); err != nil {
+			break
+		}
+	}
+	wg.Wait()
+	return err
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// Ensure that output is written in path order however jobs finish.
+func TestRun(t *testing.T) {
+	var paths []string
+	for i := 0; i < 10; i++ {
+		paths = append(paths, fmt.Sprintf("file%d.go", i))
+	}
+	withRunJob(t, func(j *job) error {
+		// Finish earlier files last.
+		var i int
+		fmt.Sscanf(j.path, "file%d.go", &i)
+		time.Sleep(time.Duration(10-i) * time.Millisecond)
+		fmt.Fprintln(&j.stdout, j.path)
+		return nil
+	})
+
+	out := captureStdout(t, func() {
+		if err := run(paths, 4); err != nil {
+			t.Fatal(err)
+		}
+	})
+	if exp := strings.Join(paths, "\n") + "\n"; out != exp {
+		t.Fatalf("unexpected output: %q", out)
+	}
+}
+
+// Ensure that the first error in path order is returned, no jobs are started
+// after an error, and every started job has finished when run returns.
+func TestRun_Error(t *testing.T) {
+	var paths []string
+	for i := 0; i < 100; i++ {
+		paths = append(paths, fmt.Sprintf("file%d.go", i))
+	}
+	var mu sync.Mutex
+	started, finished := make(map[string]bool), make(map[string]bool)
+	withRunJob(t, func(j *job) error {
+		mu.Lock()
+		started[j.path] = true
+		mu.Unlock()
+
+		var err error
+		switch j.path {
+		case "file2.go", "file3.go":
+			err = errors.New(j.path + ": failed")
+		default:
+			time.Sleep(20 * time.Millisecond)
+		}
+		fmt.Fprintln(&j.stdout, j.path)
+
+		mu.Lock()
+		finished[j.path] = true
+		mu.Unlock()
+		return err
+	})
+
+	var err error
+	out := captureStdout(t, func() { err = run(paths, 4) })
+	if err == nil || err.Error() != "file2.go: failed" {
+		t.Fatalf("unexpected error: %v", err)
+	} else if out != "file0.go\nfile1.go\nfile2.go\n" {
+		t.Fatalf("unexpected output: %q", out)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	for path := range started {
+		if !finished[path] {
+			t.Fatalf("job still running: %s", path)
+		}
+	}
+	if len(started) == len(paths) {
+		t.Fatal("expected jobs after the error not to be started")
+	}
+}
+
+// Ensure that nothing is processed after an error when processing files one
+// at a time.
+func TestRun_ErrorSerial(t *testing.T) {
+	var ran []string
+	withRunJob(t, func(j *job) error {
+		ran = append(ran, j.path)
+		if j.path == "b.go" {
+			return errors.New("failed")
+		}
+		return nil
+	})
+
+	captureStdout(t, func() {
+		if err := run([]string{"a.go", "b.go", "c.go"}, 1); err == nil || err.Error() != "failed" {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	})
+	if strings.Join(ran, ",") != "a.go,b.go" {
+		t.Fatalf("unexpected jobs: %v", ran)
+	}
+}
+
+// withRunJob replaces the processing of each job for the rest of a test.
+func withRunJob(t *testing.T, fn func(*job) error) {
+	prev := runJob
+	runJob = fn
+	t.Cleanup(func() { runJob = prev })
+}
+
+// captureStdout returns what fn writes to stdout.
+func captureStdout(t *testing.T, fn func()) string {
+	f, err := ioutil.TempFile("", "bolt-rawgen-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+
+	prev := os.Stdout
+	os.Stdout = f
+	defer func() { os.Stdout = prev }()
+	fn()
+
+	b, err := ioutil.ReadFile(f.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(b)
+}
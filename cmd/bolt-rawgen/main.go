@@ -1,339 +1,786 @@
 package main
 
 import (
-	"bytes"
 	"flag"
 	"fmt"
-	"go/ast"
 	"go/parser"
 	"go/token"
-	"io"
 	"io/ioutil"
 	"log"
 	"os"
+	"os/signal"
 	"path/filepath"
 	"regexp"
+	"strconv"
 	"strings"
-	"unicode"
+	"sync"
+	"syscall"
+	"text/template"
+
+	"github.com/boltdb/raw/rawgen"
 )
 
 // verbose turns on trace-level debugging.
 var verbose = flag.Bool("v", false, "verbose")
 
+// lintOnly reports risky raw struct patterns instead of generating code.
+var lintOnly = flag.Bool("lint", false, "report risky raw struct patterns without generating")
+
+// boltHelpers generates helpers for storing records in bolt buckets.
+var boltHelpers = flag.Bool("bolt", false, "generate bolt bucket helpers")
+
+// jsonMethods generates JSON marshal and unmarshal methods.
+var jsonMethods = flag.Bool("json", false, "generate MarshalJSON and UnmarshalJSON methods")
+
+// sqlMethods generates database/sql Value and Scan methods.
+var sqlMethods = flag.Bool("sql", false, "generate database/sql Value and Scan methods")
+
+// equalMethods generates Equal and Hash methods.
+var equalMethods = flag.Bool("equal", false, "generate Equal and Hash methods")
+
+// explicitLayout generates layout types with explicit padding fields.
+var explicitLayout = flag.Bool("explicit-layout", false, "generate layout types declaring padding explicitly")
+
+// pool generates Encode methods reusing buffers from a sync.Pool.
+var pool = flag.Bool("pool", false, "generate Encode methods reusing buffers released to a sync.Pool")
+
+// arena generates EncodeArena methods encoding into a raw.Arena.
+var arena = flag.Bool("arena", false, "generate EncodeArena methods encoding into a raw.Arena")
+
+// checksum appends a CRC-32C checksum to encoded records.
+var checksum = flag.Bool("checksum", false, "append a CRC-32C checksum to encoded records and verify it when decoding")
+
+// typeTag prefixes encoded records with the type tag of their raw struct.
+var typeTag = flag.Bool("type-tag", false, "prefix encoded records with a tag identifying their type and verify it when decoding")
+
+// allowPadding generates native code for raw structs with implicit padding.
+var allowPadding = flag.Bool("allow-padding", false, "generate native code for raw structs with padding inserted by the compiler")
+
+// insertPadding declares implicit padding with blank fields before generating.
+var insertPadding = flag.Bool("pad", false, "declare padding inserted by the compiler with blank fields in raw structs")
+
+// tinygo generates portable code that doesn't map records with unsafe.
+var tinygo = flag.Bool("tinygo", false, "generate portable code for TinyGo")
+
+// safe generates portable code that doesn't import unsafe.
+var safe = flag.Bool("safe", false, "generate portable code that doesn't use unsafe")
+
+// endian is the byte order of encoded records.
+var endian = flag.String("endian", "native", "byte order of encoded records: native, little, or big")
+
+// arch is the GOARCH whose layout records are encoded with.
+var arch = flag.String("arch", "", "encode records with the layout of `GOARCH`, e.g. arm or 386, using portable code")
+
+// intWidth is the width of int and uint fields, which are rejected if unset.
+var intWidth = flag.Int("int-width", 0, "accept int and uint fields, encoded with a width of `bits`, 32 or 64")
+
+// rootImport is the import path of the module root, which is the directory
+// containing go.mod or, without one, the processed tree.
+var rootImport = flag.String("root-import", "", "import `path` of the module root, read from go.mod if not set")
+
+// rootDir is the directory of the processed tree.
+var rootDir string
+
+// bench generates benchmarks alongside each file of the generated code, if
+// set, or comparing raw with gob and json, if set to "compare".
+var bench benchFlag
+
+// fuzzTests generates fuzz tests of Decode alongside each file.
+var fuzzTests = flag.Bool("fuzz", false, "generate fuzz tests feeding arbitrary bytes to Decode")
+
+// roundTripTests generates round-trip tests alongside each file.
+var roundTripTests = flag.Bool("tests", false, "generate tests encoding and decoding records of each raw struct")
+
+// cHeaders generates C headers alongside each file.
+var cHeaders = flag.Bool("c-header", false, "generate a C header declaring the layout of each raw struct")
+
+// flatBuffers generates FlatBuffers schemas alongside each file.
+var flatBuffers = flag.Bool("fbs", false, "generate a FlatBuffers schema declaring the fields of each raw struct")
+
+// lang is the language of bindings generated alongside each file, if not Go.
+var lang = flag.String("lang", "go", "also generate bindings reading raw structs in `language`: go or rust")
+
+// utf8Policy is the default handling of strings that are not valid UTF-8.
+var utf8Policy = flag.String("utf8", "raw", "handling of invalid UTF-8 strings: raw, replace, or error")
+
+// templatePath is a template rendered in place of the built-in code.
+var templatePath = flag.String("template", "", "render raw structs with the template in `file`")
+
+// tmpl is the parsed custom template, if any.
+var tmpl *template.Template
+
+// nameMaps are regular expression replacements applied to field names.
+var nameMaps nameMapFlag
+
+// importPaths are the import paths recognized as the raw package.
+var importPaths importPathFlag
+
+// excludes are glob patterns of files and directories to skip.
+var excludes globFlag
+
+func init() {
+	flag.Var(&nameMaps, "name-map", "rewrite field names matching `pattern=replacement` (repeatable)")
+	flag.Var(&importPaths, "import", "recognize `path` as the raw package (repeatable, default "+rawgen.DefaultImportPath+")")
+	flag.Var(&excludes, "exclude", "skip files and directories matching `glob` (repeatable)")
+	flag.Var(&bench, "bench", "generate benchmarks of the generated code, or comparing raw with gob and json if set to \"compare\"")
+}
+
+// skipDirs are directory names that are never walked into.
+var skipDirs = map[string]bool{
+	".git":         true,
+	"node_modules": true,
+	"testdata":     true,
+	"vendor":       true,
+}
+
+// lockLayouts checks struct layouts against the lock file in the root.
+var lockLayouts = flag.Bool("lock", false, "fail if struct layouts differ from "+rawgen.LockFile)
+
+// updateLock records the current struct layouts in the lock file.
+var updateLock = flag.Bool("update-lock", false, "record struct layouts in "+rawgen.LockFile)
+
+// file is a single file to process instead of walking a tree.
+var file = flag.String("file", "", "process a single `file`, e.g. $GOFILE from go:generate")
+
+// inline generates code within each file instead of in a separate file.
+var inline = flag.Bool("inline", false, "generate code within each file instead of a separate _rawgen.go file")
+
+// stripOnly removes generated code instead of generating it.
+var stripOnly = flag.Bool("strip", false, "remove all generated code and files")
+
+// diffOnly prints the changes that would be made instead of writing files.
+var diffOnly = flag.Bool("diff", false, "print a unified diff of the changes instead of writing files")
+
+// verifyOnly lists files whose generated code is out of date instead of
+// writing files.
+var verifyOnly = flag.Bool("verify", false, "list files whose generated code is out of date instead of writing files")
+
+// watchMode regenerates files whenever they change.
+var watchMode = flag.Bool("watch", false, "regenerate files whenever they change, polling the tree twice a second, until interrupted")
+
+// configPath is the configuration file, if not found automatically.
+var configPath = flag.String("config", "", "read options from `file` instead of the nearest "+configFile)
+
+// jobN is the number of files processed concurrently.
+var jobN = flag.Int("jobs", 1, "process up to `n` files concurrently")
+
+// blockN and fileN are the number of generated blocks and files removed in
+// strip mode.
+var blockN, fileN int
+
+// issueN is the number of issues reported in lint mode.
+var issueN int
+
+// changeN is the number of files that would change in diff or verify mode.
+var changeN int
+
+// lock holds the struct layouts recorded in the lock file, if enabled.
+var lock rawgen.Lock
+
+// lockDir is the directory containing the lock file.
+var lockDir string
+
+// lockMu protects the lock from files processed concurrently.
+var lockMu sync.Mutex
+
 func main() {
 	log.SetFlags(0)
 
 	// Parse command line arguments.
 	flag.Parse()
-	root := flag.Arg(0)
-	if root == "" {
+
+	// The schema command describes struct layouts instead of generating
+	// code. Flags may also follow the command.
+	schemaCmd := flag.Arg(0) == "schema"
+	if schemaCmd {
+		flag.CommandLine.Parse(flag.Args()[1:])
+		if *stripOnly || *lintOnly || *diffOnly || *verifyOnly || *watchMode {
+			log.Fatal("cannot use schema with -strip, -lint, -diff, -verify, or -watch")
+		}
+	}
+	root := strings.TrimSuffix(flag.Arg(0), "...")
+	if *file != "" {
+		// Process a single file, such as $GOFILE from go:generate.
+		if root != "" {
+			log.Fatal("cannot use -file with a path")
+		} else if info, err := os.Stat(*file); err != nil {
+			log.Fatal(err)
+		} else if info.IsDir() {
+			log.Fatalf("not a file: %s", *file)
+		}
+		root = *file
+	} else if root == "" {
 		log.Fatal("path required")
 	}
 
+	rootDir = root
+	if info, err := os.Stat(root); err == nil && !info.IsDir() {
+		rootDir = filepath.Dir(root)
+	}
+
+	// Read options from the configuration file, which command line flags
+	// take precedence over.
+	if *configPath == "" {
+		path, err := findConfig(rootDir)
+		if err != nil {
+			log.Fatal(err)
+		}
+		*configPath = path
+	}
+	if *configPath != "" {
+		if err := applyConfig(flag.CommandLine, *configPath); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	if *jobN < 1 {
+		log.Fatalf("invalid number of jobs: %d", *jobN)
+	} else if *lang != "go" && *lang != "rust" {
+		log.Fatalf("invalid language: %s", *lang)
+	}
+
+	// Parse the custom template, if any.
+	if *templatePath != "" {
+		t, err := template.ParseFiles(*templatePath)
+		if err != nil {
+			log.Fatal(err)
+		}
+		tmpl = t
+	}
+
+	// Print the schema of every raw struct in the tree.
+	if schemaCmd {
+		if err := writeSchema(root, os.Stdout); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	// Read the lock file from the root directory.
+	if *lockLayouts || *updateLock {
+		lockDir = rootDir
+		l, err := rawgen.ReadLock(filepath.Join(lockDir, rawgen.LockFile))
+		if err != nil {
+			log.Fatal(err)
+		}
+		lock = l
+	}
+
+	// Regenerate files as they change until interrupted.
+	if *watchMode {
+		if *stripOnly || *lintOnly || *diffOnly || *verifyOnly || lock != nil {
+			log.Fatal("cannot use -watch with -strip, -lint, -diff, -verify, or a lock")
+		}
+		sig := make(chan os.Signal, 1)
+		signal.Notify(sig, os.Interrupt, syscall.SIGTERM)
+		watch(root, sig)
+		return
+	}
+
 	// Iterate over the tree and process files importing boltdb/raw.
-	if err := filepath.Walk(root, walk); err != nil {
+	var paths []string
+	if err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		ok, err := walk(root, path, info, err)
+		if ok {
+			paths = append(paths, path)
+		}
+		return err
+	}); err != nil {
 		log.Fatal(err)
 	}
+	if err := run(paths, *jobN); err != nil {
+		log.Fatal(err)
+	}
+
+	// Record the struct layouts once every file has been checked.
+	if lock != nil && !*diffOnly && !*verifyOnly {
+		if err := lock.Write(filepath.Join(lockDir, rawgen.LockFile)); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	if *stripOnly {
+		log.Printf("removed %d generated block(s) and %d generated file(s)", blockN, fileN)
+	}
+
+	// Exit with an error status if lint found any issues.
+	if issueN > 0 {
+		log.Printf("%d issue(s) found", issueN)
+		os.Exit(1)
+	}
+
+	// Exit with an error status if any file would change.
+	if changeN > 0 {
+		log.Printf("%d file(s) would change", changeN)
+		os.Exit(1)
+	}
 }
 
-// Walk recursively iterates over all files in a directory and processes any
-// file that imports "github.com/boltdb/raw".
-func walk(path string, info os.FileInfo, err error) error {
+// Walk recursively iterates over all files in a directory and returns true
+// for each Go file to be processed. Excluded directories below the root are
+// skipped entirely.
+func walk(root, path string, info os.FileInfo, err error) (bool, error) {
 	traceln("walk:", path)
 
 	if info == nil {
-		return fmt.Errorf("file not found: %s", err)
+		return false, fmt.Errorf("file not found: %s", err)
+	} else if path != root && excluded(root, path, info) {
+		traceln("skipping: is excluded")
+		if info.IsDir() {
+			return false, filepath.SkipDir
+		}
+		return false, nil
 	} else if info.IsDir() {
 		traceln("skipping: is directory")
-		return nil
-	} else if filepath.Ext(path) != ".go" {
-		traceln("skipping: is not a go file")
+		return false, nil
+	} else if filepath.Ext(path) != ".go" && !strings.HasSuffix(path, schemaSuffix) {
+		traceln("skipping: is not a go or schema file")
+		return false, nil
+	}
+	return true, nil
+}
+
+// excluded returns true if a file or directory should be skipped. Exclude
+// patterns match either the base name or the slash-separated path relative to
+// the root.
+func excluded(root, path string, info os.FileInfo) bool {
+	if info.IsDir() && skipDirs[info.Name()] {
+		return true
+	}
+	rel, err := filepath.Rel(root, path)
+	if err != nil {
+		rel = path
+	}
+	for _, pattern := range excludes {
+		if ok, _ := filepath.Match(pattern, info.Name()); ok {
+			return true
+		} else if ok, _ := filepath.Match(pattern, filepath.ToSlash(rel)); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// run processes any file that imports the raw package.
+func (j *job) run() error {
+	path := j.path
+
+	// Generate Go source from schema files. Their generated files are
+	// removed in strip mode instead.
+	if strings.HasSuffix(path, schemaSuffix) {
+		if *stripOnly || *lintOnly {
+			return nil
+		}
+		return j.processSchema(path)
+	}
+
+	// Remove whole generated files in strip mode and skip them otherwise.
+	if b, err := ioutil.ReadFile(path); err != nil {
+		return err
+	} else if rawgen.IsGeneratedFile(b) && *stripOnly {
+		j.fileN++
+		return j.removeFile(path)
+	} else if rawgen.IsGeneratedFile(b) {
+		j.traceln("skipping: is generated")
 		return nil
 	}
 
 	// Check if file imports boltdb/raw.
-	if v, err := importsRaw(path); err != nil {
+	if v, err := j.importsRaw(path); err != nil {
 		return err
 	} else if !v {
-		traceln("skipping: does not import raw")
+		j.traceln("skipping: does not import raw")
 		return nil
 	}
 
+	// Only report issues in lint mode.
+	if *lintOnly {
+		issues, err := rawgen.Lint(path, nil)
+		if err != nil {
+			return err
+		}
+		for _, issue := range issues {
+			fmt.Fprintln(&j.stdout, issue)
+		}
+		j.issueN += len(issues)
+		return nil
+	}
+
+	// Only remove generated code in strip mode.
+	if *stripOnly {
+		return j.strip(path)
+	}
+
 	// Process each file.
-	if err := process(path); err != nil {
+	if err := j.process(path); err != nil {
 		return err
 	}
 
 	return nil
 }
 
-// importsRaw returns true if a given path imports boltdb/raw.
-func importsRaw(path string) (bool, error) {
+// importsRaw returns true if a given path imports the raw package.
+func (j *job) importsRaw(path string) (bool, error) {
 	f, err := parser.ParseFile(token.NewFileSet(), path, nil, parser.ImportsOnly)
 	if err != nil {
 		return false, err
 	}
+	paths := importPaths
+	if len(paths) == 0 {
+		paths = importPathFlag{rawgen.DefaultImportPath}
+	}
 	for _, i := range f.Imports {
-		traceln("✓ imports", i.Path.Value)
-		if i.Path.Value == `"github.com/boltdb/raw"` {
-			return true, nil
+		j.traceln("✓ imports", i.Path.Value)
+		for _, p := range paths {
+			if i.Path.Value == strconv.Quote(p) {
+				return true, nil
+			}
 		}
 	}
 	return false, nil
 }
 
+// newGenerator returns a generator for the file at path configured by the
+// command line flags.
+func newGenerator(path string) *rawgen.Generator {
+	return &rawgen.Generator{
+		NameMaps:       nameMaps,
+		ImportPaths:    importPaths,
+		Bolt:           *boltHelpers,
+		JSON:           *jsonMethods,
+		SQL:            *sqlMethods,
+		Equal:          *equalMethods,
+		ExplicitLayout: *explicitLayout,
+		Pool:           *pool,
+		Arena:          *arena,
+		Checksum:       *checksum,
+		TypeTag:        *typeTag,
+		AllowPadding:   *allowPadding,
+		UTF8:           *utf8Policy,
+		TinyGo:         *tinygo,
+		Safe:           *safe,
+		Endian:         *endian,
+		Arch:           *arch,
+		IntWidth:       *intWidth,
+		Dir:            packageDir(path),
+		RootImport:     *rootImport,
+		Template:       tmpl,
+	}
+}
+
+// packageDir returns the directory used to find packages imported by the file
+// at path. A tree without a go.mod file is the module root of a root import
+// path, so its packages are found from the root of the tree.
+func packageDir(path string) string {
+	dir := filepath.Dir(path)
+	if *rootImport == "" {
+		return dir
+	} else if _, err := rawgen.ImportPath(dir, ""); err != nil {
+		return rootDir
+	}
+	return dir
+}
+
 // process parses and rewrites a file by generating the appropriate exported
 // types for raw types.
-func process(path string) error {
+func (j *job) process(path string) error {
 	b, err := ioutil.ReadFile(path)
 	if err != nil {
 		return err
 	}
 
-	// Remove code between begin/end pragma comments.
-	b = regexp.MustCompile(`(?is)//raw:codegen:begin.+?//raw:codegen:end`).ReplaceAll(b, []byte{})
-	b = []byte(strings.TrimRight(string(b), " \n\r"))
+	g := newGenerator(path)
+	if *verbose {
+		g.Logger = j.log
+	}
 
-	// Re-parse the file without the pragmas.
-	f, err := parser.ParseFile(token.NewFileSet(), path, b, 0)
-	if err != nil {
-		return err
+	// Check layouts against the lock before making any changes.
+	if lock != nil {
+		if err := checkLock(g, path, b); err != nil {
+			return err
+		}
 	}
 
-	// Iterate over all the nodes and add exported types where appropriate.
-	var g generator
-	g.w.Write(b)
-	g.w.WriteString("\n\n")
+	// Declare implicit padding with blank fields in the original file, which
+	// is rewritten along with the generated code.
+	var padded bool
+	if *insertPadding {
+		p, n, err := g.InsertPadding(b)
+		if err != nil {
+			return fmt.Errorf("%s: %s", path, err)
+		}
+		b, padded = p, n > 0
+	}
 
-	ast.Walk(&g, f)
-	if g.err != nil {
-		return g.err
+	if *inline {
+		if b, err = g.GenerateFile(b); err != nil {
+			return fmt.Errorf("%s: %s", path, err)
+		}
+
+		// Rewrite original file.
+		if err := j.writeFile(path, b); err != nil {
+			return err
+		}
+	} else if err := j.writeSeparate(g, path, b, padded); err != nil {
+		return err
 	}
 
-	// Rewrite original file.
-	ioutil.WriteFile(path, g.w.Bytes(), 0600)
+	// Write benchmarks to a test file next to the original.
+	switch bench {
+	case "raw":
+		t, err := g.GenerateRawBenchmarks(b)
+		if err != nil {
+			return fmt.Errorf("%s: %s", path, err)
+		}
+		if err := j.writeFile(strings.TrimSuffix(path, ".go")+"_rawgen_bench_test.go", t); err != nil {
+			return err
+		}
+	case "compare":
+		t, err := g.GenerateBenchmarks(b)
+		if err != nil {
+			return fmt.Errorf("%s: %s", path, err)
+		}
+		if err := j.writeFile(strings.TrimSuffix(path, ".go")+"_rawbench_test.go", t); err != nil {
+			return err
+		}
+	}
 
-	log.Println("OK", path)
+	// Write fuzz tests to a test file next to the original.
+	if *fuzzTests {
+		t, err := g.GenerateFuzzTests(b)
+		if err != nil {
+			return fmt.Errorf("%s: %s", path, err)
+		}
+		if err := j.writeFile(strings.TrimSuffix(path, ".go")+"_rawgen_fuzz_test.go", t); err != nil {
+			return err
+		}
+	}
 
-	return nil
-}
+	// Write round-trip tests to a test file next to the original.
+	if *roundTripTests {
+		t, err := g.GenerateRoundTripTests(b)
+		if err != nil {
+			return fmt.Errorf("%s: %s", path, err)
+		}
+		if err := j.writeFile(strings.TrimSuffix(path, ".go")+"_rawgen_test.go", t); err != nil {
+			return err
+		}
+	}
 
-// generator iterates over every AST node and generates code as appropriate.
-type generator struct {
-	w   bytes.Buffer
-	err error
-}
+	// Write the C layout of each raw struct to a header next to the original.
+	if *cHeaders {
+		h, err := g.GenerateCHeader(b)
+		if err != nil {
+			return fmt.Errorf("%s: %s", path, err)
+		} else if h != nil {
+			if err := j.writeFile(strings.TrimSuffix(path, ".go")+"_rawgen.h", h); err != nil {
+				return err
+			}
+		}
+	}
 
-// Visit implements the ast.Visitor interface. It is called once for every AST node.
-func (g *generator) Visit(node ast.Node) ast.Visitor {
-	if g.err != nil || node == nil {
-		return nil
+	// Write Rust bindings next to the original.
+	if *lang == "rust" {
+		rs, err := g.GenerateRust(b)
+		if err != nil {
+			return fmt.Errorf("%s: %s", path, err)
+		} else if rs != nil {
+			if err := j.writeFile(strings.TrimSuffix(path, ".go")+"_rawgen.rs", rs); err != nil {
+				return err
+			}
+		}
 	}
 
-	switch node := node.(type) {
-	case *ast.TypeSpec:
-		if err := g.visitTypeSpec(node); err != nil {
-			g.err = err
+	// Write a FlatBuffers schema next to the original.
+	if *flatBuffers {
+		fbs, err := g.GenerateFlatBuffers(b)
+		if err != nil {
+			return fmt.Errorf("%s: %s", path, err)
+		} else if fbs != nil {
+			if err := j.writeFile(strings.TrimSuffix(path, ".go")+"_rawgen.fbs", fbs); err != nil {
+				return err
+			}
 		}
 	}
-	return g
+
+	j.log.Println("OK", path)
+
+	return nil
 }
 
-// visitTypeSpec is called for every type declaration. Each declaration is
-// checked for raw usage and an exported type is generated if appropriate.
-func (g *generator) visitTypeSpec(node *ast.TypeSpec) error {
-	// Only process struct types.
-	s, ok := node.Type.(*ast.StructType)
-	if !ok {
-		return nil
+// strip removes generated code from a file.
+func (j *job) strip(path string) error {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
 	}
-
-	// Check if this struct type contains only raw fields.
-	if !isRawStructType(s) {
-		traceln("not raw:", node.Name.Name)
+	b, n, err := rawgen.Strip(b)
+	if err != nil {
+		return fmt.Errorf("%s: %s", path, err)
+	} else if n == 0 {
 		return nil
 	}
+	j.blockN += n
+	return j.writeFile(path, b)
+}
 
-	// Disallow raw structs that are exported.
-	if unicode.IsUpper(rune(node.Name.Name[0])) {
-		return fmt.Errorf("raw struct cannot be exported: %s", node.Name.Name)
+// writeSeparate writes the code generated for a file to a separate file. Code
+// previously generated inline is removed from the original file, which is
+// also rewritten if src was changed since it was read.
+func (j *job) writeSeparate(g *rawgen.Generator, path string, src []byte, changed bool) error {
+	gen, err := g.GenerateSeparateFile(src)
+	if err != nil {
+		return fmt.Errorf("%s: %s", path, err)
 	}
 
-	// Generate an exported name.
-	unexp := node.Name.Name
-	exp := tocamelcase(node.Name.Name)
-
-	tracef("• processing: %s -> %s", unexp, exp)
+	if b, n, err := rawgen.Strip(src); err != nil {
+		return fmt.Errorf("%s: %s", path, err)
+	} else if n > 0 || changed {
+		if err := j.writeFile(path, b); err != nil {
+			return err
+		}
+	}
 
-	// Generate exported struct and functions.
-	fmt.Fprint(&g.w, "//raw:codegen:begin\n\n")
-	fmt.Fprint(&g.w, "//\n")
-	fmt.Fprint(&g.w, "// DO NOT CHANGE\n")
-	fmt.Fprint(&g.w, "// This section has been generated by bolt-rawgen.\n")
-	fmt.Fprint(&g.w, "//\n\n")
-	if err := writeExportedType(exp, s, &g.w); err != nil {
-		return fmt.Errorf("generate exported type: %s", s)
+	// Remove a previously generated file if there is nothing to generate.
+	name := rawgen.SeparateFileName(path)
+	if gen == nil {
+		if b, err := ioutil.ReadFile(name); err == nil && rawgen.IsGeneratedFile(b) {
+			return j.removeFile(name)
+		}
+		return nil
 	}
-	if err := writeEncodeFunc(unexp, exp, s, &g.w); err != nil {
-		return fmt.Errorf("generate encode func: %s", s)
+	return j.writeFile(name, gen)
+}
+
+// writeFile writes a file. In diff mode the changes are printed instead and
+// in verify mode the path is printed if the file would change.
+func (j *job) writeFile(path string, b []byte) error {
+	if !*diffOnly && !*verifyOnly {
+		return ioutil.WriteFile(path, b, 0600)
 	}
-	if err := writeDecodeFunc(unexp, exp, s, &g.w); err != nil {
-		return fmt.Errorf("generate decode func: %s", s)
+	old, err := ioutil.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return err
 	}
-	if err := writeAccessorFuncs(unexp, s, &g.w); err != nil {
-		return fmt.Errorf("generate accessor funcs: %s", s)
+	if d := rawgen.Diff(path, old, b); d == nil {
+		return nil
+	} else if *diffOnly {
+		j.stdout.Write(d)
+	} else {
+		fmt.Fprintln(&j.stdout, path)
 	}
-	fmt.Fprint(&g.w, "//raw:codegen:end\n\n")
-
+	j.changeN++
 	return nil
 }
 
-// writeExportedType writes a generated exported type for a raw struct type.
-func writeExportedType(name string, node *ast.StructType, w io.Writer) error {
-	fmt.Fprintf(w, "type %s struct {\n", name)
-
-	for _, f := range node.Fields.List {
-		var typ string
-		switch tostr(f.Type) {
-		case "bool":
-			typ = "bool"
-		case "int8", "int16", "int32", "int64":
-			typ = "int"
-		case "uint8", "uint16", "uint32", "uint64":
-			typ = "uint"
-		case "float32":
-			typ = "float32"
-		case "float64":
-			typ = "float64"
-		case "raw.Time":
-			typ = "time.Time"
-		case "raw.Duration":
-			typ = "time.Duration"
-		case "raw.String":
-			typ = "string"
-		default:
-			return fmt.Errorf("invalid raw type: %s", tostr(f.Type))
-		}
-
-		for _, n := range f.Names {
-			fmt.Fprintf(w, "\t%s %s\n", tocamelcase(n.Name), typ)
-		}
-	}
-
-	fmt.Fprintf(w, "}\n\n")
-	return nil
+// removeFile removes a file. In diff and verify mode the removal is printed
+// instead.
+func (j *job) removeFile(path string) error {
+	if !*diffOnly && !*verifyOnly {
+		return os.Remove(path)
+	}
+	return j.writeFile(path, nil)
 }
 
-// writeEncodeFunc writes a generated encoding function for a raw struct type.
-func writeEncodeFunc(unexp, exp string, node *ast.StructType, w io.Writer) error {
-	fmt.Fprintf(w, "func (o *%s) Encode() []byte {\n", exp)
-	fmt.Fprintf(w, "\tvar r %s\n", unexp)
-	fmt.Fprintf(w, "\tb := make([]byte, unsafe.Sizeof(r), int(unsafe.Sizeof(r)))\n")
-
-	for _, f := range node.Fields.List {
-		typ := tostr(f.Type)
-		for _, n := range f.Names {
-			switch typ {
-			case "bool":
-				fmt.Fprintf(w, "\tr.%s = o.%s\n", n.Name, tocamelcase(n.Name))
-			case "int8", "int16", "int32", "int64", "uint8", "uint16", "uint32", "uint64", "float32", "float64":
-				fmt.Fprintf(w, "\tr.%s = %s(o.%s)\n", n.Name, typ, tocamelcase(n.Name))
-				typ = "uint"
-			case "raw.Time":
-				fmt.Fprintf(w, "\tr.%s = raw.Time(o.%s.UnixNano())\n", n.Name, tocamelcase(n.Name))
-			case "raw.Duration":
-				fmt.Fprintf(w, "\tr.%s = raw.Duration(o.%s)\n", n.Name, tocamelcase(n.Name))
-			case "raw.String":
-				fmt.Fprintf(w, "\tr.%s.Encode(o.%s, &b)\n", n.Name, tocamelcase(n.Name))
-			default:
-				return fmt.Errorf("invalid raw type: %s", tostr(f.Type))
-			}
-		}
+// checkLock compares the layout of each raw struct in a file against the
+// lock. Structs are keyed by their directory, relative to the lock file, and
+// name. Layouts are overwritten instead if the lock is being updated.
+func checkLock(g *rawgen.Generator, path string, src []byte) error {
+	fps, err := g.Fingerprints(src)
+	if err != nil {
+		return fmt.Errorf("%s: %s", path, err)
 	}
 
-	fmt.Fprintf(w, "\tcopy(b, (*[unsafe.Sizeof(r)]byte)(unsafe.Pointer(&r))[:])\n")
-	fmt.Fprintf(w, "\treturn b\n")
-	fmt.Fprintf(w, "}\n\n")
+	rel, err := filepath.Rel(lockDir, filepath.Dir(path))
+	if err != nil {
+		return err
+	}
+
+	lockMu.Lock()
+	defer lockMu.Unlock()
+	for name, fp := range fps {
+		key := filepath.ToSlash(rel) + "." + name
+		if *updateLock {
+			lock[key] = fp
+		} else if err := lock.Check(key, fp); err != nil {
+			return fmt.Errorf("%s: %s with -update-lock", path, err)
+		}
+	}
 	return nil
 }
 
-// writeDecodeFunc writes a generated decoding function for a raw struct type.
-func writeDecodeFunc(unexp, exp string, node *ast.StructType, w io.Writer) error {
-	fmt.Fprintf(w, "func (o *%s) Decode(b []byte) {\n", exp)
-	fmt.Fprintf(w, "\tr := (*%s)(unsafe.Pointer(&b[0]))\n", unexp)
+// nameMapFlag is a flag.Value holding a list of name maps.
+type nameMapFlag []rawgen.NameMap
 
-	for _, f := range node.Fields.List {
-		for _, n := range f.Names {
-			fmt.Fprintf(w, "\to.%s = r.%s()\n", tocamelcase(n.Name), tocamelcase(n.Name))
-		}
+func (f *nameMapFlag) String() string {
+	var a []string
+	for _, m := range *f {
+		a = append(a, m.Pattern.String()+"="+m.Replacement)
 	}
-
-	fmt.Fprintf(w, "}\n\n")
-	return nil
+	return strings.Join(a, ",")
 }
 
-// writeAccessorFuncs writes a accessor functions for a raw struct type.
-func writeAccessorFuncs(name string, node *ast.StructType, w io.Writer) error {
-	for _, f := range node.Fields.List {
-		typ := tostr(f.Type)
-		for _, n := range f.Names {
-			switch typ {
-			case "bool":
-				fmt.Fprintf(w, "func (r *%s) %s() bool { return r.%s }\n\n", name, tocamelcase(n.Name), n.Name)
-			case "int8", "int16", "int32", "int64":
-				fmt.Fprintf(w, "func (r *%s) %s() int { return int(r.%s) }\n\n", name, tocamelcase(n.Name), n.Name)
-			case "uint8", "uint16", "uint32", "uint64":
-				fmt.Fprintf(w, "func (r *%s) %s() uint { return uint(r.%s) }\n\n", name, tocamelcase(n.Name), n.Name)
-			case "float32", "float64":
-				fmt.Fprintf(w, "func (r *%s) %s() %s { return r.%s }\n\n", name, tocamelcase(n.Name), typ, n.Name)
-			case "raw.Time":
-				fmt.Fprintf(w, "func (r *%s) %s() time.Time { return time.Unix(0, int64(r.%s)).UTC() }\n\n", name, tocamelcase(n.Name), n.Name)
-			case "raw.Duration":
-				fmt.Fprintf(w, "func (r *%s) %s() time.Duration { return time.Duration(r.%s) }\n\n", name, tocamelcase(n.Name), n.Name)
-			case "raw.String":
-				fmt.Fprintf(w, "func (r *%s) %s() string { return r.%s.String(((*[0xFFFF]byte)(unsafe.Pointer(r)))[:]) }\n", name, tocamelcase(n.Name), n.Name)
-				fmt.Fprintf(w, "func (r *%s) %sBytes() []byte { return r.%s.Bytes(((*[0xFFFF]byte)(unsafe.Pointer(r)))[:]) }\n\n", name, tocamelcase(n.Name), n.Name)
-			default:
-				return fmt.Errorf("invalid raw type: %s", tostr(f.Type))
-			}
-		}
+// Set parses a "pattern=replacement" value and appends it to the list.
+func (f *nameMapFlag) Set(v string) error {
+	i := strings.LastIndex(v, "=")
+	if i == -1 {
+		return fmt.Errorf("invalid name map: %q", v)
+	}
+	re, err := regexp.Compile(v[:i])
+	if err != nil {
+		return err
 	}
+	*f = append(*f, rawgen.NameMap{Pattern: re, Replacement: v[i+1:]})
 	return nil
 }
 
-// isRawStructType returns true when a type declaration uses all raw types.
-func isRawStructType(node *ast.StructType) bool {
-	for _, f := range node.Fields.List {
-		switch tostr(f.Type) {
-		case "bool":
-		case "int8", "int16", "int32", "int64":
-		case "uint8", "uint16", "uint32", "uint64":
-		case "float32", "float64":
-		case "raw.Time", "raw.Duration":
-		case "raw.String":
-		default:
-			return false
-		}
-	}
-	return true
+// importPathFlag is a flag.Value holding a list of import paths.
+type importPathFlag []string
+
+func (f *importPathFlag) String() string { return strings.Join(*f, ",") }
+
+// Set appends an import path to the list.
+func (f *importPathFlag) Set(v string) error {
+	*f = append(*f, v)
+	return nil
 }
 
-// tostr converts a node to a string.
-func tostr(node ast.Node) string {
-	switch node := node.(type) {
-	case *ast.Ident:
-		return node.Name
-	case *ast.SelectorExpr:
-		return tostr(node.X) + "." + tostr(node.Sel)
+// globFlag is a flag.Value holding a list of glob patterns.
+type globFlag []string
+
+func (f *globFlag) String() string { return strings.Join(*f, ",") }
+
+// Set validates a glob pattern and appends it to the list.
+func (f *globFlag) Set(v string) error {
+	if _, err := filepath.Match(v, ""); err != nil {
+		return fmt.Errorf("invalid glob: %q", v)
 	}
-	return ""
+	*f = append(*f, v)
+	return nil
 }
 
-func tocamelcase(s string) string {
-	if s == "" {
-		return s
+// benchFlag is a flag.Value holding the kind of benchmarks to generate. It can
+// be set without a value to benchmark the generated code.
+type benchFlag string
+
+func (f *benchFlag) String() string { return string(*f) }
+
+// IsBoolFlag allows the flag to be set without a value.
+func (f *benchFlag) IsBoolFlag() bool { return true }
+
+// Set validates and sets the benchmark mode.
+func (f *benchFlag) Set(v string) error {
+	switch v {
+	case "true", "raw":
+		*f = "raw"
+	case "false":
+		*f = ""
+	case "compare":
+		*f = "compare"
+	default:
+		return fmt.Errorf("invalid bench mode: %s", v)
 	}
-	return string(unicode.ToUpper(rune(s[0]))) + string(s[1:])
+	return nil
 }
 
 func trace(v ...interface{}) {
@@ -0,0 +1,218 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"testing"
+)
+
+// eventSrc is a source file with a raw struct.
+const eventSrc = "package x\n\nimport \"github.com/boltdb/raw\"\n\ntype event struct {\n\tname raw.String\n}\n"
+
+// binDir holds the command built for tests that run it.
+var binDir string
+
+func TestMain(m *testing.M) {
+	dir, err := ioutil.TempDir("", "bolt-rawgen-")
+	if err != nil {
+		panic(err)
+	}
+	binDir = dir
+	code := m.Run()
+	os.RemoveAll(dir)
+	os.Exit(code)
+}
+
+// Ensure that walking a tree finds Go and schema files outside of skipped and
+// excluded directories.
+func TestWalk(t *testing.T) {
+	root := t.TempDir()
+	for _, name := range []string{
+		"a.go",
+		"a.txt",
+		"event.raw.json",
+		".git/hook.go",
+		"vendor/v.go",
+		"testdata/t.go",
+		"node_modules/n.go",
+		"internal/keep.go",
+		"internal/legacy/l.go",
+		"internal/legacy/vendor/lv.go",
+		"sub/b.go",
+		"sub/b_old.go",
+		"sub/vendor/sv.go",
+		"sub/deep/testdata/st.go",
+		"sub/deep/c.go",
+	} {
+		mustWriteFile(t, filepath.Join(root, name), "package x\n")
+	}
+
+	for _, tt := range []struct {
+		root     string
+		excludes []string
+		paths    []string
+	}{
+		{"", nil, []string{"a.go", "event.raw.json", "internal/keep.go", "internal/legacy/l.go", "sub/b.go", "sub/b_old.go", "sub/deep/c.go"}},
+
+		// Base names match files and directories at any depth.
+		{"", []string{"*_old.go"}, []string{"a.go", "event.raw.json", "internal/keep.go", "internal/legacy/l.go", "sub/b.go", "sub/deep/c.go"}},
+		{"", []string{"deep"}, []string{"a.go", "event.raw.json", "internal/keep.go", "internal/legacy/l.go", "sub/b.go", "sub/b_old.go"}},
+		{"", []string{"*.json", "legacy"}, []string{"a.go", "internal/keep.go", "sub/b.go", "sub/b_old.go", "sub/deep/c.go"}},
+
+		// Paths match relative to the root.
+		{"", []string{"internal/legacy"}, []string{"a.go", "event.raw.json", "internal/keep.go", "sub/b.go", "sub/b_old.go", "sub/deep/c.go"}},
+		{"", []string{"sub/*.go"}, []string{"a.go", "event.raw.json", "internal/keep.go", "internal/legacy/l.go", "sub/deep/c.go"}},
+		{"", []string{"sub/*"}, []string{"a.go", "event.raw.json", "internal/keep.go", "internal/legacy/l.go"}},
+		{"", []string{"internal/keep"}, []string{"a.go", "event.raw.json", "internal/keep.go", "internal/legacy/l.go", "sub/b.go", "sub/b_old.go", "sub/deep/c.go"}},
+		{"sub", []string{"sub/b.go"}, []string{"b.go", "b_old.go", "deep/c.go"}},
+		{"sub", []string{"deep/c.go"}, []string{"b.go", "b_old.go"}},
+
+		// A skipped or excluded directory is walked if it's the root.
+		{"vendor", nil, []string{"v.go"}},
+		{"internal/legacy", []string{"legacy"}, []string{"l.go"}},
+	} {
+		if paths := mustWalk(t, filepath.Join(root, tt.root), tt.excludes); !reflect.DeepEqual(paths, tt.paths) {
+			t.Errorf("%s %q: unexpected paths: %q", tt.root, tt.excludes, paths)
+		}
+	}
+}
+
+// mustWalk returns the files found by walking root with the given exclude
+// patterns, relative to root.
+func mustWalk(t *testing.T, root string, patterns []string) []string {
+	prev := excludes
+	excludes = patterns
+	defer func() { excludes = prev }()
+
+	var paths []string
+	if err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		ok, err := walk(root, path, info, err)
+		if ok {
+			rel, _ := filepath.Rel(root, path)
+			paths = append(paths, filepath.ToSlash(rel))
+		}
+		return err
+	}); err != nil {
+		t.Fatal(err)
+	}
+	return paths
+}
+
+// mustWriteFile writes a file, creating its directory if needed.
+func mustWriteFile(t *testing.T, path, s string) {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		t.Fatal(err)
+	} else if err := ioutil.WriteFile(path, []byte(s), 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// Ensure that verify mode lists stale files and exits with an error status
+// without writing anything.
+func TestMain_Verify(t *testing.T) {
+	dir := t.TempDir()
+	path, gen := filepath.Join(dir, "event.go"), filepath.Join(dir, "event_rawgen.go")
+	mustWriteFile(t, path, eventSrc)
+
+	// The generated file is missing.
+	if out, _, code := mustRunRawgen(t, "", "-verify", dir); code != 1 || out != gen+"\n" {
+		t.Fatalf("unexpected result: %d %q", code, out)
+	} else if _, err := os.Stat(gen); !os.IsNotExist(err) {
+		t.Fatalf("expected no generated file: %v", err)
+	}
+
+	// The generated file is up to date.
+	if out, _, code := mustRunRawgen(t, "", dir); code != 0 {
+		t.Fatalf("unexpected result: %d %q", code, out)
+	} else if out, _, code := mustRunRawgen(t, "", "-verify", dir); code != 0 || out != "" {
+		t.Fatalf("unexpected result: %d %q", code, out)
+	}
+
+	// The generated file is stale and left unchanged.
+	b := mustReadFile(t, gen)
+	mustWriteFile(t, path, eventSrc[:len(eventSrc)-2]+"\tn int32\n}\n")
+	if out, _, code := mustRunRawgen(t, "", "-verify", dir); code != 1 || out != gen+"\n" {
+		t.Fatalf("unexpected result: %d %q", code, out)
+	} else if !bytes.Equal(mustReadFile(t, gen), b) {
+		t.Fatal("generated file changed")
+	}
+}
+
+// mustRunRawgen runs the command in dir, if set, and returns its standard
+// output and error and its exit status.
+func mustRunRawgen(t *testing.T, dir string, args ...string) (string, string, int) {
+	buildOnce.Do(func() {
+		buildErr = exec.Command("go", "build", "-o", filepath.Join(binDir, "bolt-rawgen"), ".").Run()
+	})
+	if buildErr != nil {
+		t.Fatalf("build: %s", buildErr)
+	}
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command(filepath.Join(binDir, "bolt-rawgen"), args...)
+	cmd.Dir, cmd.Stdout, cmd.Stderr = dir, &stdout, &stderr
+	var exitErr *exec.ExitError
+	if err := cmd.Run(); errors.As(err, &exitErr) {
+		return stdout.String(), stderr.String(), exitErr.ExitCode()
+	} else if err != nil {
+		t.Fatal(err)
+	}
+	return stdout.String(), stderr.String(), 0
+}
+
+// buildOnce builds the command the first time it's run.
+var (
+	buildOnce sync.Once
+	buildErr  error
+)
+
+// mustReadFile returns the contents of a file.
+func mustReadFile(t *testing.T, path string) []byte {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+// Ensure that a single file is processed with -file, such as $GOFILE from
+// go:generate, using the configuration file nearest to it.
+func TestMain_File(t *testing.T) {
+	dir := t.TempDir()
+	mustWriteFile(t, filepath.Join(dir, "event.go"), eventSrc)
+	mustWriteFile(t, filepath.Join(dir, "other.go"), eventSrc)
+	mustWriteFile(t, filepath.Join(dir, configFile), `{"inline": true}`)
+
+	// The file is found relative to the working directory, as from go
+	// generate, and other files in the directory are left alone.
+	if _, stderr, code := mustRunRawgen(t, dir, "-file", "event.go"); code != 0 {
+		t.Fatalf("unexpected result: %d %s", code, stderr)
+	} else if b := mustReadFile(t, filepath.Join(dir, "event.go")); !bytes.Contains(b, []byte("type Event struct {")) {
+		t.Fatalf("expected inline code:\n%s", b)
+	} else if b := mustReadFile(t, filepath.Join(dir, "other.go")); string(b) != eventSrc {
+		t.Fatalf("unexpected change to other file:\n%s", b)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "event_rawgen.go")); !os.IsNotExist(err) {
+		t.Fatalf("expected no separate file: %v", err)
+	}
+
+	for _, tt := range []struct {
+		args   []string
+		stderr string
+	}{
+		{[]string{"-file", "event.go", "."}, "cannot use -file with a path\n"},
+		{[]string{"-file", "."}, "not a file: .\n"},
+		{[]string{"-file", "missing.go"}, "stat missing.go: no such file or directory\n"},
+		{[]string{"-file", "event.go", "-config", "missing.json"}, "open missing.json: no such file or directory\n"},
+	} {
+		if _, stderr, code := mustRunRawgen(t, dir, tt.args...); code != 1 || stderr != tt.stderr {
+			t.Errorf("%q: unexpected result: %d %q", tt.args, code, stderr)
+		}
+	}
+}
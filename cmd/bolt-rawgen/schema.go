@@ -0,0 +1,107 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/boltdb/raw/rawgen"
+)
+
+// schemaSuffix is the suffix of schema files that Go source is generated from.
+// The schema of user.raw.json is generated into user_raw.go.
+const schemaSuffix = ".raw.json"
+
+// writeSchema writes a JSON array with the schema of each file under root
+// that declares raw structs. Generated files are skipped.
+func writeSchema(root string, w io.Writer) error {
+	schemas := []*rawgen.Schema{}
+	if err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if ok, err := walk(root, path, info, err); !ok {
+			return err
+		}
+
+		if strings.HasSuffix(path, schemaSuffix) {
+			traceln("skipping: is a schema file")
+			return nil
+		}
+		b, err := ioutil.ReadFile(path)
+		if err != nil {
+			return err
+		} else if rawgen.IsGeneratedFile(b) {
+			traceln("skipping: is generated")
+			return nil
+		}
+		if ok, err := newJob(path).importsRaw(path); err != nil {
+			return err
+		} else if !ok {
+			traceln("skipping: does not import raw")
+			return nil
+		}
+
+		s, err := newGenerator(path).Schema(b)
+		if err != nil {
+			return fmt.Errorf("%s: %s", path, err)
+		} else if len(s.Structs) == 0 {
+			return nil
+		}
+
+		// Paths are relative to the root so schemas are the same on
+		// every machine.
+		if rel, err := filepath.Rel(root, path); err == nil && rel != "." {
+			path = rel
+		}
+		s.File = filepath.ToSlash(path)
+		schemas = append(schemas, s)
+		return nil
+	}); err != nil {
+		return err
+	}
+
+	b, err := json.MarshalIndent(schemas, "", "\t")
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "%s\n", b)
+	return err
+}
+
+// processSchema generates a Go source file from the schema file at path. The
+// file has the same format as the output of the schema command, except that
+// it describes a single file.
+func (j *job) processSchema(path string) error {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	var s rawgen.Schema
+	if err := json.Unmarshal(b, &s); err != nil {
+		return fmt.Errorf("%s: %s", path, err)
+	}
+
+	target := strings.TrimSuffix(path, schemaSuffix) + "_raw.go"
+	g := newGenerator(target)
+	if *verbose {
+		g.Logger = j.log
+	}
+	if b, err = g.GenerateFromSchema(&s); err != nil {
+		return fmt.Errorf("%s: %s", path, err)
+	}
+
+	// Check layouts against the lock before making any changes.
+	if lock != nil {
+		if err := checkLock(g, target, b); err != nil {
+			return err
+		}
+	}
+
+	if err := j.writeFile(target, b); err != nil {
+		return err
+	}
+	j.log.Println("OK", path)
+	return nil
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// watchInterval is how often the tree is polled for changes in watch mode.
+var watchInterval = 500 * time.Millisecond
+
+// watch processes every Go file in root and then processes them again
+// whenever they change, until a value is received from stop. The tree is
+// polled for changes so no dependencies outside the standard library are
+// required. Stopping waits for the file being processed, if any, so none is
+// left partly written. Errors are logged instead of stopping the watch.
+func watch(root string, stop <-chan os.Signal) {
+	ticker := time.NewTicker(watchInterval)
+	defer ticker.Stop()
+
+	mtimes := make(map[string]time.Time)
+	for {
+		filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+			if ok, err := walk(root, path, info, err); err == filepath.SkipDir {
+				return err
+			} else if !ok || err != nil {
+				return nil
+			} else if t, ok := mtimes[path]; ok && t.Equal(info.ModTime()) {
+				return nil
+			}
+
+			if err := run([]string{path}, 1); err != nil {
+				log.Println(err)
+			}
+
+			// Record the time after processing so files rewritten with
+			// inline code aren't processed again.
+			if info, err := os.Stat(path); err == nil {
+				mtimes[path] = info.ModTime()
+			}
+			return nil
+		})
+
+		select {
+		case <-ticker.C:
+		case <-stop:
+			return
+		}
+	}
+}
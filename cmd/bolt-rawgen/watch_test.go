@@ -0,0 +1,53 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// Ensure that files are regenerated when they change until the watch is
+// stopped.
+func TestWatch(t *testing.T) {
+	prev := watchInterval
+	watchInterval = 10 * time.Millisecond
+	defer func() { watchInterval = prev }()
+
+	dir := t.TempDir()
+	path, gen := filepath.Join(dir, "event.go"), filepath.Join(dir, "event_rawgen.go")
+	mustWriteFile(t, path, eventSrc)
+
+	stop, done := make(chan os.Signal, 1), make(chan struct{})
+	go func() {
+		watch(dir, stop)
+		close(done)
+	}()
+
+	// waitFor waits for the generated file to contain s.
+	waitFor := func(s string) {
+		for deadline := time.Now().Add(10 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+			if b, err := ioutil.ReadFile(gen); err == nil && bytes.Contains(b, []byte(s)) {
+				return
+			}
+		}
+		t.Fatalf("timed out waiting for %q", s)
+	}
+	waitFor("Name string")
+
+	// Change the file with a later modification time.
+	mustWriteFile(t, path, eventSrc[:len(eventSrc)-2]+"\tn int32\n}\n")
+	if err := os.Chtimes(path, time.Now(), time.Now().Add(time.Second)); err != nil {
+		t.Fatal(err)
+	}
+	waitFor("N    int")
+
+	stop <- os.Interrupt
+	select {
+	case <-done:
+	case <-time.After(10 * time.Second):
+		t.Fatal("watch not stopped")
+	}
+}
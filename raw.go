@@ -4,9 +4,93 @@ Package raw provides utilities for mapping raw Go structs to byte slices.
 package raw
 
 import (
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"math/big"
+	"net/netip"
+	"strconv"
+	"strings"
+	"time"
 	"unsafe"
 )
 
+// ErrInvalidUTF8 is returned when a string is not valid UTF-8.
+var ErrInvalidUTF8 = errors.New("raw: invalid utf-8")
+
+// ErrVersion is returned when decoding a record of a different version.
+var ErrVersion = errors.New("raw: unexpected record version")
+
+// ErrInvalidEnum is returned when decoding a record with an enum field that
+// isn't one of its values.
+var ErrInvalidEnum = errors.New("raw: invalid enum value")
+
+// ErrInvalidField is returned when validating a record with a field outside
+// of the limits set by its tags.
+var ErrInvalidField = errors.New("raw: invalid field")
+
+// ErrChecksum is returned when decoding a record whose checksum doesn't match
+// its contents.
+var ErrChecksum = errors.New("raw: checksum mismatch")
+
+// ErrTypeTag is returned when decoding a record whose type tag is of another
+// type.
+var ErrTypeTag = errors.New("raw: unexpected type tag")
+
+// ErrOverflow is returned when encoding or decoding an int or uint field
+// whose value doesn't fit in its encoded width or in an int.
+var ErrOverflow = errors.New("raw: integer overflow")
+
+// ErrSchema is returned when checking the schema of a database that stores
+// records of a raw struct with an incompatible layout.
+var ErrSchema = errors.New("raw: incompatible schema")
+
+// ErrDuplicateIndex is returned when putting a record whose indexed field has
+// the same value as that of another record.
+var ErrDuplicateIndex = errors.New("raw: duplicate index value")
+
+// SchemaBucket is the name of the bolt bucket recording the layout
+// fingerprint of the records in each bucket, which generated schema checks
+// compare against.
+const SchemaBucket = "raw.schema"
+
+// ErrInvalidUUID is returned when parsing a string that isn't a UUID.
+var ErrInvalidUUID = errors.New("raw: invalid uuid")
+
+// ErrInvalidDecimal is returned when parsing a string that isn't a decimal.
+var ErrInvalidDecimal = errors.New("raw: invalid decimal")
+
+// ErrInvalidInt128 is returned when parsing a string that isn't an integer
+// in the range of a 128-bit integer type.
+var ErrInvalidInt128 = errors.New("raw: invalid 128-bit integer")
+
+// Encoder is implemented by fixed size field types that encode a value of type
+// T into a record. Variable length data may be appended to the record. String
+// implements Encoder[string].
+type Encoder[T any] interface {
+	Encode(v T, value *[]byte)
+}
+
+// Decoder is implemented by fixed size field types that decode a value of
+// type T from the record that contains them. String implements
+// Decoder[string].
+type Decoder[T any] interface {
+	Decode(value []byte) T
+}
+
+// CheckOffset panics if data of length n at offset off in a record can't be
+// referenced by an offset and length of the given number of bits. Encoding
+// the data would otherwise silently truncate its offset or length. It is
+// called when encoding variable length fields, including by generated code.
+func CheckOffset(off, n, bits int) {
+	if max := 1<<uint(bits) - 1; off > max || n > max {
+		panic(fmt.Sprintf("raw: %d bytes at offset %d exceed the %d-bit limit of %d", n, off, bits, max))
+	}
+}
+
 // String represents an offset and pointer to a string in a byte slice.
 type String struct {
 	Offset uint16
@@ -15,6 +99,7 @@ type String struct {
 
 // Encode writes a string to a byte slice and updates the offset/length.
 func (s *String) Encode(str string, value *[]byte) {
+	CheckOffset(len(*value), len(str), 16)
 	s.Offset = uint16(len(*value))
 	s.Length = uint16(len(str))
 	*value = append(*value, []byte(str)...)
@@ -22,7 +107,12 @@ func (s *String) Encode(str string, value *[]byte) {
 
 // Bytes returns a byte slice pointing to the string's contents.
 func (s *String) Bytes(value []byte) []byte {
-	return (*[0xFFFF]byte)(unsafe.Pointer(&value[s.Offset]))[:s.Length]
+	return value[s.Offset:s.End()]
+}
+
+// End returns the offset of the end of the string's contents.
+func (s *String) End() int {
+	return int(s.Offset) + int(s.Length)
 }
 
 // String returns a Go string of the string value from an encoded byte slice.
@@ -30,8 +120,710 @@ func (s *String) String(value []byte) string {
 	return string(s.Bytes(value))
 }
 
-// Time is a marker type for time.Time.
+// Decode returns the string value from an encoded byte slice.
+func (s *String) Decode(value []byte) string {
+	return s.String(value)
+}
+
+// NullString is a String that may be null. A null string has no contents.
+type NullString struct {
+	Offset uint16
+	Length uint16
+	Valid  bool
+}
+
+// Encode writes a string to a byte slice and marks it as valid.
+func (s *NullString) Encode(str string, value *[]byte) {
+	CheckOffset(len(*value), len(str), 16)
+	s.Offset = uint16(len(*value))
+	s.Length = uint16(len(str))
+	s.Valid = true
+	*value = append(*value, []byte(str)...)
+}
+
+// Bytes returns a byte slice pointing to the string's contents.
+func (s *NullString) Bytes(value []byte) []byte {
+	return value[s.Offset:s.End()]
+}
+
+// End returns the offset of the end of the string's contents.
+func (s *NullString) End() int {
+	return int(s.Offset) + int(s.Length)
+}
+
+// String returns a Go string of the string value from an encoded byte slice.
+// Returns a blank string if the string is null.
+func (s *NullString) String(value []byte) string {
+	return string(s.Bytes(value))
+}
+
+// NullInt64 is an int64 that may be null.
+type NullInt64 struct {
+	Int64 int64
+	Valid bool
+}
+
+// NullFloat64 is a float64 that may be null.
+type NullFloat64 struct {
+	Float64 float64
+	Valid   bool
+}
+
+// String8 is a String with 8-bit offset and length for small records. The
+// string must end within the first 255 bytes of the record.
+type String8 struct {
+	Offset uint8
+	Length uint8
+}
+
+// Encode writes a string to a byte slice and updates the offset/length.
+func (s *String8) Encode(str string, value *[]byte) {
+	CheckOffset(len(*value), len(str), 8)
+	s.Offset = uint8(len(*value))
+	s.Length = uint8(len(str))
+	*value = append(*value, []byte(str)...)
+}
+
+// Bytes returns a byte slice pointing to the string's contents.
+func (s *String8) Bytes(value []byte) []byte {
+	return value[s.Offset:s.End()]
+}
+
+// End returns the offset of the end of the string's contents.
+func (s *String8) End() int {
+	return int(s.Offset) + int(s.Length)
+}
+
+// String returns a Go string of the string value from an encoded byte slice.
+func (s *String8) String(value []byte) string {
+	return string(s.Bytes(value))
+}
+
+// Decode returns the string value from an encoded byte slice.
+func (s *String8) Decode(value []byte) string {
+	return s.String(value)
+}
+
+// String32 is a String with 32-bit offset and length for large records.
+type String32 struct {
+	Offset uint32
+	Length uint32
+}
+
+// Encode writes a string to a byte slice and updates the offset/length.
+func (s *String32) Encode(str string, value *[]byte) {
+	s.Offset = uint32(len(*value))
+	s.Length = uint32(len(str))
+	*value = append(*value, []byte(str)...)
+}
+
+// Bytes returns a byte slice pointing to the string's contents.
+func (s *String32) Bytes(value []byte) []byte {
+	return value[s.Offset:s.End()]
+}
+
+// End returns the offset of the end of the string's contents.
+func (s *String32) End() int {
+	return int(s.Offset) + int(s.Length)
+}
+
+// String returns a Go string of the string value from an encoded byte slice.
+func (s *String32) String(value []byte) string {
+	return string(s.Bytes(value))
+}
+
+// Decode returns the string value from an encoded byte slice.
+func (s *String32) Decode(value []byte) string {
+	return s.String(value)
+}
+
+// Bytes represents an offset and length of a byte slice in a byte slice. It
+// is stored like a String but holds binary data.
+type Bytes struct {
+	Offset uint16
+	Length uint16
+}
+
+// Encode writes a byte slice to a byte slice and updates the offset/length.
+func (b *Bytes) Encode(v []byte, value *[]byte) {
+	CheckOffset(len(*value), len(v), 16)
+	b.Offset = uint16(len(*value))
+	b.Length = uint16(len(v))
+	*value = append(*value, v...)
+}
+
+// Bytes returns a byte slice pointing to the contents.
+func (b *Bytes) Bytes(value []byte) []byte {
+	return value[b.Offset:b.End()]
+}
+
+// End returns the offset of the end of the contents.
+func (b *Bytes) End() int {
+	return int(b.Offset) + int(b.Length)
+}
+
+// Decode returns a copy of the contents from an encoded byte slice.
+func (b *Bytes) Decode(value []byte) []byte {
+	return append([]byte(nil), b.Bytes(value)...)
+}
+
+// StringList represents an offset, count and size of a list of strings in a
+// byte slice. The list starts with a table of a String for each element,
+// aligned to 2 bytes, followed by the contents of the strings.
+type StringList struct {
+	Offset uint16
+	Length uint16
+	Size   uint16
+}
+
+// Encode writes a list of strings to a byte slice and updates the
+// offset/length/size.
+func (l *StringList) Encode(v []string, value *[]byte) {
+	if len(*value)%2 != 0 {
+		*value = append(*value, 0)
+	}
+	CheckOffset(len(*value), len(v), 16)
+	l.Offset = uint16(len(*value))
+	l.Length = uint16(len(v))
+
+	// Write the table and then the contents of the strings after it.
+	off := len(*value) + len(v)*int(unsafe.Sizeof(String{}))
+	for _, str := range v {
+		CheckOffset(off, len(str), 16)
+		s := String{Offset: uint16(off), Length: uint16(len(str))}
+		*value = append(*value, unsafe.Slice((*byte)(unsafe.Pointer(&s)), unsafe.Sizeof(s))...)
+		off += len(str)
+	}
+	for _, str := range v {
+		*value = append(*value, str...)
+	}
+	CheckOffset(int(l.Offset), len(*value)-int(l.Offset), 16)
+	l.Size = uint16(len(*value) - int(l.Offset))
+}
+
+// At returns the i-th string of the list from an encoded byte slice.
+func (l *StringList) At(i int, value []byte) string {
+	s := (*String)(unsafe.Pointer(&value[int(l.Offset)+i*int(unsafe.Sizeof(String{}))]))
+	return s.String(value)
+}
+
+// End returns the offset of the end of the list's contents.
+func (l *StringList) End() int {
+	return int(l.Offset) + int(l.Size)
+}
+
+// Valid returns true if the table and the contents of every string of the
+// list are within an encoded byte slice.
+func (l *StringList) Valid(value []byte) bool {
+	if int(l.Offset)+int(l.Length)*int(unsafe.Sizeof(String{})) > len(value) || l.End() > len(value) {
+		return false
+	}
+	for i := 0; i < int(l.Length); i++ {
+		s := (*String)(unsafe.Pointer(&value[int(l.Offset)+i*int(unsafe.Sizeof(String{}))]))
+		if s.End() > len(value) {
+			return false
+		}
+	}
+	return true
+}
+
+// Strings returns the strings of the list from an encoded byte slice.
+func (l *StringList) Strings(value []byte) []string {
+	if l.Length == 0 {
+		return nil
+	}
+	a := make([]string, l.Length)
+	for i := range a {
+		a[i] = l.At(i, value)
+	}
+	return a
+}
+
+// Decode returns the strings of the list from an encoded byte slice.
+func (l *StringList) Decode(value []byte) []string {
+	return l.Strings(value)
+}
+
+// Number is the set of fixed width numeric types that can be stored in a
+// Slice.
+type Number interface {
+	~int8 | ~int16 | ~int32 | ~int64 | ~uint8 | ~uint16 | ~uint32 | ~uint64 | ~float32 | ~float64
+}
+
+// Slice represents an offset and element count of a slice of numbers in a
+// byte slice. The elements are aligned to their size relative to the start of
+// the record so they can be read without copying.
+type Slice[T Number] struct {
+	Offset uint16
+	Length uint16
+}
+
+// Encode writes the elements of a slice to a byte slice and updates the
+// offset/length. Zero bytes are added before the elements to align them.
+func (s *Slice[T]) Encode(v []T, value *[]byte) {
+	size := int(unsafe.Sizeof(*new(T)))
+	for len(*value)%size != 0 {
+		*value = append(*value, 0)
+	}
+	CheckOffset(len(*value), len(v), 16)
+	s.Offset = uint16(len(*value))
+	s.Length = uint16(len(v))
+	if len(v) > 0 {
+		*value = append(*value, unsafe.Slice((*byte)(unsafe.Pointer(&v[0])), len(v)*size)...)
+	}
+}
+
+// View returns a slice pointing to the elements in an encoded byte slice.
+func (s *Slice[T]) View(value []byte) []T {
+	if s.Length == 0 {
+		return nil
+	}
+	b := value[s.Offset:s.End()]
+	return unsafe.Slice((*T)(unsafe.Pointer(&b[0])), s.Length)
+}
+
+// End returns the offset of the end of the elements.
+func (s *Slice[T]) End() int {
+	return int(s.Offset) + int(s.Length)*int(unsafe.Sizeof(*new(T)))
+}
+
+// Decode returns a copy of the elements from an encoded byte slice.
+func (s *Slice[T]) Decode(value []byte) []T {
+	return append([]T(nil), s.View(value)...)
+}
+
+// Time is a marker type for time.Time stored as nanoseconds since the Unix
+// epoch.
 type Time int64
 
+// TimeMicro is a marker type for time.Time stored as microseconds since the
+// Unix epoch. Times are truncated to the microsecond.
+type TimeMicro int64
+
+// TimeMilli is a marker type for time.Time stored as milliseconds since the
+// Unix epoch. Times are truncated to the millisecond.
+type TimeMilli int64
+
+// TimeSec is a marker type for time.Time stored as seconds since the Unix
+// epoch in half the space of a Time. Times are truncated to the second and
+// must be between 1970 and 2106.
+type TimeSec uint32
+
+// ZonedTime is a time.Time stored as nanoseconds since the Unix epoch along
+// with the offset of its zone, so it's read back in the same offset instead of
+// in UTC. Zone names aren't stored.
+type ZonedTime struct {
+	Nano   int64
+	Offset int32 // seconds east of UTC
+}
+
+// NewZonedTime returns t as a ZonedTime.
+func NewZonedTime(t time.Time) ZonedTime {
+	_, offset := t.Zone()
+	return ZonedTime{Nano: t.UnixNano(), Offset: int32(offset)}
+}
+
+// Time returns the time in a fixed zone with the stored offset. Times with a
+// zero offset are in UTC.
+func (z ZonedTime) Time() time.Time {
+	t := time.Unix(0, z.Nano).UTC()
+	if z.Offset != 0 {
+		t = t.In(time.FixedZone("", int(z.Offset)))
+	}
+	return t
+}
+
+// UUID is a 16-byte UUID stored inline in a record. Its bytes are in the
+// same order as its string form so keys holding UUIDs sort like the strings.
+type UUID [16]byte
+
+// ParseUUID parses a UUID in the canonical form,
+// xxxxxxxx-xxxx-xxxx-xxxx-xxxxxxxxxxxx.
+func ParseUUID(s string) (UUID, error) {
+	var u UUID
+	if len(s) != 36 || s[8] != '-' || s[13] != '-' || s[18] != '-' || s[23] != '-' {
+		return u, ErrInvalidUUID
+	}
+	b := []byte(s[0:8] + s[9:13] + s[14:18] + s[19:23] + s[24:])
+	if _, err := hex.Decode(u[:], b); err != nil {
+		return u, ErrInvalidUUID
+	}
+	return u, nil
+}
+
+// String returns the UUID in the canonical form.
+func (u UUID) String() string {
+	var b [36]byte
+	hex.Encode(b[0:8], u[0:4])
+	hex.Encode(b[9:13], u[4:6])
+	hex.Encode(b[14:18], u[6:8])
+	hex.Encode(b[19:23], u[8:10])
+	hex.Encode(b[24:], u[10:])
+	b[8], b[13], b[18], b[23] = '-', '-', '-', '-'
+	return string(b[:])
+}
+
+// IP is a netip.Addr stored inline in a record. IPv4 addresses are stored as
+// IPv4-mapped IPv6 addresses with a family of 4 so they're read back as IPv4.
+// Zones aren't stored.
+type IP struct {
+	Bytes  [16]byte
+	Family uint8 // 4, 6, or 0 for the zero Addr
+}
+
+// NewIP returns a as an IP.
+func NewIP(a netip.Addr) IP {
+	switch {
+	case a.Is4():
+		return IP{Bytes: a.As16(), Family: 4}
+	case a.Is6():
+		return IP{Bytes: a.As16(), Family: 6}
+	}
+	return IP{}
+}
+
+// Addr returns the address. Returns the zero Addr if the family is unknown.
+func (ip IP) Addr() netip.Addr {
+	switch ip.Family {
+	case 4:
+		return netip.AddrFrom16(ip.Bytes).Unmap()
+	case 6:
+		return netip.AddrFrom16(ip.Bytes)
+	}
+	return netip.Addr{}
+}
+
+// Decimal is a fixed-point decimal number, Unscaled * 10^-Scale, so amounts
+// such as prices are stored exactly instead of as a float64. Decimals with
+// different scales are different values, e.g. 1.5 and 1.50.
+type Decimal struct {
+	Unscaled int64
+	Scale    int32
+}
+
+// NewDecimal returns the decimal unscaled * 10^-scale.
+func NewDecimal(unscaled int64, scale int) Decimal {
+	return Decimal{Unscaled: unscaled, Scale: int32(scale)}
+}
+
+// ParseDecimal parses a decimal number such as "-12.50". The scale is the
+// number of digits after the decimal point.
+func ParseDecimal(s string) (Decimal, error) {
+	i := strings.IndexByte(s, '.')
+	if i >= 0 {
+		if i == len(s)-1 || strings.ContainsAny(s[i+1:], "+-") {
+			return Decimal{}, ErrInvalidDecimal
+		}
+		s = s[:i] + s[i+1:]
+	}
+	n, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return Decimal{}, ErrInvalidDecimal
+	} else if i < 0 {
+		return Decimal{Unscaled: n}, nil
+	}
+	return Decimal{Unscaled: n, Scale: int32(len(s) - i)}, nil
+}
+
+// String returns the decimal with Scale digits after the decimal point.
+func (d Decimal) String() string {
+	s := strconv.FormatInt(d.Unscaled, 10)
+	if d.Scale <= 0 {
+		if d.Unscaled == 0 {
+			return "0"
+		}
+		return s + strings.Repeat("0", int(-d.Scale))
+	}
+
+	// Pad with zeros so there's a digit before the decimal point.
+	var sign string
+	if d.Unscaled < 0 {
+		sign, s = "-", s[1:]
+	}
+	if n := int(d.Scale) + 1 - len(s); n > 0 {
+		s = strings.Repeat("0", n) + s
+	}
+	return sign + s[:len(s)-int(d.Scale)] + "." + s[len(s)-int(d.Scale):]
+}
+
+// Float64 returns the nearest float64 to the decimal.
+func (d Decimal) Float64() float64 {
+	f, _ := strconv.ParseFloat(strconv.FormatInt(d.Unscaled, 10)+"e"+strconv.Itoa(int(-d.Scale)), 64)
+	return f
+}
+
+// MarshalText implements encoding.TextMarshaler.
+func (d Decimal) MarshalText() ([]byte, error) {
+	return []byte(d.String()), nil
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler.
+func (d *Decimal) UnmarshalText(b []byte) error {
+	v, err := ParseDecimal(string(b))
+	if err != nil {
+		return err
+	}
+	*d = v
+	return nil
+}
+
+// Int128 is a signed 128-bit integer, Hi * 2^64 + Lo.
+type Int128 struct {
+	Hi int64
+	Lo uint64
+}
+
+// Int128FromBig returns b as an Int128. Returns false if b is out of range.
+func Int128FromBig(b *big.Int) (Int128, bool) {
+	hi := new(big.Int).Rsh(b, 64)
+	if !hi.IsInt64() {
+		return Int128{}, false
+	}
+	lo := new(big.Int).Sub(b, new(big.Int).Lsh(hi, 64))
+	return Int128{Hi: hi.Int64(), Lo: lo.Uint64()}, true
+}
+
+// Big returns the integer as a big.Int.
+func (x Int128) Big() *big.Int {
+	b := new(big.Int).Lsh(big.NewInt(x.Hi), 64)
+	return b.Add(b, new(big.Int).SetUint64(x.Lo))
+}
+
+// String returns the integer in base 10.
+func (x Int128) String() string {
+	return x.Big().String()
+}
+
+// MarshalText implements encoding.TextMarshaler.
+func (x Int128) MarshalText() ([]byte, error) {
+	return []byte(x.String()), nil
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler.
+func (x *Int128) UnmarshalText(b []byte) error {
+	n, ok := new(big.Int).SetString(string(b), 10)
+	if !ok {
+		return ErrInvalidInt128
+	}
+	v, ok := Int128FromBig(n)
+	if !ok {
+		return ErrInvalidInt128
+	}
+	*x = v
+	return nil
+}
+
+// Uint128 is an unsigned 128-bit integer, Hi * 2^64 + Lo.
+type Uint128 struct {
+	Hi uint64
+	Lo uint64
+}
+
+// Uint128FromBig returns b as a Uint128. Returns false if b is out of range.
+func Uint128FromBig(b *big.Int) (Uint128, bool) {
+	if b.Sign() < 0 || b.BitLen() > 128 {
+		return Uint128{}, false
+	}
+	hi := new(big.Int).Rsh(b, 64)
+	lo := new(big.Int).Sub(b, new(big.Int).Lsh(hi, 64))
+	return Uint128{Hi: hi.Uint64(), Lo: lo.Uint64()}, true
+}
+
+// Big returns the integer as a big.Int.
+func (x Uint128) Big() *big.Int {
+	b := new(big.Int).Lsh(new(big.Int).SetUint64(x.Hi), 64)
+	return b.Add(b, new(big.Int).SetUint64(x.Lo))
+}
+
+// String returns the integer in base 10.
+func (x Uint128) String() string {
+	return x.Big().String()
+}
+
+// MarshalText implements encoding.TextMarshaler.
+func (x Uint128) MarshalText() ([]byte, error) {
+	return []byte(x.String()), nil
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler.
+func (x *Uint128) UnmarshalText(b []byte) error {
+	n, ok := new(big.Int).SetString(string(b), 10)
+	if !ok {
+		return ErrInvalidInt128
+	}
+	v, ok := Uint128FromBig(n)
+	if !ok {
+		return ErrInvalidInt128
+	}
+	*x = v
+	return nil
+}
+
 // Duration is a marker type for time.Duration.
 type Duration int64
+
+// Presence is a bitmap recording which optional fields of a record are set.
+// Bit i is set when the i-th optional field has a value.
+type Presence uint64
+
+// Has returns true if bit i is set.
+func (p Presence) Has(i int) bool {
+	return p&(1<<uint(i)) != 0
+}
+
+// Set sets bit i.
+func (p *Presence) Set(i int) {
+	*p |= 1 << uint(i)
+}
+
+// Flags8 is a set of up to 8 boolean flags packed into a byte. The flags are
+// named by the tag of its field, e.g. `raw:"flags=admin|active"`, and bit i
+// is set when the i-th flag is set.
+type Flags8 uint8
+
+// Has returns true if bit i is set.
+func (f Flags8) Has(i int) bool {
+	return f&(1<<uint(i)) != 0
+}
+
+// Set sets bit i.
+func (f *Flags8) Set(i int) {
+	*f |= 1 << uint(i)
+}
+
+// Flags16 is a set of up to 16 boolean flags, like Flags8.
+type Flags16 uint16
+
+// Has returns true if bit i is set.
+func (f Flags16) Has(i int) bool {
+	return f&(1<<uint(i)) != 0
+}
+
+// Set sets bit i.
+func (f *Flags16) Set(i int) {
+	*f |= 1 << uint(i)
+}
+
+// Flags32 is a set of up to 32 boolean flags, like Flags8.
+type Flags32 uint32
+
+// Has returns true if bit i is set.
+func (f Flags32) Has(i int) bool {
+	return f&(1<<uint(i)) != 0
+}
+
+// Set sets bit i.
+func (f *Flags32) Set(i int) {
+	*f |= 1 << uint(i)
+}
+
+// DefaultSlabSize is the size of the slabs allocated by an Arena unless
+// another size is set with NewArena.
+const DefaultSlabSize = 64 << 10
+
+// Arena hands out byte slices from large slabs so that encoding many records,
+// such as a batch written in a single bolt transaction, allocates a few slabs
+// instead of a slice per record. Slices are valid until the arena is reset.
+// The zero value is ready to use. An Arena is not safe for concurrent use.
+type Arena struct {
+	slabs [][]byte
+	size  int // size of each slab
+	i     int // index of the current slab
+	off   int // offset of the next slice in the current slab
+}
+
+// NewArena returns an arena that allocates slabs of size bytes.
+func NewArena(size int) *Arena {
+	return &Arena{size: size}
+}
+
+// Alloc returns a zeroed byte slice of length n and capacity c, like make.
+// Slices larger than a slab are allocated separately. Appending past the
+// capacity of a slice moves it out of the arena.
+func (a *Arena) Alloc(n, c int) []byte {
+	if a.size <= 0 {
+		a.size = DefaultSlabSize
+	}
+	if c < n {
+		c = n
+	}
+	if c > a.size {
+		return make([]byte, n, c)
+	}
+
+	// Move on to the next slab, allocating it if needed, when the slice
+	// doesn't fit in the current one.
+	for a.i < len(a.slabs) && a.off+c > len(a.slabs[a.i]) {
+		a.i, a.off = a.i+1, 0
+	}
+	if a.i == len(a.slabs) {
+		a.slabs = append(a.slabs, make([]byte, a.size))
+	}
+	b := a.slabs[a.i][a.off : a.off+n : a.off+c]
+	a.off += c
+	for i := range b {
+		b[i] = 0
+	}
+	return b
+}
+
+// Reset makes the arena's slabs available for reuse. Slices returned by Alloc
+// must not be used after the arena is reset.
+func (a *Arena) Reset() {
+	a.i, a.off = 0, 0
+}
+
+// ChecksumSize is the size of the checksum appended to checksummed records.
+const ChecksumSize = 4
+
+// castagnoli is the CRC-32C table used for record checksums.
+var castagnoli = crc32.MakeTable(crc32.Castagnoli)
+
+// AppendChecksum appends the CRC-32C checksum of the record starting at
+// b[start:] to b. The checksum is little endian regardless of the byte order
+// of the record.
+func AppendChecksum(b []byte, start int) []byte {
+	return binary.LittleEndian.AppendUint32(b, crc32.Checksum(b[start:], castagnoli))
+}
+
+// VerifyChecksum returns the record in b without its trailing checksum.
+// Returns io.ErrUnexpectedEOF if b is too short to have a checksum and
+// ErrChecksum if the checksum doesn't match the record.
+func VerifyChecksum(b []byte) ([]byte, error) {
+	if len(b) < ChecksumSize {
+		return nil, io.ErrUnexpectedEOF
+	}
+	n := len(b) - ChecksumSize
+	if crc32.Checksum(b[:n], castagnoli) != binary.LittleEndian.Uint32(b[n:]) {
+		return nil, ErrChecksum
+	}
+	return b[:n], nil
+}
+
+// PutChecksum overwrites the checksum at the end of b with the checksum of the
+// record before it, such as after a field of the record is changed in place.
+func PutChecksum(b []byte) {
+	n := len(b) - ChecksumSize
+	binary.LittleEndian.PutUint32(b[n:], crc32.Checksum(b[:n], castagnoli))
+}
+
+// TypeTagSize is the size of the type tag prefixed to tagged records.
+const TypeTagSize = 4
+
+// AppendTypeTag appends a type tag to b, before the record it identifies. The
+// tag is little endian regardless of the byte order of the record.
+func AppendTypeTag(b []byte, tag uint32) []byte {
+	return binary.LittleEndian.AppendUint32(b, tag)
+}
+
+// VerifyTypeTag returns the record in b without its type tag. Returns
+// io.ErrUnexpectedEOF if b is too short to have a type tag and ErrTypeTag if
+// it has a different tag.
+func VerifyTypeTag(b []byte, tag uint32) ([]byte, error) {
+	if len(b) < TypeTagSize {
+		return nil, io.ErrUnexpectedEOF
+	} else if binary.LittleEndian.Uint32(b) != tag {
+		return nil, ErrTypeTag
+	}
+	return b[TypeTagSize:], nil
+}
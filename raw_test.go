@@ -1,7 +1,10 @@
 package raw_test
 
 import (
+	"io"
+	"net/netip"
 	"testing"
+	"time"
 	"unsafe"
 
 	. "github.com/boltdb/raw"
@@ -19,15 +22,338 @@ func TestString_Encode(t *testing.T) {
 		t.Fatalf("invalid string decode(1): %q", s)
 	}
 	if i := r.MyInt; i != 1000 {
-		t.Fatalf("invalid int decode: %q", i)
+		t.Fatalf("invalid int decode: %d", i)
 	}
 	if s := r.MyString2.String(v); s != "bar" {
 		t.Fatalf("invalid string decode(1): %q", s)
 	}
 }
 
+// Ensure that bytes can be encoded and decoded as a copy.
+func TestBytes_Decode(t *testing.T) {
+	var b Bytes
+	v := make([]byte, unsafe.Sizeof(b))
+	b.Encode([]byte{1, 2, 3}, &v)
+	if b.Offset != 4 || b.Length != 3 || b.End() != 7 {
+		t.Fatalf("unexpected bytes: %+v", b)
+	}
+
+	other := b.Decode(v)
+	if string(other) != "\x01\x02\x03" {
+		t.Fatalf("unexpected decode: %x", other)
+	}
+	other[0] = 100
+	if v[4] != 1 {
+		t.Fatal("decode shares memory with the record")
+	}
+}
+
+// Ensure that a null string is only valid once it's encoded.
+func TestNullString_Encode(t *testing.T) {
+	var s NullString
+	v := make([]byte, unsafe.Sizeof(s))
+	if s.Valid || s.String(v) != "" {
+		t.Fatalf("unexpected null string: %+v", s)
+	}
+	s.Encode("", &v)
+	if !s.Valid || s.Offset != 6 || s.End() != 6 {
+		t.Fatalf("unexpected empty string: %+v", s)
+	}
+	s.Encode("foo", &v)
+	if !s.Valid || s.String(v) != "foo" {
+		t.Fatalf("unexpected string: %+v", s)
+	}
+}
+
+// Ensure that encoding data past the offset or length limit panics instead
+// of truncating the offset or length.
+func TestString_EncodeOverflow(t *testing.T) {
+	mustPanic := func(name string, fn func()) {
+		defer func() {
+			if r := recover(); r == nil {
+				t.Errorf("%s: expected panic", name)
+			}
+		}()
+		fn()
+	}
+
+	long := string(make([]byte, 70000))
+	mustPanic("String8 length", func() { var s String8; v := make([]byte, 2); s.Encode(long[:256], &v) })
+	mustPanic("String8 offset", func() { var s String8; v := make([]byte, 256); s.Encode("", &v) })
+	mustPanic("String", func() { var s String; v := make([]byte, 4); s.Encode(long, &v) })
+	mustPanic("NullString", func() { var s NullString; v := make([]byte, 6); s.Encode(long, &v) })
+	mustPanic("Bytes", func() { var b Bytes; v := make([]byte, 65536); b.Encode(nil, &v) })
+	mustPanic("StringList", func() { var l StringList; v := make([]byte, 6); l.Encode([]string{long[:40000], long[:40000]}, &v) })
+	mustPanic("Slice", func() { var s Slice[int64]; v := make([]byte, 4); s.Encode(make([]int64, 65536), &v) })
+
+	// Data ending past the limit is fine if its offset and length fit.
+	var s String8
+	v := make([]byte, 200)
+	s.Encode(long[:200], &v)
+	if s.Offset != 200 || s.Length != 200 || s.End() != 400 {
+		t.Fatalf("unexpected string: %+v", s)
+	}
+}
+
+// Ensure that a list of strings can be encoded and decoded.
+func TestStringList_Decode(t *testing.T) {
+	var l StringList
+	v := make([]byte, 7)
+	l.Encode([]string{"foo", "", "bazz"}, &v)
+	if l.Offset != 8 || l.Length != 3 || l.Size != 19 || l.End() != 27 || len(v) != 27 {
+		t.Fatalf("unexpected list: %+v", l)
+	}
+	if a := l.Decode(v); len(a) != 3 || a[0] != "foo" || a[1] != "" || a[2] != "bazz" {
+		t.Fatalf("unexpected decode: %q", a)
+	} else if s := l.At(2, v); s != "bazz" {
+		t.Fatalf("unexpected string: %q", s)
+	}
+
+	var empty StringList
+	empty.Encode(nil, &v)
+	if a := empty.Decode(v); a != nil || empty.End() != 28 {
+		t.Fatalf("unexpected empty list: %+v %q", empty, a)
+	}
+}
+
+// Ensure that a list is invalid if any string is outside the byte slice.
+func TestStringList_Valid(t *testing.T) {
+	var l StringList
+	var v []byte
+	l.Encode([]string{"foo", "bar"}, &v)
+	if !l.Valid(v) {
+		t.Fatal("expected valid list")
+	} else if l.Valid(v[:len(v)-1]) {
+		t.Fatal("expected truncated list to be invalid")
+	}
+	v[l.Offset+4] = 0xff
+	if l.Valid(v) {
+		t.Fatal("expected list with out of bounds string to be invalid")
+	}
+}
+
+// Ensure that presence bits can be set independently.
+func TestPresence_Set(t *testing.T) {
+	var p Presence
+	p.Set(0)
+	p.Set(63)
+	if !p.Has(0) || !p.Has(63) || p.Has(1) || p.Has(62) {
+		t.Fatalf("unexpected presence: %x", uint64(p))
+	}
+}
+
+// Ensure that flags can be set independently.
+func TestFlags8_Set(t *testing.T) {
+	var f Flags8
+	f.Set(0)
+	f.Set(7)
+	if !f.Has(0) || !f.Has(7) || f.Has(1) || f != 0x81 {
+		t.Fatalf("unexpected flags: %x", uint8(f))
+	}
+}
+
+// Ensure that a zoned time is read back in the offset it was stored with.
+func TestZonedTime_Time(t *testing.T) {
+	tm := time.Date(2014, 5, 1, 12, 30, 15, 500, time.FixedZone("EST", -5*3600))
+	z := NewZonedTime(tm)
+	if got := z.Time(); !got.Equal(tm) {
+		t.Fatalf("unexpected time: %s", got)
+	} else if _, offset := got.Zone(); offset != -5*3600 {
+		t.Fatalf("unexpected offset: %d", offset)
+	} else if got.Format(time.RFC3339Nano) != "2014-05-01T12:30:15.0000005-05:00" {
+		t.Fatalf("unexpected format: %s", got.Format(time.RFC3339Nano))
+	}
+	if got := NewZonedTime(tm.UTC()).Time(); got.Location() != time.UTC {
+		t.Fatalf("unexpected location: %s", got.Location())
+	}
+}
+
+// Ensure that a UUID round trips through its string form.
+func TestUUID_String(t *testing.T) {
+	const str = "0123abcd-4567-89ab-cdef-0123456789ab"
+	u, err := ParseUUID(str)
+	if err != nil {
+		t.Fatal(err)
+	} else if u[0] != 0x01 || u[15] != 0xab {
+		t.Fatalf("unexpected bytes: %x", u)
+	} else if u.String() != str {
+		t.Fatalf("unexpected string: %s", u)
+	}
+	for _, s := range []string{"", "0123abcd4567-89ab-cdef-0123456789ab0", "0123abcd-4567-89ab-cdef-0123456789ag"} {
+		if _, err := ParseUUID(s); err != ErrInvalidUUID {
+			t.Fatalf("%q: unexpected error: %v", s, err)
+		}
+	}
+}
+
+// Ensure that addresses are read back in the family they were stored with.
+func TestIP_Addr(t *testing.T) {
+	for _, s := range []string{"192.0.2.1", "::ffff:192.0.2.1", "2001:db8::1", "::"} {
+		a := netip.MustParseAddr(s)
+		if got := NewIP(a).Addr(); got != a {
+			t.Fatalf("%s: unexpected address: %s", s, got)
+		}
+	}
+	if got := NewIP(netip.Addr{}).Addr(); got.IsValid() {
+		t.Fatalf("unexpected address: %s", got)
+	}
+}
+
+// Ensure that decimals round trip through their string form.
+func TestDecimal_String(t *testing.T) {
+	for _, tt := range []struct {
+		s string
+		d Decimal
+	}{
+		{"12.50", NewDecimal(1250, 2)},
+		{"-0.05", NewDecimal(-5, 2)},
+		{"-12", NewDecimal(-12, 0)},
+		{"0.000", NewDecimal(0, 3)},
+	} {
+		if d, err := ParseDecimal(tt.s); err != nil {
+			t.Fatalf("%s: %s", tt.s, err)
+		} else if d != tt.d {
+			t.Fatalf("%s: unexpected decimal: %+v", tt.s, d)
+		} else if d.String() != tt.s {
+			t.Fatalf("%s: unexpected string: %s", tt.s, d)
+		}
+	}
+	if s := NewDecimal(12, -2).String(); s != "1200" {
+		t.Fatalf("unexpected string: %s", s)
+	} else if f := NewDecimal(-1250, 2).Float64(); f != -12.5 {
+		t.Fatalf("unexpected float: %v", f)
+	}
+	for _, s := range []string{"", ".", "1.", "1.-2", "1.2.3", "x"} {
+		if _, err := ParseDecimal(s); err != ErrInvalidDecimal {
+			t.Fatalf("%q: unexpected error: %v", s, err)
+		}
+	}
+}
+
+// Ensure that 128-bit integers convert to and from big integers.
+func TestInt128_Big(t *testing.T) {
+	for _, s := range []string{"0", "-1", "18446744073709551616", "-170141183460469231731687303715884105728", "170141183460469231731687303715884105727"} {
+		var x Int128
+		if err := x.UnmarshalText([]byte(s)); err != nil {
+			t.Fatalf("%s: %s", s, err)
+		} else if x.String() != s {
+			t.Fatalf("%s: unexpected string: %s", s, x)
+		}
+	}
+	if x := (Int128{Hi: -1, Lo: 1<<64 - 1}); x.String() != "-1" {
+		t.Fatalf("unexpected string: %s", x)
+	}
+	var x Int128
+	if err := x.UnmarshalText([]byte("170141183460469231731687303715884105728")); err != ErrInvalidInt128 {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	var u Uint128
+	if err := u.UnmarshalText([]byte("340282366920938463463374607431768211455")); err != nil {
+		t.Fatal(err)
+	} else if u != (Uint128{Hi: 1<<64 - 1, Lo: 1<<64 - 1}) {
+		t.Fatalf("unexpected integer: %+v", u)
+	} else if err := u.UnmarshalText([]byte("-1")); err != ErrInvalidInt128 {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+// Ensure that an arena hands out zeroed slices that don't overlap and reuses
+// its slabs after a reset.
+func TestArena_Alloc(t *testing.T) {
+	a := NewArena(16)
+	b0 := a.Alloc(4, 8)
+	if len(b0) != 4 || cap(b0) != 8 {
+		t.Fatalf("unexpected len/cap: %d/%d", len(b0), cap(b0))
+	}
+	b0 = append(b0, "abcd"...)
+	b1 := a.Alloc(8, 8)
+	copy(b1, "efghijkl")
+	if string(b0) != "\x00\x00\x00\x00abcd" {
+		t.Fatalf("unexpected value: %q", b0)
+	}
+
+	// Slices that don't fit are taken from a new slab or allocated on their own.
+	b2 := a.Alloc(4, 4)
+	if &b2[0] == &b0[0] {
+		t.Fatal("expected new slab")
+	} else if b3 := a.Alloc(32, 32); len(b3) != 32 {
+		t.Fatalf("unexpected len: %d", len(b3))
+	}
+
+	a.Reset()
+	if b := a.Alloc(4, 4); &b[0] != &b0[0] {
+		t.Fatal("expected first slab to be reused")
+	} else if string(b) != "\x00\x00\x00\x00" {
+		t.Fatalf("expected zeroed slice: %q", b)
+	}
+}
+
+// Ensure that a checksum appended to a record is verified and stripped, that
+// a corrupt or truncated record is rejected, and that a checksum can be
+// rewritten after the record is changed.
+func TestVerifyChecksum(t *testing.T) {
+	b := AppendChecksum([]byte("xxfoo"), 2)
+	if len(b) != 5+ChecksumSize {
+		t.Fatalf("unexpected len: %d", len(b))
+	} else if v, err := VerifyChecksum(b[2:]); err != nil {
+		t.Fatal(err)
+	} else if string(v) != "foo" {
+		t.Fatalf("unexpected value: %q", v)
+	}
+
+	b[3] = 'g'
+	if _, err := VerifyChecksum(b[2:]); err != ErrChecksum {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	PutChecksum(b[2:])
+	if _, err := VerifyChecksum(b[2:]); err != nil {
+		t.Fatal(err)
+	}
+
+	b[4] = 'p'
+	if _, err := VerifyChecksum(b[2:]); err != ErrChecksum {
+		t.Fatalf("unexpected error: %v", err)
+	} else if _, err := VerifyChecksum(b[:3]); err != io.ErrUnexpectedEOF {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+// Ensure that a type tag is verified and stripped from the record after it.
+func TestVerifyTypeTag(t *testing.T) {
+	b := AppendTypeTag(nil, 0x01020304)
+	b = append(b, "foo"...)
+	if string(b[:TypeTagSize]) != "\x04\x03\x02\x01" {
+		t.Fatalf("unexpected tag: %x", b[:TypeTagSize])
+	} else if v, err := VerifyTypeTag(b, 0x01020304); err != nil {
+		t.Fatal(err)
+	} else if string(v) != "foo" {
+		t.Fatalf("unexpected value: %q", v)
+	}
+	if _, err := VerifyTypeTag(b, 0x01020305); err != ErrTypeTag {
+		t.Fatalf("unexpected error: %v", err)
+	} else if _, err := VerifyTypeTag(b[:3], 0x01020304); err != io.ErrUnexpectedEOF {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+// Ensure that field functions read short and corrupt records as zero values
+// without allocating.
+func TestFieldFunc(t *testing.T) {
+	v := (&Record{MyString1: "foo", MyInt: 1000, MyString2: "bar"}).Encode()
+	if RecordMyInt(v) != 1000 || RecordMyString1(v) != "foo" {
+		t.Fatalf("unexpected fields: %d %q", RecordMyInt(v), RecordMyString1(v))
+	} else if RecordMyInt(v[:4]) != 0 || RecordMyString1(v[:len(v)-4]) != "" {
+		t.Fatalf("unexpected fields of short record: %d %q", RecordMyInt(v[:4]), RecordMyString1(v[:len(v)-4]))
+	}
+	if n := testing.AllocsPerRun(100, func() { RecordMyInt(v) }); n != 0 {
+		t.Fatalf("unexpected allocations: %v", n)
+	}
+}
+
 func BenchmarkStringEncode(b *testing.B) {
 	o := &O{MyString1: "foo", MyInt: 1000, MyString2: "bar"}
+	b.ReportAllocs()
 	for i := 0; i < b.N; i++ {
 		v := o.Encode()
 		if len(v) == 0 {
@@ -36,6 +362,36 @@ func BenchmarkStringEncode(b *testing.B) {
 	}
 }
 
+func BenchmarkStringEncodeArena(b *testing.B) {
+	o := &Record{MyString1: "foo", MyInt: 1000, MyString2: "bar"}
+	var a Arena
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if i%1000 == 0 {
+			a.Reset()
+		}
+		v := o.EncodeArena(&a)
+		if len(v) == 0 {
+			b.Fatalf("invalid string length: %d", len(v))
+		}
+	}
+}
+
+func BenchmarkEncoderAppend(b *testing.B) {
+	o := &Record{MyString1: "foo", MyInt: 1000, MyString2: "bar"}
+	e := NewRecordEncoder()
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if i%1000 == 0 {
+			e.Reset()
+		}
+		e.Append(o)
+	}
+	if len(e.Bytes()) == 0 {
+		b.Fatalf("invalid encoder length")
+	}
+}
+
 func BenchmarkStringDecode(b *testing.B) {
 	o := &O{MyString1: "foo", MyInt: 1000, MyString2: "bar"}
 	v := o.Encode()
@@ -48,6 +404,30 @@ func BenchmarkStringDecode(b *testing.B) {
 	}
 }
 
+func BenchmarkFieldFunc(b *testing.B) {
+	o := &Record{MyString1: "foo", MyInt: 1000, MyString2: "bar"}
+	v := o.Encode()
+
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if RecordMyInt(v) != 1000 {
+			b.Fatalf("invalid int")
+		}
+	}
+}
+
+func BenchmarkFieldFuncString(b *testing.B) {
+	o := &Record{MyString1: "foo", MyInt: 1000, MyString2: "bar"}
+	v := o.Encode()
+
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if RecordMyString1(v) != "foo" {
+			b.Fatalf("invalid string")
+		}
+	}
+}
+
 // O represents a test struct that will encode into R.
 type O struct {
 	MyString1 string
@@ -62,7 +442,7 @@ func (o *O) Encode() []byte {
 	r.MyString1.Encode(o.MyString1, &b)
 	r.MyInt = int64(o.MyInt)
 	r.MyString2.Encode(o.MyString2, &b)
-	copy(b, (*[unsafe.Sizeof(r)]byte)(unsafe.Pointer(&r))[:])
+	copy(b, unsafe.Slice((*byte)(unsafe.Pointer(&r)), unsafe.Sizeof(r)))
 	return b
 }
 
@@ -0,0 +1,76 @@
+package rawgen
+
+import (
+	"fmt"
+	"go/ast"
+	"io"
+)
+
+// writeBatchFunc writes a generated function storing many records with
+// bolt's DB.Batch. Records are encoded before the batch starts so the write
+// lock is held as briefly as possible. Records are stored under their key if
+// a field is tagged with "key" and otherwise under the bucket's next sequence
+// number, as Append does. Every record that fails is reported, not just the
+// first, and the transaction is rolled back so no records are stored.
+func (v *visitor) writeBatchFunc(exp string, node *ast.StructType, w io.Writer) error {
+	parts, err := keyFields(node)
+	if err != nil {
+		return err
+	}
+	keyed := len(parts) > 0
+
+	fmt.Fprintf(w, "// Put%sBatch stores items using db.Batch. Returns an error describing every\n", exp)
+	fmt.Fprintf(w, "// item that couldn't be stored, in which case none of the items are stored.\n")
+	fmt.Fprintf(w, "func Put%sBatch(db *bolt.DB, items []*%s) error {\n", exp, exp)
+	fmt.Fprintf(w, "\tvalues := make([][]byte, len(items))\n")
+	if keyed {
+		fmt.Fprintf(w, "\tkeys := make([][]byte, len(items))\n")
+	}
+	fmt.Fprintf(w, "\tfor i, o := range items {\n")
+	fmt.Fprintf(w, "\t\tvalues[i] = o.Encode()\n")
+	if keyed {
+		fmt.Fprintf(w, "\t\tkeys[i] = o.Key()\n")
+	}
+	fmt.Fprintf(w, "\t}\n\n")
+
+	// Batch may call the function more than once so it must not modify
+	// anything outside the transaction.
+	fmt.Fprintf(w, "\treturn db.Batch(func(tx *bolt.Tx) error {\n")
+	fmt.Fprintf(w, "\t\tb, err := tx.CreateBucketIfNotExists([]byte(%sBucket))\n", exp)
+	fmt.Fprintf(w, "\t\tif err != nil {\n")
+	fmt.Fprintf(w, "\t\t\treturn err\n")
+	fmt.Fprintf(w, "\t\t}\n")
+	fmt.Fprintf(w, "\t\tvar errs []error\n")
+	indexed := len(indexFields(node)) > 0
+	if indexed {
+		fmt.Fprintf(w, "\t\tfor i, o := range items {\n")
+	} else {
+		fmt.Fprintf(w, "\t\tfor i := range items {\n")
+	}
+	if keyed {
+		fmt.Fprintf(w, "\t\t\tkey := keys[i]\n")
+	} else {
+		fmt.Fprintf(w, "\t\t\tid, err := b.NextSequence()\n")
+		fmt.Fprintf(w, "\t\t\tif err != nil {\n")
+		fmt.Fprintf(w, "\t\t\t\treturn err\n")
+		fmt.Fprintf(w, "\t\t\t}\n")
+		fmt.Fprintf(w, "\t\t\tkey := binary.BigEndian.AppendUint64(nil, id)\n")
+	}
+	if indexed {
+		fmt.Fprintf(w, "\t\t\tif err := reindex%s(tx, key, b.Get(key), o); err != nil {\n", exp)
+		fmt.Fprintf(w, "\t\t\t\terrs = append(errs, fmt.Errorf(\"item %%d: %%w\", i, err))\n")
+		fmt.Fprintf(w, "\t\t\t\tcontinue\n")
+		fmt.Fprintf(w, "\t\t\t}\n")
+	}
+	fmt.Fprintf(w, "\t\t\tif err := b.Put(key, values[i]); err != nil {\n")
+	fmt.Fprintf(w, "\t\t\t\terrs = append(errs, fmt.Errorf(\"item %%d: %%w\", i, err))\n")
+	fmt.Fprintf(w, "\t\t\t}\n")
+	fmt.Fprintf(w, "\t\t}\n")
+	fmt.Fprintf(w, "\t\treturn errors.Join(errs...)\n")
+	fmt.Fprintf(w, "\t})\n")
+	fmt.Fprintf(w, "}\n\n")
+
+	v.imports["errors"] = true
+	v.imports["fmt"] = true
+	return nil
+}
@@ -0,0 +1,306 @@
+package rawgen
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/token"
+	"io"
+	"sort"
+	"strings"
+)
+
+// GenerateBenchmarks returns a Go test file for the package of the source
+// file, src, with benchmarks comparing the encoding and decoding of each raw
+// struct using raw, encoding/gob, and encoding/json. Each benchmark reports
+// the size of an encoded record as a "B/record" metric.
+//
+// Code must have been generated for the file, with the same Generator, before
+// the benchmarks can be compiled.
+func (g *Generator) GenerateBenchmarks(src []byte) ([]byte, error) {
+	return g.generateTestFile(src, []string{"bytes", "encoding/gob", "encoding/json", "testing"}, g.writeBenchmarks)
+}
+
+// GenerateRawBenchmarks returns a Go test file for the package of the source
+// file, src, with benchmarks of the generated Encode and Decode methods of
+// each raw struct and, unless the code is portable, of each accessor. These
+// measure the effect of changes to a layout or to the generated code.
+//
+// Code must have been generated for the file, with the same Generator, before
+// the benchmarks can be compiled.
+func (g *Generator) GenerateRawBenchmarks(src []byte) ([]byte, error) {
+	imports := []string{"testing"}
+	if !g.portable() {
+		imports = append(imports, "runtime", "unsafe")
+	}
+	return g.generateTestFile(src, imports, g.writeRawBenchmarks)
+}
+
+// generateTestFile returns a Go test file importing imports with the tests or
+// benchmarks written by fn for each raw struct in src.
+func (g *Generator) generateTestFile(src []byte, imports []string, fn func(unexp, exp string, node *ast.StructType, pragmas map[string]string, w io.Writer) error) ([]byte, error) {
+	b, err := strip(src)
+	if err != nil {
+		return nil, err
+	}
+	_, f, _, err := g.parse(b)
+	if err != nil {
+		return nil, err
+	}
+
+	var w bytes.Buffer
+	var usesTime, usesNetip, usesRaw bool
+	for _, decl := range f.Decls {
+		d, ok := decl.(*ast.GenDecl)
+		if !ok || d.Tok != token.TYPE {
+			continue
+		}
+		for _, spec := range d.Specs {
+			spec := spec.(*ast.TypeSpec)
+			s, ok := spec.Type.(*ast.StructType)
+			if !ok || !g.isRawStruct(s) {
+				continue
+			}
+
+			// Skipped and read-only structs can't be round tripped.
+			doc := spec.Doc
+			if doc == nil && len(d.Specs) == 1 {
+				doc = d.Doc
+			}
+			pragmas := parsePragmas(doc)
+			if _, ok := pragmas["skip"]; ok {
+				continue
+			} else if _, ok := pragmas["ctype"]; ok {
+				continue
+			} else if _, ok := pragmas["version"]; ok {
+				s = withoutVersion(s)
+			}
+			s = withoutPresence(withoutSkipped(s))
+
+			if err := fn(spec.Name.Name, tocamelcase(spec.Name.Name), s, pragmas, &w); err != nil {
+				return nil, fmt.Errorf("%s: %s", spec.Name.Name, err)
+			}
+			for _, fld := range s.Fields.List {
+				if typ := tostr(fld.Type); isTime(typ) || typ == "raw.ZonedTime" || typ == "raw.Duration" {
+					usesTime = true
+				} else if typ == "raw.IP" {
+					usesNetip = true
+				} else if typ == "raw.Decimal" || typ == "raw.Int128" || typ == "raw.Uint128" {
+					usesRaw = true
+				}
+			}
+		}
+	}
+	if usesTime {
+		imports = append(imports, "time")
+	}
+	if usesNetip {
+		imports = append(imports, "net/netip")
+	}
+	if usesRaw {
+		imports = append(imports, g.importPath(f))
+	}
+	sort.Strings(imports)
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "package %s\n\n", f.Name.Name)
+	fmt.Fprint(&buf, "//\n")
+	fmt.Fprint(&buf, "// DO NOT CHANGE\n")
+	fmt.Fprint(&buf, generatedHeader)
+	fmt.Fprint(&buf, "//\n\n")
+	fmt.Fprint(&buf, "import (\n")
+	for _, path := range imports {
+		fmt.Fprintf(&buf, "\t%q\n", path)
+	}
+	fmt.Fprint(&buf, ")\n\n")
+	buf.Write(w.Bytes())
+	return formatSource(buf.Bytes())
+}
+
+// writeBenchmarks writes the comparison benchmarks for a single raw struct.
+func (g *Generator) writeBenchmarks(unexp, exp string, node *ast.StructType, pragmas map[string]string, w io.Writer) error {
+	if err := g.writeBenchRecord("newBench"+exp, exp, node, w); err != nil {
+		return err
+	}
+
+	// Records are encoded individually, as they would be stored in bolt, so
+	// gob includes its type information in every record.
+	codecs := []struct{ name, encode, decode string }{
+		{"Raw",
+			"v := o.Encode()",
+			"var other %[1]s\n\t\tif err := other.Decode(v); err != nil {\n\t\t\tb.Fatal(err)\n\t\t}"},
+		{"Gob",
+			"var buf bytes.Buffer\n\t\tif err := gob.NewEncoder(&buf).Encode(o); err != nil {\n\t\t\tb.Fatal(err)\n\t\t}\n\t\tv := buf.Bytes()",
+			"var other %[1]s\n\t\tif err := gob.NewDecoder(bytes.NewReader(v)).Decode(&other); err != nil {\n\t\t\tb.Fatal(err)\n\t\t}"},
+		{"JSON",
+			"v, err := json.Marshal(o)\n\t\tif err != nil {\n\t\t\tb.Fatal(err)\n\t\t}",
+			"var other %[1]s\n\t\tif err := json.Unmarshal(v, &other); err != nil {\n\t\t\tb.Fatal(err)\n\t\t}"},
+	}
+	for _, c := range codecs {
+		fmt.Fprintf(w, "func Benchmark%sEncode%s(b *testing.B) {\n", exp, c.name)
+		fmt.Fprintf(w, "\to := newBench%s()\n", exp)
+		fmt.Fprintf(w, "\tvar n int\n")
+		fmt.Fprintf(w, "\tb.ReportAllocs()\n")
+		fmt.Fprintf(w, "\tfor i := 0; i < b.N; i++ {\n")
+		fmt.Fprintf(w, "\t\t%s\n", c.encode)
+		fmt.Fprintf(w, "\t\tn = len(v)\n")
+		fmt.Fprintf(w, "\t}\n")
+		fmt.Fprintf(w, "\tb.ReportMetric(float64(n), \"B/record\")\n")
+		fmt.Fprintf(w, "}\n\n")
+
+		fmt.Fprintf(w, "func Benchmark%sDecode%s(b *testing.B) {\n", exp, c.name)
+		fmt.Fprintf(w, "\to := newBench%s()\n", exp)
+		fmt.Fprintf(w, "\t%s\n", strings.Replace(c.encode, "\n\t\t", "\n\t", -1))
+		fmt.Fprintf(w, "\tb.ReportAllocs()\n")
+		fmt.Fprintf(w, "\tfor i := 0; i < b.N; i++ {\n")
+		fmt.Fprintf(w, "\t\t"+c.decode+"\n", exp)
+		fmt.Fprintf(w, "\t}\n")
+		fmt.Fprintf(w, "\tb.ReportMetric(float64(len(v)), \"B/record\")\n")
+		fmt.Fprintf(w, "}\n\n")
+	}
+	return nil
+}
+
+// writeRawBenchmarks writes the benchmarks of the generated code for a single
+// raw struct. Accessors read from an encoded record, as they would from a
+// value in bolt.
+func (g *Generator) writeRawBenchmarks(unexp, exp string, node *ast.StructType, pragmas map[string]string, w io.Writer) error {
+	if err := g.writeBenchRecord("newRawBench"+exp, exp, node, w); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(w, "func Benchmark%sEncode(b *testing.B) {\n", exp)
+	fmt.Fprintf(w, "\to := newRawBench%s()\n", exp)
+	fmt.Fprintf(w, "\tvar n int\n")
+	fmt.Fprintf(w, "\tb.ReportAllocs()\n")
+	fmt.Fprintf(w, "\tfor i := 0; i < b.N; i++ {\n")
+	fmt.Fprintf(w, "\t\tn = len(o.Encode())\n")
+	fmt.Fprintf(w, "\t}\n")
+	fmt.Fprintf(w, "\tb.ReportMetric(float64(n), \"B/record\")\n")
+	fmt.Fprintf(w, "}\n\n")
+
+	fmt.Fprintf(w, "func Benchmark%sDecode(b *testing.B) {\n", exp)
+	fmt.Fprintf(w, "\tv := newRawBench%s().Encode()\n", exp)
+	fmt.Fprintf(w, "\tb.ReportAllocs()\n")
+	fmt.Fprintf(w, "\tfor i := 0; i < b.N; i++ {\n")
+	fmt.Fprintf(w, "\t\tvar other %s\n", exp)
+	fmt.Fprintf(w, "\t\tif err := other.Decode(v); err != nil {\n")
+	fmt.Fprintf(w, "\t\t\tb.Fatal(err)\n")
+	fmt.Fprintf(w, "\t\t}\n")
+	fmt.Fprintf(w, "\t}\n")
+	fmt.Fprintf(w, "\tb.ReportMetric(float64(len(v)), \"B/record\")\n")
+	fmt.Fprintf(w, "}\n\n")
+
+	// Portable code has no accessors.
+	if g.portable() {
+		return nil
+	}
+
+	// Results are kept alive so the calls aren't optimized away.
+	for _, f := range node.Fields.List {
+		for _, n := range f.Names {
+			name := g.exportedName(f, n.Name)
+			fmt.Fprintf(w, "func Benchmark%sAccess%s(b *testing.B) {\n", exp, name)
+			fmt.Fprintf(w, "\tv := newRawBench%s().Encode()\n", exp)
+			fmt.Fprintf(w, "\tr := (*%s)(unsafe.Pointer(&v[0]))\n", unexp)
+			fmt.Fprintf(w, "\tx := r.%s()\n", name)
+			fmt.Fprintf(w, "\tb.ReportAllocs()\n")
+			fmt.Fprintf(w, "\tb.ResetTimer()\n")
+			fmt.Fprintf(w, "\tfor i := 0; i < b.N; i++ {\n")
+			fmt.Fprintf(w, "\t\tx = r.%s()\n", name)
+			fmt.Fprintf(w, "\t}\n")
+			fmt.Fprintf(w, "\truntime.KeepAlive(x)\n")
+			fmt.Fprintf(w, "}\n\n")
+
+			// Field functions read the same field without a raw struct
+			// pointer, so neither benchmark allocates a struct.
+			fmt.Fprintf(w, "func Benchmark%sField%s(b *testing.B) {\n", exp, name)
+			fmt.Fprintf(w, "\tv := newRawBench%s().Encode()\n", exp)
+			fmt.Fprintf(w, "\tx := %s%s(v)\n", exp, name)
+			fmt.Fprintf(w, "\tb.ReportAllocs()\n")
+			fmt.Fprintf(w, "\tb.ResetTimer()\n")
+			fmt.Fprintf(w, "\tfor i := 0; i < b.N; i++ {\n")
+			fmt.Fprintf(w, "\t\tx = %s%s(v)\n", exp, name)
+			fmt.Fprintf(w, "\t}\n")
+			fmt.Fprintf(w, "\truntime.KeepAlive(x)\n")
+			fmt.Fprintf(w, "}\n\n")
+		}
+	}
+	return nil
+}
+
+// writeBenchRecord writes a function, fn, returning a record of an exported
+// type with a representative value for each field.
+func (g *Generator) writeBenchRecord(fn, exp string, node *ast.StructType, w io.Writer) error {
+	fmt.Fprintf(w, "func %s() *%s {\n", fn, exp)
+	fmt.Fprintf(w, "\treturn &%s{\n", exp)
+	for _, f := range node.Fields.List {
+		typ := tostr(f.Type)
+		if value, ok := nullTypes[typ]; ok {
+			typ = value
+		}
+		for _, n := range f.Names {
+			var value string
+			switch typ {
+			case "bool":
+				value = "true"
+			case "int8":
+				value = "-100"
+			case "uint8":
+				value = "200"
+			case "int16", "int32", "int64", "int":
+				value = "-12345"
+			case "uint16", "uint32", "uint64", "uint":
+				value = "12345"
+			case "raw.Flags8", "raw.Flags16", "raw.Flags32":
+				value = "1"
+			case "float32", "float64":
+				value = "1234.5"
+			case "complex64", "complex128":
+				value = "complex(1234.5, -2)"
+			case "raw.Time", "raw.TimeMicro", "raw.TimeMilli", "raw.TimeSec":
+				value = "time.Date(2014, 5, 1, 12, 30, 0, 0, time.UTC)"
+			case "raw.Decimal":
+				value = "raw.NewDecimal(12345, 2)"
+			case "raw.Int128":
+				value = "raw.Int128{Hi: -12345, Lo: 12345}"
+			case "raw.Uint128":
+				value = "raw.Uint128{Hi: 12345, Lo: 12345}"
+			case "raw.IP":
+				value = "netip.MustParseAddr(\"192.0.2.1\")"
+			case "raw.ZonedTime":
+				value = "time.Date(2014, 5, 1, 12, 30, 0, 0, time.FixedZone(\"\", -5*3600))"
+			case "raw.Duration":
+				value = "90 * time.Second"
+			case "raw.String8", "raw.String", "raw.String32":
+				value = fmt.Sprintf("%q", "example "+n.Name)
+			case "raw.Bytes":
+				value = fmt.Sprintf("[]byte(%q)", "example "+n.Name)
+			case "raw.StringList":
+				value = fmt.Sprintf("[]string{%q, %q}", "example", n.Name)
+			default:
+				if elem := sliceElem(typ); elem != "" {
+					value = "[]" + elem + "{1, 2, 3}"
+				} else if n := arrayLen(typ); n > 0 {
+					value = fmt.Sprintf("[%d]byte{1, 2, 3}", n)
+				} else {
+					return fmt.Errorf("invalid raw type: %s", typ)
+				}
+			}
+			if values := enumValues(f); values != nil {
+				value = fmt.Sprint(len(values) - 1)
+			}
+			if isNullableField(f) {
+				gotyp, err := g.exportedType(exp, f, n.Name)
+				if err != nil {
+					return err
+				}
+				value = optionalValue(gotyp, value)
+			}
+			fmt.Fprintf(w, "\t\t%s: %s,\n", g.exportedName(f, n.Name), value)
+		}
+	}
+	fmt.Fprintf(w, "\t}\n")
+	fmt.Fprintf(w, "}\n\n")
+	return nil
+}
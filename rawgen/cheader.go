@@ -0,0 +1,177 @@
+package rawgen
+
+import (
+	"bytes"
+	"fmt"
+)
+
+// cTypes are the C types of raw types with a fixed C equivalent. The raw_*
+// types are declared at the top of every header.
+var cTypes = map[string]string{
+	"bool":            "bool",
+	"int8":            "int8_t",
+	"int16":           "int16_t",
+	"int32":           "int32_t",
+	"int64":           "int64_t",
+	"int":             "int64_t",
+	"uint8":           "uint8_t",
+	"uint16":          "uint16_t",
+	"uint32":          "uint32_t",
+	"uint64":          "uint64_t",
+	"uint":            "uint64_t",
+	"uintptr":         "uint64_t",
+	"float32":         "float",
+	"float64":         "double",
+	"complex64":       "float _Complex",
+	"complex128":      "double _Complex",
+	"raw.Time":        "int64_t",
+	"raw.TimeMicro":   "int64_t",
+	"raw.TimeMilli":   "int64_t",
+	"raw.TimeSec":     "uint32_t",
+	"raw.ZonedTime":   "raw_zoned_time",
+	"raw.IP":          "raw_ip",
+	"raw.Decimal":     "raw_decimal",
+	"raw.Int128":      "raw_int128",
+	"raw.Uint128":     "raw_uint128",
+	"raw.NullInt64":   "raw_null_int64",
+	"raw.NullFloat64": "raw_null_float64",
+	"raw.NullString":  "raw_null_string",
+	"raw.Duration":    "int64_t",
+	"raw.Presence":    "uint64_t",
+	"raw.Flags8":      "uint8_t",
+	"raw.Flags16":     "uint16_t",
+	"raw.Flags32":     "uint32_t",
+	"raw.String8":     "raw_string8",
+	"raw.String":      "raw_string",
+	"raw.String32":    "raw_string32",
+	"raw.Bytes":       "raw_bytes",
+	"raw.StringList":  "raw_string_list",
+}
+
+// cKeywords are C and C++ keywords that are valid Go field names.
+var cKeywords = map[string]bool{
+	"auto": true, "bool": true, "catch": true, "char": true, "class": true,
+	"delete": true, "do": true, "double": true, "enum": true, "explicit": true,
+	"extern": true, "float": true, "friend": true, "inline": true, "int": true,
+	"long": true, "mutable": true, "namespace": true, "new": true,
+	"operator": true, "private": true, "protected": true, "public": true,
+	"register": true, "restrict": true, "short": true, "signed": true,
+	"sizeof": true, "static": true, "template": true, "this": true,
+	"throw": true, "try": true, "typedef": true, "typename": true,
+	"union": true, "unsigned": true, "using": true, "virtual": true,
+	"void": true, "volatile": true, "while": true,
+}
+
+// cHeaderTypes declares the C layout of the raw package's types.
+const cHeaderTypes = `#ifndef RAW_TYPES_H
+#define RAW_TYPES_H
+
+#pragma pack(push, 1)
+typedef struct { uint8_t offset; uint8_t length; } raw_string8;
+typedef struct { uint16_t offset; uint16_t length; } raw_string;
+typedef struct { uint32_t offset; uint32_t length; } raw_string32;
+typedef struct { uint16_t offset; uint16_t length; } raw_bytes;
+typedef struct { uint16_t offset; uint16_t length; uint16_t size; } raw_string_list;
+typedef struct { uint16_t offset; uint16_t length; } raw_slice;
+typedef struct { int64_t nano; int32_t offset; uint8_t _pad[4]; } raw_zoned_time;
+typedef struct { uint8_t addr[16]; uint8_t family; } raw_ip;
+typedef struct { int64_t unscaled; int32_t scale; uint8_t _pad[4]; } raw_decimal;
+typedef struct { int64_t hi; uint64_t lo; } raw_int128;
+typedef struct { uint64_t hi; uint64_t lo; } raw_uint128;
+typedef struct { int64_t value; uint8_t valid; uint8_t _pad[7]; } raw_null_int64;
+typedef struct { double value; uint8_t valid; uint8_t _pad[7]; } raw_null_float64;
+typedef struct { uint16_t offset; uint16_t length; uint8_t valid; uint8_t _pad; } raw_null_string;
+#pragma pack(pop)
+
+#ifdef __cplusplus
+#define RAW_STATIC_ASSERT static_assert
+#else
+#define RAW_STATIC_ASSERT _Static_assert
+#endif
+
+#endif
+`
+
+// GenerateCHeader returns a C header declaring a packed C struct for each raw
+// struct in the Go source file, src, so C and C++ programs can read the same
+// records. Padding inserted by the Go compiler is declared as explicit
+// padding fields and the size and offset of every field is checked with
+// static assertions. Offsets are relative to the start of the record.
+// Returns nil if the file has no raw structs.
+func (g *Generator) GenerateCHeader(src []byte) ([]byte, error) {
+	s, err := g.Schema(src)
+	if err != nil {
+		return nil, err
+	} else if len(s.Structs) == 0 {
+		return nil, nil
+	}
+
+	var buf bytes.Buffer
+	fmt.Fprint(&buf, generatedHeader)
+	fmt.Fprintf(&buf, "// Records of package %s are encoded in %s byte order unless noted.\n\n", s.Package, s.Endian)
+	fmt.Fprint(&buf, "#pragma once\n\n")
+	fmt.Fprint(&buf, "#include <stdbool.h>\n")
+	fmt.Fprint(&buf, "#include <stddef.h>\n")
+	fmt.Fprint(&buf, "#include <stdint.h>\n\n")
+	fmt.Fprint(&buf, cHeaderTypes)
+	for _, st := range s.Structs {
+		if err := writeCStruct(st, &buf); err != nil {
+			return nil, fmt.Errorf("%s: %s", st.Name, err)
+		}
+	}
+	return buf.Bytes(), nil
+}
+
+// writeCStruct writes the packed C struct and static assertions for a raw
+// struct.
+func writeCStruct(st *Struct, buf *bytes.Buffer) error {
+	if cKeywords[st.Name] {
+		return fmt.Errorf("struct name is a C keyword")
+	}
+
+	fmt.Fprint(buf, "\n")
+	if _, ok := st.Pragmas["ctype"]; ok {
+		fmt.Fprint(buf, "// Encoded in big-endian byte order.\n")
+	}
+	fmt.Fprint(buf, "#pragma pack(push, 1)\n")
+	fmt.Fprintf(buf, "struct %s {\n", st.Name)
+	var end, padN int
+	for _, f := range st.Fields {
+		// Blank fields declare padding, which is declared again below.
+		if f.Name == "_" {
+			continue
+		} else if cKeywords[f.Name] {
+			return fmt.Errorf("field name is a C keyword: %s", f.Name)
+		}
+		if f.Offset > end {
+			fmt.Fprintf(buf, "\tuint8_t _pad%d[%d];\n", padN, f.Offset-end)
+			padN++
+		}
+		end = f.Offset + f.Size
+
+		if typ, ok := cTypes[f.RawType]; ok {
+			fmt.Fprintf(buf, "\t%s %s;\n", typ, f.Name)
+		} else if n := arrayLen(f.RawType); n > 0 {
+			fmt.Fprintf(buf, "\tuint8_t %s[%d];\n", f.Name, n)
+		} else if elem := sliceElem(f.RawType); elem != "" {
+			fmt.Fprintf(buf, "\traw_slice %s; // %s elements\n", f.Name, cTypes[elem])
+		} else {
+			return fmt.Errorf("no C type for %s", f.RawType)
+		}
+	}
+	if st.Size > end {
+		fmt.Fprintf(buf, "\tuint8_t _pad%d[%d];\n", padN, st.Size-end)
+	}
+	fmt.Fprint(buf, "};\n")
+	fmt.Fprint(buf, "#pragma pack(pop)\n\n")
+
+	fmt.Fprintf(buf, "RAW_STATIC_ASSERT(sizeof(struct %s) == %d, \"size of %s\");\n", st.Name, st.Size, st.Name)
+	for _, f := range st.Fields {
+		if f.Name == "_" {
+			continue
+		}
+		fmt.Fprintf(buf, "RAW_STATIC_ASSERT(offsetof(struct %s, %s) == %d, \"offset of %s.%s\");\n", st.Name, f.Name, f.Offset, st.Name, f.Name)
+		fmt.Fprintf(buf, "RAW_STATIC_ASSERT(sizeof(((struct %s *)0)->%s) == %d, \"size of %s.%s\");\n", st.Name, f.Name, f.Size, st.Name, f.Name)
+	}
+	return nil
+}
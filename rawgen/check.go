@@ -0,0 +1,94 @@
+package rawgen
+
+import (
+	"crypto/sha1"
+	"fmt"
+	"go/ast"
+	"io"
+	"sort"
+)
+
+// schemaFingerprint returns the layout fingerprint of a raw struct, which also
+// covers the options that change how its records are encoded.
+func (v *visitor) schemaFingerprint(node *ast.StructType) string {
+	h := sha1.New()
+	fmt.Fprint(h, fingerprint(v.fixedInts(node)))
+	if v.Endian == "big" {
+		fmt.Fprint(h, " big")
+	}
+	if t := v.target(); t != target64 {
+		fmt.Fprintf(h, " word=%d align=%d", t.word, t.align)
+	}
+	if v.Checksum {
+		fmt.Fprint(h, " checksum")
+	}
+	if v.TypeTag {
+		fmt.Fprint(h, " type-tag")
+	}
+	return fmt.Sprintf("%x", h.Sum(nil))[:16]
+}
+
+// writeSchemaFuncs writes a generated constant holding the layout fingerprint
+// of a raw struct and a function checking it against the fingerprint recorded
+// in a bolt database, for refusing to open a database written with another
+// layout. The fingerprints of older versions of a versioned raw struct are
+// also accepted as DecodeAny upgrades their records.
+func (v *visitor) writeSchemaFuncs(unexp, exp string, node *ast.StructType, w io.Writer) error {
+	fmt.Fprintf(w, "// %sSchema is the layout fingerprint of %s records.\n", exp, exp)
+	fmt.Fprintf(w, "const %sSchema = %q\n\n", exp, v.schemaFingerprint(node))
+
+	schemas := []string{exp + "Schema"}
+	if v.version > 0 && !isOlderVersion(unexp, v.version) {
+		older, err := v.olderVersions(unexp, v.version)
+		if err != nil {
+			return err
+		}
+		versions := make([]int, 0, len(older))
+		for n := range older {
+			versions = append(versions, n)
+		}
+		sort.Ints(versions)
+		for _, n := range versions {
+			schemas = append(schemas, tocamelcase(older[n])+"Schema")
+		}
+	}
+
+	// Read-only databases are only checked. Otherwise the fingerprint is
+	// recorded when there is none yet or it's of an older version.
+	fmt.Fprintf(w, "// Check%sSchema returns an error wrapping %s.ErrSchema if db stores %s\n", exp, v.pkg, exp)
+	fmt.Fprintf(w, "// records with another layout. The layout is recorded in the %s.SchemaBucket\n", v.pkg)
+	fmt.Fprintf(w, "// bucket, under the name of the bucket storing the records, if it isn't yet.\n")
+	fmt.Fprintf(w, "func Check%sSchema(db *bolt.DB) error {\n", exp)
+	fmt.Fprintf(w, "\tfn := db.Update\n")
+	fmt.Fprintf(w, "\tif db.IsReadOnly() {\n")
+	fmt.Fprintf(w, "\t\tfn = db.View\n")
+	fmt.Fprintf(w, "\t}\n")
+	fmt.Fprintf(w, "\treturn fn(func(tx *bolt.Tx) error {\n")
+	fmt.Fprintf(w, "\t\tvar schema string\n")
+	fmt.Fprintf(w, "\t\tif b := tx.Bucket([]byte(%s.SchemaBucket)); b != nil {\n", v.pkg)
+	fmt.Fprintf(w, "\t\t\tschema = string(b.Get([]byte(%sBucket)))\n", exp)
+	fmt.Fprintf(w, "\t\t}\n")
+	fmt.Fprintf(w, "\t\tswitch schema {\n")
+	fmt.Fprintf(w, "\t\tcase %sSchema:\n", exp)
+	fmt.Fprintf(w, "\t\t\treturn nil\n")
+	fmt.Fprintf(w, "\t\tcase \"\"")
+	for _, name := range schemas[1:] {
+		fmt.Fprintf(w, ", %s", name)
+	}
+	fmt.Fprintf(w, ":\n")
+	fmt.Fprintf(w, "\t\t\tif !tx.Writable() {\n")
+	fmt.Fprintf(w, "\t\t\t\treturn nil\n")
+	fmt.Fprintf(w, "\t\t\t}\n")
+	fmt.Fprintf(w, "\t\t\tb, err := tx.CreateBucketIfNotExists([]byte(%s.SchemaBucket))\n", v.pkg)
+	fmt.Fprintf(w, "\t\t\tif err != nil {\n")
+	fmt.Fprintf(w, "\t\t\t\treturn err\n")
+	fmt.Fprintf(w, "\t\t\t}\n")
+	fmt.Fprintf(w, "\t\t\treturn b.Put([]byte(%sBucket), []byte(%sSchema))\n", exp, exp)
+	fmt.Fprintf(w, "\t\tdefault:\n")
+	fmt.Fprintf(w, "\t\t\treturn fmt.Errorf(\"%%w: %%s bucket has layout %%s, not %%s\", %s.ErrSchema, %sBucket, schema, %sSchema)\n", v.pkg, exp, exp)
+	fmt.Fprintf(w, "\t\t}\n")
+	fmt.Fprintf(w, "\t})\n")
+	fmt.Fprintf(w, "}\n\n")
+	v.imports["fmt"] = true
+	return nil
+}
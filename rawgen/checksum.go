@@ -0,0 +1,47 @@
+package rawgen
+
+import (
+	"fmt"
+	"io"
+)
+
+// checksumResult returns the expression returned by a generated function that
+// encoded a record starting at b[start:], which appends the checksum of the
+// record when checksums are enabled.
+func (v *visitor) checksumResult(b, start string) string {
+	if v.Checksum {
+		return fmt.Sprintf("%s.AppendChecksum(%s, %s)", v.pkg, b, start)
+	}
+	return b
+}
+
+// checksumCapacity returns the extra capacity, added to capacity, needed to
+// encode a record along with its checksum.
+func (v *visitor) checksumCapacity(capacity string) string {
+	if v.Checksum {
+		return capacity + "+" + v.pkg + ".ChecksumSize"
+	}
+	return capacity
+}
+
+// writeChecksumVerify writes the statements, at the start of a generated
+// function reading an encoded record, b, that verify its checksum and then
+// strip it from b when checksums are enabled. The error is preceded by the
+// zero values in ret.
+func (v *visitor) writeChecksumVerify(ret string, w io.Writer) {
+	if !v.Checksum {
+		return
+	}
+	fmt.Fprintf(w, "\tb, err := %s.VerifyChecksum(b)\n", v.pkg)
+	fmt.Fprintf(w, "\tif err != nil {\n")
+	fmt.Fprintf(w, "\t\treturn %serr\n", ret)
+	fmt.Fprintf(w, "\t}\n")
+}
+
+// writeChecksumLen writes a statement adding the size of the checksum to n,
+// the length of an encoded record, when checksums are enabled.
+func (v *visitor) writeChecksumLen(w io.Writer) {
+	if v.Checksum {
+		fmt.Fprintf(w, "\tn += %s.ChecksumSize\n", v.pkg)
+	}
+}
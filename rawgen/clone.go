@@ -0,0 +1,79 @@
+package rawgen
+
+import (
+	"fmt"
+	"go/ast"
+	"io"
+)
+
+// writeCloneFunc writes a generated Clone method returning a deep copy of an
+// exported type. Strings and slices are copied so the clone can be retained
+// after the bytes it was decoded from are reused, such as after a bolt
+// transaction closes. User-defined field types are copied by value.
+func (v *visitor) writeCloneFunc(exp string, node *ast.StructType, pragmas map[string]string, w io.Writer) error {
+	for _, f := range node.Fields.List {
+		for _, n := range f.Names {
+			if v.fieldname(n.Name) == "Clone" {
+				return fmt.Errorf("%s: exported name Clone conflicts with generated Clone method", n.Name)
+			}
+		}
+	}
+
+	fmt.Fprintf(w, "// Clone returns a copy of o that shares no memory with it.\n")
+	fmt.Fprintf(w, "func (o *%s) Clone() *%s {\n", exp, exp)
+	v.writeLoad("o", w)
+	fmt.Fprintf(w, "\tc := *o\n")
+	for _, f := range node.Fields.List {
+		typ := tostr(f.Type)
+
+		// Embedded raw structs are copied with their own Clone method.
+		if len(f.Names) == 0 {
+			name, err := v.gotype(typ)
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(w, "\tc.%s = *o.%s.Clone()\n", name, name)
+		}
+		for _, n := range f.Names {
+			name := v.fieldname(n.Name)
+			switch {
+			case v.isOptional(n.Name):
+				fmt.Fprintf(w, "\tif o.%s != nil {\n", name)
+				if stringWidth(typ) > 0 {
+					fmt.Fprintf(w, "\t\tx := strings.Clone(*o.%s)\n", name)
+					v.imports["strings"] = true
+				} else {
+					fmt.Fprintf(w, "\t\tx := *o.%s\n", name)
+				}
+				fmt.Fprintf(w, "\t\tc.%s = &x\n", name)
+				fmt.Fprintf(w, "\t}\n")
+			case v.nested[typ] != nil:
+				fmt.Fprintf(w, "\tc.%s = *o.%s.Clone()\n", name, name)
+			case typ == "raw.String8", typ == "raw.String", typ == "raw.String32":
+				fmt.Fprintf(w, "\tc.%s = strings.Clone(o.%s)\n", name, name)
+				v.imports["strings"] = true
+			case typ == "raw.Bytes":
+				fmt.Fprintf(w, "\tc.%s = bytes.Clone(o.%s)\n", name, name)
+				v.imports["bytes"] = true
+			case typ == "raw.StringList":
+				fmt.Fprintf(w, "\tif o.%s != nil {\n", name)
+				fmt.Fprintf(w, "\t\tc.%s = make([]string, len(o.%s))\n", name, name)
+				fmt.Fprintf(w, "\t\tfor i, s := range o.%s {\n", name)
+				fmt.Fprintf(w, "\t\t\tc.%s[i] = strings.Clone(s)\n", name)
+				fmt.Fprintf(w, "\t\t}\n")
+				fmt.Fprintf(w, "\t}\n")
+				v.imports["strings"] = true
+			case sliceElem(typ) != "":
+				fmt.Fprintf(w, "\tc.%s = slices.Clone(o.%s)\n", name, name)
+				v.imports["slices"] = true
+			}
+		}
+	}
+	if _, ok := pragmas["retain"]; ok {
+		fmt.Fprintf(w, "\tc.raw = bytes.Clone(o.raw)\n")
+		v.imports["bytes"] = true
+	}
+	fmt.Fprintf(w, "\treturn &c\n")
+	fmt.Fprintf(w, "}\n\n")
+	return nil
+}
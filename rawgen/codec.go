@@ -0,0 +1,122 @@
+package rawgen
+
+import (
+	"fmt"
+	"go/ast"
+	"go/types"
+	"io"
+)
+
+// findCodecs returns the types declared in a file that implement both
+// raw.Encoder and raw.Decoder with pointer receivers, mapped to the type
+// they encode. Only the method signatures are checked; the generated code
+// asserts that each type implements the interfaces.
+func findCodecs(f *ast.File) map[string]string {
+	encoders := make(map[string]string)
+	decoders := make(map[string]string)
+	for _, decl := range f.Decls {
+		fn, ok := decl.(*ast.FuncDecl)
+		if !ok || fn.Recv == nil || len(fn.Recv.List) != 1 {
+			continue
+		}
+		star, ok := fn.Recv.List[0].Type.(*ast.StarExpr)
+		if !ok {
+			continue
+		}
+		recv, ok := star.X.(*ast.Ident)
+		if !ok {
+			continue
+		}
+
+		params, results := fieldTypes(fn.Type.Params), fieldTypes(fn.Type.Results)
+		switch fn.Name.Name {
+		case "Encode":
+			if len(params) == 2 && params[1] == "*[]byte" && len(results) == 0 {
+				encoders[recv.Name] = params[0]
+			}
+		case "Decode":
+			if len(params) == 1 && params[0] == "[]byte" && len(results) == 1 {
+				decoders[recv.Name] = results[0]
+			}
+		}
+	}
+
+	codecs := make(map[string]string)
+	for name, typ := range encoders {
+		if decoders[name] == typ {
+			codecs[name] = typ
+		}
+	}
+	return codecs
+}
+
+// fieldTypes returns the type of each parameter or result in a list.
+func fieldTypes(l *ast.FieldList) []string {
+	var a []string
+	if l == nil {
+		return a
+	}
+	for _, f := range l.List {
+		n := len(f.Names)
+		if n == 0 {
+			n = 1
+		}
+		for i := 0; i < n; i++ {
+			a = append(a, types.ExprString(f.Type))
+		}
+	}
+	return a
+}
+
+// isRawStructType returns true when a struct only has fields with raw types,
+// int and uint fields if IntWidth is set, or user-defined types implementing
+// raw.Encoder and raw.Decoder.
+func (v *visitor) isRawStructType(node *ast.StructType) bool {
+	for _, f := range node.Fields.List {
+		if _, ok := v.codecs[tostr(f.Type)]; ok {
+			continue
+		} else if v.isIntType(tostr(f.Type)) {
+			continue
+		}
+		if !isRawStructType(&ast.StructType{Fields: &ast.FieldList{List: []*ast.Field{f}}}) {
+			return false
+		}
+	}
+	return true
+}
+
+// hasCodecs returns true if a struct has any fields with user-defined types.
+func (v *visitor) hasCodecs(node *ast.StructType) bool {
+	for _, f := range node.Fields.List {
+		if _, ok := v.codecs[tostr(f.Type)]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+// writeCodecChecks writes compile-time assertions that the user-defined field
+// types of a struct implement raw.Encoder and raw.Decoder. The length of a
+// record with these fields is unknown so they can't be used with features
+// that need it.
+func (v *visitor) writeCodecChecks(node *ast.StructType, pragmas map[string]string, w io.Writer) error {
+	if !v.hasCodecs(node) {
+		return nil
+	}
+	if _, ok := pragmas["retain"]; ok {
+		return fmt.Errorf("retain is not supported with user-defined field types")
+	} else if v.portable() {
+		return fmt.Errorf("user-defined field types are not supported with portable encoding")
+	}
+
+	seen := make(map[string]bool)
+	for _, f := range node.Fields.List {
+		typ := tostr(f.Type)
+		if exp, ok := v.codecs[typ]; ok && !seen[typ] {
+			fmt.Fprintf(w, "var _ %s.Encoder[%s] = (*%s)(nil)\n", v.pkg, exp, typ)
+			fmt.Fprintf(w, "var _ %s.Decoder[%s] = (*%s)(nil)\n\n", v.pkg, exp, typ)
+			seen[typ] = true
+		}
+	}
+	return nil
+}
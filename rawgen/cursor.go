@@ -0,0 +1,94 @@
+package rawgen
+
+import (
+	"fmt"
+	"io"
+)
+
+// writeCursorFuncs writes a generated cursor type that iterates over the
+// records in a bolt bucket in key order, decoding each one, along with
+// functions calling a callback for each record in a range of keys or with a
+// key prefix.
+func (v *visitor) writeCursorFuncs(exp string, pragmas map[string]string, w io.Writer) error {
+	fmt.Fprintf(w, "// %sCursor iterates over the %s records in a bucket in key order. Each\n", exp, exp)
+	fmt.Fprintf(w, "// method returns the key and decoded record at the cursor's new position,\n")
+	fmt.Fprintf(w, "// or a nil key at the end of the bucket or if a record can't be decoded.\n")
+	fmt.Fprintf(w, "type %sCursor struct {\n", exp)
+	fmt.Fprintf(w, "\tc   *bolt.Cursor\n")
+	fmt.Fprintf(w, "\terr error\n")
+	fmt.Fprintf(w, "}\n\n")
+
+	fmt.Fprintf(w, "// New%sCursor returns a cursor over the %s bucket. The cursor is empty if\n", exp, exp)
+	fmt.Fprintf(w, "// the bucket doesn't exist.\n")
+	fmt.Fprintf(w, "func New%sCursor(tx *bolt.Tx) *%sCursor {\n", exp, exp)
+	fmt.Fprintf(w, "\tb := tx.Bucket([]byte(%sBucket))\n", exp)
+	fmt.Fprintf(w, "\tif b == nil {\n")
+	fmt.Fprintf(w, "\t\treturn &%sCursor{}\n", exp)
+	fmt.Fprintf(w, "\t}\n")
+	fmt.Fprintf(w, "\treturn &%sCursor{c: b.Cursor()}\n", exp)
+	fmt.Fprintf(w, "}\n\n")
+
+	for _, m := range []struct{ name, params, args string }{
+		{"First", "", ""},
+		{"Last", "", ""},
+		{"Next", "", ""},
+		{"Prev", "", ""},
+		{"Seek", "seek []byte", "seek"},
+	} {
+		fmt.Fprintf(w, "func (c *%sCursor) %s(%s) ([]byte, *%s) {\n", exp, m.name, m.params, exp)
+		fmt.Fprintf(w, "\tif c.c == nil || c.err != nil {\n")
+		fmt.Fprintf(w, "\t\treturn nil, nil\n")
+		fmt.Fprintf(w, "\t}\n")
+		fmt.Fprintf(w, "\treturn c.decode(c.c.%s(%s))\n", m.name, m.args)
+		fmt.Fprintf(w, "}\n\n")
+	}
+
+	// Values are only valid during the transaction so retained bytes are
+	// copied.
+	fmt.Fprintf(w, "func (c *%sCursor) decode(k, v []byte) ([]byte, *%s) {\n", exp, exp)
+	fmt.Fprintf(w, "\tif k == nil {\n")
+	fmt.Fprintf(w, "\t\treturn nil, nil\n")
+	fmt.Fprintf(w, "\t}\n")
+	if retainsBytes(pragmas) {
+		fmt.Fprintf(w, "\tv = append([]byte(nil), v...)\n")
+	}
+	fmt.Fprintf(w, "\to := &%s{}\n", exp)
+	fmt.Fprintf(w, "\tif err := o.Decode(v); err != nil {\n")
+	fmt.Fprintf(w, "\t\tc.err = err\n")
+	fmt.Fprintf(w, "\t\treturn nil, nil\n")
+	fmt.Fprintf(w, "\t}\n")
+	fmt.Fprintf(w, "\treturn k, o\n")
+	fmt.Fprintf(w, "}\n\n")
+
+	fmt.Fprintf(w, "// Err returns the error that stopped iteration, if any.\n")
+	fmt.Fprintf(w, "func (c *%sCursor) Err() error { return c.err }\n\n", exp)
+
+	fmt.Fprintf(w, "// Range%s calls fn for each record with a key from min up to and including\n", exp)
+	fmt.Fprintf(w, "// max, in key order. A nil max has no upper bound. Iteration stops at the\n")
+	fmt.Fprintf(w, "// first error returned by fn or when decoding a record.\n")
+	fmt.Fprintf(w, "func Range%s(tx *bolt.Tx, min, max []byte, fn func(key []byte, o *%s) error) error {\n", exp, exp)
+	fmt.Fprintf(w, "\tc := New%sCursor(tx)\n", exp)
+	fmt.Fprintf(w, "\tfor k, o := c.Seek(min); k != nil && (max == nil || bytes.Compare(k, max) <= 0); k, o = c.Next() {\n")
+	fmt.Fprintf(w, "\t\tif err := fn(k, o); err != nil {\n")
+	fmt.Fprintf(w, "\t\t\treturn err\n")
+	fmt.Fprintf(w, "\t\t}\n")
+	fmt.Fprintf(w, "\t}\n")
+	fmt.Fprintf(w, "\treturn c.Err()\n")
+	fmt.Fprintf(w, "}\n\n")
+
+	fmt.Fprintf(w, "// Range%sPrefix calls fn for each record with a key starting with prefix, in\n", exp)
+	fmt.Fprintf(w, "// key order. Iteration stops at the first error returned by fn or when\n")
+	fmt.Fprintf(w, "// decoding a record.\n")
+	fmt.Fprintf(w, "func Range%sPrefix(tx *bolt.Tx, prefix []byte, fn func(key []byte, o *%s) error) error {\n", exp, exp)
+	fmt.Fprintf(w, "\tc := New%sCursor(tx)\n", exp)
+	fmt.Fprintf(w, "\tfor k, o := c.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, o = c.Next() {\n")
+	fmt.Fprintf(w, "\t\tif err := fn(k, o); err != nil {\n")
+	fmt.Fprintf(w, "\t\t\treturn err\n")
+	fmt.Fprintf(w, "\t\t}\n")
+	fmt.Fprintf(w, "\t}\n")
+	fmt.Fprintf(w, "\treturn c.Err()\n")
+	fmt.Fprintf(w, "}\n\n")
+
+	v.imports["bytes"] = true
+	return nil
+}
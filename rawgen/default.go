@@ -0,0 +1,122 @@
+package rawgen
+
+import (
+	"fmt"
+	"go/ast"
+	"io"
+	"strconv"
+	"time"
+)
+
+// defaultFields returns the default value of each optional or null field of
+// a raw struct tagged with one, keyed by field name, as an expression of a
+// pointer to the value. Defaults are set by the generated constructor and by
+// Decode for fields that are unset in a record, such as fields added after
+// the record was written.
+func (g *Generator) defaultFields(exp string, node *ast.StructType) (map[string]string, error) {
+	defaults := make(map[string]string)
+	for _, f := range node.Fields.List {
+		for _, n := range f.Names {
+			value, err := g.defaultValue(exp, f, n.Name)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %s", n.Name, err)
+			} else if value != "" {
+				defaults[n.Name] = value
+			}
+		}
+	}
+	return defaults, nil
+}
+
+// defaultValue returns an expression of a pointer to the default value of a
+// field, n, in the exported type exp, or a blank string if it has none. The
+// default of an enum field may be the name of one of its values.
+func (g *Generator) defaultValue(exp string, f *ast.Field, n string) (string, error) {
+	lit, ok := parseTag(f)["default"]
+	if !ok {
+		return "", nil
+	}
+	gotyp, err := g.exportedType(exp, f, n)
+	if err != nil {
+		return "", err
+	}
+
+	typ := tostr(f.Type)
+	if value, ok := nullTypes[typ]; ok {
+		typ = value
+	}
+	var value string
+	switch typ {
+	case "raw.Time", "raw.TimeMicro", "raw.TimeMilli", "raw.TimeSec", "raw.ZonedTime":
+		t, err := time.Parse(time.RFC3339Nano, lit)
+		if err != nil {
+			return "", err
+		}
+		value = fmt.Sprintf("time.Unix(%d, %d).UTC()", t.Unix(), t.Nanosecond())
+		if typ == "raw.ZonedTime" {
+			_, offset := t.Zone()
+			value = fmt.Sprintf("time.Unix(%d, %d).In(time.FixedZone(\"\", %d))", t.Unix(), t.Nanosecond(), offset)
+		}
+	case "raw.Duration":
+		d, err := time.ParseDuration(lit)
+		if err != nil {
+			return "", err
+		}
+		value = fmt.Sprintf("time.Duration(%d)", d)
+	case "raw.String8", "raw.String", "raw.String32":
+		value = strconv.Quote(lit)
+	default:
+		value = lit
+		if isEnumDefault(f, lit) {
+			value = exp + g.exportedName(f, n) + tocamelcase(lit)
+		}
+	}
+	return optionalValue(gotyp, value), nil
+}
+
+// isEnumDefault returns true if the default of a field is the name of one of
+// its enum values.
+func isEnumDefault(f *ast.Field, lit string) bool {
+	for _, name := range enumValues(f) {
+		if name == lit {
+			return true
+		}
+	}
+	return false
+}
+
+// writeConstructor writes a generated function returning a new value of an
+// exported type with each field that has a default set to it. Nothing is
+// written if no field has a default.
+func (v *visitor) writeConstructor(exp string, node *ast.StructType, w io.Writer) {
+	if len(v.defaults) == 0 {
+		return
+	}
+	fmt.Fprintf(w, "// New%s returns a %s with the default value of each field that has one.\n", exp, exp)
+	fmt.Fprintf(w, "func New%s() *%s {\n", exp, exp)
+	fmt.Fprintf(w, "\treturn &%s{\n", exp)
+	for _, f := range node.Fields.List {
+		for _, n := range f.Names {
+			if value, ok := v.defaults[n.Name]; ok {
+				fmt.Fprintf(w, "\t\t%s: %s,\n", v.fieldname(n.Name), value)
+			}
+		}
+	}
+	fmt.Fprintf(w, "\t}\n")
+	fmt.Fprintf(w, "}\n\n")
+}
+
+// writeApplyDefaults writes the statements, within a case of DecodeAny,
+// setting each field of an upgraded value, o, that has a default and is nil
+// to its default.
+func (v *visitor) writeApplyDefaults(node *ast.StructType, w io.Writer) {
+	for _, f := range node.Fields.List {
+		for _, n := range f.Names {
+			if value, ok := v.defaults[n.Name]; ok {
+				fmt.Fprintf(w, "\t\tif o.%s == nil {\n", v.fieldname(n.Name))
+				fmt.Fprintf(w, "\t\t\to.%s = %s\n", v.fieldname(n.Name), value)
+				fmt.Fprintf(w, "\t\t}\n")
+			}
+		}
+	}
+}
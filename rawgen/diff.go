@@ -0,0 +1,210 @@
+package rawgen
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+// diffContext is the number of unchanged lines shown around each change.
+const diffContext = 3
+
+// Diff returns a unified diff of the changes from old to new for the file at
+// path. Returns nil if there are no changes.
+func Diff(path string, old, new []byte) []byte {
+	if bytes.Equal(old, new) {
+		return nil
+	}
+	a, b := splitLines(old), splitLines(new)
+
+	// Build the edits from the lines common to both files, recording the
+	// line numbers in each file before every edit. Lines removed between two
+	// common lines are listed before the lines added.
+	type edit struct {
+		op   byte
+		line string
+		i, j int
+	}
+	var edits []edit
+	i, j := 0, 0
+	for _, m := range append(commonLines(a, b, 0, 0, nil), [2]int{len(a), len(b)}) {
+		for ; i < m[0]; i++ {
+			edits = append(edits, edit{'-', a[i], i, j})
+		}
+		for ; j < m[1]; j++ {
+			edits = append(edits, edit{'+', b[j], i, j})
+		}
+		if i < len(a) {
+			edits = append(edits, edit{' ', a[i], i, j})
+			i, j = i+1, j+1
+		}
+	}
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "--- a/%s\n", path)
+	fmt.Fprintf(&buf, "+++ b/%s\n", path)
+	for k := 0; k < len(edits); {
+		if edits[k].op == ' ' {
+			k++
+			continue
+		}
+
+		// Extend the hunk over changes separated by less than twice the
+		// context, then add the trailing context.
+		start, end := k-diffContext, k
+		if start < 0 {
+			start = 0
+		}
+		for end < len(edits) {
+			if edits[end].op != ' ' {
+				end++
+				continue
+			}
+			next := end
+			for next < len(edits) && edits[next].op == ' ' {
+				next++
+			}
+			if next == len(edits) || next-end > 2*diffContext {
+				end += diffContext
+				if end > len(edits) {
+					end = len(edits)
+				}
+				break
+			}
+			end = next
+		}
+
+		var an, bn int
+		for _, e := range edits[start:end] {
+			if e.op != '+' {
+				an++
+			}
+			if e.op != '-' {
+				bn++
+			}
+		}
+		fmt.Fprintf(&buf, "@@ -%s +%s @@\n", hunkRange(edits[start].i, an), hunkRange(edits[start].j, bn))
+		for _, e := range edits[start:end] {
+			buf.WriteByte(e.op)
+			buf.WriteString(e.line)
+			if !strings.HasSuffix(e.line, "\n") {
+				buf.WriteString("\n\\ No newline at end of file\n")
+			}
+		}
+		k = end
+	}
+	return buf.Bytes()
+}
+
+// commonLines appends to m the indexes, offset by i0 and j0, of each pair of
+// lines of a longest common subsequence of a and b, in order. Lines common to
+// the start and end are matched directly and the rest is split at the middle
+// of a shortest edit path, found with Myers' algorithm searching from both
+// ends at once, so only linear space is used.
+func commonLines(a, b []string, i0, j0 int, m [][2]int) [][2]int {
+	for len(a) > 0 && len(b) > 0 && a[0] == b[0] {
+		m = append(m, [2]int{i0, j0})
+		a, b, i0, j0 = a[1:], b[1:], i0+1, j0+1
+	}
+	var n int
+	for n < len(a) && n < len(b) && a[len(a)-1-n] == b[len(b)-1-n] {
+		n++
+	}
+	a, b = a[:len(a)-n], b[:len(b)-n]
+
+	if len(a) > 0 && len(b) > 0 {
+		if x, y, ok := middleSnake(a, b); ok {
+			m = commonLines(a[:x], b[:y], i0, j0, m)
+			m = commonLines(a[x:], b[y:], i0+x, j0+y, m)
+		}
+	}
+	for k := 0; k < n; k++ {
+		m = append(m, [2]int{i0 + len(a) + k, j0 + len(b) + k})
+	}
+	return m
+}
+
+// middleSnake returns the point, x lines into a and y lines into b, where the
+// shortest edit paths from the start and from the end of a and b meet. Both
+// paths are extended one edit at a time, keeping only the furthest point
+// reached on each diagonal. Returns false if a and b have no common lines.
+func middleSnake(a, b []string) (x, y int, ok bool) {
+	n, m := len(a), len(b)
+	max := (n + m + 1) / 2
+	delta := n - m
+	front := delta%2 != 0
+
+	// vf and vb hold the furthest x reached on each diagonal, k = x - y,
+	// offset by max, from the start and from the end respectively.
+	vf, vb := make([]int, 2*max+2), make([]int, 2*max+2)
+	for i := range vf {
+		vf[i], vb[i] = -1, -1
+	}
+	vf[max+1], vb[max+1] = 0, 0
+
+	var fstart, fend, bstart, bend int
+	for d := 0; d < max; d++ {
+		for k := -d + fstart; k <= d-fend; k += 2 {
+			var x int
+			if k == -d || (k != d && vf[max+k-1] < vf[max+k+1]) {
+				x = vf[max+k+1]
+			} else {
+				x = vf[max+k-1] + 1
+			}
+			y := x - k
+			for x < n && y < m && a[x] == b[y] {
+				x, y = x+1, y+1
+			}
+			vf[max+k] = x
+			if x > n {
+				fend += 2
+			} else if y > m {
+				fstart += 2
+			} else if bk := max + delta - k; front && bk >= 0 && bk < len(vb) && vb[bk] != -1 && x >= n-vb[bk] {
+				return x, y, true
+			}
+		}
+		for k := -d + bstart; k <= d-bend; k += 2 {
+			var x int
+			if k == -d || (k != d && vb[max+k-1] < vb[max+k+1]) {
+				x = vb[max+k+1]
+			} else {
+				x = vb[max+k-1] + 1
+			}
+			y := x - k
+			for x < n && y < m && a[n-x-1] == b[m-y-1] {
+				x, y = x+1, y+1
+			}
+			vb[max+k] = x
+			if x > n {
+				bend += 2
+			} else if y > m {
+				bstart += 2
+			} else if fk := max + delta - k; !front && fk >= 0 && fk < len(vf) && vf[fk] != -1 && vf[fk] >= n-x {
+				return vf[fk], vf[fk] - (delta - k), true
+			}
+		}
+	}
+	return 0, 0, false
+}
+
+// hunkRange returns the range of lines in a hunk header for a hunk of n lines
+// starting after the i-th line of a file.
+func hunkRange(i, n int) string {
+	if n == 0 {
+		return fmt.Sprintf("%d,0", i)
+	}
+	return fmt.Sprintf("%d,%d", i+1, n)
+}
+
+// splitLines returns the lines of b, including their line endings.
+func splitLines(b []byte) []string {
+	if len(b) == 0 {
+		return nil
+	}
+	lines := strings.SplitAfter(string(b), "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
@@ -0,0 +1,95 @@
+package rawgen
+
+import (
+	"fmt"
+	"math/rand"
+	"strings"
+	"testing"
+)
+
+// Ensure that a unified diff is returned for changed files.
+func TestDiff(t *testing.T) {
+	for _, tt := range []struct {
+		old, new string
+		diff     string
+	}{
+		{"a\nb\n", "a\nb\n", ""},
+		{"a\nb\nc\n", "a\nx\nc\n", "--- a/f.go\n+++ b/f.go\n@@ -1,3 +1,3 @@\n a\n-b\n+x\n c\n"},
+		{"", "a\n", "--- a/f.go\n+++ b/f.go\n@@ -0,0 +1,1 @@\n+a\n"},
+		{"a\n", "", "--- a/f.go\n+++ b/f.go\n@@ -1,1 +0,0 @@\n-a\n"},
+		{"a\n", "a", "--- a/f.go\n+++ b/f.go\n@@ -1,1 +1,1 @@\n-a\n+a\n\\ No newline at end of file\n"},
+
+		// Changes far apart are split into separate hunks.
+		{
+			"1\n2\n3\n4\n5\n6\n7\n8\n9\n10\n",
+			"x\n2\n3\n4\n5\n6\n7\n8\n9\ny\n",
+			"--- a/f.go\n+++ b/f.go\n@@ -1,4 +1,4 @@\n-1\n+x\n 2\n 3\n 4\n@@ -7,4 +7,4 @@\n 7\n 8\n 9\n-10\n+y\n",
+		},
+	} {
+		if diff := string(Diff("f.go", []byte(tt.old), []byte(tt.new))); diff != tt.diff {
+			t.Errorf("%q -> %q: unexpected diff:\n%s", tt.old, tt.new, diff)
+		}
+	}
+}
+
+// Ensure that the lines matched between two files are a longest common
+// subsequence.
+func TestCommonLines(t *testing.T) {
+	rnd := rand.New(rand.NewSource(0))
+	lines := func() []string {
+		a := make([]string, rnd.Intn(30))
+		for i := range a {
+			a[i] = string(rune('a' + rnd.Intn(4)))
+		}
+		return a
+	}
+	for n := 0; n < 1000; n++ {
+		a, b := lines(), lines()
+		m := commonLines(a, b, 0, 0, nil)
+		for k, p := range m {
+			if a[p[0]] != b[p[1]] || (k > 0 && (p[0] <= m[k-1][0] || p[1] <= m[k-1][1])) {
+				t.Fatalf("%q -> %q: invalid match %d: %v", a, b, k, m)
+			}
+		}
+
+		// Compare with the length found by dynamic programming.
+		lcs := make([][]int, len(a)+1)
+		for i := range lcs {
+			lcs[i] = make([]int, len(b)+1)
+		}
+		for i := len(a) - 1; i >= 0; i-- {
+			for j := len(b) - 1; j >= 0; j-- {
+				if a[i] == b[j] {
+					lcs[i][j] = lcs[i+1][j+1] + 1
+				} else if lcs[i+1][j] > lcs[i][j+1] {
+					lcs[i][j] = lcs[i+1][j]
+				} else {
+					lcs[i][j] = lcs[i][j+1]
+				}
+			}
+		}
+		if len(m) != lcs[0][0] {
+			t.Fatalf("%q -> %q: expected %d common lines, got %d", a, b, lcs[0][0], len(m))
+		}
+	}
+}
+
+// Ensure that large files with few changes are diffed without a table of
+// every pair of lines.
+func TestDiff_Large(t *testing.T) {
+	var old, new strings.Builder
+	for i := 0; i < 100000; i++ {
+		fmt.Fprintf(&old, "%d\n", i)
+		if i%20000 == 10000 {
+			fmt.Fprintf(&new, "x\n")
+		} else {
+			fmt.Fprintf(&new, "%d\n", i)
+		}
+	}
+	diff := string(Diff("f.go", []byte(old.String()), []byte(new.String())))
+	if n := strings.Count(diff, "@@ -"); n != 5 {
+		t.Fatalf("expected 5 hunks, got %d:\n%s", n, diff)
+	} else if !strings.Contains(diff, "@@ -9998,7 +9998,7 @@\n 9997\n 9998\n 9999\n-10000\n+x\n 10001\n") {
+		t.Fatalf("unexpected diff:\n%s", diff)
+	}
+}
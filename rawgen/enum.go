@@ -0,0 +1,164 @@
+package rawgen
+
+import (
+	"fmt"
+	"go/ast"
+	"go/token"
+	"io"
+	"strings"
+)
+
+// enum is a uint8 or uint16 field tagged with the names of its values, e.g.
+// `raw:"enum=active|suspended|deleted"`. Its exported field has a generated
+// type, such as UserStatusEnum, with a constant for each value numbered from
+// zero, such as UserStatusActive. The type's name has a suffix so it doesn't
+// conflict with the function reading the field from an encoded record.
+type enum struct {
+	name   string
+	prefix string
+	typ    string
+	values []string
+}
+
+// enumFields returns the enum fields of a raw struct, keyed by field name,
+// whose exported type is exp.
+func (v *visitor) enumFields(exp string, node *ast.StructType) (map[string]*enum, error) {
+	// Constants can't have the name of a function reading another field.
+	funcs := make(map[string]bool)
+	for _, f := range node.Fields.List {
+		for _, n := range f.Names {
+			funcs[exp+v.fieldname(n.Name)] = true
+		}
+	}
+
+	enums := make(map[string]*enum)
+	for _, f := range node.Fields.List {
+		value, ok := parseTag(f)["enum"]
+		if !ok {
+			continue
+		}
+		typ := tostr(f.Type)
+		for _, n := range f.Names {
+			if typ != "uint8" && typ != "uint16" {
+				return nil, fmt.Errorf("%s: enum requires a uint8 or uint16 field", n.Name)
+			}
+			prefix := exp + v.fieldname(n.Name)
+			e := &enum{name: prefix + "Enum", prefix: prefix, typ: typ, values: strings.Split(value, "|")}
+			if len(e.values) > 1<<bitsize(typ) {
+				return nil, fmt.Errorf("%s: too many enum values for %s: %d", n.Name, typ, len(e.values))
+			}
+			seen := make(map[string]bool)
+			for _, value := range e.values {
+				if !token.IsIdentifier(value) {
+					return nil, fmt.Errorf("%s: invalid enum value: %q", n.Name, value)
+				} else if seen[tocamelcase(value)] {
+					return nil, fmt.Errorf("%s: duplicate enum value: %s", n.Name, value)
+				} else if funcs[prefix+tocamelcase(value)] {
+					return nil, fmt.Errorf("%s: enum constant %s conflicts with generated %s function", n.Name, prefix+tocamelcase(value), prefix+tocamelcase(value))
+				}
+				seen[tocamelcase(value)] = true
+			}
+			enums[n.Name] = e
+		}
+	}
+	return enums, nil
+}
+
+// fieldType returns the type of the exported field of a raw field, which is
+// the field's enum or flags type if it has one.
+func (v *visitor) fieldType(name, typ string) (string, error) {
+	if e, ok := v.enums[name]; ok {
+		return e.name, nil
+	} else if fs, ok := v.flags[name]; ok {
+		return fs.name, nil
+	}
+	return v.gotype(typ)
+}
+
+// exportedType returns the type of the exported field of a raw field, n, in
+// the exported type exp, for generated code that doesn't have a visitor.
+func (g *Generator) exportedType(exp string, f *ast.Field, n string) (string, error) {
+	if _, ok := parseTag(f)["enum"]; ok {
+		return exp + g.exportedName(f, n) + "Enum", nil
+	} else if _, ok := parseTag(f)["flags"]; ok {
+		return exp + g.exportedName(f, n) + "Flags", nil
+	}
+	return (&visitor{}).gotype(tostr(f.Type))
+}
+
+// enumValues returns the values of an enum field, or nil if it isn't one.
+func enumValues(f *ast.Field) []string {
+	if value, ok := parseTag(f)["enum"]; ok {
+		return strings.Split(value, "|")
+	}
+	return nil
+}
+
+// writeEnumTypes writes the generated type of each enum field of a raw
+// struct along with a constant for each of its values and a String method
+// returning the value's name.
+func (v *visitor) writeEnumTypes(node *ast.StructType, w io.Writer) {
+	for _, f := range node.Fields.List {
+		for _, n := range f.Names {
+			e, ok := v.enums[n.Name]
+			if !ok {
+				continue
+			}
+			fmt.Fprintf(w, "// %s is the type of the %s field.\n", e.name, v.fieldname(n.Name))
+			fmt.Fprintf(w, "type %s %s\n\n", e.name, e.typ)
+
+			fmt.Fprintf(w, "const (\n")
+			for i, value := range e.values {
+				if i == 0 {
+					fmt.Fprintf(w, "\t%s%s %s = iota\n", e.prefix, tocamelcase(value), e.name)
+				} else {
+					fmt.Fprintf(w, "\t%s%s\n", e.prefix, tocamelcase(value))
+				}
+			}
+			fmt.Fprintf(w, ")\n\n")
+
+			fmt.Fprintf(w, "// String returns the name of x.\n")
+			fmt.Fprintf(w, "func (x %s) String() string {\n", e.name)
+			fmt.Fprintf(w, "\tswitch x {\n")
+			for _, value := range e.values {
+				fmt.Fprintf(w, "\tcase %s%s:\n", e.prefix, tocamelcase(value))
+				fmt.Fprintf(w, "\t\treturn %q\n", value)
+			}
+			fmt.Fprintf(w, "\t}\n")
+			fmt.Fprintf(w, "\treturn fmt.Sprintf(\"%s(%%d)\", x)\n", e.name)
+			fmt.Fprintf(w, "}\n\n")
+			v.imports["fmt"] = true
+		}
+	}
+}
+
+// writeEnumCheck writes a statement returning err if an enum field of a raw
+// value, r, isn't one of its values. Values are numbered from zero so any
+// value less than the number of values is valid.
+func (v *visitor) writeEnumCheck(node *ast.StructType, err string, w io.Writer) {
+	var conds []string
+	for _, f := range node.Fields.List {
+		for _, n := range f.Names {
+			if e, ok := v.enums[n.Name]; ok && len(e.values) < 1<<bitsize(e.typ) {
+				conds = append(conds, fmt.Sprintf("r.%s >= %d", n.Name, len(e.values)))
+			}
+		}
+	}
+	if len(conds) == 0 {
+		return
+	}
+	fmt.Fprintf(w, "\tif %s {\n", strings.Join(conds, " || "))
+	fmt.Fprintf(w, "\t\treturn %s\n", err)
+	fmt.Fprintf(w, "\t}\n")
+}
+
+// writeEnumValueCheck writes a statement returning raw.ErrInvalidEnum if
+// expr, the decoded value of a field, isn't one of its values. Nothing is
+// written if the field isn't an enum.
+func (v *visitor) writeEnumValueCheck(name, expr string, w io.Writer) {
+	if e, ok := v.enums[name]; ok && len(e.values) < 1<<bitsize(e.typ) {
+		fmt.Fprintf(w, "\tif %s >= %d {\n", expr, len(e.values))
+		fmt.Fprintf(w, "\t\treturn %s.ErrInvalidEnum\n", v.pkg)
+		fmt.Fprintf(w, "\t}\n")
+	}
+}
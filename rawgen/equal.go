@@ -0,0 +1,90 @@
+package rawgen
+
+import (
+	"fmt"
+	"go/ast"
+	"io"
+	"strings"
+)
+
+// writeEqualFuncs writes a generated Equal method comparing each field of an
+// exported type and, if the type can be encoded, a Hash method returning the
+// 64-bit FNV-1a hash of its encoding. Hashes are stable for a given byte
+// order, so natively encoded records hash differently between platforms of
+// different endianness.
+func (v *visitor) writeEqualFuncs(exp string, node *ast.StructType, encode bool, w io.Writer) error {
+	for _, f := range node.Fields.List {
+		for _, n := range f.Names {
+			if name := v.fieldname(n.Name); name == "Equal" || name == "Hash" {
+				return fmt.Errorf("%s: exported name %s conflicts with generated %s method", n.Name, name, name)
+			}
+		}
+	}
+
+	fmt.Fprintf(w, "// Equal returns true if every field of o is equal to the same field of other.\n")
+	fmt.Fprintf(w, "func (o *%s) Equal(other *%s) bool {\n", exp, exp)
+	v.writeLoad("o", w)
+	v.writeLoad("other", w)
+	var exprs []string
+	for _, f := range node.Fields.List {
+		typ := tostr(f.Type)
+
+		// Embedded raw structs are compared with their own Equal method.
+		if len(f.Names) == 0 {
+			name, err := v.gotype(typ)
+			if err != nil {
+				return err
+			}
+			exprs = append(exprs, fmt.Sprintf("o.%s.Equal(&other.%s)", name, name))
+		}
+		for _, n := range f.Names {
+			name := v.fieldname(n.Name)
+			switch {
+			case v.isOptional(n.Name):
+				// Optional fields are equal if both are unset or their
+				// values are equal.
+				cmp := fmt.Sprintf("*o.%s == *other.%s", name, name)
+				if isTime(typ) {
+					cmp = fmt.Sprintf("o.%s.Equal(*other.%s)", name, name)
+				} else if typ == "raw.ZonedTime" {
+					cmp = fmt.Sprintf("%s.NewZonedTime(*o.%s) == %s.NewZonedTime(*other.%s)", v.pkg, name, v.pkg, name)
+				}
+				exprs = append(exprs, fmt.Sprintf("(o.%s == nil) == (other.%s == nil)", name, name), fmt.Sprintf("(o.%s == nil || %s)", name, cmp))
+			case v.nested[typ] != nil:
+				exprs = append(exprs, fmt.Sprintf("o.%s.Equal(&other.%s)", name, name))
+			case v.codecs[typ] != "":
+				exprs = append(exprs, fmt.Sprintf("reflect.DeepEqual(o.%s, other.%s)", name, name))
+				v.imports["reflect"] = true
+			case typ == "raw.ZonedTime":
+				// Zoned times are equal if their instants and offsets are.
+				exprs = append(exprs, fmt.Sprintf("%s.NewZonedTime(o.%s) == %s.NewZonedTime(other.%s)", v.pkg, name, v.pkg, name))
+			case isTime(typ):
+				exprs = append(exprs, fmt.Sprintf("o.%s.Equal(other.%s)", name, name))
+			case typ == "raw.Bytes":
+				exprs = append(exprs, fmt.Sprintf("bytes.Equal(o.%s, other.%s)", name, name))
+				v.imports["bytes"] = true
+			case typ == "raw.StringList", sliceElem(typ) != "":
+				exprs = append(exprs, fmt.Sprintf("slices.Equal(o.%s, other.%s)", name, name))
+				v.imports["slices"] = true
+			default:
+				exprs = append(exprs, fmt.Sprintf("o.%s == other.%s", name, name))
+			}
+		}
+	}
+	if len(exprs) == 0 {
+		exprs = append(exprs, "true")
+	}
+	fmt.Fprintf(w, "\treturn %s\n", strings.Join(exprs, " &&\n\t\t"))
+	fmt.Fprintf(w, "}\n\n")
+
+	if encode {
+		fmt.Fprintf(w, "// Hash returns the 64-bit FNV-1a hash of the encoding of o.\n")
+		fmt.Fprintf(w, "func (o *%s) Hash() uint64 {\n", exp)
+		fmt.Fprintf(w, "\th := fnv.New64a()\n")
+		fmt.Fprintf(w, "\th.Write(o.Encode())\n")
+		fmt.Fprintf(w, "\treturn h.Sum64()\n")
+		fmt.Fprintf(w, "}\n\n")
+		v.imports["hash/fnv"] = true
+	}
+	return nil
+}
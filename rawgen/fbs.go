@@ -0,0 +1,124 @@
+package rawgen
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+)
+
+// fbsTypes are the FlatBuffers types of fixed size raw types.
+var fbsTypes = map[string]string{
+	"bool":            "bool",
+	"int8":            "byte",
+	"int16":           "short",
+	"int32":           "int",
+	"int64":           "long",
+	"uint8":           "ubyte",
+	"uint16":          "ushort",
+	"uint32":          "uint",
+	"uint64":          "ulong",
+	"float32":         "float",
+	"float64":         "double",
+	"raw.Time":        "long",
+	"raw.TimeMicro":   "long",
+	"raw.TimeMilli":   "long",
+	"raw.TimeSec":     "uint",
+	"raw.Duration":    "long",
+	"raw.Presence":    "ulong",
+	"raw.Flags8":      "ubyte",
+	"raw.Flags16":     "ushort",
+	"raw.Flags32":     "uint",
+	"raw.NullInt64":   "long",
+	"raw.NullFloat64": "double",
+}
+
+// GenerateFlatBuffers returns a FlatBuffers schema declaring a table for each
+// raw struct in the Go source file, src, so consumers using FlatBuffers can
+// share its field definitions. FlatBuffers encodes tables differently, so the
+// raw layout of each struct and field is recorded with the raw_size and
+// raw_offset attributes for validating layouts instead. Returns nil if the
+// file has no raw structs.
+func (g *Generator) GenerateFlatBuffers(src []byte) ([]byte, error) {
+	s, err := g.Schema(src)
+	if err != nil {
+		return nil, err
+	} else if len(s.Structs) == 0 {
+		return nil, nil
+	}
+
+	var buf bytes.Buffer
+	fmt.Fprint(&buf, generatedHeader)
+	fmt.Fprintf(&buf, "// Records of package %s are encoded in %s byte order unless noted.\n\n", s.Package, s.Endian)
+	fmt.Fprintf(&buf, "namespace %s;\n\n", s.Package)
+	fmt.Fprint(&buf, "attribute \"raw_size\";\n")
+	fmt.Fprint(&buf, "attribute \"raw_offset\";\n")
+	for _, st := range s.Structs {
+		if err := writeFlatBuffersTable(st, &buf); err != nil {
+			return nil, fmt.Errorf("%s: %s", st.Name, err)
+		}
+	}
+	return buf.Bytes(), nil
+}
+
+// writeFlatBuffersTable writes the table for a raw struct. Times are
+// nanoseconds since the Unix epoch and durations are nanoseconds, as they
+// are in a record.
+func writeFlatBuffersTable(st *Struct, w io.Writer) error {
+	fmt.Fprint(w, "\n")
+	if _, ok := st.Pragmas["ctype"]; ok {
+		fmt.Fprintf(w, "/// Layout of the raw struct %s, encoded in big-endian byte order.\n", st.Name)
+	} else {
+		fmt.Fprintf(w, "/// Layout of the raw struct %s.\n", st.Name)
+	}
+	fmt.Fprintf(w, "table %s (raw_size: %d) {\n", st.Exported, st.Size)
+	for _, f := range st.Fields {
+		if f.Name == "_" {
+			continue
+		}
+		var typ string
+		switch elem := sliceElem(f.RawType); {
+		case fbsTypes[f.RawType] != "":
+			typ = fbsTypes[f.RawType]
+		case elem != "":
+			typ = "[" + fbsTypes[elem] + "]"
+		case f.RawType == "raw.StringList":
+			typ = "[string]"
+		case f.RawType == "raw.Bytes", arrayLen(f.RawType) > 0:
+			typ = "[ubyte]"
+		case stringWidth(f.RawType) > 0:
+			typ = "string"
+		default:
+			return fmt.Errorf("no FlatBuffers type for %s", f.RawType)
+		}
+
+		switch f.RawType {
+		case "raw.Time":
+			fmt.Fprint(w, "  /// Nanoseconds since the Unix epoch.\n")
+		case "raw.TimeMicro":
+			fmt.Fprint(w, "  /// Microseconds since the Unix epoch.\n")
+		case "raw.TimeMilli":
+			fmt.Fprint(w, "  /// Milliseconds since the Unix epoch.\n")
+		case "raw.TimeSec":
+			fmt.Fprint(w, "  /// Seconds since the Unix epoch.\n")
+		case "raw.Duration":
+			fmt.Fprint(w, "  /// Nanoseconds.\n")
+		case "raw.Presence":
+			fmt.Fprint(w, "  /// Bits set for each optional field with a value.\n")
+		}
+		if n := arrayLen(f.RawType); n > 0 {
+			fmt.Fprintf(w, "  /// Exactly %d bytes.\n", n)
+		}
+
+		// Optional and null scalars have no default so unset fields are
+		// null.
+		def := ""
+		if _, ok := f.Tag["optional"]; ok && fbsTypes[f.RawType] != "" {
+			def = " = null"
+		} else if _, ok := nullTypes[f.RawType]; ok && fbsTypes[f.RawType] != "" {
+			def = " = null"
+		}
+		fmt.Fprintf(w, "  %s: %s%s (raw_offset: %d, raw_size: %d);\n", f.Name, typ, def, f.Offset, f.Size)
+	}
+	fmt.Fprint(w, "}\n")
+	return nil
+}
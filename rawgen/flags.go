@@ -0,0 +1,138 @@
+package rawgen
+
+import (
+	"fmt"
+	"go/ast"
+	"go/token"
+	"io"
+	"strings"
+)
+
+// flagTypes are the raw flag types and the number of flags each holds.
+var flagTypes = map[string]int{"raw.Flags8": 8, "raw.Flags16": 16, "raw.Flags32": 32}
+
+// flagSet is a raw.Flags8, raw.Flags16, or raw.Flags32 field tagged with the
+// names of its flags, e.g. `raw:"flags=admin|active"`, which packs up to 32
+// bool values into a single field. Its exported field has a generated type,
+// such as UserPermsFlags, with a constant for each flag numbered from the
+// lowest bit, such as UserPermsAdmin, and a method getting and setting each
+// flag, such as Admin and SetAdmin.
+type flagSet struct {
+	name   string
+	prefix string
+	typ    string
+	values []string
+}
+
+// flagFields returns the flag fields of a raw struct, keyed by field name,
+// whose exported type is exp.
+func (v *visitor) flagFields(exp string, node *ast.StructType) (map[string]*flagSet, error) {
+	// Constants can't have the name of a function reading another field.
+	funcs := make(map[string]bool)
+	for _, f := range node.Fields.List {
+		for _, n := range f.Names {
+			funcs[exp+v.fieldname(n.Name)] = true
+		}
+	}
+
+	flags := make(map[string]*flagSet)
+	for _, f := range node.Fields.List {
+		typ := tostr(f.Type)
+		value, ok := parseTag(f)["flags"]
+		for _, n := range f.Names {
+			if !ok {
+				if _, isFlags := flagTypes[typ]; isFlags {
+					return nil, fmt.Errorf("%s: %s field requires a flags tag", n.Name, typ)
+				}
+				continue
+			}
+			bits, isFlags := flagTypes[typ]
+			if !isFlags {
+				return nil, fmt.Errorf("%s: flags requires a raw.Flags8, raw.Flags16, or raw.Flags32 field", n.Name)
+			}
+			prefix := exp + v.fieldname(n.Name)
+			fs := &flagSet{name: prefix + "Flags", prefix: prefix, typ: "uint" + strings.TrimPrefix(typ, "raw.Flags"), values: strings.Split(value, "|")}
+			if len(fs.values) > bits {
+				return nil, fmt.Errorf("%s: too many flags for %s: %d", n.Name, typ, len(fs.values))
+			}
+
+			// Each flag has a method getting and setting it, which can't
+			// conflict with each other or with String.
+			seen, methods := make(map[string]bool), map[string]bool{"String": true}
+			for _, value := range fs.values {
+				if !token.IsIdentifier(value) {
+					return nil, fmt.Errorf("%s: invalid flag: %q", n.Name, value)
+				} else if seen[tocamelcase(value)] {
+					return nil, fmt.Errorf("%s: duplicate flag: %s", n.Name, value)
+				} else if methods[tocamelcase(value)] || methods["Set"+tocamelcase(value)] {
+					return nil, fmt.Errorf("%s: flag %s conflicts with another method of %s", n.Name, value, fs.name)
+				} else if funcs[prefix+tocamelcase(value)] {
+					return nil, fmt.Errorf("%s: flag constant %s conflicts with generated %s function", n.Name, prefix+tocamelcase(value), prefix+tocamelcase(value))
+				}
+				seen[tocamelcase(value)] = true
+				methods[tocamelcase(value)], methods["Set"+tocamelcase(value)] = true, true
+			}
+			flags[n.Name] = fs
+		}
+	}
+	return flags, nil
+}
+
+// writeFlagTypes writes the generated type of each flag field of a raw
+// struct along with a constant for each of its flags, methods getting and
+// setting each flag, and a String method returning the names of the flags
+// that are set.
+func (v *visitor) writeFlagTypes(node *ast.StructType, w io.Writer) {
+	for _, f := range node.Fields.List {
+		for _, n := range f.Names {
+			fs, ok := v.flags[n.Name]
+			if !ok {
+				continue
+			}
+			fmt.Fprintf(w, "// %s is the type of the %s field.\n", fs.name, v.fieldname(n.Name))
+			fmt.Fprintf(w, "type %s %s\n\n", fs.name, fs.typ)
+
+			fmt.Fprintf(w, "const (\n")
+			for i, value := range fs.values {
+				if i == 0 {
+					fmt.Fprintf(w, "\t%s%s %s = 1 << iota\n", fs.prefix, tocamelcase(value), fs.name)
+				} else {
+					fmt.Fprintf(w, "\t%s%s\n", fs.prefix, tocamelcase(value))
+				}
+			}
+			fmt.Fprintf(w, ")\n\n")
+
+			for _, value := range fs.values {
+				c := fs.prefix + tocamelcase(value)
+				fmt.Fprintf(w, "// %s returns true if the %s flag is set.\n", tocamelcase(value), value)
+				fmt.Fprintf(w, "func (x %s) %s() bool { return x&%s != 0 }\n\n", fs.name, tocamelcase(value), c)
+				fmt.Fprintf(w, "// Set%s sets or clears the %s flag.\n", tocamelcase(value), value)
+				fmt.Fprintf(w, "func (x *%s) Set%s(v bool) {\n", fs.name, tocamelcase(value))
+				fmt.Fprintf(w, "\tif v {\n")
+				fmt.Fprintf(w, "\t\t*x |= %s\n", c)
+				fmt.Fprintf(w, "\t} else {\n")
+				fmt.Fprintf(w, "\t\t*x &^= %s\n", c)
+				fmt.Fprintf(w, "\t}\n")
+				fmt.Fprintf(w, "}\n\n")
+			}
+
+			fmt.Fprintf(w, "// String returns the names of the flags set in x separated by \"|\".\n")
+			fmt.Fprintf(w, "func (x %s) String() string {\n", fs.name)
+			fmt.Fprintf(w, "\tvar a []string\n")
+			for _, value := range fs.values {
+				fmt.Fprintf(w, "\tif x&%s%s != 0 {\n", fs.prefix, tocamelcase(value))
+				fmt.Fprintf(w, "\t\ta = append(a, %q)\n", value)
+				fmt.Fprintf(w, "\t}\n")
+			}
+			if len(fs.values) < bitsize(fs.typ) {
+				fmt.Fprintf(w, "\tif rest := x &^ (1<<%d - 1); rest != 0 {\n", len(fs.values))
+				fmt.Fprintf(w, "\t\ta = append(a, fmt.Sprintf(\"%%#x\", %s(rest)))\n", fs.typ)
+				fmt.Fprintf(w, "\t}\n")
+				v.imports["fmt"] = true
+			}
+			fmt.Fprintf(w, "\treturn strings.Join(a, \"|\")\n")
+			fmt.Fprintf(w, "}\n\n")
+			v.imports["strings"] = true
+		}
+	}
+}
@@ -0,0 +1,45 @@
+package rawgen
+
+import (
+	"fmt"
+	"go/ast"
+	"io"
+)
+
+// GenerateFuzzTests returns a Go test file for the package of the source file,
+// src, with a fuzz test feeding arbitrary bytes to the Decode method of each
+// raw struct. Records are read straight off disk so Decode must return an
+// error for corrupt data instead of panicking or reading out of bounds. A
+// record that decodes must also decode again after being re-encoded.
+//
+// Code must have been generated for the file, with the same Generator, before
+// the tests can be compiled.
+func (g *Generator) GenerateFuzzTests(src []byte) ([]byte, error) {
+	return g.generateTestFile(src, []string{"testing"}, g.writeFuzzTest)
+}
+
+// writeFuzzTest writes the fuzz test for a single raw struct. The corpus is
+// seeded with a valid record, a truncated record, and no data.
+func (g *Generator) writeFuzzTest(unexp, exp string, node *ast.StructType, pragmas map[string]string, w io.Writer) error {
+	if err := g.writeBenchRecord("newFuzz"+exp, exp, node, w); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(w, "func Fuzz%sDecode(f *testing.F) {\n", exp)
+	fmt.Fprintf(w, "\tb := newFuzz%s().Encode()\n", exp)
+	fmt.Fprintf(w, "\tf.Add(b)\n")
+	fmt.Fprintf(w, "\tf.Add(b[:len(b)/2])\n")
+	fmt.Fprintf(w, "\tf.Add([]byte{})\n")
+	fmt.Fprintf(w, "\tf.Fuzz(func(t *testing.T, b []byte) {\n")
+	fmt.Fprintf(w, "\t\tvar o %s\n", exp)
+	fmt.Fprintf(w, "\t\tif err := o.Decode(b); err != nil {\n")
+	fmt.Fprintf(w, "\t\t\treturn\n")
+	fmt.Fprintf(w, "\t\t}\n")
+	fmt.Fprintf(w, "\t\tvar other %s\n", exp)
+	fmt.Fprintf(w, "\t\tif err := other.Decode(o.Encode()); err != nil {\n")
+	fmt.Fprintf(w, "\t\t\tt.Fatalf(\"decode re-encoded record: %%s\", err)\n")
+	fmt.Fprintf(w, "\t\t}\n")
+	fmt.Fprintf(w, "\t})\n")
+	fmt.Fprintf(w, "}\n\n")
+	return nil
+}
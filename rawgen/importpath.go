@@ -0,0 +1,88 @@
+package rawgen
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// ImportPath returns the import path of the package in dir. If root is set,
+// it is used as the import path of the module root. Otherwise the module path
+// is read from the nearest go.mod file in dir or one of its parents.
+//
+// Generated code that lives outside of the package declaring the raw structs
+// uses this path to import it.
+func ImportPath(dir, root string) (string, error) {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return "", err
+	}
+	modroot, root, err := moduleRoot(dir, root)
+	if err != nil {
+		return "", err
+	}
+	rel, err := filepath.Rel(modroot, dir)
+	if err != nil {
+		return "", err
+	}
+	return path.Join(root, filepath.ToSlash(rel)), nil
+}
+
+// moduleRoot returns the module root of an absolute directory, which contains
+// the nearest go.mod file, along with its import path. If root is set, it is
+// used as the import path, and dir is the module root if there is no go.mod.
+func moduleRoot(dir, root string) (string, string, error) {
+	// Find the module root by searching up the tree for a go.mod file.
+	modroot := dir
+	for {
+		if _, err := os.Stat(filepath.Join(modroot, "go.mod")); err == nil {
+			break
+		} else if parent := filepath.Dir(modroot); parent == modroot {
+			if root == "" {
+				return "", "", fmt.Errorf("go.mod not found for %s: set a root import path", dir)
+			}
+			modroot = dir
+			break
+		} else {
+			modroot = parent
+		}
+	}
+
+	// Read the module path if a root import path is not set.
+	if root == "" {
+		b, err := ioutil.ReadFile(filepath.Join(modroot, "go.mod"))
+		if err != nil {
+			return "", "", err
+		}
+		if root = modulePath(b); root == "" {
+			return "", "", fmt.Errorf("module path not found: %s", filepath.Join(modroot, "go.mod"))
+		}
+	}
+	return modroot, root, nil
+}
+
+// modulePath returns the module path declared in a go.mod file.
+func modulePath(b []byte) string {
+	s := bufio.NewScanner(bytes.NewReader(b))
+	for s.Scan() {
+		line := strings.TrimSpace(s.Text())
+		if !strings.HasPrefix(line, "module") {
+			continue
+		}
+		line = strings.TrimSpace(strings.TrimPrefix(line, "module"))
+		if i := strings.Index(line, "//"); i != -1 {
+			line = strings.TrimSpace(line[:i])
+		}
+		if v, err := strconv.Unquote(line); err == nil {
+			return v
+		}
+		return line
+	}
+	return ""
+}
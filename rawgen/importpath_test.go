@@ -0,0 +1,74 @@
+package rawgen
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// Ensure that a package import path is resolved from the nearest go.mod.
+func TestImportPath_GoMod(t *testing.T) {
+	dir := mustTempDir(t)
+	defer os.RemoveAll(dir)
+
+	if err := ioutil.WriteFile(filepath.Join(dir, "go.mod"), []byte("// comment\nmodule example.com/app // app\n\ngo 1.21\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	pkg := filepath.Join(dir, "internal", "store")
+	if err := os.MkdirAll(pkg, 0700); err != nil {
+		t.Fatal(err)
+	}
+
+	if p, err := ImportPath(pkg, ""); err != nil {
+		t.Fatal(err)
+	} else if p != "example.com/app/internal/store" {
+		t.Fatalf("unexpected import path: %s", p)
+	}
+	if p, err := ImportPath(dir, ""); err != nil {
+		t.Fatal(err)
+	} else if p != "example.com/app" {
+		t.Fatalf("unexpected import path: %s", p)
+	}
+}
+
+// Ensure that a root import path overrides the module path.
+func TestImportPath_Root(t *testing.T) {
+	dir := mustTempDir(t)
+	defer os.RemoveAll(dir)
+
+	if err := ioutil.WriteFile(filepath.Join(dir, "go.mod"), []byte("module example.com/app\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	pkg := filepath.Join(dir, "store")
+	if err := os.MkdirAll(pkg, 0700); err != nil {
+		t.Fatal(err)
+	}
+
+	if p, err := ImportPath(pkg, "github.com/user/app"); err != nil {
+		t.Fatal(err)
+	} else if p != "github.com/user/app/store" {
+		t.Fatalf("unexpected import path: %s", p)
+	}
+}
+
+// Ensure that a root import path is used for a directory without a go.mod.
+func TestImportPath_NoGoMod(t *testing.T) {
+	dir := mustTempDir(t)
+	defer os.RemoveAll(dir)
+
+	if p, err := ImportPath(dir, "github.com/user/app"); err != nil {
+		t.Fatal(err)
+	} else if p != "github.com/user/app" {
+		t.Fatalf("unexpected import path: %s", p)
+	}
+}
+
+// mustTempDir returns a new temporary directory.
+func mustTempDir(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "bolt-rawgen-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
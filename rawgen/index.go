@@ -0,0 +1,118 @@
+package rawgen
+
+import (
+	"fmt"
+	"go/ast"
+	"io"
+)
+
+// indexFields returns the fields tagged with "index".
+func indexFields(node *ast.StructType) []*ast.Field {
+	var a []*ast.Field
+	for _, f := range node.Fields.List {
+		if _, ok := parseTag(f)["index"]; ok {
+			a = append(a, f)
+		}
+	}
+	return a
+}
+
+// writeIndexFuncs writes generated functions maintaining a bucket for each
+// field tagged with "index". An index bucket maps the sort-preserving key
+// encoding of a field's value to the key of the record with that value, so
+// each value refers to a single record and putting another record with it
+// fails. A Find function looks up a record by the value of each indexed field.
+func (v *visitor) writeIndexFuncs(unexp, exp, bucket string, node *ast.StructType, w io.Writer) error {
+	type index struct{ name, param, gotyp string }
+	var indexes []index
+	for _, f := range indexFields(node) {
+		typ := tostr(f.Type)
+		for _, n := range f.Names {
+			gotyp, err := v.fieldType(n.Name, typ)
+			if err != nil {
+				return err
+			}
+			name, param := v.fieldname(n.Name), keyParam(n.Name)
+			stmt, err := v.keyAppend(typ, param, false)
+			if err != nil {
+				return fmt.Errorf("%s: index %s", n.Name, err)
+			}
+			indexes = append(indexes, index{name, param, gotyp})
+
+			fmt.Fprintf(w, "// %s%sIndexBucket is the name of the bucket indexing %s records by %s.\n", exp, name, exp, name)
+			fmt.Fprintf(w, "const %s%sIndexBucket = %q\n\n", exp, name, bucket+"."+n.Name)
+
+			fmt.Fprintf(w, "func %s%sIndexKey(%s %s) []byte {\n", unexp, name, param, gotyp)
+			fmt.Fprintf(w, "\tvar b []byte\n")
+			fmt.Fprintf(w, "%s", stmt)
+			fmt.Fprintf(w, "\treturn b\n")
+			fmt.Fprintf(w, "}\n\n")
+
+			fmt.Fprintf(w, "// Find%sBy%s returns the record whose %s is %s, or nil if there is none.\n", exp, name, name, param)
+			fmt.Fprintf(w, "func Find%sBy%s(tx *bolt.Tx, %s %s) (*%s, error) {\n", exp, name, param, gotyp, exp)
+			fmt.Fprintf(w, "\tb := tx.Bucket([]byte(%s%sIndexBucket))\n", exp, name)
+			fmt.Fprintf(w, "\tif b == nil {\n")
+			fmt.Fprintf(w, "\t\treturn nil, nil\n")
+			fmt.Fprintf(w, "\t}\n")
+			fmt.Fprintf(w, "\tkey := b.Get(%s%sIndexKey(%s))\n", unexp, name, param)
+			fmt.Fprintf(w, "\tif key == nil {\n")
+			fmt.Fprintf(w, "\t\treturn nil, nil\n")
+			fmt.Fprintf(w, "\t}\n")
+			fmt.Fprintf(w, "\treturn Get%s(tx, key)\n", exp)
+			fmt.Fprintf(w, "}\n\n")
+		}
+	}
+
+	// Every value is checked before any entry changes so a record with a
+	// duplicate value leaves the indexes as they were.
+	fmt.Fprintf(w, "// reindex%s replaces the index entries of the encoded record, value, stored\n", exp)
+	fmt.Fprintf(w, "// under key with those of o. Returns an error wrapping %s.ErrDuplicateIndex,\n", v.pkg)
+	fmt.Fprintf(w, "// without changing any entry, if another record has an indexed value of o.\n")
+	fmt.Fprintf(w, "func reindex%s(tx *bolt.Tx, key, value []byte, o *%s) error {\n", exp, exp)
+	for _, idx := range indexes {
+		fmt.Fprintf(w, "\tif b := tx.Bucket([]byte(%s%sIndexBucket)); b != nil {\n", exp, idx.name)
+		fmt.Fprintf(w, "\t\tif k := b.Get(%s%sIndexKey(%s)); k != nil && !bytes.Equal(k, key) {\n", unexp, idx.name, v.fieldExpr("o", idx.name))
+		fmt.Fprintf(w, "\t\t\treturn fmt.Errorf(\"%%w: %%s\", %s.ErrDuplicateIndex, %s%sIndexBucket)\n", v.pkg, exp, idx.name)
+		fmt.Fprintf(w, "\t\t}\n")
+		fmt.Fprintf(w, "\t}\n")
+	}
+	fmt.Fprintf(w, "\tif err := unindex%s(tx, key, value); err != nil {\n", exp)
+	fmt.Fprintf(w, "\t\treturn err\n")
+	fmt.Fprintf(w, "\t}\n")
+	for _, idx := range indexes {
+		fmt.Fprintf(w, "\tif b, err := tx.CreateBucketIfNotExists([]byte(%s%sIndexBucket)); err != nil {\n", exp, idx.name)
+		fmt.Fprintf(w, "\t\treturn err\n")
+		fmt.Fprintf(w, "\t} else if err := b.Put(%s%sIndexKey(%s), key); err != nil {\n", unexp, idx.name, v.fieldExpr("o", idx.name))
+		fmt.Fprintf(w, "\t\treturn err\n")
+		fmt.Fprintf(w, "\t}\n")
+	}
+	fmt.Fprintf(w, "\treturn nil\n")
+	fmt.Fprintf(w, "}\n\n")
+
+	// Entries belonging to another record are kept.
+	fmt.Fprintf(w, "// unindex%s removes the index entries of the encoded record, value, stored\n", exp)
+	fmt.Fprintf(w, "// under key.\n")
+	fmt.Fprintf(w, "func unindex%s(tx *bolt.Tx, key, value []byte) error {\n", exp)
+	fmt.Fprintf(w, "\tif value == nil {\n")
+	fmt.Fprintf(w, "\t\treturn nil\n")
+	fmt.Fprintf(w, "\t}\n")
+	fmt.Fprintf(w, "\tvar o %s\n", exp)
+	fmt.Fprintf(w, "\tif err := o.Decode(value); err != nil {\n")
+	fmt.Fprintf(w, "\t\treturn err\n")
+	fmt.Fprintf(w, "\t}\n")
+	for _, idx := range indexes {
+		fmt.Fprintf(w, "\tif b := tx.Bucket([]byte(%s%sIndexBucket)); b != nil {\n", exp, idx.name)
+		fmt.Fprintf(w, "\t\tif k := %s%sIndexKey(%s); bytes.Equal(b.Get(k), key) {\n", unexp, idx.name, v.fieldExpr("o", idx.name))
+		fmt.Fprintf(w, "\t\t\tif err := b.Delete(k); err != nil {\n")
+		fmt.Fprintf(w, "\t\t\t\treturn err\n")
+		fmt.Fprintf(w, "\t\t\t}\n")
+		fmt.Fprintf(w, "\t\t}\n")
+		fmt.Fprintf(w, "\t}\n")
+	}
+	fmt.Fprintf(w, "\treturn nil\n")
+	fmt.Fprintf(w, "}\n\n")
+
+	v.imports["bytes"] = true
+	v.imports["fmt"] = true
+	return nil
+}
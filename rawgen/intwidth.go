@@ -0,0 +1,141 @@
+package rawgen
+
+import (
+	"fmt"
+	"go/ast"
+	"io"
+)
+
+// isIntType returns true if typ is int or uint, which raw structs can only
+// use when IntWidth is set.
+func (g *Generator) isIntType(typ string) bool {
+	return g.IntWidth != 0 && (typ == "int" || typ == "uint")
+}
+
+// isRawStruct returns true when a struct only has fields with raw types, or
+// int and uint fields if IntWidth is set.
+func (g *Generator) isRawStruct(node *ast.StructType) bool {
+	for _, f := range node.Fields.List {
+		if g.isIntType(tostr(f.Type)) {
+			continue
+		} else if !isRawStructType(&ast.StructType{Fields: &ast.FieldList{List: []*ast.Field{f}}}) {
+			return false
+		}
+	}
+	return true
+}
+
+// intFields returns the type, int or uint, of each int and uint field of a
+// struct by name.
+func (g *Generator) intFields(node *ast.StructType) map[string]string {
+	m := make(map[string]string)
+	for _, f := range node.Fields.List {
+		if typ := tostr(f.Type); g.isIntType(typ) {
+			for _, n := range f.Names {
+				m[n.Name] = typ
+			}
+		}
+	}
+	return m
+}
+
+// fixedInts returns a copy of a raw struct with its int and uint fields
+// replaced by the fixed width types they're encoded as, e.g. int64, so
+// portable code and fingerprints treat them like any other integer. Returns
+// the struct itself if it has none.
+func (g *Generator) fixedInts(node *ast.StructType) *ast.StructType {
+	if len(g.intFields(node)) == 0 {
+		return node
+	}
+	list := make([]*ast.Field, len(node.Fields.List))
+	for i, f := range node.Fields.List {
+		list[i] = f
+		if typ := tostr(f.Type); g.isIntType(typ) {
+			c := *f
+			c.Type = &ast.Ident{NamePos: f.Type.Pos(), Name: fmt.Sprintf("%s%d", typ, g.IntWidth)}
+			list[i] = &c
+		}
+	}
+	return &ast.StructType{Struct: node.Struct, Fields: &ast.FieldList{Opening: node.Fields.Opening, List: list, Closing: node.Fields.Closing}}
+}
+
+// writeIntWidthCheck writes compile-time assertions that int has a width of
+// IntWidth bits on the platform native code for a raw struct with int or uint
+// fields is compiled for, as they're mapped directly to records.
+func (v *visitor) writeIntWidthCheck(name string, w io.Writer) {
+	if len(v.ints) == 0 {
+		return
+	}
+	fmt.Fprintf(w, "// The int and uint fields of %s are encoded with a width of %d bits.\n", name, v.IntWidth)
+	fmt.Fprintf(w, "var _ [unsafe.Sizeof(int(0)) - %d]struct{}\n", v.IntWidth/8)
+	fmt.Fprintf(w, "var _ [%d - unsafe.Sizeof(int(0))]struct{}\n\n", v.IntWidth/8)
+	v.imports["unsafe"] = true
+}
+
+// narrowInts returns true if the int and uint fields of a raw struct are
+// encoded by portable code with a width of less than 64 bits, so encoding a
+// value can overflow.
+func (v *visitor) narrowInts() bool {
+	return v.portable() && len(v.ints) > 0 && v.IntWidth < 64
+}
+
+// writeOverflowFunc writes a generated checkOverflow method returning an
+// error wrapping raw.ErrOverflow if an int or uint field of an exported value
+// doesn't fit in IntWidth bits. Nothing is written unless encoding a value
+// can overflow.
+func (v *visitor) writeOverflowFunc(exp string, node *ast.StructType, w io.Writer) {
+	if !v.narrowInts() {
+		return
+	}
+	fmt.Fprintf(w, "// checkOverflow returns an error wrapping %s.ErrOverflow if an int or uint\n", v.pkg)
+	fmt.Fprintf(w, "// field of o doesn't fit in %d bits.\n", v.IntWidth)
+	fmt.Fprintf(w, "func (o *%s) checkOverflow() error {\n", exp)
+	for _, f := range node.Fields.List {
+		for _, n := range f.Names {
+			typ, ok := v.ints[n.Name]
+			if !ok {
+				continue
+			}
+			name := v.fieldname(n.Name)
+			expr := "o." + name
+			if v.isOptional(n.Name) {
+				fmt.Fprintf(w, "\tif o.%s != nil {\n", name)
+				fmt.Fprintf(w, "\t\tx := *o.%s\n", name)
+				expr = "x"
+			}
+			cond := fmt.Sprintf("uint64(%s) > 1<<%d-1", expr, v.IntWidth)
+			if typ == "int" {
+				cond = fmt.Sprintf("%s < -1<<%d || %s > 1<<%d-1", expr, v.IntWidth-1, expr, v.IntWidth-1)
+			}
+			fmt.Fprintf(w, "\tif %s {\n", cond)
+			fmt.Fprintf(w, "\t\treturn fmt.Errorf(\"%%w: %s does not fit in %d bits\", %s.ErrOverflow)\n", name, v.IntWidth, v.pkg)
+			fmt.Fprintf(w, "\t}\n")
+			if v.isOptional(n.Name) {
+				fmt.Fprintf(w, "\t}\n")
+			}
+		}
+	}
+	fmt.Fprintf(w, "\treturn nil\n")
+	fmt.Fprintf(w, "}\n\n")
+	v.imports["fmt"] = true
+}
+
+// writeIntDecodeCheck writes a statement returning an error wrapping
+// raw.ErrOverflow if expr, the decoded value of an int or uint field, was
+// truncated from the value encoded at offset, which only happens on platforms
+// where int is narrower than IntWidth.
+func (v *visitor) writeIntDecodeCheck(field, expr string, offset int, w io.Writer) {
+	typ, ok := v.ints[field]
+	if !ok || v.IntWidth < 64 {
+		return
+	}
+	value := fmt.Sprintf("%s.Uint64(b[%d:])", v.byteOrder(), offset)
+	if typ == "int" {
+		fmt.Fprintf(w, "\tif int64(%s) != int64(%s) {\n", expr, value)
+	} else {
+		fmt.Fprintf(w, "\tif uint64(%s) != %s {\n", expr, value)
+	}
+	fmt.Fprintf(w, "\t\treturn fmt.Errorf(\"%%w: %s does not fit in %s\", %s.ErrOverflow)\n", v.fieldname(field), typ, v.pkg)
+	fmt.Fprintf(w, "\t}\n")
+	v.imports["fmt"] = true
+}
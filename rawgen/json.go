@@ -0,0 +1,146 @@
+package rawgen
+
+import (
+	"fmt"
+	"go/ast"
+	"io"
+	"reflect"
+	"strconv"
+)
+
+// writeJSONFuncs writes generated MarshalJSON and UnmarshalJSON methods for
+// an exported type. Fields are keyed by their raw field name unless the raw
+// field has a json struct tag, which is used as-is. Times are formatted as
+// RFC 3339 and durations as nanoseconds, as encoding/json does by default.
+// Complex numbers, which encoding/json doesn't support, are encoded as an
+// array of their real and imaginary parts.
+func (v *visitor) writeJSONFuncs(unexp, exp string, node *ast.StructType, w io.Writer) error {
+	type field struct {
+		name, typ, tag string
+		part           string // float type of the parts of a complex number, if any
+		optional       bool
+	}
+	var fields []field
+	var late bool // whether optional complex fields are converted after the literal
+	for _, f := range node.Fields.List {
+		typ, err := v.gotype(tostr(f.Type))
+		if err != nil {
+			return err
+		}
+
+		// Embedded raw structs are kept under their own key. Embedding them
+		// would promote their JSON methods to the JSON type.
+		if len(f.Names) == 0 {
+			fields = append(fields, field{name: typ, typ: typ, tag: jsonTag(f, tostr(f.Type))})
+		}
+		for _, n := range f.Names {
+			typ, err := v.fieldType(n.Name, tostr(f.Type))
+			if err != nil {
+				return err
+			}
+			var part string
+			switch typ {
+			case "complex64":
+				typ, part = "[2]float32", "float32"
+			case "complex128":
+				typ, part = "[2]float64", "float64"
+			}
+			if v.isOptional(n.Name) {
+				fields = append(fields, field{v.fieldname(n.Name), "*" + typ, jsonTag(f, n.Name), part, true})
+				late = late || part != ""
+				continue
+			}
+			fields = append(fields, field{v.fieldname(n.Name), typ, jsonTag(f, n.Name), part, false})
+		}
+	}
+
+	// literal writes a literal of the JSON type holding the fields of o,
+	// except optional complex numbers, which are set by the statements
+	// written by setLate.
+	literal := func() {
+		for _, f := range fields {
+			switch {
+			case f.part == "":
+				fmt.Fprintf(w, "\t\t%s: o.%s,\n", f.name, f.name)
+			case !f.optional:
+				fmt.Fprintf(w, "\t\t%s: [2]%s{real(o.%s), imag(o.%s)},\n", f.name, f.part, f.name, f.name)
+			}
+		}
+	}
+	setLate := func() {
+		for _, f := range fields {
+			if f.part != "" && f.optional {
+				fmt.Fprintf(w, "\tif o.%s != nil {\n", f.name)
+				fmt.Fprintf(w, "\t\tv.%s = &[2]%s{real(*o.%s), imag(*o.%s)}\n", f.name, f.part, f.name, f.name)
+				fmt.Fprintf(w, "\t}\n")
+			}
+		}
+	}
+
+	fmt.Fprintf(w, "// %sJSON is the JSON representation of %s.\n", unexp, exp)
+	fmt.Fprintf(w, "type %sJSON struct {\n", unexp)
+	for _, f := range fields {
+		fmt.Fprintf(w, "\t%s %s `json:%s`\n", f.name, f.typ, strconv.Quote(f.tag))
+	}
+	fmt.Fprintf(w, "}\n\n")
+
+	fmt.Fprintf(w, "// MarshalJSON implements json.Marshaler.\n")
+	fmt.Fprintf(w, "func (o %s) MarshalJSON() ([]byte, error) {\n", exp)
+	v.writeLoad("o", w)
+	if late {
+		fmt.Fprintf(w, "\tv := %sJSON{\n", unexp)
+		literal()
+		fmt.Fprintf(w, "\t}\n")
+		setLate()
+		fmt.Fprintf(w, "\treturn json.Marshal(v)\n")
+	} else {
+		fmt.Fprintf(w, "\treturn json.Marshal(%sJSON{\n", unexp)
+		literal()
+		fmt.Fprintf(w, "\t})\n")
+	}
+	fmt.Fprintf(w, "}\n\n")
+
+	// Fields missing from the JSON keep their current values.
+	fmt.Fprintf(w, "// UnmarshalJSON implements json.Unmarshaler.\n")
+	fmt.Fprintf(w, "func (o *%s) UnmarshalJSON(b []byte) error {\n", exp)
+	v.writeLoad("o", w)
+	fmt.Fprintf(w, "\tv := %sJSON{\n", unexp)
+	literal()
+	fmt.Fprintf(w, "\t}\n")
+	setLate()
+	fmt.Fprintf(w, "\tif err := json.Unmarshal(b, &v); err != nil {\n")
+	fmt.Fprintf(w, "\t\treturn err\n")
+	fmt.Fprintf(w, "\t}\n")
+	for _, f := range fields {
+		switch {
+		case f.part == "":
+			fmt.Fprintf(w, "\to.%s = v.%s\n", f.name, f.name)
+		case !f.optional:
+			fmt.Fprintf(w, "\to.%s = complex(v.%s[0], v.%s[1])\n", f.name, f.name, f.name)
+		default:
+			fmt.Fprintf(w, "\tif v.%s != nil {\n", f.name)
+			fmt.Fprintf(w, "\t\tx := complex(v.%s[0], v.%s[1])\n", f.name, f.name)
+			fmt.Fprintf(w, "\t\to.%s = &x\n", f.name)
+			fmt.Fprintf(w, "\t} else {\n")
+			fmt.Fprintf(w, "\t\to.%s = nil\n", f.name)
+			fmt.Fprintf(w, "\t}\n")
+		}
+	}
+	fmt.Fprintf(w, "\treturn nil\n")
+	fmt.Fprintf(w, "}\n\n")
+
+	v.imports["encoding/json"] = true
+	return nil
+}
+
+// jsonTag returns the json struct tag of a raw field, defaulting to its name.
+func jsonTag(f *ast.Field, name string) string {
+	if f.Tag != nil {
+		if s, err := strconv.Unquote(f.Tag.Value); err == nil {
+			if tag, ok := reflect.StructTag(s).Lookup("json"); ok {
+				return tag
+			}
+		}
+	}
+	return name
+}
@@ -0,0 +1,371 @@
+package rawgen
+
+import (
+	"fmt"
+	"go/ast"
+	"io"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// keyPart is a field making up the key of a record.
+type keyPart struct {
+	field *ast.Field
+	ident *ast.Ident
+	pos   int
+}
+
+// keyFields returns the fields making up the key of a record in key order.
+// A single field is tagged with "key" while the fields of a composite key are
+// tagged with their position, e.g. "key=1" and "key=2".
+func keyFields(node *ast.StructType) ([]keyPart, error) {
+	var parts []keyPart
+	plain := false
+	for _, f := range node.Fields.List {
+		value, ok := parseTag(f)["key"]
+		if !ok {
+			continue
+		}
+		for _, n := range f.Names {
+			if plain || (value == "" && len(parts) > 0) {
+				return nil, fmt.Errorf("%s: only one field can be tagged as the key", n.Name)
+			}
+			p := keyPart{field: f, ident: n}
+			if value == "" {
+				plain = true
+			} else if x, err := strconv.Atoi(value); err != nil || x < 1 {
+				return nil, fmt.Errorf("%s: invalid key position: %s", n.Name, value)
+			} else if slices.ContainsFunc(parts, func(p keyPart) bool { return p.pos == x }) {
+				return nil, fmt.Errorf("%s: duplicate key position: %d", n.Name, x)
+			} else {
+				p.pos = x
+			}
+			parts = append(parts, p)
+		}
+	}
+	sort.Slice(parts, func(i, j int) bool { return parts[i].pos < parts[j].pos })
+	return parts, nil
+}
+
+// writeKeyFuncs writes a generated Key method returning the key of a record,
+// taken from the fields tagged with "key", along with functions building the
+// same key from values and parsing the values back out of a key. Keys are
+// encoded so they sort in the same order as their values, which lets bolt
+// iterate over records in key order. Composite keys also get a function
+// building the prefix shared by keys starting with the same values, for
+// scanning a range of records such as every record of a tenant.
+func (v *visitor) writeKeyFuncs(exp string, node *ast.StructType, w io.Writer) error {
+	parts, err := keyFields(node)
+	if err != nil || len(parts) == 0 {
+		return err
+	}
+	for _, other := range node.Fields.List {
+		for _, o := range other.Names {
+			if v.fieldname(o.Name) == "Key" {
+				return fmt.Errorf("%s: exported name Key conflicts with generated Key method", o.Name)
+			}
+		}
+	}
+
+	var names, params, gotyps, stmts, parses, zeros []string
+	for i, p := range parts {
+		typ := tostr(p.field.Type)
+		gotyp, err := v.fieldType(p.ident.Name, typ)
+		if err != nil {
+			return err
+		}
+		param, last := keyParam(p.ident.Name), i == len(parts)-1
+		stmt, err := v.keyAppend(typ, param, !last)
+		if err != nil {
+			return fmt.Errorf("%s: %s", p.ident.Name, err)
+		}
+		parse, err := v.keyParse(typ, gotyp, param, !last)
+		if err != nil {
+			return fmt.Errorf("%s: %s", p.ident.Name, err)
+		}
+		names, params, gotyps = append(names, v.fieldname(p.ident.Name)), append(params, param), append(gotyps, gotyp)
+		stmts, parses, zeros = append(stmts, stmt), append(parses, parse), append(zeros, zeroValue(gotyp))
+	}
+
+	// Arguments use the field names of the record in Key.
+	var args []string
+	for _, name := range names {
+		args = append(args, v.fieldExpr("o", name))
+	}
+	fmt.Fprintf(w, "// Key returns the key of o, encoded so keys sort in the same order as\n")
+	fmt.Fprintf(w, "// their %s values.\n", joinNames(names))
+	fmt.Fprintf(w, "func (o *%s) Key() []byte { return %sKeyFrom(%s) }\n\n", exp, exp, strings.Join(args, ", "))
+
+	for i := range parts {
+		fn := exp + "KeyFrom"
+		doc := fmt.Sprintf("// %s returns the key of %s records with the given %s.\n", fn, exp, joinNames(names))
+		if i < len(parts)-1 {
+			fn = exp + names[i] + "KeyPrefix"
+			doc = fmt.Sprintf("// %s returns the prefix of keys with the given %s.\n", fn, joinNames(names[:i+1]))
+		}
+		var decls []string
+		for j := 0; j <= i; j++ {
+			decls = append(decls, params[j]+" "+gotyps[j])
+		}
+		fmt.Fprint(w, doc)
+		fmt.Fprintf(w, "func %s(%s) []byte {\n", fn, strings.Join(decls, ", "))
+		fmt.Fprintf(w, "\tb := make([]byte, 0, %s)\n", keyCap(parts, params, i+1))
+		fmt.Fprintf(w, "%s", strings.Join(stmts[:i+1], ""))
+		fmt.Fprintf(w, "\treturn b\n")
+		fmt.Fprintf(w, "}\n\n")
+	}
+
+	var results []string
+	for i := range params {
+		results = append(results, params[i]+" "+gotyps[i])
+	}
+	zero := strings.Join(zeros, ", ")
+	fmt.Fprintf(w, "// Parse%sKey returns the %s values encoded in key.\n", exp, joinNames(names))
+	fmt.Fprintf(w, "func Parse%sKey(key []byte) (%s, err error) {\n", exp, strings.Join(results, ", "))
+	for _, parse := range parses {
+		fmt.Fprintf(w, "%s", strings.ReplaceAll(parse, "$zero", zero))
+	}
+	fmt.Fprintf(w, "\tif len(key) > 0 {\n")
+	fmt.Fprintf(w, "\t\treturn %s, fmt.Errorf(\"%%d trailing bytes in %s key\", len(key))\n", zero, exp)
+	fmt.Fprintf(w, "\t}\n")
+	fmt.Fprintf(w, "\treturn %s, nil\n", strings.Join(params, ", "))
+	fmt.Fprintf(w, "}\n\n")
+
+	v.imports["fmt"] = true
+	return nil
+}
+
+// keyCap returns an expression for the capacity of a key, or a prefix of a
+// key, made up of the first n parts.
+func keyCap(parts []keyPart, params []string, n int) string {
+	var size int
+	var exprs []string
+	for i, p := range parts[:n] {
+		typ := tostr(p.field.Type)
+		if stringWidth(typ) > 0 || typ == "raw.Bytes" {
+			exprs = append(exprs, "len("+params[i]+")")
+			if i < len(parts)-1 {
+				size += 2
+			}
+			continue
+		}
+		n, _ := sizeof(typ)
+		size += n
+	}
+	if size > 0 || len(exprs) == 0 {
+		exprs = append([]string{strconv.Itoa(size)}, exprs...)
+	}
+	return strings.Join(exprs, "+")
+}
+
+// joinNames joins field names for use in a sentence, e.g. "A, B and C".
+func joinNames(names []string) string {
+	if len(names) == 1 {
+		return names[0]
+	}
+	return strings.Join(names[:len(names)-1], ", ") + " and " + names[len(names)-1]
+}
+
+// keyAppend returns the statements appending the sort-preserving encoding of
+// expr, a value of the exported type, to b. Integers are big-endian with the
+// sign bit flipped so negative values sort first, and floats are flipped so
+// their bits sort in numeric order. Strings and byte arrays are appended as-is
+// unless terminate is set, as for all but the last field of a composite key.
+// Terminated values escape each zero byte as 0x00 0xFF and end with 0x00 0x01
+// so shorter values sort first and a value can't run into the next field.
+func (v *visitor) keyAppend(typ, expr string, terminate bool) (string, error) {
+	var buf strings.Builder
+	switch typ {
+	case "bool":
+		fmt.Fprintf(&buf, "\tif %s {\n", expr)
+		fmt.Fprintf(&buf, "\t\tb = append(b, 1)\n")
+		fmt.Fprintf(&buf, "\t} else {\n")
+		fmt.Fprintf(&buf, "\t\tb = append(b, 0)\n")
+		fmt.Fprintf(&buf, "\t}\n")
+	case "int8":
+		fmt.Fprintf(&buf, "\tb = append(b, byte(int8(%s))^0x80)\n", expr)
+	case "uint8":
+		fmt.Fprintf(&buf, "\tb = append(b, byte(%s))\n", expr)
+	case "int16", "int32", "int64":
+		bits := bitsize(typ)
+		fmt.Fprintf(&buf, "\tb = binary.BigEndian.AppendUint%d(b, uint%d(%s(%s))^1<<%d)\n", bits, bits, typ, expr, bits-1)
+		v.imports["encoding/binary"] = true
+	case "uint16", "uint32", "uint64":
+		bits := bitsize(typ)
+		fmt.Fprintf(&buf, "\tb = binary.BigEndian.AppendUint%d(b, uint%d(%s))\n", bits, bits, expr)
+		v.imports["encoding/binary"] = true
+	case "float32", "float64":
+		bits := bitsize(typ)
+		fmt.Fprintf(&buf, "\tif x := math.Float%dbits(%s); x>>%d == 1 {\n", bits, expr, bits-1)
+		fmt.Fprintf(&buf, "\t\tb = binary.BigEndian.AppendUint%d(b, ^x)\n", bits)
+		fmt.Fprintf(&buf, "\t} else {\n")
+		fmt.Fprintf(&buf, "\t\tb = binary.BigEndian.AppendUint%d(b, x^1<<%d)\n", bits, bits-1)
+		fmt.Fprintf(&buf, "\t}\n")
+		v.imports["encoding/binary"] = true
+		v.imports["math"] = true
+	case "raw.Time", "raw.TimeMicro", "raw.TimeMilli":
+		fmt.Fprintf(&buf, "\tb = binary.BigEndian.AppendUint64(b, uint64(%s)^1<<63)\n", timeUnix(typ, expr))
+		v.imports["encoding/binary"] = true
+	case "raw.TimeSec":
+		fmt.Fprintf(&buf, "\tb = binary.BigEndian.AppendUint32(b, uint32(%s))\n", timeUnix(typ, expr))
+		v.imports["encoding/binary"] = true
+	case "raw.Duration":
+		fmt.Fprintf(&buf, "\tb = binary.BigEndian.AppendUint64(b, uint64(%s)^1<<63)\n", expr)
+		v.imports["encoding/binary"] = true
+	case "raw.Int128":
+		fmt.Fprintf(&buf, "\tb = binary.BigEndian.AppendUint64(b, uint64(%s.Hi)^1<<63)\n", expr)
+		fmt.Fprintf(&buf, "\tb = binary.BigEndian.AppendUint64(b, %s.Lo)\n", expr)
+		v.imports["encoding/binary"] = true
+	case "raw.Uint128":
+		fmt.Fprintf(&buf, "\tb = binary.BigEndian.AppendUint64(b, %s.Hi)\n", expr)
+		fmt.Fprintf(&buf, "\tb = binary.BigEndian.AppendUint64(b, %s.Lo)\n", expr)
+		v.imports["encoding/binary"] = true
+	case "raw.String8", "raw.String", "raw.String32", "raw.Bytes":
+		if !terminate {
+			fmt.Fprintf(&buf, "\tb = append(b, %s...)\n", expr)
+			break
+		}
+		fmt.Fprintf(&buf, "\tfor _, c := range []byte(%s) {\n", expr)
+		fmt.Fprintf(&buf, "\t\tif b = append(b, c); c == 0 {\n")
+		fmt.Fprintf(&buf, "\t\t\tb = append(b, 0xff)\n")
+		fmt.Fprintf(&buf, "\t\t}\n")
+		fmt.Fprintf(&buf, "\t}\n")
+		fmt.Fprintf(&buf, "\tb = append(b, 0, 1)\n")
+	default:
+		if arrayLen(typ) == 0 {
+			return "", fmt.Errorf("key cannot be a %s field", typ)
+		}
+		fmt.Fprintf(&buf, "\tb = append(b, %s[:]...)\n", expr)
+	}
+	return buf.String(), nil
+}
+
+// keyParse returns the statements reading the value of a key field from the
+// front of key into name, a variable of the exported type gotyp, the inverse
+// of keyAppend. Returns "$zero" followed by io.ErrUnexpectedEOF if key is too
+// short, or by an error if a terminated field doesn't end with 0x00 0x01,
+// where $zero is replaced with the zero values returned by the parse function.
+func (v *visitor) keyParse(typ, gotyp, name string, terminated bool) (string, error) {
+	var buf strings.Builder
+	size, _ := sizeof(typ)
+	if n := arrayLen(typ); n > 0 {
+		size = n
+	} else if stringWidth(typ) > 0 || typ == "raw.Bytes" {
+		size = 0
+	}
+	if size > 0 {
+		fmt.Fprintf(&buf, "\tif len(key) < %d {\n", size)
+		fmt.Fprintf(&buf, "\t\treturn $zero, io.ErrUnexpectedEOF\n")
+		fmt.Fprintf(&buf, "\t}\n")
+		v.imports["io"] = true
+	}
+	bits := bitsize(typ)
+	switch typ {
+	case "bool":
+		fmt.Fprintf(&buf, "\t%s = key[0] != 0\n", name)
+	case "int8":
+		fmt.Fprintf(&buf, "\t%s = int(int8(key[0] ^ 0x80))\n", name)
+	case "uint8":
+		fmt.Fprintf(&buf, "\t%s = %s(key[0])\n", name, gotyp)
+	case "int16", "int32", "int64":
+		fmt.Fprintf(&buf, "\t%s = int(%s(binary.BigEndian.Uint%d(key) ^ 1<<%d))\n", name, typ, bits, bits-1)
+		v.imports["encoding/binary"] = true
+	case "uint16", "uint32", "uint64":
+		fmt.Fprintf(&buf, "\t%s = %s(binary.BigEndian.Uint%d(key))\n", name, gotyp, bits)
+		v.imports["encoding/binary"] = true
+	case "float32", "float64":
+		fmt.Fprintf(&buf, "\tif x := binary.BigEndian.Uint%d(key); x>>%d == 1 {\n", bits, bits-1)
+		fmt.Fprintf(&buf, "\t\t%s = math.Float%dfrombits(x ^ 1<<%d)\n", name, bits, bits-1)
+		fmt.Fprintf(&buf, "\t} else {\n")
+		fmt.Fprintf(&buf, "\t\t%s = math.Float%dfrombits(^x)\n", name, bits)
+		fmt.Fprintf(&buf, "\t}\n")
+		v.imports["encoding/binary"] = true
+		v.imports["math"] = true
+	case "raw.Time", "raw.TimeMicro", "raw.TimeMilli":
+		fmt.Fprintf(&buf, "\t%s = %s\n", name, timeValue(typ, "int64(binary.BigEndian.Uint64(key)^1<<63)"))
+		v.imports["encoding/binary"] = true
+		v.imports["time"] = true
+	case "raw.TimeSec":
+		fmt.Fprintf(&buf, "\t%s = %s\n", name, timeValue(typ, "int64(binary.BigEndian.Uint32(key))"))
+		v.imports["encoding/binary"] = true
+		v.imports["time"] = true
+	case "raw.Duration":
+		fmt.Fprintf(&buf, "\t%s = time.Duration(binary.BigEndian.Uint64(key) ^ 1<<63)\n", name)
+		v.imports["encoding/binary"] = true
+		v.imports["time"] = true
+	case "raw.Int128":
+		fmt.Fprintf(&buf, "\t%s = %s.Int128{Hi: int64(binary.BigEndian.Uint64(key) ^ 1<<63), Lo: binary.BigEndian.Uint64(key[8:])}\n", name, v.pkg)
+		v.imports["encoding/binary"] = true
+	case "raw.Uint128":
+		fmt.Fprintf(&buf, "\t%s = %s.Uint128{Hi: binary.BigEndian.Uint64(key), Lo: binary.BigEndian.Uint64(key[8:])}\n", name, v.pkg)
+		v.imports["encoding/binary"] = true
+	case "raw.String8", "raw.String", "raw.String32", "raw.Bytes":
+		conv := "string"
+		if typ == "raw.Bytes" {
+			conv = "[]byte"
+		}
+		if !terminated && conv == "string" {
+			fmt.Fprintf(&buf, "\t%s, key = string(key), nil\n", name)
+			break
+		} else if !terminated {
+			fmt.Fprintf(&buf, "\t%s, key = append([]byte(nil), key...), nil\n", name)
+			break
+		}
+		fmt.Fprintf(&buf, "\tvar %sBytes []byte\n", name)
+		fmt.Fprintf(&buf, "\tfor {\n")
+		fmt.Fprintf(&buf, "\t\ti := bytes.IndexByte(key, 0)\n")
+		fmt.Fprintf(&buf, "\t\tif i < 0 || i == len(key)-1 {\n")
+		fmt.Fprintf(&buf, "\t\t\treturn $zero, io.ErrUnexpectedEOF\n")
+		fmt.Fprintf(&buf, "\t\t}\n")
+		fmt.Fprintf(&buf, "\t\t%sBytes, key = append(%sBytes, key[:i]...), key[i+1:]\n", name, name)
+		fmt.Fprintf(&buf, "\t\tif key[0] != 0xff {\n")
+		fmt.Fprintf(&buf, "\t\t\tbreak\n")
+		fmt.Fprintf(&buf, "\t\t}\n")
+		fmt.Fprintf(&buf, "\t\t%sBytes, key = append(%sBytes, 0), key[1:]\n", name, name)
+		fmt.Fprintf(&buf, "\t}\n")
+		fmt.Fprintf(&buf, "\tif key[0] != 1 {\n")
+		fmt.Fprintf(&buf, "\t\treturn $zero, fmt.Errorf(\"invalid terminator after %s in key: %%#x\", key[0])\n", name)
+		fmt.Fprintf(&buf, "\t}\n")
+		fmt.Fprintf(&buf, "\t%s, key = %s(%sBytes), key[1:]\n", name, conv, name)
+		v.imports["bytes"] = true
+		v.imports["io"] = true
+		return buf.String(), nil
+	default:
+		if arrayLen(typ) == 0 {
+			return "", fmt.Errorf("key cannot be a %s field", typ)
+		}
+		fmt.Fprintf(&buf, "\tcopy(%s[:], key)\n", name)
+	}
+	if size > 0 {
+		fmt.Fprintf(&buf, "\tkey = key[%d:]\n", size)
+	}
+	return buf.String(), nil
+}
+
+// zeroValue returns the zero value of an exported field type.
+func zeroValue(gotyp string) string {
+	switch {
+	case gotyp == "bool":
+		return "false"
+	case gotyp == "string":
+		return `""`
+	case gotyp == "time.Time" || gotyp == "netip.Addr" || strings.HasSuffix(gotyp, ".Decimal") || strings.HasSuffix(gotyp, ".Int128") || strings.HasSuffix(gotyp, ".Uint128") || strings.HasPrefix(gotyp, "["):
+		if strings.HasPrefix(gotyp, "[]") {
+			return "nil"
+		}
+		return gotyp + "{}"
+	}
+	return "0"
+}
+
+// keyParam returns the parameter name used for a key field so it doesn't
+// shadow the identifiers used by the generated key functions.
+func keyParam(name string) string {
+	switch name {
+	case "b", "c", "i", "x", "tx", "key", "err", "binary", "bytes", "fmt", "io", "math", "time":
+		return name + "Value"
+	}
+	return name
+}
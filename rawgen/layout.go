@@ -0,0 +1,142 @@
+package rawgen
+
+import (
+	"go/ast"
+	"go/types"
+)
+
+// slot describes the position of a single field within a struct.
+type slot struct {
+	ident  *ast.Ident
+	typ    string
+	offset int
+	size   int
+	pad    int // padding inserted before the field
+}
+
+// structLayout describes the memory layout of a struct.
+type structLayout struct {
+	slots []slot
+	size  int
+	tail  int // padding inserted after the last field
+}
+
+// target describes the sizes of a platform whose layout raw structs are
+// encoded with.
+type target struct {
+	word  int // size of int, uint, and uintptr
+	align int // largest alignment of a field
+}
+
+// target64 is the layout of 64-bit platforms, such as amd64 and arm64.
+var target64 = target{word: 8, align: 8}
+
+// target returns the platform whose layout records are encoded with, which
+// is set by Arch. Defaults to 64-bit platforms.
+func (g *Generator) target() target {
+	sizes := types.SizesFor("gc", g.Arch)
+	if g.Arch == "" || sizes == nil {
+		return target64
+	}
+	return target{word: int(sizes.Sizeof(types.Typ[types.Int])), align: int(sizes.Alignof(types.Typ[types.Int64]))}
+}
+
+// layout returns the layout of a struct on the platform set by Arch.
+func (g *Generator) layout(node *ast.StructType) (structLayout, bool) {
+	return layoutFor(node, g.target())
+}
+
+// layoutOf returns the layout of a struct on 64-bit platforms, including any
+// padding inserted by the compiler. Returns false if the size of a field type
+// is not known.
+func layoutOf(node *ast.StructType) (structLayout, bool) {
+	return layoutFor(node, target64)
+}
+
+// layoutFor returns the layout of a struct on a target platform, including
+// any padding inserted by the compiler. Returns false if the size of a field
+// type is not known.
+func layoutFor(node *ast.StructType, t target) (structLayout, bool) {
+	var l structLayout
+	maxAlign := 1
+	for _, f := range node.Fields.List {
+		typ := tostr(f.Type)
+		size, align := sizeofFor(typ, t)
+		if size == 0 {
+			return l, false
+		}
+		if align > maxAlign {
+			maxAlign = align
+		}
+		for _, n := range f.Names {
+			pad := (align - l.size%align) % align
+			l.size += pad
+			l.slots = append(l.slots, slot{ident: n, typ: typ, offset: l.size, size: size, pad: pad})
+			l.size += size
+		}
+	}
+
+	// Structs are padded to a multiple of their largest alignment.
+	l.tail = (maxAlign - l.size%maxAlign) % maxAlign
+	l.size += l.tail
+	return l, true
+}
+
+// sizeofFor returns the size and alignment of a raw type on a target
+// platform. 64-bit fields are only aligned to 4 bytes on most 32-bit
+// platforms, which also drops the padding at the end of raw types holding
+// them. Returns zero for unknown types.
+func sizeofFor(typ string, t target) (size, align int) {
+	switch typ {
+	case "int", "uint", "uintptr":
+		return t.word, t.word
+	}
+	size, align = sizeof(typ)
+	if align <= t.align {
+		return size, align
+	}
+	switch typ {
+	case "raw.ZonedTime", "raw.Decimal":
+		size = 12
+	case "raw.NullInt64", "raw.NullFloat64":
+		size = 9
+	}
+	return (size + t.align - 1) / t.align * t.align, t.align
+}
+
+// sizeof returns the size and alignment of a raw type on 64-bit platforms.
+// Returns zero for unknown types.
+func sizeof(typ string) (size, align int) {
+	switch typ {
+	case "bool", "int8", "uint8", "raw.Flags8":
+		return 1, 1
+	case "int16", "uint16", "raw.Flags16":
+		return 2, 2
+	case "int32", "uint32", "float32", "raw.TimeSec", "raw.Flags32":
+		return 4, 4
+	case "complex64":
+		return 8, 4
+	case "int64", "uint64", "float64", "int", "uint", "uintptr", "raw.Time", "raw.TimeMicro", "raw.TimeMilli", "raw.Duration", "raw.Presence":
+		return 8, 8
+	case "raw.String8":
+		return 2, 1
+	case "raw.String", "raw.Bytes":
+		return 4, 2
+	case "raw.String32":
+		return 8, 4
+	case "raw.ZonedTime":
+		return 16, 8
+	case "raw.IP":
+		return 17, 1
+	case "complex128", "raw.Decimal", "raw.Int128", "raw.Uint128", "raw.NullInt64", "raw.NullFloat64":
+		return 16, 8
+	case "raw.StringList", "raw.NullString":
+		return 6, 2
+	}
+	if n := arrayLen(typ); n > 0 {
+		return n, 1
+	} else if sliceElem(typ) != "" {
+		return 4, 2
+	}
+	return 0, 0
+}
@@ -0,0 +1,112 @@
+package rawgen
+
+import (
+	"fmt"
+	"go/ast"
+	"io"
+)
+
+// validateLazy returns an error if a raw struct with the "lazy" pragma can't
+// be decoded lazily. Each field has a bit recording whether it's decoded so
+// there can be at most 64 of them.
+func (v *visitor) validateLazy(node *ast.StructType, pragmas map[string]string) error {
+	if v.portable() {
+		return fmt.Errorf("lazy is not supported with portable encoding")
+	} else if _, ok := pragmas["ctype"]; ok {
+		return fmt.Errorf("lazy is not supported with ctype")
+	}
+	var n int
+	for _, f := range node.Fields.List {
+		if len(f.Names) == 0 {
+			return fmt.Errorf("embedded raw structs are not supported with lazy")
+		}
+		for _, name := range f.Names {
+			if v.fieldname(name.Name) == "Load" {
+				return fmt.Errorf("%s: exported name Load conflicts with generated Load method", name.Name)
+			}
+			n++
+		}
+	}
+	if n > 64 {
+		return fmt.Errorf("lazy supports at most 64 fields")
+	}
+	return nil
+}
+
+// retainsBytes returns true if decoded values of a raw struct share memory
+// with the bytes they were decoded from, so bytes that are only valid for a
+// while, such as bolt values, must be copied before decoding.
+func retainsBytes(pragmas map[string]string) bool {
+	_, retain := pragmas["retain"]
+	_, lazy := pragmas["lazy"]
+	return retain || lazy
+}
+
+// writeLoad writes a statement decoding the remaining fields of recv, a lazily
+// decoded exported value, before generated code reads or sets its fields.
+func (v *visitor) writeLoad(recv string, w io.Writer) {
+	if v.lazy {
+		fmt.Fprintf(w, "\t%s.Load()\n", recv)
+	}
+}
+
+// fieldExpr returns an expression reading the field, name, of recv, which
+// is read with its getter if the exported value is decoded lazily.
+func (v *visitor) fieldExpr(recv, name string) string {
+	if v.lazy {
+		return recv + ".Get" + name + "()"
+	}
+	return recv + "." + name
+}
+
+// writeLazyFuncs writes the generated getters and setters of a lazily decoded
+// exported type. Decode keeps the record and each getter decodes its field
+// the first time it's called, setting a bit in o.loaded. Setters set the bit
+// too so a field that's set isn't overwritten by the record.
+func (v *visitor) writeLazyFuncs(unexp, exp string, node *ast.StructType, w io.Writer) error {
+	var names []string
+	for _, f := range node.Fields.List {
+		typ := tostr(f.Type)
+		for _, n := range f.Names {
+			ftyp, err := v.fieldType(n.Name, typ)
+			if err != nil {
+				return err
+			}
+			bit, name := len(names), v.fieldname(n.Name)
+			names = append(names, name)
+			if v.isOptional(n.Name) {
+				ftyp = "*" + ftyp
+			}
+
+			fmt.Fprintf(w, "// Get%s returns the %s field of o, decoding it on first use.\n", name, name)
+			fmt.Fprintf(w, "func (o *%s) Get%s() %s {\n", exp, name, ftyp)
+			fmt.Fprintf(w, "\tif o.lazy != nil && o.loaded&(1<<%d) == 0 {\n", bit)
+			fmt.Fprintf(w, "\t\tr := (*%s)(unsafe.Pointer(&o.lazy[0]))\n", unexp)
+			v.writeDecodeField(n.Name, typ, "o.lazy", w)
+			fmt.Fprintf(w, "\t\to.loaded |= 1 << %d\n", bit)
+			fmt.Fprintf(w, "\t}\n")
+			fmt.Fprintf(w, "\treturn o.%s\n", name)
+			fmt.Fprintf(w, "}\n\n")
+
+			fmt.Fprintf(w, "// Set%s sets the %s field of o.\n", name, name)
+			fmt.Fprintf(w, "func (o *%s) Set%s(x %s) {\n", exp, name, ftyp)
+			fmt.Fprintf(w, "\to.%s = x\n", name)
+			fmt.Fprintf(w, "\to.loaded |= 1 << %d\n", bit)
+			fmt.Fprintf(w, "}\n\n")
+		}
+	}
+
+	fmt.Fprintf(w, "// Load decodes the fields of o that haven't been decoded yet, after which\n")
+	fmt.Fprintf(w, "// o no longer shares memory with the bytes it was decoded from. Fields must\n")
+	fmt.Fprintf(w, "// be loaded before they're read or set directly.\n")
+	fmt.Fprintf(w, "func (o *%s) Load() {\n", exp)
+	fmt.Fprintf(w, "\tif o.lazy == nil {\n")
+	fmt.Fprintf(w, "\t\treturn\n")
+	fmt.Fprintf(w, "\t}\n")
+	for _, name := range names {
+		fmt.Fprintf(w, "\to.Get%s()\n", name)
+	}
+	fmt.Fprintf(w, "\to.lazy, o.loaded = nil, 0\n")
+	fmt.Fprintf(w, "}\n\n")
+	return nil
+}
@@ -0,0 +1,125 @@
+package rawgen
+
+import (
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"unicode"
+)
+
+// Issue represents a risky raw struct pattern found by Lint.
+type Issue struct {
+	Pos token.Position
+	Msg string
+}
+
+// String returns the issue prefixed by its file and line.
+func (i Issue) String() string {
+	return fmt.Sprintf("%s:%d: %s", i.Pos.Filename, i.Pos.Line, i.Msg)
+}
+
+// Lint parses a file and returns risky patterns found in structs that use raw
+// types. No code is generated. If src is nil, the file is read from filename.
+func Lint(filename string, src []byte) ([]Issue, error) {
+	fset := token.NewFileSet()
+	var f *ast.File
+	var err error
+	if src == nil {
+		f, err = parser.ParseFile(fset, filename, nil, 0)
+	} else {
+		f, err = parser.ParseFile(fset, filename, src, 0)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var issues []Issue
+	ast.Inspect(f, func(node ast.Node) bool {
+		if spec, ok := node.(*ast.TypeSpec); ok {
+			if s, ok := spec.Type.(*ast.StructType); ok && usesRawTypes(s) {
+				issues = append(issues, lintStruct(fset, spec.Name, s)...)
+			}
+		}
+		return true
+	})
+	return issues, nil
+}
+
+// lintStruct returns the risky patterns found in a single raw struct.
+func lintStruct(fset *token.FileSet, name *ast.Ident, node *ast.StructType) []Issue {
+	var issues []Issue
+	report := func(pos token.Pos, format string, v ...interface{}) {
+		issues = append(issues, Issue{fset.Position(pos), fmt.Sprintf(format, v...)})
+	}
+
+	if unicode.IsUpper(rune(name.Name[0])) {
+		report(name.Pos(), "raw struct %s is exported; raw structs must be unexported", name.Name)
+	}
+
+	var hasString bool
+	for _, f := range node.Fields.List {
+		typ := tostr(f.Type)
+
+		switch t := f.Type.(type) {
+		case *ast.StarExpr:
+			report(f.Pos(), "pointer field %s cannot be stored raw", fieldNames(f))
+		case *ast.MapType:
+			report(f.Pos(), "map field %s cannot be stored raw", fieldNames(f))
+		case *ast.Ident:
+			if t.Name == "int" || t.Name == "uint" || t.Name == "uintptr" {
+				report(f.Pos(), "field %s has platform-dependent width %s; use a sized type such as %s64", fieldNames(f), t.Name, t.Name)
+			}
+		}
+
+		if (typ == "raw.String" || typ == "raw.StringList") && !hasString {
+			hasString = true
+			report(f.Pos(), "string field %s uses 16-bit offsets; the encoded record must stay under 64KB", fieldNames(f))
+		} else if typ == "raw.Bytes" && !hasString {
+			hasString = true
+			report(f.Pos(), "bytes field %s uses 16-bit offsets; the encoded record must stay under 64KB", fieldNames(f))
+		} else if typ == "raw.String8" && !hasString {
+			hasString = true
+			report(f.Pos(), "string field %s uses 8-bit offsets; the encoded record must stay under 256 bytes", fieldNames(f))
+		}
+
+	}
+
+	// Report compiler-inserted padding.
+	if l, ok := layoutOf(node); ok {
+		for _, sl := range l.slots {
+			if sl.pad > 0 {
+				report(sl.ident.Pos(), "%d byte(s) of padding before field %s; order fields by decreasing size", sl.pad, sl.ident.Name)
+			}
+		}
+		if l.tail > 0 {
+			last := l.slots[len(l.slots)-1].ident
+			report(last.Pos(), "%d byte(s) of trailing padding after field %s; order fields by decreasing size", l.tail, last.Name)
+		}
+	}
+
+	return issues
+}
+
+// usesRawTypes returns true if any field of a struct uses a type from the raw
+// package.
+func usesRawTypes(node *ast.StructType) bool {
+	for _, f := range node.Fields.List {
+		if sel, ok := f.Type.(*ast.SelectorExpr); ok && tostr(sel.X) == "raw" {
+			return true
+		}
+	}
+	return false
+}
+
+// fieldNames returns a comma-separated list of the names of a field.
+func fieldNames(f *ast.Field) string {
+	var s string
+	for i, n := range f.Names {
+		if i > 0 {
+			s += ", "
+		}
+		s += n.Name
+	}
+	return s
+}
@@ -0,0 +1,49 @@
+package rawgen
+
+import (
+	"strings"
+	"testing"
+)
+
+// Ensure that lint reports each risky pattern with its file and line.
+func TestLint(t *testing.T) {
+	for _, tt := range []struct {
+		src string
+		msg string
+	}{
+		{"type Foo struct {\n\tname raw.String\n}", "foo.go:3: raw struct Foo is exported"},
+		{"type foo struct {\n\tid int\n\tname raw.String\n}", "foo.go:4: field id has platform-dependent width int"},
+		{"type foo struct {\n\tname raw.String\n}", "foo.go:4: string field name uses 16-bit offsets"},
+		{"type foo struct {\n\tname raw.String\n\tp *int64\n}", "foo.go:5: pointer field p cannot be stored raw"},
+		{"type foo struct {\n\tname raw.String\n\tm map[string]int64\n}", "foo.go:5: map field m cannot be stored raw"},
+		{"type foo struct {\n\tok bool\n\tt raw.Time\n}", "foo.go:5: 7 byte(s) of padding before field t"},
+		{"type foo struct {\n\tt raw.Time\n\tok bool\n}", "foo.go:5: 7 byte(s) of trailing padding after field ok"},
+	} {
+		issues := mustLint(t, tt.src)
+		var found bool
+		for _, issue := range issues {
+			if strings.HasPrefix(issue.String(), tt.msg) {
+				found = true
+			}
+		}
+		if !found {
+			t.Errorf("%q: expected issue %q, got: %v", tt.src, tt.msg, issues)
+		}
+	}
+}
+
+// Ensure that a well-ordered raw struct has no issues.
+func TestLint_OK(t *testing.T) {
+	if issues := mustLint(t, "type foo struct {\n\tt raw.Time\n\tn int32\n\tm int32\n}"); len(issues) != 0 {
+		t.Fatalf("unexpected issues: %v", issues)
+	}
+}
+
+// mustLint lints src as the body of a file named foo.go.
+func mustLint(t *testing.T, src string) []Issue {
+	issues, err := Lint("foo.go", []byte("package foo\n\n"+src+"\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return issues
+}
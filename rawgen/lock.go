@@ -0,0 +1,114 @@
+package rawgen
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha1"
+	"fmt"
+	"go/ast"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+)
+
+// LockFile is the default name of the file recording struct layouts.
+const LockFile = "rawgen.lock"
+
+// Lock records the layout fingerprint of raw structs by key. Comparing the
+// fingerprints of the current source against a lock detects layout changes,
+// such as reordered fields, that make previously encoded data unreadable.
+type Lock map[string]string
+
+// ReadLock reads a lock from a file. A missing file returns an empty lock.
+func ReadLock(path string) (Lock, error) {
+	l := make(Lock)
+	b, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return l, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	s := bufio.NewScanner(bytes.NewReader(b))
+	for s.Scan() {
+		line := strings.TrimSpace(s.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("invalid lock entry: %q", line)
+		}
+		l[fields[0]] = fields[1]
+	}
+	return l, s.Err()
+}
+
+// Write writes the lock to a file, sorted by key.
+func (l Lock) Write(path string) error {
+	var keys []string
+	for k := range l {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var buf bytes.Buffer
+	fmt.Fprintln(&buf, "# This file has been generated by bolt-rawgen. DO NOT EDIT.")
+	for _, k := range keys {
+		fmt.Fprintf(&buf, "%s %s\n", k, l[k])
+	}
+	return ioutil.WriteFile(path, buf.Bytes(), 0644)
+}
+
+// Check returns an error if a fingerprint differs from the one recorded for
+// a key. Keys that are not recorded are added to the lock.
+func (l Lock) Check(key, fingerprint string) error {
+	if prev, ok := l[key]; !ok {
+		l[key] = fingerprint
+	} else if prev != fingerprint {
+		return fmt.Errorf("layout of %s has changed since it was locked; migrate existing data and update the lock", key)
+	}
+	return nil
+}
+
+// Fingerprints returns the layout fingerprint of each raw struct in a file,
+// by struct name. The fingerprint covers the name and type of every field in
+// declaration order.
+func (g *Generator) Fingerprints(src []byte) (map[string]string, error) {
+	b, err := strip(src)
+	if err != nil {
+		return nil, err
+	}
+	_, f, _, err := g.parse(b)
+	if err != nil {
+		return nil, err
+	}
+
+	m := make(map[string]string)
+	ast.Inspect(f, func(node ast.Node) bool {
+		if spec, ok := node.(*ast.TypeSpec); ok {
+			if s, ok := spec.Type.(*ast.StructType); ok && g.isRawStruct(s) {
+				m[spec.Name.Name] = fingerprint(g.fixedInts(s))
+			}
+		}
+		return true
+	})
+	return m, nil
+}
+
+// fingerprint returns a hash of the physical layout of a raw struct. Blank
+// fields declaring the padding the compiler would insert anyway are left
+// out, so declaring it doesn't change the fingerprint.
+func fingerprint(node *ast.StructType) string {
+	if onlyPadding(node) {
+		node = withoutBlank(node)
+	}
+	h := sha1.New()
+	for _, f := range node.Fields.List {
+		for _, n := range f.Names {
+			fmt.Fprintf(h, "%s %s;", n.Name, tostr(f.Type))
+		}
+	}
+	return fmt.Sprintf("%x", h.Sum(nil))[:16]
+}
@@ -0,0 +1,83 @@
+package rawgen
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// Ensure that reordering the fields of a locked struct is detected.
+func TestLock_Reorder(t *testing.T) {
+	dir := mustTempDir(t)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, LockFile)
+
+	// Lock the original layout.
+	l, err := ReadLock(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, fp := range mustFingerprints(t, "type user struct {\n\tid int64\n\tage int32\n\tname raw.String\n}") {
+		if err := l.Check("models."+name, fp); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := l.Write(path); err != nil {
+		t.Fatal(err)
+	}
+
+	// Regenerating the same layout, including previously generated code, is fine.
+	src, err := GenerateFile([]byte("package foo\n\nimport \"github.com/boltdb/raw\"\n\ntype user struct {\n\tid int64\n\tage int32\n\tname raw.String\n}\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	fps, err := (&Generator{}).Fingerprints(src)
+	if err != nil {
+		t.Fatal(err)
+	} else if len(fps) != 1 {
+		t.Fatalf("unexpected fingerprints: %v", fps)
+	}
+	if l, err = ReadLock(path); err != nil {
+		t.Fatal(err)
+	} else if err := l.Check("models.user", fps["user"]); err != nil {
+		t.Fatal(err)
+	}
+
+	// Reordering fields changes the layout.
+	fps = mustFingerprints(t, "type user struct {\n\tage int32\n\tid int64\n\tname raw.String\n}")
+	if err := l.Check("models.user", fps["user"]); err == nil || !strings.Contains(err.Error(), "layout of models.user has changed") {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// Updating the lock accepts the new layout.
+	l["models.user"] = fps["user"]
+	if err := l.Write(path); err != nil {
+		t.Fatal(err)
+	} else if l, err = ReadLock(path); err != nil {
+		t.Fatal(err)
+	} else if err := l.Check("models.user", fps["user"]); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// Ensure that structs using different names for the same type layout match.
+func TestFingerprints_Alias(t *testing.T) {
+	a := mustFingerprints(t, "type user struct {\n\tname raw.String\n}")
+	g := &Generator{ImportPaths: []string{"example.com/raw"}}
+	b, err := g.Fingerprints([]byte("package foo\n\nimport r \"example.com/raw\"\n\ntype user struct {\n\tname r.String\n}\n"))
+	if err != nil {
+		t.Fatal(err)
+	} else if a["user"] == "" || a["user"] != b["user"] {
+		t.Fatalf("fingerprint mismatch: %v != %v", a, b)
+	}
+}
+
+// mustFingerprints returns the fingerprints of src as the body of a file.
+func mustFingerprints(t *testing.T, src string) map[string]string {
+	m, err := (&Generator{}).Fingerprints([]byte("package foo\n\nimport \"github.com/boltdb/raw\"\n\n" + src + "\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return m
+}
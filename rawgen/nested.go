@@ -0,0 +1,155 @@
+package rawgen
+
+import (
+	"fmt"
+	"go/ast"
+	"go/token"
+	"io"
+)
+
+// findNested adds the unexported raw structs of a file that are used as field
+// types of other raw structs to the visitor's codecs, mapped to their exported
+// types. A struct is only nested if all of its own fields are raw, including
+// any nested raw structs. Skipped and C structs are never nested.
+func (v *visitor) findNested(f *ast.File) {
+	structs := make(map[string]*ast.StructType)
+	candidates := make(map[string]*ast.StructType)
+	for _, decl := range f.Decls {
+		d, ok := decl.(*ast.GenDecl)
+		if !ok || d.Tok != token.TYPE {
+			continue
+		}
+		for _, spec := range d.Specs {
+			spec := spec.(*ast.TypeSpec)
+			s, ok := spec.Type.(*ast.StructType)
+			if !ok {
+				continue
+			}
+			structs[spec.Name.Name] = s
+
+			doc := spec.Doc
+			if doc == nil && len(d.Specs) == 1 {
+				doc = d.Doc
+			}
+			pragmas := parsePragmas(doc)
+			_, skip := pragmas["skip"]
+			_, ctype := pragmas["ctype"]
+			_, codec := v.codecs[spec.Name.Name]
+			if !skip && !ctype && !codec && !spec.Name.IsExported() {
+				candidates[spec.Name.Name] = s
+			}
+		}
+	}
+
+	// Check each struct recursively. Structs being checked are not raw so
+	// recursive types are rejected.
+	visiting := make(map[string]bool)
+	var isRaw func(s *ast.StructType) bool
+	isRaw = func(s *ast.StructType) bool {
+		for _, f := range s.Fields.List {
+			typ := tostr(f.Type)
+			if _, ok := v.codecs[typ]; ok {
+				continue
+			} else if v.isRawStruct(&ast.StructType{Fields: &ast.FieldList{List: []*ast.Field{f}}}) {
+				continue
+			}
+			c, ok := candidates[typ]
+			if !ok || visiting[typ] {
+				return false
+			}
+			visiting[typ] = true
+			ok = isRaw(c)
+			visiting[typ] = false
+			if !ok {
+				return false
+			}
+		}
+		return true
+	}
+
+	v.nested = make(map[string]*ast.StructType)
+	for _, s := range structs {
+		if !isRaw(s) {
+			continue
+		}
+		for _, f := range s.Fields.List {
+			if typ := tostr(f.Type); candidates[typ] != nil {
+				v.nested[typ] = candidates[typ]
+			}
+		}
+	}
+	for name := range v.nested {
+		v.codecs[name] = tocamelcase(name)
+	}
+}
+
+// hasEnd returns true if End() is generated for a nested raw struct. The end
+// of a record can't be found from a user-defined field type so structs with
+// them, other than nested raw structs, don't have one.
+func (v *visitor) hasEnd(typ string) bool {
+	s, ok := v.nested[typ]
+	if !ok {
+		return false
+	}
+	for _, f := range s.Fields.List {
+		if t := tostr(f.Type); v.codecs[t] != "" && !v.hasEnd(t) {
+			return false
+		}
+	}
+	return true
+}
+
+// writeEndFunc writes a generated function returning the offset of the end of
+// the strings of a nested raw struct within the record containing it.
+func (v *visitor) writeEndFunc(unexp string, node *ast.StructType, w io.Writer) error {
+	for _, f := range node.Fields.List {
+		for _, n := range f.Names {
+			if v.fieldname(n.Name) == "End" {
+				return fmt.Errorf("%s: exported name End conflicts with generated End method", n.Name)
+			}
+		}
+	}
+
+	fmt.Fprintf(w, "// End returns the offset of the end of the strings of r within the record\n")
+	fmt.Fprintf(w, "// containing it.\n")
+	fmt.Fprintf(w, "func (r *%s) End() int {\n", unexp)
+	fmt.Fprintf(w, "\tvar n int\n")
+	for _, f := range node.Fields.List {
+		typ := tostr(f.Type)
+		if stringWidth(typ) == 0 && !v.hasEnd(typ) {
+			continue
+		}
+		for _, n := range f.Names {
+			fmt.Fprintf(w, "\tif end := r.%s.End(); end > n {\n", n.Name)
+			fmt.Fprintf(w, "\t\tn = end\n")
+			fmt.Fprintf(w, "\t}\n")
+		}
+	}
+	fmt.Fprintf(w, "\treturn n\n")
+	fmt.Fprintf(w, "}\n\n")
+	return nil
+}
+
+// hasEmbedded returns true if a struct embeds any nested raw structs.
+func (v *visitor) hasEmbedded(node *ast.StructType) bool {
+	for _, f := range node.Fields.List {
+		if len(f.Names) == 0 && v.nested[tostr(f.Type)] != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// flatten returns a struct with the fields of embedded raw structs, including
+// their own embedded raw structs, in place of each embedded field.
+func (v *visitor) flatten(node *ast.StructType) *ast.StructType {
+	var list []*ast.Field
+	for _, f := range node.Fields.List {
+		if s := v.nested[tostr(f.Type)]; len(f.Names) == 0 && s != nil {
+			list = append(list, v.flatten(s).Fields.List...)
+			continue
+		}
+		list = append(list, f)
+	}
+	return &ast.StructType{Struct: node.Struct, Fields: &ast.FieldList{Opening: node.Fields.Opening, List: list, Closing: node.Fields.Closing}}
+}
@@ -0,0 +1,39 @@
+package rawgen
+
+import "go/ast"
+
+// nullTypes are the raw types that may be null, mapped to the raw type of
+// their value. Null fields are optional fields that record whether they're
+// set in a Valid flag of their own instead of a raw.Presence field.
+var nullTypes = map[string]string{
+	"raw.NullInt64":   "int64",
+	"raw.NullFloat64": "float64",
+	"raw.NullString":  "raw.String",
+}
+
+// nullFields returns the names of the fields of a struct with null types.
+func nullFields(node *ast.StructType) map[string]bool {
+	m := make(map[string]bool)
+	for _, f := range node.Fields.List {
+		if _, ok := nullTypes[tostr(f.Type)]; ok {
+			for _, n := range f.Names {
+				m[n.Name] = true
+			}
+		}
+	}
+	return m
+}
+
+// isNullableField returns true if a field maps to a pointer on the exported
+// type, either because it's optional or because it has a null type.
+func isNullableField(f *ast.Field) bool {
+	_, ok := nullTypes[tostr(f.Type)]
+	return ok || isOptionalField(f)
+}
+
+// nullValid returns the offset of the Valid flag within a null type, which
+// follows its value.
+func nullValid(typ string) int {
+	size, _ := sizeof(nullTypes[typ])
+	return size
+}
@@ -0,0 +1,163 @@
+package rawgen
+
+import (
+	"fmt"
+	"go/ast"
+	"io"
+)
+
+// optionalFields returns the name of the raw.Presence field of a struct and
+// the presence bit of each field tagged with "optional". Optional fields are
+// pointers on the exported type and their bit is set when they're encoded
+// with a value, so a record can tell an unset field from a zero value.
+func (g *Generator) optionalFields(node *ast.StructType, pragmas map[string]string) (string, map[string]int, error) {
+	var presence string
+	optional := make(map[string]int)
+	names := make(map[string]string)
+	for _, f := range node.Fields.List {
+		typ, tag := tostr(f.Type), parseTag(f)
+		for _, n := range f.Names {
+			names[g.exportedName(f, n.Name)] = n.Name
+			if typ == "raw.Presence" {
+				if presence != "" {
+					return "", nil, fmt.Errorf("%s: only one raw.Presence field is allowed", n.Name)
+				}
+				presence = n.Name
+			}
+
+			if !isOptionalField(f) {
+				continue
+			} else if !isOptionalType(typ) {
+				return "", nil, fmt.Errorf("%s: optional is not supported for %s fields", n.Name, typ)
+			} else if _, ok := tag["-"]; ok {
+				return "", nil, fmt.Errorf("%s: skipped fields cannot be optional", n.Name)
+			} else if _, ok := tag["key"]; ok {
+				return "", nil, fmt.Errorf("%s: key fields cannot be optional", n.Name)
+			} else if _, ok := tag["index"]; ok {
+				return "", nil, fmt.Errorf("%s: indexed fields cannot be optional", n.Name)
+			} else if len(optional) == 64 {
+				return "", nil, fmt.Errorf("%s: a raw.Presence field holds at most 64 optional fields", n.Name)
+			}
+			optional[n.Name] = len(optional)
+		}
+	}
+
+	if len(optional) == 0 {
+		if presence != "" {
+			return "", nil, fmt.Errorf("%s: raw.Presence field requires an optional field", presence)
+		}
+		return "", nil, nil
+	} else if presence == "" {
+		return "", nil, fmt.Errorf("optional fields require a raw.Presence field")
+	} else if _, ok := pragmas["ctype"]; ok {
+		return "", nil, fmt.Errorf("optional fields are not supported with ctype")
+	}
+
+	// Each optional field has a Has accessor reporting whether it's set.
+	for _, f := range node.Fields.List {
+		for _, n := range f.Names {
+			if _, ok := optional[n.Name]; !ok {
+				continue
+			}
+			name := "Has" + g.exportedName(f, n.Name)
+			if other, ok := names[name]; ok {
+				return "", nil, fmt.Errorf("accessor %s() of field %s conflicts with field %s", name, n.Name, other)
+			}
+		}
+	}
+	return presence, optional, nil
+}
+
+// isOptionalType returns true if a raw type can be optional. Binary data,
+// lists, and slices are nil when they're unset so they're never optional.
+func isOptionalType(typ string) bool {
+	switch typ {
+	case "bool", "int8", "int16", "int32", "int64", "uint8", "uint16", "uint32", "uint64", "float32", "float64", "complex64", "complex128", "int", "uint":
+	case "raw.Time", "raw.TimeMicro", "raw.TimeMilli", "raw.TimeSec", "raw.ZonedTime", "raw.Duration", "raw.IP", "raw.Decimal", "raw.Int128", "raw.Uint128", "raw.String8", "raw.String", "raw.String32":
+	default:
+		return arrayLen(typ) > 0
+	}
+	return true
+}
+
+// isOptional returns true if a field of the raw struct being generated is
+// optional or has a null type.
+func (v *visitor) isOptional(name string) bool {
+	_, ok := v.optional[name]
+	return ok || v.nulls[name]
+}
+
+// withoutField returns a struct without the named field. Fields declaring
+// several names keep their other names.
+func withoutField(node *ast.StructType, name string) *ast.StructType {
+	var list []*ast.Field
+	for _, f := range node.Fields.List {
+		var names []*ast.Ident
+		for _, n := range f.Names {
+			if n.Name != name {
+				names = append(names, n)
+			}
+		}
+		if len(names) == 0 && len(f.Names) > 0 {
+			continue
+		} else if len(names) < len(f.Names) {
+			f = &ast.Field{Doc: f.Doc, Names: names, Type: f.Type, Tag: f.Tag, Comment: f.Comment}
+		}
+		list = append(list, f)
+	}
+	return &ast.StructType{Struct: node.Struct, Fields: &ast.FieldList{Opening: node.Fields.Opening, List: list, Closing: node.Fields.Closing}}
+}
+
+// writeOptionalEncode writes the statements that copy an optional field of an
+// exported value, o, into a raw value, r, and set its presence bit. Unset
+// fields are left as zero values. Null fields are valid once they're set so
+// they have no presence bit.
+func (v *visitor) writeOptionalEncode(typ, name, buf string, w io.Writer) error {
+	exp := v.fieldname(name)
+	fmt.Fprintf(w, "\tif o.%s != nil {\n", exp)
+	if stringWidth(typ) > 0 {
+		fmt.Fprintf(w, "\t\tr.%s.Encode(*o.%s, &%s)\n", name, exp, buf)
+	} else {
+		// Methods are called through the pointer.
+		expr := "*o." + exp
+		if isTime(typ) {
+			expr = "o." + exp
+		}
+		value, err := v.rawValue(typ, expr)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(w, "\t\tr.%s = %s\n", name, value)
+	}
+	if bit, ok := v.optional[name]; ok {
+		fmt.Fprintf(w, "\t\tr.%s.Set(%d)\n", v.presence, bit)
+	}
+	fmt.Fprintf(w, "\t}\n")
+	return nil
+}
+
+// isOptionalField returns true if a field is tagged with "optional".
+func isOptionalField(f *ast.Field) bool {
+	_, ok := parseTag(f)["optional"]
+	return ok
+}
+
+// withoutPresence returns a struct without its raw.Presence field, which has
+// no exported field.
+func withoutPresence(node *ast.StructType) *ast.StructType {
+	for _, f := range node.Fields.List {
+		if tostr(f.Type) == "raw.Presence" {
+			for _, n := range f.Names {
+				node = withoutField(node, n.Name)
+			}
+		}
+	}
+	return node
+}
+
+// optionalValue returns an expression of a pointer to value, an expression of
+// the exported field type gotyp, for setting an optional field in a record
+// literal.
+func optionalValue(gotyp, value string) string {
+	return fmt.Sprintf("&[]%s{%s}[0]", gotyp, value)
+}
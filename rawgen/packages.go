@@ -0,0 +1,208 @@
+package rawgen
+
+import (
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"io"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// resolveFields adds the raw structs exported by other packages, with the
+// export pragma, that are used as field types of a struct to the visitor's
+// codecs. Fields of structs that don't use the raw package are ignored.
+//
+// Returns an error if a struct uses the raw package and has a field with a
+// type from another package that is not an exported raw struct.
+func (v *visitor) resolveFields(node *ast.StructType) error {
+	if v.file == nil || !usesRawTypes(node) {
+		return nil
+	}
+	for _, f := range node.Fields.List {
+		sel, ok := f.Type.(*ast.SelectorExpr)
+		if !ok {
+			continue
+		}
+		// Raw types are normalized to the "raw" package name when parsing.
+		x, ok := sel.X.(*ast.Ident)
+		if !ok || x.Name == "raw" {
+			continue
+		}
+		typ := tostr(f.Type)
+		if _, ok := v.codecs[typ]; ok {
+			continue
+		}
+
+		importPath := v.importPath(x.Name)
+		if importPath == "" {
+			continue
+		}
+		codecs, err := v.exportedCodecs(importPath)
+		if err != nil {
+			return err
+		}
+		exp, ok := codecs[sel.Sel.Name]
+		if !ok {
+			return fmt.Errorf("%s: %s is not a raw struct exported with //raw:export: generate %s first", fieldNames(f), typ, importPath)
+		}
+		v.codecs[typ] = exp
+	}
+	return nil
+}
+
+// importPath returns the path imported by the file with a given package name.
+// Unnamed imports are assumed to use the last element of their path.
+func (v *visitor) importPath(name string) string {
+	for _, i := range v.file.Imports {
+		p, _ := strconv.Unquote(i.Path.Value)
+		if (i.Name != nil && i.Name.Name == name) || (i.Name == nil && path.Base(p) == name) {
+			return p
+		}
+	}
+	return ""
+}
+
+// exportedCodecs returns the exported raw structs of an imported package,
+// keyed by the name of their alias, mapped to their qualified exported types.
+func (v *visitor) exportedCodecs(importPath string) (map[string]string, error) {
+	if m, ok := v.packages[importPath]; ok {
+		return m, nil
+	}
+
+	dir, err := v.packageDir(importPath)
+	if err != nil {
+		return nil, err
+	}
+	paths, err := filepath.Glob(filepath.Join(dir, "*.go"))
+	if err != nil {
+		return nil, err
+	}
+	m := make(map[string]string)
+	for _, p := range paths {
+		if strings.HasSuffix(p, "_test.go") {
+			continue
+		}
+		f, err := parser.ParseFile(token.NewFileSet(), p, nil, 0)
+		if err != nil {
+			return nil, err
+		}
+		name := f.Name.Name
+
+		// Exported raw structs are aliased by an exported name and have
+		// generated Encode and Decode methods.
+		codecs := findCodecs(f)
+		for _, decl := range f.Decls {
+			d, ok := decl.(*ast.GenDecl)
+			if !ok || d.Tok != token.TYPE {
+				continue
+			}
+			for _, spec := range d.Specs {
+				spec := spec.(*ast.TypeSpec)
+				target, ok := spec.Type.(*ast.Ident)
+				if !spec.Assign.IsValid() || !ok || !spec.Name.IsExported() {
+					continue
+				}
+				if exp, ok := codecs[target.Name]; ok && ast.IsExported(exp) {
+					m[spec.Name.Name] = name + "." + exp
+				}
+			}
+		}
+	}
+
+	if v.packages == nil {
+		v.packages = make(map[string]map[string]string)
+	}
+	v.packages[importPath] = m
+	return m, nil
+}
+
+// packageDir returns the directory of an imported package. Packages of the
+// module containing the generator's directory are found relative to the
+// module root, and others with "go list" from the generator's directory.
+func (v *visitor) packageDir(importPath string) (string, error) {
+	dir := v.Dir
+	if dir == "" {
+		dir = "."
+	}
+	if dir, err := filepath.Abs(dir); err == nil {
+		if modroot, root, err := moduleRoot(dir, v.RootImport); err == nil && (importPath == root || strings.HasPrefix(importPath, root+"/")) {
+			dir := filepath.Join(modroot, filepath.FromSlash(strings.TrimPrefix(importPath, root)))
+			if info, err := os.Stat(dir); err == nil && info.IsDir() {
+				return dir, nil
+			}
+		}
+	}
+
+	cmd := exec.Command("go", "list", "-f", "{{.Dir}}", importPath)
+	cmd.Dir = v.Dir
+	out, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("find package %s: %s", importPath, err)
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+// writeExportFuncs writes generated Encode and Decode methods that allow a raw
+// struct to be used as a field of raw structs in other packages, along with
+// an exported alias for the raw struct.
+func (v *visitor) writeExportFuncs(unexp, exp string, node *ast.StructType, w io.Writer) error {
+	alias := "Raw" + exp
+	fmt.Fprintf(w, "// %s is the raw struct of %s for use as a field of raw structs in\n", alias, exp)
+	fmt.Fprintf(w, "// other packages.\n")
+	fmt.Fprintf(w, "type %s = %s\n\n", alias, unexp)
+	return v.writeCodecFuncs(unexp, exp, node, w)
+}
+
+// writeCodecFuncs writes generated Encode and Decode methods on a raw struct
+// that allow it to be used as a field of other raw structs.
+//
+// Strings are stored in the record containing the struct so they're read
+// from the whole record instead of relative to the struct.
+func (v *visitor) writeCodecFuncs(unexp, exp string, node *ast.StructType, w io.Writer) error {
+	for _, f := range node.Fields.List {
+		for _, n := range f.Names {
+			if name := v.fieldname(n.Name); name == "Encode" || name == "Decode" {
+				return fmt.Errorf("%s: exported name %s conflicts with generated %s method", n.Name, name, name)
+			}
+		}
+	}
+
+	fmt.Fprintf(w, "// Encode encodes v into r. Strings are appended to value, the record\n")
+	fmt.Fprintf(w, "// containing r.\n")
+	fmt.Fprintf(w, "func (r *%s) Encode(v %s, value *[]byte) {\n", unexp, exp)
+	fmt.Fprintf(w, "\to := &v\n")
+	v.writeLoad("o", w)
+	if err := v.writeEncodeFields(node, "*value", w); err != nil {
+		return err
+	}
+	fmt.Fprintf(w, "}\n\n")
+
+	fmt.Fprintf(w, "// Decode decodes r from value, the record containing r.\n")
+	fmt.Fprintf(w, "func (r *%s) Decode(value []byte) %s {\n", unexp, exp)
+	fmt.Fprintf(w, "\tvar o %s\n", exp)
+	for _, f := range node.Fields.List {
+		typ := tostr(f.Type)
+		for _, n := range f.Names {
+			name := v.fieldname(n.Name)
+			if _, ok := v.codecs[typ]; ok || decodesCopy(typ) {
+				fmt.Fprintf(w, "\to.%s = r.%s.Decode(value)\n", name, n.Name)
+			} else if stringWidth(typ) == 0 {
+				fmt.Fprintf(w, "\to.%s = r.%s()\n", name, name)
+			} else if v.utf8Policy(f) == "replace" {
+				fmt.Fprintf(w, "\to.%s = strings.ToValidUTF8(r.%s.String(value), \"\\uFFFD\")\n", name, n.Name)
+				v.imports["strings"] = true
+			} else {
+				fmt.Fprintf(w, "\to.%s = r.%s.String(value)\n", name, n.Name)
+			}
+		}
+	}
+	fmt.Fprintf(w, "\treturn o\n")
+	fmt.Fprintf(w, "}\n\n")
+	return nil
+}
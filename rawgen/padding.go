@@ -0,0 +1,164 @@
+package rawgen
+
+import (
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/token"
+	"sort"
+	"unicode"
+)
+
+// implicitPadding returns an error describing the first padding inserted by
+// the compiler into a raw struct. Native code copies it into encoded records
+// so its contents are undefined. Returns nil if the struct has none or if its
+// layout isn't known.
+func implicitPadding(node *ast.StructType) error {
+	l, ok := layoutOf(node)
+	if !ok {
+		return nil
+	}
+	for _, sl := range l.slots {
+		if sl.pad > 0 {
+			return fmt.Errorf("%d bytes of implicit padding before %s; declare it with a blank field, _ [%d]byte, or allow padding", sl.pad, sl.ident.Name, sl.pad)
+		}
+	}
+	if l.tail > 0 {
+		return fmt.Errorf("%d bytes of implicit padding after the last field; declare it with a blank field, _ [%d]byte, or allow padding", l.tail, l.tail)
+	}
+	return nil
+}
+
+// withoutBlank returns a struct without its blank fields.
+func withoutBlank(node *ast.StructType) *ast.StructType {
+	var list []*ast.Field
+	for _, f := range node.Fields.List {
+		if !isBlank(f) {
+			list = append(list, f)
+		}
+	}
+	return &ast.StructType{Struct: node.Struct, Fields: &ast.FieldList{Opening: node.Fields.Opening, List: list, Closing: node.Fields.Closing}}
+}
+
+// onlyPadding returns true if the blank fields of a raw struct only declare
+// the padding the compiler would insert without them, so removing them
+// doesn't change its layout.
+func onlyPadding(node *ast.StructType) bool {
+	l, ok := layoutOf(node)
+	if !ok {
+		return false
+	}
+	implicit, _ := layoutOf(withoutBlank(node))
+	if l.size != implicit.size {
+		return false
+	}
+	var i int
+	for _, sl := range l.slots {
+		if sl.ident.Name == "_" {
+			continue
+		} else if sl.offset != implicit.slots[i].offset {
+			return false
+		}
+		i++
+	}
+	return true
+}
+
+// InsertPadding returns the Go source file, src, with a blank field, e.g.
+// `_ [7]byte`, declaring each padding inserted by the compiler into a raw
+// struct, so its encoded bytes are deterministic. Also returns the number of
+// blank fields inserted. The layout of each raw struct is unchanged.
+func (g *Generator) InsertPadding(src []byte) ([]byte, int, error) {
+	fset, f, _, err := g.parse(src)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	// Find the offset of each blank field to insert in src.
+	type insert struct {
+		offset int
+		text   string
+	}
+	var inserts []insert
+	for _, decl := range f.Decls {
+		decl, ok := decl.(*ast.GenDecl)
+		if !ok || decl.Tok != token.TYPE {
+			continue
+		}
+		for _, spec := range decl.Specs {
+			spec := spec.(*ast.TypeSpec)
+			s, ok := spec.Type.(*ast.StructType)
+			if !ok || !g.isRawStruct(s) || unicode.IsUpper(rune(spec.Name.Name[0])) {
+				continue
+			}
+
+			// C structs are packed so they have no padding.
+			doc := spec.Doc
+			if doc == nil && len(decl.Specs) == 1 {
+				doc = decl.Doc
+			}
+			pragmas := parsePragmas(doc)
+			if _, ok := pragmas["skip"]; ok {
+				continue
+			} else if _, ok := pragmas["ctype"]; ok {
+				continue
+			}
+
+			l, ok := layoutOf(s)
+			if !ok {
+				continue
+			}
+			for _, sl := range l.slots {
+				if sl.pad == 0 {
+					continue
+				}
+
+				// Padding is only inserted before the first name of a
+				// field, as its other names have the same alignment.
+				for _, field := range s.Fields.List {
+					if len(field.Names) == 0 || field.Names[0] != sl.ident {
+						continue
+					}
+					pos := field.Pos()
+					if field.Doc != nil {
+						pos = field.Doc.Pos()
+					}
+					inserts = append(inserts, insert{fset.Position(pos).Offset, fmt.Sprintf("_ [%d]byte\n", sl.pad)})
+				}
+			}
+			if l.tail > 0 {
+				offset := fset.Position(s.Fields.Closing).Offset
+				text := fmt.Sprintf("_ [%d]byte\n", l.tail)
+				if i := lastNonBlank(src[:offset]); i < 0 || src[i] != '\n' {
+					text = "\n" + text
+				}
+				inserts = append(inserts, insert{offset, text})
+			}
+		}
+	}
+	if len(inserts) == 0 {
+		return src, 0, nil
+	}
+
+	// Insert the fields from the end of src so earlier offsets are unchanged.
+	sort.Slice(inserts, func(i, j int) bool { return inserts[i].offset > inserts[j].offset })
+	b := append([]byte(nil), src...)
+	for _, ins := range inserts {
+		b = append(b[:ins.offset], append([]byte(ins.text), b[ins.offset:]...)...)
+	}
+	out, err := format.Source(b)
+	if err != nil {
+		return nil, 0, fmt.Errorf("format: %s", err)
+	}
+	return out, len(inserts), nil
+}
+
+// lastNonBlank returns the index of the last byte in b that isn't a space or
+// a tab, or -1 if there is none.
+func lastNonBlank(b []byte) int {
+	i := len(b) - 1
+	for i >= 0 && (b[i] == ' ' || b[i] == '\t') {
+		i--
+	}
+	return i
+}
@@ -0,0 +1,38 @@
+package rawgen
+
+import (
+	"fmt"
+	"io"
+)
+
+// writePoolFuncs writes the pool of encode buffers for an exported type and a
+// generated function returning buffers to it. Buffers are pooled as pointers
+// so they aren't copied into an interface when they're released.
+func (v *visitor) writePoolFuncs(unexp, exp string, w io.Writer) {
+	fmt.Fprintf(w, "// %sPool holds buffers released by Release%s for reuse by Encode.\n", unexp, exp)
+	fmt.Fprintf(w, "var %sPool sync.Pool\n\n", unexp)
+
+	fmt.Fprintf(w, "// Release%s returns a slice returned by %s.Encode to a pool so later\n", exp, exp)
+	fmt.Fprintf(w, "// calls can reuse it. The slice must not be used after it's released.\n")
+	fmt.Fprintf(w, "func Release%s(b []byte) {\n", exp)
+	fmt.Fprintf(w, "\tb = b[:0]\n")
+	fmt.Fprintf(w, "\t%sPool.Put(&b)\n", unexp)
+	fmt.Fprintf(w, "}\n\n")
+	v.imports["sync"] = true
+}
+
+// writeEncodeBuffer writes the statements declaring b, the buffer that a
+// record is encoded into, with a length of size and a capacity of capacity.
+// If Pool is set then a released buffer is reused when it's large enough.
+func (v *visitor) writeEncodeBuffer(unexp, size, capacity string, w io.Writer) {
+	if !v.Pool {
+		fmt.Fprintf(w, "\tb := make([]byte, %s, %s)\n", size, capacity)
+		return
+	}
+	fmt.Fprintf(w, "\tvar b []byte\n")
+	fmt.Fprintf(w, "\tif p, _ := %sPool.Get().(*[]byte); p != nil && cap(*p) >= %s {\n", unexp, capacity)
+	fmt.Fprintf(w, "\t\tb = (*p)[:%s]\n", size)
+	fmt.Fprintf(w, "\t} else {\n")
+	fmt.Fprintf(w, "\t\tb = make([]byte, %s, %s)\n", size, capacity)
+	fmt.Fprintf(w, "\t}\n")
+}
@@ -0,0 +1,409 @@
+package rawgen
+
+import (
+	"fmt"
+	"go/ast"
+	"io"
+	"strconv"
+)
+
+// portable returns true if records are encoded field by field instead of
+// being mapped with unsafe.
+func (g *Generator) portable() bool {
+	return g.TinyGo || g.Safe || g.Endian == "little" || g.Endian == "big" || g.Arch != ""
+}
+
+// byteOrder returns the encoding/binary byte order used by portable encoding.
+func (v *visitor) byteOrder() string {
+	if v.Endian == "big" {
+		return "binary.BigEndian"
+	}
+	return "binary.LittleEndian"
+}
+
+// writePortableFuncs writes generated Encode and Decode functions that read
+// and write each field at its offset with encoding/binary instead of mapping
+// the record with unsafe. Records use the same layout as the raw struct on
+// 64-bit platforms, or on the platform set by Arch, so little-endian records
+// can be shared with the native code.
+func (v *visitor) writePortableFuncs(unexp, exp string, node *ast.StructType, pragmas map[string]string, w io.Writer) error {
+	if _, ok := pragmas["retain"]; ok {
+		return fmt.Errorf("retain is not supported with portable encoding")
+	} else if _, ok := pragmas["export"]; ok {
+		return fmt.Errorf("export is not supported with portable encoding")
+	} else if _, ok := pragmas["version"]; ok {
+		return fmt.Errorf("version is not supported with portable encoding")
+	}
+	l, ok := v.layout(node)
+	if !ok {
+		return fmt.Errorf("unknown layout")
+	}
+
+	order := v.byteOrder()
+
+	// Fields tagged with "-" are left as zero values.
+	skipped := make(map[int]bool)
+	for i := range l.slots {
+		skipped[i] = isSkipped(node.Fields.List[fieldIndex(node, i)])
+	}
+
+	// Encode appends to a new buffer, sized to fit the whole record.
+	fmt.Fprintf(w, "func (o *%s) Encode() []byte {\n", exp)
+	capacity := strconv.Itoa(l.size)
+	if v.tag != "" {
+		capacity = v.pkg + ".TypeTagSize+" + capacity
+	}
+	for i, s := range l.slots {
+		if skipped[i] {
+			continue
+		} else if elem := sliceElem(s.typ); elem != "" {
+			size, _ := sizeof(elem)
+			capacity += fmt.Sprintf("+len(o.%s)*%d", v.fieldname(s.ident.Name), size)
+		} else if s.typ == "raw.StringList" {
+			capacity += fmt.Sprintf("+len(o.%s)*4", v.fieldname(s.ident.Name))
+		} else if stringWidth(s.typ) > 0 && !v.isOptional(s.ident.Name) {
+			capacity += fmt.Sprintf("+len(o.%s)", v.fieldname(s.ident.Name))
+		}
+	}
+	v.writeEncodeBuffer(unexp, "0", v.checksumCapacity(capacity), w)
+	fmt.Fprintf(w, "\treturn o.AppendEncode(b)\n")
+	fmt.Fprintf(w, "}\n\n")
+
+	// Encode the fixed size fields into a zeroed region at the end of dst
+	// and then append the strings, so offsets are relative to the start of
+	// the record.
+	fmt.Fprintf(w, "// AppendEncode appends the encoding of o to dst and returns the extended\n")
+	fmt.Fprintf(w, "// slice.\n")
+	fmt.Fprintf(w, "func (o *%s) AppendEncode(dst []byte) []byte {\n", exp)
+	v.writeTypeTagAppend(w)
+	fmt.Fprintf(w, "\tstart := len(dst)\n")
+	fmt.Fprintf(w, "\tdst = append(dst, make([]byte, %d)...)\n", l.size)
+	fmt.Fprintf(w, "\tb := dst[start:]\n")
+
+	// Optional fields are only written if they're set, along with their
+	// presence bit. Null fields are written along with their Valid flag.
+	var presence slot
+	for _, s := range l.slots {
+		if s.ident.Name == v.presence {
+			presence = s
+			fmt.Fprintf(w, "\tvar presence %s.Presence\n", v.pkg)
+		}
+	}
+	for i, s := range l.slots {
+		if skipped[i] || s.ident.Name == v.presence {
+			continue
+		}
+		name, expr := v.fieldname(s.ident.Name), "o."+v.fieldname(s.ident.Name)
+		if bit, ok := v.optional[s.ident.Name]; ok {
+			fmt.Fprintf(w, "\tif o.%s != nil {\n", name)
+			fmt.Fprintf(w, "\t\tx := *o.%s\n", name)
+			fmt.Fprintf(w, "\t\tpresence.Set(%d)\n", bit)
+			expr = "x"
+		} else if value, ok := nullTypes[s.typ]; ok {
+			fmt.Fprintf(w, "\tif o.%s != nil {\n", name)
+			fmt.Fprintf(w, "\t\tx := *o.%s\n", name)
+			fmt.Fprintf(w, "\t\tb[%d] = 1\n", s.offset+nullValid(s.typ))
+			expr = "x"
+			s.typ = value
+			s.size, _ = sizeof(value)
+		}
+		switch s.typ {
+		case "bool":
+			fmt.Fprintf(w, "\tif %s {\n", expr)
+			fmt.Fprintf(w, "\t\tb[%d] = 1\n", s.offset)
+			fmt.Fprintf(w, "\t}\n")
+		case "int8", "uint8", "raw.Flags8":
+			fmt.Fprintf(w, "\tb[%d] = byte(%s)\n", s.offset, expr)
+		case "int16", "int32", "int64", "uint16", "uint32", "uint64", "raw.Flags16", "raw.Flags32":
+			fmt.Fprintf(w, "\t%s.PutUint%d(b[%d:], uint%d(%s))\n", order, s.size*8, s.offset, s.size*8, expr)
+		case "float32", "float64":
+			fmt.Fprintf(w, "\t%s.PutUint%d(b[%d:], math.Float%dbits(%s))\n", order, s.size*8, s.offset, s.size*8, expr)
+			v.imports["math"] = true
+		case "complex64", "complex128":
+			bits := s.size * 4
+			fmt.Fprintf(w, "\t%s.PutUint%d(b[%d:], math.Float%dbits(real(%s)))\n", order, bits, s.offset, bits, expr)
+			fmt.Fprintf(w, "\t%s.PutUint%d(b[%d:], math.Float%dbits(imag(%s)))\n", order, bits, s.offset+s.size/2, bits, expr)
+			v.imports["math"] = true
+		case "raw.Time", "raw.TimeMicro", "raw.TimeMilli", "raw.TimeSec":
+			fmt.Fprintf(w, "\t%s.PutUint%d(b[%d:], uint%d(%s))\n", order, s.size*8, s.offset, s.size*8, timeUnix(s.typ, expr))
+		case "raw.IP":
+			fmt.Fprintf(w, "\tif ip := %s.NewIP(%s); ip.Family != 0 {\n", v.pkg, expr)
+			fmt.Fprintf(w, "\t\tcopy(b[%d:], ip.Bytes[:])\n", s.offset)
+			fmt.Fprintf(w, "\t\tb[%d] = ip.Family\n", s.offset+16)
+			fmt.Fprintf(w, "\t}\n")
+		case "raw.Int128", "raw.Uint128":
+			fmt.Fprintf(w, "\t%s.PutUint64(b[%d:], uint64(%s.Hi))\n", order, s.offset, expr)
+			fmt.Fprintf(w, "\t%s.PutUint64(b[%d:], %s.Lo)\n", order, s.offset+8, expr)
+		case "raw.Decimal":
+			fmt.Fprintf(w, "\t%s.PutUint64(b[%d:], uint64(%s.Unscaled))\n", order, s.offset, expr)
+			fmt.Fprintf(w, "\t%s.PutUint32(b[%d:], uint32(%s.Scale))\n", order, s.offset+8, expr)
+		case "raw.ZonedTime":
+			fmt.Fprintf(w, "\t%s.PutUint64(b[%d:], uint64(%s.UnixNano()))\n", order, s.offset, expr)
+			fmt.Fprintf(w, "\t%s.PutUint32(b[%d:], uint32(%s.NewZonedTime(%s).Offset))\n", order, s.offset+8, v.pkg, expr)
+		case "raw.Duration":
+			fmt.Fprintf(w, "\t%s.PutUint64(b[%d:], uint64(%s))\n", order, s.offset, expr)
+		case "raw.String8":
+			fmt.Fprintf(w, "\t%s.CheckOffset(len(b), len(%s), 8)\n", v.pkg, expr)
+			fmt.Fprintf(w, "\tb[%d] = byte(len(b))\n", s.offset)
+			fmt.Fprintf(w, "\tb[%d] = byte(len(%s))\n", s.offset+1, expr)
+			fmt.Fprintf(w, "\tb = append(b, %s...)\n", expr)
+		case "raw.String", "raw.String32", "raw.Bytes":
+			bits := stringWidth(s.typ)
+			if bits < 32 {
+				fmt.Fprintf(w, "\t%s.CheckOffset(len(b), len(%s), %d)\n", v.pkg, expr, bits)
+			}
+			fmt.Fprintf(w, "\t%s.PutUint%d(b[%d:], uint%d(len(b)))\n", order, bits, s.offset, bits)
+			fmt.Fprintf(w, "\t%s.PutUint%d(b[%d:], uint%d(len(%s)))\n", order, bits, s.offset+bits/8, bits, expr)
+			fmt.Fprintf(w, "\tb = append(b, %s...)\n", expr)
+		case "raw.StringList":
+			v.writePortableListEncode(name, s, w)
+		default:
+			if sliceElem(s.typ) != "" {
+				v.writePortableSliceEncode(name, s, w)
+				continue
+			} else if arrayLen(s.typ) == 0 {
+				return fmt.Errorf("invalid raw type: %s", s.typ)
+			}
+			fmt.Fprintf(w, "\tcopy(b[%d:], %s[:])\n", s.offset, expr)
+		}
+		if v.isOptional(s.ident.Name) {
+			fmt.Fprintf(w, "\t}\n")
+		}
+	}
+	if v.presence != "" {
+		fmt.Fprintf(w, "\t%s.PutUint64(b[%d:], uint64(presence))\n", order, presence.offset)
+	}
+	fmt.Fprintf(w, "\treturn %s\n", v.checksumResult("append(dst[:start], b...)", v.tagStart()))
+	fmt.Fprintf(w, "}\n\n")
+
+	fmt.Fprintf(w, "func (o *%s) Decode(b []byte) error {\n", exp)
+	v.writeUnwrap("", w)
+	fmt.Fprintf(w, "\tif len(b) < %d {\n", l.size)
+	fmt.Fprintf(w, "\t\treturn io.ErrUnexpectedEOF\n")
+	fmt.Fprintf(w, "\t}\n")
+	v.imports["io"] = true
+	if v.presence != "" {
+		fmt.Fprintf(w, "\tpresence := %s.Presence(%s.Uint64(b[%d:]))\n", v.pkg, order, presence.offset)
+	}
+	for i, s := range l.slots {
+		if skipped[i] || s.ident.Name == v.presence {
+			continue
+		}
+		name, expr := v.fieldname(s.ident.Name), "o."+v.fieldname(s.ident.Name)
+		if bit, ok := v.optional[s.ident.Name]; ok {
+			gotyp, err := v.fieldType(s.ident.Name, s.typ)
+			if err != nil {
+				return err
+			}
+			if value, ok := v.defaults[s.ident.Name]; ok {
+				fmt.Fprintf(w, "\to.%s = %s\n", name, value)
+			} else {
+				fmt.Fprintf(w, "\to.%s = nil\n", name)
+			}
+			fmt.Fprintf(w, "\tif presence.Has(%d) {\n", bit)
+			fmt.Fprintf(w, "\t\tvar x %s\n", gotyp)
+			expr = "x"
+		} else if value, ok := nullTypes[s.typ]; ok {
+			gotyp, err := v.gotype(value)
+			if err != nil {
+				return err
+			}
+			if value, ok := v.defaults[s.ident.Name]; ok {
+				fmt.Fprintf(w, "\to.%s = %s\n", name, value)
+			} else {
+				fmt.Fprintf(w, "\to.%s = nil\n", name)
+			}
+			fmt.Fprintf(w, "\tif b[%d] != 0 {\n", s.offset+nullValid(s.typ))
+			fmt.Fprintf(w, "\t\tvar x %s\n", gotyp)
+			expr = "x"
+			s.typ = value
+			s.size, _ = sizeof(value)
+		}
+		switch s.typ {
+		case "bool":
+			fmt.Fprintf(w, "\t%s = b[%d] != 0\n", expr, s.offset)
+		case "int8":
+			fmt.Fprintf(w, "\t%s = int(int8(b[%d]))\n", expr, s.offset)
+		case "uint8", "raw.Flags8":
+			gotyp, _ := v.fieldType(s.ident.Name, s.typ)
+			fmt.Fprintf(w, "\t%s = %s(b[%d])\n", expr, gotyp, s.offset)
+			v.writeEnumValueCheck(s.ident.Name, expr, w)
+		case "int16", "int32", "int64":
+			fmt.Fprintf(w, "\t%s = int(%s(%s.Uint%d(b[%d:])))\n", expr, s.typ, order, s.size*8, s.offset)
+			v.writeIntDecodeCheck(s.ident.Name, expr, s.offset, w)
+		case "uint16", "uint32", "uint64", "raw.Flags16", "raw.Flags32":
+			gotyp, _ := v.fieldType(s.ident.Name, s.typ)
+			fmt.Fprintf(w, "\t%s = %s(%s.Uint%d(b[%d:]))\n", expr, gotyp, order, s.size*8, s.offset)
+			v.writeEnumValueCheck(s.ident.Name, expr, w)
+			v.writeIntDecodeCheck(s.ident.Name, expr, s.offset, w)
+		case "float32", "float64":
+			fmt.Fprintf(w, "\t%s = math.Float%dfrombits(%s.Uint%d(b[%d:]))\n", expr, s.size*8, order, s.size*8, s.offset)
+		case "complex64", "complex128":
+			bits := s.size * 4
+			fmt.Fprintf(w, "\t%s = complex(math.Float%dfrombits(%s.Uint%d(b[%d:])), math.Float%dfrombits(%s.Uint%d(b[%d:])))\n", expr, bits, order, bits, s.offset, bits, order, bits, s.offset+s.size/2)
+		case "raw.Time", "raw.TimeMicro", "raw.TimeMilli", "raw.TimeSec":
+			fmt.Fprintf(w, "\t%s = %s\n", expr, timeValue(s.typ, fmt.Sprintf("int64(%s.Uint%d(b[%d:]))", order, s.size*8, s.offset)))
+			v.imports["time"] = true
+		case "raw.IP":
+			fmt.Fprintf(w, "\t%s = %s.IP{Bytes: [16]byte(b[%d:%d]), Family: b[%d]}.Addr()\n", expr, v.pkg, s.offset, s.offset+16, s.offset+16)
+		case "raw.Int128":
+			fmt.Fprintf(w, "\t%s = %s.Int128{Hi: int64(%s.Uint64(b[%d:])), Lo: %s.Uint64(b[%d:])}\n", expr, v.pkg, order, s.offset, order, s.offset+8)
+		case "raw.Uint128":
+			fmt.Fprintf(w, "\t%s = %s.Uint128{Hi: %s.Uint64(b[%d:]), Lo: %s.Uint64(b[%d:])}\n", expr, v.pkg, order, s.offset, order, s.offset+8)
+		case "raw.Decimal":
+			fmt.Fprintf(w, "\t%s = %s.Decimal{Unscaled: int64(%s.Uint64(b[%d:])), Scale: int32(%s.Uint32(b[%d:]))}\n", expr, v.pkg, order, s.offset, order, s.offset+8)
+		case "raw.ZonedTime":
+			fmt.Fprintf(w, "\t%s = %s.ZonedTime{Nano: int64(%s.Uint64(b[%d:])), Offset: int32(%s.Uint32(b[%d:]))}.Time()\n", expr, v.pkg, order, s.offset, order, s.offset+8)
+		case "raw.Duration":
+			fmt.Fprintf(w, "\t%s = time.Duration(%s.Uint64(b[%d:]))\n", expr, order, s.offset)
+			v.imports["time"] = true
+		case "raw.String8", "raw.String", "raw.String32", "raw.Bytes":
+			off, end := fmt.Sprintf("int(b[%d])", s.offset), fmt.Sprintf("int(b[%d])+int(b[%d])", s.offset, s.offset+1)
+			if bits := stringWidth(s.typ); bits > 8 {
+				off = fmt.Sprintf("int(%s.Uint%d(b[%d:]))", order, bits, s.offset)
+				end = fmt.Sprintf("%s+int(%s.Uint%d(b[%d:]))", off, order, bits, s.offset+bits/8)
+			}
+			fmt.Fprintf(w, "\tif %s > len(b) {\n", end)
+			fmt.Fprintf(w, "\t\treturn io.ErrUnexpectedEOF\n")
+			fmt.Fprintf(w, "\t}\n")
+			if s.typ == "raw.Bytes" {
+				fmt.Fprintf(w, "\t%s = append([]byte(nil), b[%s:%s]...)\n", expr, off, end)
+				continue
+			}
+			switch policy := v.utf8Policy(node.Fields.List[fieldIndex(node, i)]); policy {
+			case "raw", "error":
+				fmt.Fprintf(w, "\t%s = string(b[%s : %s])\n", expr, off, end)
+			case "replace":
+				fmt.Fprintf(w, "\t%s = strings.ToValidUTF8(string(b[%s : %s]), \"\\uFFFD\")\n", expr, off, end)
+				v.imports["strings"] = true
+			default:
+				return fmt.Errorf("invalid utf8 policy: %s", policy)
+			}
+		case "raw.StringList":
+			v.writePortableListDecode(name, s, w)
+		default:
+			if sliceElem(s.typ) != "" {
+				v.writePortableSliceDecode(name, s, w)
+				continue
+			}
+			fmt.Fprintf(w, "\tcopy(%s[:], b[%d:%d])\n", expr, s.offset, s.offset+s.size)
+		}
+		if v.isOptional(s.ident.Name) {
+			fmt.Fprintf(w, "\t\to.%s = &x\n", name)
+			fmt.Fprintf(w, "\t}\n")
+		}
+	}
+	fmt.Fprintf(w, "\treturn %s\n", v.decodeResult())
+	fmt.Fprintf(w, "}\n\n")
+
+	for i, s := range l.slots {
+		if s.size > 1 && arrayLen(s.typ) == 0 && !skipped[i] {
+			v.imports["encoding/binary"] = true
+		}
+	}
+	return nil
+}
+
+// writePortableSliceEncode writes the statements appending the elements of a
+// raw.Slice field to b. Elements are aligned to their size, as they are by
+// raw.Slice, so records match the native code.
+func (v *visitor) writePortableSliceEncode(name string, s slot, w io.Writer) {
+	order, elem := v.byteOrder(), sliceElem(s.typ)
+	size, _ := sizeof(elem)
+	if size > 1 {
+		fmt.Fprintf(w, "\tfor len(b)%%%d != 0 {\n", size)
+		fmt.Fprintf(w, "\t\tb = append(b, 0)\n")
+		fmt.Fprintf(w, "\t}\n")
+	}
+	fmt.Fprintf(w, "\t%s.CheckOffset(len(b), len(o.%s), 16)\n", v.pkg, name)
+	fmt.Fprintf(w, "\t%s.PutUint16(b[%d:], uint16(len(b)))\n", order, s.offset)
+	fmt.Fprintf(w, "\t%s.PutUint16(b[%d:], uint16(len(o.%s)))\n", order, s.offset+2, name)
+	fmt.Fprintf(w, "\tfor _, x := range o.%s {\n", name)
+	switch elem {
+	case "int8", "uint8":
+		fmt.Fprintf(w, "\t\tb = append(b, byte(x))\n")
+	case "float32", "float64":
+		fmt.Fprintf(w, "\t\tb = %s.AppendUint%d(b, math.Float%dbits(x))\n", order, size*8, size*8)
+		v.imports["math"] = true
+	default:
+		fmt.Fprintf(w, "\t\tb = %s.AppendUint%d(b, uint%d(x))\n", order, size*8, size*8)
+	}
+	fmt.Fprintf(w, "\t}\n")
+}
+
+// writePortableSliceDecode writes the statements decoding the elements of a
+// raw.Slice field from b.
+func (v *visitor) writePortableSliceDecode(name string, s slot, w io.Writer) {
+	order, elem := v.byteOrder(), sliceElem(s.typ)
+	size, _ := sizeof(elem)
+	fmt.Fprintf(w, "\tif off, n := int(%s.Uint16(b[%d:])), int(%s.Uint16(b[%d:])); off+n*%d > len(b) {\n", order, s.offset, order, s.offset+2, size)
+	fmt.Fprintf(w, "\t\treturn io.ErrUnexpectedEOF\n")
+	fmt.Fprintf(w, "\t} else {\n")
+	fmt.Fprintf(w, "\t\to.%s = nil\n", name)
+	fmt.Fprintf(w, "\t\tfor i := 0; i < n; i++ {\n")
+	switch elem {
+	case "int8", "uint8":
+		fmt.Fprintf(w, "\t\t\to.%s = append(o.%s, %s(b[off+i]))\n", name, name, elem)
+	case "float32", "float64":
+		fmt.Fprintf(w, "\t\t\to.%s = append(o.%s, math.Float%dfrombits(%s.Uint%d(b[off+i*%d:])))\n", name, name, size*8, order, size*8, size)
+		v.imports["math"] = true
+	default:
+		fmt.Fprintf(w, "\t\t\to.%s = append(o.%s, %s(%s.Uint%d(b[off+i*%d:])))\n", name, name, elem, order, size*8, size)
+	}
+	fmt.Fprintf(w, "\t\t}\n")
+	fmt.Fprintf(w, "\t}\n")
+}
+
+// writePortableListEncode writes the statements appending a raw.StringList
+// field to b. The table of string offsets and lengths is aligned to 2 bytes,
+// as it is by raw.StringList, and is followed by the contents of the strings.
+func (v *visitor) writePortableListEncode(name string, s slot, w io.Writer) {
+	order := v.byteOrder()
+	fmt.Fprintf(w, "\tif len(b)%%2 != 0 {\n")
+	fmt.Fprintf(w, "\t\tb = append(b, 0)\n")
+	fmt.Fprintf(w, "\t}\n")
+	fmt.Fprintf(w, "\t%s.CheckOffset(len(b), len(o.%s), 16)\n", v.pkg, name)
+	fmt.Fprintf(w, "\t%s.PutUint16(b[%d:], uint16(len(b)))\n", order, s.offset)
+	fmt.Fprintf(w, "\t%s.PutUint16(b[%d:], uint16(len(o.%s)))\n", order, s.offset+2, name)
+	fmt.Fprintf(w, "\tfor i, off := 0, len(b)+len(o.%s)*4; i < len(o.%s); i++ {\n", name, name)
+	fmt.Fprintf(w, "\t\t%s.CheckOffset(off, len(o.%s[i]), 16)\n", v.pkg, name)
+	fmt.Fprintf(w, "\t\tb = %s.AppendUint16(b, uint16(off))\n", order)
+	fmt.Fprintf(w, "\t\tb = %s.AppendUint16(b, uint16(len(o.%s[i])))\n", order, name)
+	fmt.Fprintf(w, "\t\toff += len(o.%s[i])\n", name)
+	fmt.Fprintf(w, "\t}\n")
+	fmt.Fprintf(w, "\tfor _, x := range o.%s {\n", name)
+	fmt.Fprintf(w, "\t\tb = append(b, x...)\n")
+	fmt.Fprintf(w, "\t}\n")
+	fmt.Fprintf(w, "\t%s.CheckOffset(0, len(b)-int(%s.Uint16(b[%d:])), 16)\n", v.pkg, order, s.offset)
+	fmt.Fprintf(w, "\t%s.PutUint16(b[%d:], uint16(len(b)-int(%s.Uint16(b[%d:]))))\n", order, s.offset+4, order, s.offset)
+}
+
+// writePortableListDecode writes the statements decoding a raw.StringList
+// field from b. Every string must be within the record.
+func (v *visitor) writePortableListDecode(name string, s slot, w io.Writer) {
+	order := v.byteOrder()
+	fmt.Fprintf(w, "\tif off, n := int(%s.Uint16(b[%d:])), int(%s.Uint16(b[%d:])); off+n*4 > len(b) || off+int(%s.Uint16(b[%d:])) > len(b) {\n", order, s.offset, order, s.offset+2, order, s.offset+4)
+	fmt.Fprintf(w, "\t\treturn io.ErrUnexpectedEOF\n")
+	fmt.Fprintf(w, "\t} else {\n")
+	fmt.Fprintf(w, "\t\to.%s = nil\n", name)
+	fmt.Fprintf(w, "\t\tfor i := 0; i < n; i++ {\n")
+	fmt.Fprintf(w, "\t\t\tstart, end := int(%s.Uint16(b[off+i*4:])), int(%s.Uint16(b[off+i*4:]))+int(%s.Uint16(b[off+i*4+2:]))\n", order, order, order)
+	fmt.Fprintf(w, "\t\t\tif end > len(b) {\n")
+	fmt.Fprintf(w, "\t\t\t\treturn io.ErrUnexpectedEOF\n")
+	fmt.Fprintf(w, "\t\t\t}\n")
+	fmt.Fprintf(w, "\t\t\to.%s = append(o.%s, string(b[start:end]))\n", name, name)
+	fmt.Fprintf(w, "\t\t}\n")
+	fmt.Fprintf(w, "\t}\n")
+}
+
+// fieldIndex returns the index, within a struct's field list, of the field
+// declaring the i-th name.
+func fieldIndex(node *ast.StructType, i int) int {
+	for j, f := range node.Fields.List {
+		if i < len(f.Names) {
+			return j
+		}
+		i -= len(f.Names)
+	}
+	return -1
+}
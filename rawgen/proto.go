@@ -0,0 +1,185 @@
+package rawgen
+
+import (
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"io"
+	"strings"
+)
+
+// Import paths of the well-known protobuf types used for times and durations.
+const (
+	TimestampImportPath = "google.golang.org/protobuf/types/known/timestamppb"
+	DurationImportPath  = "google.golang.org/protobuf/types/known/durationpb"
+)
+
+// writeProtoFuncs writes generated ToProto and FromProto methods converting
+// an exported type to and from the protobuf message named by the "proto"
+// pragma, e.g. "//raw:proto=pb.User". The message's package must be imported
+// by the file. Fields match the message field with the same name, or the
+// name set by a proto tag, using the Go names generated by protoc-gen-go.
+// Fields tagged with `raw:"proto=-"` are left out.
+func (v *visitor) writeProtoFuncs(exp string, node *ast.StructType, msg string, w io.Writer) error {
+	if x, err := parser.ParseExpr(msg); err != nil || tostr(x) != msg {
+		return fmt.Errorf("invalid proto message type: %q", msg)
+	}
+	for _, f := range node.Fields.List {
+		if len(f.Names) == 0 {
+			return fmt.Errorf("embedded raw structs are not supported with proto")
+		}
+		for _, n := range f.Names {
+			if name := v.fieldname(n.Name); name == "ToProto" || name == "FromProto" {
+				return fmt.Errorf("%s: exported name %s conflicts with generated %s method", n.Name, name, name)
+			}
+		}
+	}
+
+	var to, from strings.Builder
+	for _, f := range node.Fields.List {
+		typ := tostr(f.Type)
+		pname, ok := parseTag(f)["proto"]
+		if pname == "-" {
+			continue
+		}
+		for _, n := range f.Names {
+			if !ok || pname == "" {
+				pname = n.Name
+			}
+			if err := v.writeProtoField(typ, n.Name, protoGoName(pname), v.isOptional(n.Name), &to, &from); err != nil {
+				return fmt.Errorf("%s: %s", n.Name, err)
+			}
+		}
+	}
+
+	fmt.Fprintf(w, "// ToProto returns o as a %s message. Slices share memory with o.\n", msg)
+	fmt.Fprintf(w, "func (o *%s) ToProto() *%s {\n", exp, msg)
+	v.writeLoad("o", w)
+	fmt.Fprintf(w, "\tm := &%s{}\n", msg)
+	fmt.Fprint(w, to.String())
+	fmt.Fprintf(w, "\treturn m\n")
+	fmt.Fprintf(w, "}\n\n")
+
+	fmt.Fprintf(w, "// FromProto sets the fields of o from a %s message. Slices share memory\n", msg)
+	fmt.Fprintf(w, "// with m.\n")
+	fmt.Fprintf(w, "func (o *%s) FromProto(m *%s) {\n", exp, msg)
+	v.writeLoad("o", w)
+	fmt.Fprint(w, from.String())
+	fmt.Fprintf(w, "}\n\n")
+	return nil
+}
+
+// writeProtoField writes the statements converting a single raw field, field,
+// to its message field, name, and back. Optional fields map to proto3 optional
+// fields, which are pointers, and are only set if they're set on the source.
+func (v *visitor) writeProtoField(typ, field, name string, optional bool, to, from io.Writer) error {
+	exp := v.fieldname(field)
+	if value, ok := nullTypes[typ]; ok {
+		typ = value
+	}
+	var ptyp, toExpr, fromExpr string
+	switch typ {
+	case "bool", "float32", "float64":
+		ptyp, toExpr, fromExpr = typ, "%s", "%s"
+	case "raw.String8", "raw.String", "raw.String32":
+		ptyp, toExpr, fromExpr = "string", "%s", "%s"
+	case "int8", "int16", "int32":
+		ptyp, toExpr, fromExpr = "int32", "int32(%s)", "int(%s)"
+	case "int64":
+		ptyp, toExpr, fromExpr = "int64", "int64(%s)", "int(%s)"
+	case "uint8", "uint16", "uint32":
+		ptyp, toExpr, fromExpr = "uint32", "uint32(%s)", "uint(%s)"
+		if e, ok := v.enums[field]; ok {
+			fromExpr = e.name + "(%s)"
+		}
+	case "raw.Flags8", "raw.Flags16", "raw.Flags32":
+		ptyp, toExpr, fromExpr = "uint32", "uint32(%s)", v.flags[field].name+"(%s)"
+	case "uint64":
+		ptyp, toExpr, fromExpr = "uint64", "uint64(%s)", "uint(%s)"
+	case "raw.Bytes", "raw.StringList":
+		toExpr, fromExpr = "%s", "%s"
+	case "raw.Time", "raw.TimeMicro", "raw.TimeMilli", "raw.TimeSec":
+		toExpr, fromExpr = "timestamppb.New(%s)", "%s.AsTime()"
+		v.imports[TimestampImportPath] = true
+	case "raw.Duration":
+		toExpr, fromExpr = "durationpb.New(%s)", "%s.AsDuration()"
+		v.imports[DurationImportPath] = true
+	default:
+		switch elem := sliceElem(typ); {
+		case elem == "int32", elem == "int64", elem == "uint32", elem == "uint64", elem == "float32", elem == "float64":
+			toExpr, fromExpr = "%s", "%s"
+		case arrayLen(typ) > 0:
+			// Arrays are copied so the message doesn't share memory with o.
+			toExpr = "append([]byte(nil), %s[:]...)"
+		default:
+			return fmt.Errorf("no protobuf type for %s", typ)
+		}
+	}
+
+	if !optional {
+		fmt.Fprintf(to, "\tm.%s = %s\n", name, fmt.Sprintf(toExpr, "o."+exp))
+		if fromExpr == "" {
+			fmt.Fprintf(from, "\tcopy(o.%s[:], m.%s)\n", exp, name)
+		} else {
+			fmt.Fprintf(from, "\to.%s = %s\n", exp, fmt.Sprintf(fromExpr, "m."+name))
+		}
+		return nil
+	}
+
+	// Arrays are sliced through the pointer.
+	arg := "*o." + exp
+	if arrayLen(typ) > 0 {
+		arg = "o." + exp
+	}
+	// Times, durations, and bytes are nil in a message when they're unset
+	// so they aren't pointers.
+	fmt.Fprintf(to, "\tif o.%s != nil {\n", exp)
+	if ptyp == "" {
+		fmt.Fprintf(to, "\t\tm.%s = %s\n", name, fmt.Sprintf(toExpr, arg))
+	} else {
+		fmt.Fprintf(to, "\t\tx := %s\n", fmt.Sprintf(toExpr, arg))
+		fmt.Fprintf(to, "\t\tm.%s = &x\n", name)
+	}
+	fmt.Fprintf(to, "\t}\n")
+
+	fmt.Fprintf(from, "\to.%s = nil\n", exp)
+	fmt.Fprintf(from, "\tif m.%s != nil {\n", name)
+	switch {
+	case fromExpr == "":
+		fmt.Fprintf(from, "\t\tvar x %s\n", typ)
+		fmt.Fprintf(from, "\t\tcopy(x[:], m.%s)\n", name)
+	case ptyp == "":
+		fmt.Fprintf(from, "\t\tx := %s\n", fmt.Sprintf(fromExpr, "m."+name))
+	default:
+		fmt.Fprintf(from, "\t\tx := %s\n", fmt.Sprintf(fromExpr, "*m."+name))
+	}
+	fmt.Fprintf(from, "\t\to.%s = &x\n", exp)
+	fmt.Fprintf(from, "\t}\n")
+	return nil
+}
+
+// protoGoName returns the Go name that protoc-gen-go generates for a message
+// field, e.g. "user_id" becomes "UserId".
+func protoGoName(s string) string {
+	isLower := func(c byte) bool { return 'a' <= c && c <= 'z' }
+	var b []byte
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c == '_' && i == 0:
+			b = append(b, 'X')
+		case c == '_' && i+1 < len(s) && isLower(s[i+1]):
+		case '0' <= c && c <= '9':
+			b = append(b, c)
+		default:
+			if isLower(c) {
+				c -= 'a' - 'A'
+			}
+			b = append(b, c)
+			for ; i+1 < len(s) && isLower(s[i+1]); i++ {
+				b = append(b, s[i+1])
+			}
+		}
+	}
+	return string(b)
+}
@@ -0,0 +1,2404 @@
+/*
+Package rawgen generates exported types, encoders, decoders, and accessors for
+raw struct types.
+
+A raw struct is an unexported struct composed entirely of fixed-width types and
+types from the raw package. For every raw struct in a file, an exported type is
+generated with Encode and Decode methods along with accessors on the raw type.
+*/
+package rawgen
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"io"
+	"log"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+	"unicode"
+)
+
+// DefaultImportPath is the import path of the raw package.
+const DefaultImportPath = "github.com/boltdb/raw"
+
+// BoltImportPath is the import path of the bolt package used by generated
+// bolt helpers.
+const BoltImportPath = "github.com/boltdb/bolt"
+
+// NameMap represents a regular expression replacement on field names.
+type NameMap struct {
+	Pattern     *regexp.Regexp
+	Replacement string
+}
+
+// StructSpec describes a raw struct type to generate code for.
+type StructSpec struct {
+	// Name of the unexported raw struct type.
+	Name string
+
+	// Pragmas set on the struct, e.g. "ctype". Values may be blank.
+	Pragmas map[string]string
+
+	Fields []FieldSpec
+}
+
+// FieldSpec describes a single field of a raw struct type.
+type FieldSpec struct {
+	Name string
+	Type string // raw type, e.g. "int64" or "raw.String"
+	Tag  string // struct tag, if any
+}
+
+// Generator generates code for raw struct types.
+type Generator struct {
+	// NameMaps are applied, in order, to field names before they are camel
+	// cased to create exported names.
+	NameMaps []NameMap
+
+	// ImportPaths are the import paths recognized as the raw package, such as
+	// a vendored or internal copy. Defaults to DefaultImportPath.
+	ImportPaths []string
+
+	// Bolt generates helpers for storing records in bolt buckets.
+	Bolt bool
+
+	// JSON generates MarshalJSON and UnmarshalJSON methods on each exported
+	// type. Fields are keyed by their raw field name unless the raw field has
+	// a json struct tag.
+	JSON bool
+
+	// SQL generates Value and Scan methods on each exported type so records
+	// can be stored in a database/sql BLOB column with their raw encoding.
+	SQL bool
+
+	// Equal generates an Equal method comparing each field of an exported
+	// type and a Hash method returning the FNV-1a hash of its encoding.
+	Equal bool
+
+	// ExplicitLayout generates a copy of each raw struct's layout that
+	// declares compiler-inserted padding as blank fields, along with a
+	// compile-time check that its size matches the raw struct.
+	ExplicitLayout bool
+
+	// Pool generates Encode methods that reuse buffers from a package-level
+	// sync.Pool, along with a ReleaseT function returning a buffer to the
+	// pool once it's no longer used.
+	Pool bool
+
+	// Arena generates an EncodeArena method on each exported type that
+	// encodes into a slice handed out by a raw.Arena, for encoding large
+	// batches of records without allocating a slice per record. It isn't
+	// generated with portable code.
+	Arena bool
+
+	// Checksum appends a CRC-32C checksum to each encoded record, which Decode
+	// and views verify before reading the record, returning raw.ErrChecksum
+	// if it doesn't match. Field functions read records without verifying
+	// them. C structs aren't checksummed.
+	Checksum bool
+
+	// TypeTag prefixes each encoded record with a type tag, a hash of the name
+	// and layout of its raw struct, which Decode and views verify before
+	// reading the record, returning raw.ErrTypeTag if it's of another type.
+	// The tag of each raw struct is generated as a constant, e.g. UserTypeTag.
+	// Field functions read records without verifying them. C structs aren't
+	// tagged.
+	TypeTag bool
+
+	// Arch is the GOARCH whose layout records are encoded with, e.g. "arm"
+	// or "386", so records written by native code on that platform can be
+	// read on any other. Setting it generates the same portable code as
+	// TinyGo, reading and writing each field at its offset on that platform.
+	// Records are little-endian unless Endian is "big". Defaults to the
+	// layout of 64-bit platforms.
+	Arch string
+
+	// IntWidth is the width in bits, 32 or 64, of int and uint fields, which
+	// raw structs can only use when it's set. Native code asserts that int
+	// has that width on the platform it's compiled for. Portable code
+	// encodes them as fixed width integers: Decode returns an error wrapping
+	// raw.ErrOverflow if a value doesn't fit in an int, and the methods that
+	// return errors when encoding do the same if a value doesn't fit in
+	// IntWidth bits. Encode truncates them.
+	IntWidth int
+
+	// AllowPadding generates native code for raw structs with padding
+	// inserted by the compiler, which is copied into encoded records with
+	// undefined contents. Otherwise generation fails unless the padding is
+	// declared with blank fields, e.g. `_ [7]byte`, which InsertPadding
+	// inserts. Portable code and C structs are unaffected.
+	AllowPadding bool
+
+	// UTF8 is the default policy for string fields that are not valid UTF-8.
+	// The "raw" policy returns strings as-is, "replace" replaces invalid bytes
+	// with U+FFFD, and "error" adds a NameUTF8() accessor that returns
+	// raw.ErrInvalidUTF8. Fields can override it with a `raw:"utf8=..."` tag.
+	// Defaults to "raw".
+	UTF8 string
+
+	// TinyGo generates portable code that encodes and decodes each field with
+	// encoding/binary instead of mapping records with unsafe. The encoded
+	// format is unchanged but only the exported type, Encode, AppendEncode,
+	// EncodeTo, Decode, DecodeFrom, and the Touch and bolt helpers are
+	// generated.
+	TinyGo bool
+
+	// Safe generates the same portable code as TinyGo for codebases where
+	// the unsafe package is forbidden. Generated code doesn't import unsafe.
+	Safe bool
+
+	// Endian is the byte order of encoded records. The "little" and "big"
+	// orders generate the same portable code as TinyGo, using that byte
+	// order, so records can be shared between platforms. Defaults to
+	// "native", which maps records with unsafe in the platform's byte order.
+	Endian string
+
+	// Template replaces the built-in code generated for each raw struct, if
+	// set. It is executed with a *Struct describing the raw struct.
+	Template *template.Template
+
+	// Dir is the directory used to find imported packages when a raw struct
+	// has a field whose type is a raw struct exported by another package.
+	// Defaults to the current directory.
+	Dir string
+
+	// RootImport is the import path of the module root, the directory with
+	// the nearest go.mod file above Dir, or Dir itself if there is none. It
+	// locates imported packages of the module without the go command and
+	// defaults to the module path declared in go.mod.
+	RootImport string
+
+	// Logger receives trace-level debugging messages, if set.
+	Logger *log.Logger
+}
+
+// GenerateFile generates code using a default Generator.
+func GenerateFile(src []byte) ([]byte, error) {
+	return (&Generator{}).GenerateFile(src)
+}
+
+// GenerateStruct generates code using a default Generator.
+func GenerateStruct(spec StructSpec) ([]byte, error) {
+	return (&Generator{}).GenerateStruct(spec)
+}
+
+// GenerateFile returns the Go source file, src, with code generated for each
+// raw struct type. Previously generated code is removed before generating and
+// any imports required by the generated code are added.
+func (g *Generator) GenerateFile(src []byte) ([]byte, error) {
+	// Re-parse the file without the generated code.
+	b, err := strip(src)
+	if err != nil {
+		return nil, err
+	}
+	fset, f, pkg, err := g.parse(b)
+	if err != nil {
+		return nil, err
+	}
+
+	// Iterate over all the nodes and add exported types where appropriate.
+	v := visitor{Generator: g, imports: make(map[string]bool), pkg: pkg, codecs: findCodecs(f), file: f}
+	v.findNested(f)
+	ast.Walk(&v, f)
+	if v.err != nil {
+		return nil, v.err
+	}
+
+	// Append generated code with any imports it requires.
+	var buf bytes.Buffer
+	buf.Write(addImports(b, fset, f, v.imports))
+	buf.WriteString("\n\n")
+	buf.Write(v.w.Bytes())
+	return formatSource(buf.Bytes())
+}
+
+// formatSource returns a generated file formatted with gofmt. Returns an
+// error if the generated code doesn't parse.
+func formatSource(src []byte) ([]byte, error) {
+	b, err := format.Source(src)
+	if err != nil {
+		return nil, fmt.Errorf("format generated code: %s", err)
+	}
+	return b, nil
+}
+
+// GenerateStruct returns the generated code for a single raw struct type.
+// Unlike GenerateFile, no imports are added so the caller must ensure the
+// generated code's dependencies are imported.
+func (g *Generator) GenerateStruct(spec StructSpec) ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteString("package rawgen\n\n")
+	writeStructSpec(&buf, spec)
+
+	f, err := parser.ParseFile(token.NewFileSet(), "", buf.Bytes(), parser.ParseComments)
+	if err != nil {
+		return nil, fmt.Errorf("invalid struct spec: %s", err)
+	}
+
+	v := visitor{Generator: g, imports: make(map[string]bool), pkg: "raw"}
+	ast.Walk(&v, f)
+	if v.err != nil {
+		return nil, v.err
+	} else if v.w.Len() == 0 {
+		return nil, fmt.Errorf("not a raw struct: %s", spec.Name)
+	}
+	return v.w.Bytes(), nil
+}
+
+// writeStructSpec writes the declaration of the raw struct described by spec.
+func writeStructSpec(w io.Writer, spec StructSpec) {
+	var pragmas []string
+	for k, v := range spec.Pragmas {
+		if v != "" {
+			k += "=" + v
+		}
+		pragmas = append(pragmas, k)
+	}
+	sort.Strings(pragmas)
+	for _, p := range pragmas {
+		fmt.Fprintf(w, "//raw:%s\n", p)
+	}
+
+	fmt.Fprintf(w, "type %s struct {\n", spec.Name)
+	for _, f := range spec.Fields {
+		fmt.Fprintf(w, "\t%s %s", f.Name, f.Type)
+		if strconv.CanBackquote(f.Tag) && f.Tag != "" {
+			fmt.Fprintf(w, " `%s`", f.Tag)
+		} else if f.Tag != "" {
+			fmt.Fprintf(w, " %s", strconv.Quote(f.Tag))
+		}
+		fmt.Fprint(w, "\n")
+	}
+	fmt.Fprint(w, "}\n")
+}
+
+// addImports returns src with import declarations added for each path in
+// imports that the file does not already import.
+func addImports(src []byte, fset *token.FileSet, f *ast.File, imports map[string]bool) []byte {
+	var paths []string
+	for path := range imports {
+		paths = append(paths, path)
+	}
+	sort.Sort(sort.Reverse(sort.StringSlice(paths)))
+
+	for _, path := range paths {
+		if hasImport(f, path) {
+			continue
+		}
+
+		// Insert into the first parenthesized import declaration, if there is
+		// one. Otherwise add a new declaration after the package clause.
+		var offset int
+		var text string
+		for _, decl := range f.Decls {
+			if d, ok := decl.(*ast.GenDecl); ok && d.Tok == token.IMPORT && d.Lparen.IsValid() {
+				offset = fset.Position(d.Lparen).Offset + 1
+				text = fmt.Sprintf("\n\t%q", path)
+				break
+			}
+		}
+		if text == "" {
+			offset = fset.Position(f.Name.End()).Offset
+			text = fmt.Sprintf("\n\nimport %q", path)
+		}
+		src = append(src[:offset], append([]byte(text), src[offset:]...)...)
+	}
+	return src
+}
+
+// hasImport returns true if a file imports a given path.
+func hasImport(f *ast.File, path string) bool {
+	for _, i := range f.Imports {
+		if v, _ := strconv.Unquote(i.Path.Value); v == path {
+			return true
+		}
+	}
+	return false
+}
+
+// parse parses a Go source file. References to the raw package through an
+// aliased import are rewritten to use "raw" so field types can be matched by
+// name. Returns the name the file uses for the raw package.
+func (g *Generator) parse(src []byte) (*token.FileSet, *ast.File, string, error) {
+	switch g.Endian {
+	case "", "native", "little", "big":
+	default:
+		return nil, nil, "", fmt.Errorf("invalid byte order: %s", g.Endian)
+	}
+	if g.Arch != "" && types.SizesFor("gc", g.Arch) == nil {
+		return nil, nil, "", fmt.Errorf("unknown architecture: %s", g.Arch)
+	}
+	switch g.IntWidth {
+	case 0, 32, 64:
+	default:
+		return nil, nil, "", fmt.Errorf("invalid int width: %d", g.IntWidth)
+	}
+
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, "", src, parser.ParseComments)
+	if err != nil {
+		return nil, nil, "", err
+	}
+
+	pkg := g.packageName(f)
+	if pkg != "raw" {
+		ast.Inspect(f, func(node ast.Node) bool {
+			if sel, ok := node.(*ast.SelectorExpr); ok {
+				if x, ok := sel.X.(*ast.Ident); ok && x.Name == pkg {
+					x.Name = "raw"
+				}
+			}
+			return true
+		})
+	}
+	return fset, f, pkg, nil
+}
+
+// importPaths returns the import paths recognized as the raw package.
+func (g *Generator) importPaths() []string {
+	if len(g.ImportPaths) == 0 {
+		return []string{DefaultImportPath}
+	}
+	return g.ImportPaths
+}
+
+// packageName returns the name that a file uses to refer to the raw package.
+// This is the import's alias, if set, or the last element of its import path,
+// ignoring any major version suffix.
+func (g *Generator) packageName(f *ast.File) string {
+	for _, i := range f.Imports {
+		path, _ := strconv.Unquote(i.Path.Value)
+		for _, p := range g.importPaths() {
+			if path != p {
+				continue
+			} else if i.Name != nil && i.Name.Name != "_" && i.Name.Name != "." {
+				return i.Name.Name
+			}
+
+			elems := strings.Split(path, "/")
+			name := elems[len(elems)-1]
+			if len(elems) > 1 && isMajorVersion(name) {
+				name = elems[len(elems)-2]
+			}
+			return name
+		}
+	}
+	return "raw"
+}
+
+// importPath returns the path that a file imports the raw package from.
+// Returns DefaultImportPath if the file doesn't import it.
+func (g *Generator) importPath(f *ast.File) string {
+	for _, p := range g.importPaths() {
+		if hasImport(f, p) {
+			return p
+		}
+	}
+	return DefaultImportPath
+}
+
+// isMajorVersion returns true if s is a module major version suffix, e.g. "v2".
+func isMajorVersion(s string) bool {
+	if len(s) < 2 || s[0] != 'v' {
+		return false
+	}
+	_, err := strconv.Atoi(s[1:])
+	return err == nil
+}
+
+// visitor iterates over every AST node and generates code as appropriate.
+type visitor struct {
+	*Generator
+	w       bytes.Buffer
+	err     error
+	decl    *ast.GenDecl
+	imports map[string]bool
+	pkg     string                     // name of the raw package within the file
+	codecs  map[string]string          // user-defined field types and their exported types
+	nested  map[string]*ast.StructType // raw structs used as field types of other raw structs
+	version int                        // version of the raw struct being generated, if any
+	names   map[string]string          // exported names set by name tags on the raw struct being generated
+
+	presence string              // raw.Presence field of the raw struct being generated, if any
+	optional map[string]int      // presence bits of its optional fields
+	nulls    map[string]bool     // its fields with null types
+	lazy     bool                // whether its fields are decoded lazily
+	validate bool                // whether it's validated when it's encoded and decoded
+	enums    map[string]*enum    // its enum fields
+	flags    map[string]*flagSet // its flag fields
+	defaults map[string]string   // default values of its fields with one
+	tag      string              // constant holding its type tag, if records are tagged
+	ints     map[string]string   // its int and uint fields and their types
+
+	file     *ast.File                    // file being generated, if any
+	packages map[string]map[string]string // exported raw structs by import path
+
+	schema *Schema // schema being built instead of generating code, if any
+}
+
+// Visit implements the ast.Visitor interface. It is called once for every AST node.
+func (v *visitor) Visit(node ast.Node) ast.Visitor {
+	if v.err != nil || node == nil {
+		return nil
+	}
+
+	switch node := node.(type) {
+	case *ast.GenDecl:
+		v.decl = node
+	case *ast.TypeSpec:
+		if err := v.visitTypeSpec(node); err != nil {
+			v.err = err
+		}
+	}
+	return v
+}
+
+// visitTypeSpec is called for every type declaration. Each declaration is
+// checked for raw usage and an exported type is generated if appropriate.
+func (v *visitor) visitTypeSpec(node *ast.TypeSpec) error {
+	// Only process struct types.
+	s, ok := node.Type.(*ast.StructType)
+	if !ok {
+		return nil
+	}
+
+	// Resolve raw structs from other packages used as field types.
+	if err := v.resolveFields(s); err != nil {
+		return fmt.Errorf("%s: %s", node.Name.Name, err)
+	}
+
+	// Check if this struct type contains only raw fields.
+	if !v.isRawStructType(s) {
+		v.tracef("not raw: %s", node.Name.Name)
+		return nil
+	}
+
+	// Read pragmas from the type's doc comment. A declaration with a single
+	// spec attaches its doc comment to the declaration instead.
+	doc := node.Doc
+	if doc == nil && v.decl != nil && len(v.decl.Specs) == 1 {
+		doc = v.decl.Doc
+	}
+	pragmas := parsePragmas(doc)
+
+	// Ignore structs that have opted out of generation.
+	if _, ok := pragmas["skip"]; ok {
+		v.tracef("skipping by request: %s", node.Name.Name)
+		return nil
+	}
+
+	// User-defined field types encode themselves.
+	if _, ok := v.codecs[node.Name.Name]; ok && v.nested[node.Name.Name] == nil {
+		v.tracef("skipping field type: %s", node.Name.Name)
+		return nil
+	}
+
+	// Disallow raw structs that are exported.
+	if unicode.IsUpper(rune(node.Name.Name[0])) {
+		return fmt.Errorf("raw struct cannot be exported: %s", node.Name.Name)
+	}
+
+	// Versioned records start with a version byte that is set by Encode and
+	// checked by Decode.
+	version, err := parseVersion(s, pragmas)
+	if err != nil {
+		return fmt.Errorf("%s: %s", node.Name.Name, err)
+	} else if _, ok := pragmas["ctype"]; ok && version > 0 {
+		return fmt.Errorf("%s: version is not supported with ctype", node.Name.Name)
+	} else if v.ExplicitLayout && version > 0 {
+		return fmt.Errorf("%s: version is not supported with explicit layouts", node.Name.Name)
+	}
+	v.version = version
+	_, v.lazy = pragmas["lazy"]
+
+	// Validated records are checked by Validate when they're encoded and
+	// decoded.
+	if _, v.validate = pragmas["validate"]; v.validate && !hasConstraints(s) {
+		return fmt.Errorf("%s: validate requires a field with a min, max, or nonzero tag", node.Name.Name)
+	} else if v.validate && v.lazy {
+		return fmt.Errorf("%s: validate is not supported with lazy", node.Name.Name)
+	}
+
+	// Lazily decoded fields are only decoded when they're first read.
+	if v.lazy {
+		if err := v.validateLazy(s, pragmas); err != nil {
+			return fmt.Errorf("%s: %s", node.Name.Name, err)
+		}
+	}
+
+	// Promote the fields of embedded raw structs. The raw struct still embeds
+	// them so generated code reaches their fields through promotion.
+	if v.hasEmbedded(s) {
+		if v.portable() {
+			return fmt.Errorf("%s: embedded raw structs are not supported with portable encoding", node.Name.Name)
+		} else if v.ExplicitLayout {
+			return fmt.Errorf("%s: embedded raw structs are not supported with explicit layouts", node.Name.Name)
+		}
+		s = v.flatten(s)
+	}
+
+	// Int and uint fields are encoded with a width of IntWidth bits, so
+	// portable code encodes them as fixed width integers.
+	v.ints = v.intFields(s)
+	if _, ok := pragmas["ctype"]; ok && len(v.ints) > 0 {
+		return fmt.Errorf("%s: int fields are not supported with ctype", node.Name.Name)
+	} else if v.portable() {
+		s = v.fixedInts(s)
+	}
+
+	// Validate the struct tags on each field.
+	if err := validateTags(s); err != nil {
+		return fmt.Errorf("%s: %s", node.Name.Name, err)
+	}
+
+	// Validate the offset widths of string fields.
+	if err := validateWidths(s, pragmas); err != nil {
+		return fmt.Errorf("%s: %s", node.Name.Name, err)
+	}
+
+	// Optional fields record whether they're set in a raw.Presence field.
+	presence, optional, err := v.optionalFields(s, pragmas)
+	if err != nil {
+		return fmt.Errorf("%s: %s", node.Name.Name, err)
+	}
+	v.presence, v.optional = presence, optional
+
+	// Null fields record whether they're set in their own Valid flag.
+	v.nulls = nullFields(s)
+	if _, ok := pragmas["ctype"]; ok && len(v.nulls) > 0 {
+		return fmt.Errorf("%s: null fields are not supported with ctype", node.Name.Name)
+	}
+
+	// Fields tagged with "-" are still part of the record but have no
+	// exported field or accessor. The full struct is kept for code that
+	// depends on the layout of every field.
+	full := s
+	s = withoutSkipped(s)
+	orig := withoutSkipped(node.Type.(*ast.StructType))
+
+	// The presence field is set by the generated code so it isn't part of
+	// the exported type.
+	if presence != "" {
+		s, orig = withoutField(s, presence), withoutField(orig, presence)
+	}
+
+	// Validate the generated field names.
+	v.names = tagNames(s)
+	if err := v.validateNames(s); err != nil {
+		return fmt.Errorf("%s: %s", node.Name.Name, err)
+	}
+
+	// The version field is set by the generated code so it isn't part of the
+	// exported type.
+	if version > 0 {
+		s, orig = withoutVersion(s), withoutVersion(orig)
+	}
+
+	// Generate an exported name.
+	unexp := node.Name.Name
+	exp := tocamelcase(node.Name.Name)
+
+	v.tracef("• processing: %s -> %s", unexp, exp)
+
+	// Enum fields have a generated type on the exported type.
+	enums, err := v.enumFields(exp, s)
+	if err != nil {
+		return fmt.Errorf("%s: %s", unexp, err)
+	} else if _, ok := pragmas["ctype"]; ok && len(enums) > 0 {
+		return fmt.Errorf("%s: enum fields are not supported with ctype", unexp)
+	}
+	v.enums = enums
+
+	// Flag fields also have a generated type on the exported type.
+	flags, err := v.flagFields(exp, s)
+	if err != nil {
+		return fmt.Errorf("%s: %s", unexp, err)
+	} else if _, ok := pragmas["ctype"]; ok && len(flags) > 0 {
+		return fmt.Errorf("%s: flag fields are not supported with ctype", unexp)
+	}
+	v.flags = flags
+
+	// Optional and null fields may have a default for when they're unset.
+	defaults, err := v.defaultFields(exp, s)
+	if err != nil {
+		return fmt.Errorf("%s: %s", unexp, err)
+	}
+	v.defaults = defaults
+
+	// Tagged records are prefixed with the type tag of their raw struct.
+	v.tag = ""
+	if _, ok := pragmas["ctype"]; !ok && v.TypeTag {
+		v.tag = exp + "TypeTag"
+	}
+
+	// Describe the layout of every field, including skipped and version
+	// fields, instead of generating code when building a schema.
+	if v.schema != nil {
+		data, err := v.describeStruct(unexp, exp, v.fixedInts(full), pragmas)
+		if err != nil {
+			return fmt.Errorf("%s: %s", unexp, err)
+		}
+		v.schema.Structs = append(v.schema.Structs, data)
+		return nil
+	}
+
+	// Native code copies padding into encoded records, so it must be declared
+	// with blank fields to be zeroed.
+	if _, ok := pragmas["ctype"]; !ok && !v.portable() && !v.AllowPadding {
+		if err := implicitPadding(node.Type.(*ast.StructType)); err != nil {
+			return fmt.Errorf("%s: %s", unexp, err)
+		}
+	}
+
+	// Generate exported struct and functions.
+	fmt.Fprint(&v.w, "//raw:codegen:begin\n\n")
+	fmt.Fprint(&v.w, "//\n")
+	fmt.Fprint(&v.w, "// DO NOT CHANGE\n")
+	fmt.Fprint(&v.w, "// This section has been generated by bolt-rawgen.\n")
+	fmt.Fprint(&v.w, "//\n\n")
+
+	// Render a custom template instead of the built-in code, if set.
+	if v.Template != nil {
+		data, err := v.newStruct(unexp, exp, s, full, pragmas)
+		if err != nil {
+			return err
+		}
+		if err := v.Template.Execute(&v.w, data); err != nil {
+			return fmt.Errorf("execute template: %s", err)
+		}
+		fmt.Fprint(&v.w, "\n//raw:codegen:end\n\n")
+		return nil
+	}
+
+	if err := v.writeExportedType(exp, orig, pragmas, &v.w); err != nil {
+		return fmt.Errorf("generate exported type: %s", err)
+	}
+	v.writeEnumTypes(s, &v.w)
+	v.writeFlagTypes(s, &v.w)
+	v.writeConstructor(exp, s, &v.w)
+	if err := v.writeValidateFunc(exp, s, &v.w); err != nil {
+		return fmt.Errorf("generate validate func: %s", err)
+	}
+	v.writeOverflowFunc(exp, s, &v.w)
+
+	// C structs only support decoding.
+	if _, ok := pragmas["ctype"]; ok {
+		if err := v.writeCTypeDecodeFunc(exp, s, &v.w); err != nil {
+			return fmt.Errorf("generate ctype decode func: %s", err)
+		}
+		v.imports["io"] = true
+		for _, f := range s.Fields.List {
+			switch tostr(f.Type) {
+			case "float32", "float64", "complex64", "complex128":
+				v.imports["math"] = true
+			case "raw.Time", "raw.TimeMicro", "raw.TimeMilli", "raw.TimeSec", "raw.Duration":
+				v.imports["time"] = true
+			}
+			if sz, _ := csizeof(tostr(f.Type)); sz > 1 && arrayLen(tostr(f.Type)) == 0 {
+				v.imports["encoding/binary"] = true
+			}
+		}
+		if err := v.writeBinaryFuncs(exp, pragmas, false, &v.w); err != nil {
+			return fmt.Errorf("generate binary funcs: %s", err)
+		}
+		if err := v.writeStringFunc(exp, orig, &v.w); err != nil {
+			return fmt.Errorf("generate string func: %s", err)
+		}
+		if err := v.writeCloneFunc(exp, orig, pragmas, &v.w); err != nil {
+			return fmt.Errorf("generate clone func: %s", err)
+		}
+		if v.Equal {
+			if err := v.writeEqualFuncs(exp, orig, false, &v.w); err != nil {
+				return fmt.Errorf("generate equal funcs: %s", err)
+			}
+		}
+		if msg, ok := pragmas["proto"]; ok {
+			if err := v.writeProtoFuncs(exp, orig, msg, &v.w); err != nil {
+				return fmt.Errorf("%s: generate proto funcs: %s", unexp, err)
+			}
+		}
+		fmt.Fprint(&v.w, "//raw:codegen:end\n\n")
+		return nil
+	}
+
+	if err := v.writeCodecChecks(s, pragmas, &v.w); err != nil {
+		return err
+	}
+	if !v.portable() {
+		v.writeIntWidthCheck(exp, &v.w)
+	}
+	if v.tag != "" {
+		v.writeTypeTagConst(unexp, exp, v.fixedInts(full), &v.w)
+	}
+	if v.Pool {
+		v.writePoolFuncs(unexp, exp, &v.w)
+	}
+
+	// TinyGo does not support mapping records with unsafe, and mapped records
+	// use the platform's byte order, so portable records are encoded and
+	// decoded field by field instead.
+	if v.portable() {
+		if err := v.writePortableFuncs(unexp, exp, full, pragmas, &v.w); err != nil {
+			return fmt.Errorf("generate portable funcs: %s", err)
+		}
+		if err := v.writeEncodeToFunc(unexp, exp, full, &v.w); err != nil {
+			return fmt.Errorf("generate encode to func: %s", err)
+		}
+		if err := v.writeDecodeFromFunc(unexp, exp, full, &v.w); err != nil {
+			return fmt.Errorf("generate decode from func: %s", err)
+		}
+	} else {
+		if v.ExplicitLayout {
+			if err := v.writeLayoutType(unexp, full, &v.w); err != nil {
+				return fmt.Errorf("generate layout type: %s", err)
+			}
+		}
+		if err := v.writeEncodeFunc(unexp, exp, s, &v.w); err != nil {
+			return fmt.Errorf("generate encode func: %s", err)
+		}
+		if err := v.writeAppendEncodeFunc(unexp, exp, s, &v.w); err != nil {
+			return fmt.Errorf("generate append encode func: %s", err)
+		}
+		if v.Arena {
+			if err := v.writeEncodeArenaFunc(unexp, exp, s, &v.w); err != nil {
+				return fmt.Errorf("generate encode arena func: %s", err)
+			}
+		}
+		v.writeEncoderType(exp, &v.w)
+		if err := v.writeEncodeToFunc(unexp, exp, s, &v.w); err != nil {
+			return fmt.Errorf("generate encode to func: %s", err)
+		}
+		if err := v.writeDecodeFunc(unexp, exp, s, pragmas, &v.w); err != nil {
+			return fmt.Errorf("generate decode func: %s", err)
+		}
+		if v.lazy {
+			if err := v.writeLazyFuncs(unexp, exp, s, &v.w); err != nil {
+				return fmt.Errorf("generate lazy funcs: %s", err)
+			}
+		}
+		if version > 0 && !isOlderVersion(unexp, version) {
+			if err := v.writeDecodeAnyFunc(unexp, exp, version, s, &v.w); err != nil {
+				return fmt.Errorf("generate decode any func: %s", err)
+			}
+		}
+		if !v.hasCodecs(s) {
+			if err := v.writeIteratorType(unexp, exp, s, &v.w); err != nil {
+				return fmt.Errorf("generate iterator type: %s", err)
+			}
+			if err := v.writeDecodeFromFunc(unexp, exp, s, &v.w); err != nil {
+				return fmt.Errorf("generate decode from func: %s", err)
+			}
+			v.imports["io"] = true
+		}
+		if err := v.writeAccessorFuncs(unexp, s, &v.w); err != nil {
+			return fmt.Errorf("generate accessor funcs: %s", err)
+		}
+		if err := v.writeRawStringFunc(unexp, s, &v.w); err != nil {
+			return fmt.Errorf("generate raw string func: %s", err)
+		}
+		if err := v.writePatchFuncs(unexp, exp, s, &v.w); err != nil {
+			return fmt.Errorf("generate patch funcs: %s", err)
+		}
+		if err := v.writeFieldFuncs(unexp, exp, s, &v.w); err != nil {
+			return fmt.Errorf("generate field funcs: %s", err)
+		}
+		if err := v.writeViewType(unexp, exp, s, &v.w); err != nil {
+			return fmt.Errorf("generate view type: %s", err)
+		}
+		if _, ok := pragmas["export"]; ok {
+			if err := v.writeExportFuncs(unexp, exp, s, &v.w); err != nil {
+				return fmt.Errorf("generate export funcs: %s", err)
+			}
+		} else if v.nested[unexp] != nil {
+			if err := v.writeCodecFuncs(unexp, exp, s, &v.w); err != nil {
+				return fmt.Errorf("generate codec funcs: %s", err)
+			}
+		}
+		if v.hasEnd(unexp) {
+			if err := v.writeEndFunc(unexp, s, &v.w); err != nil {
+				return fmt.Errorf("generate end func: %s", err)
+			}
+		}
+	}
+	if err := v.writeBinaryFuncs(exp, pragmas, true, &v.w); err != nil {
+		return fmt.Errorf("generate binary funcs: %s", err)
+	}
+	if err := v.writeStringFunc(exp, orig, &v.w); err != nil {
+		return fmt.Errorf("generate string func: %s", err)
+	}
+	if err := v.writeCloneFunc(exp, orig, pragmas, &v.w); err != nil {
+		return fmt.Errorf("generate clone func: %s", err)
+	}
+	if value, ok := pragmas["timestamps"]; ok {
+		if err := v.writeTouchFunc(exp, s, value, &v.w); err != nil {
+			return fmt.Errorf("generate touch func: %s", err)
+		}
+	}
+	if _, ok := pragmas["map"]; ok {
+		if err := v.writeMapFunc(exp, s, &v.w); err != nil {
+			return fmt.Errorf("generate map func: %s", err)
+		}
+	}
+	if v.JSON {
+		if err := v.writeJSONFuncs(unexp, exp, orig, &v.w); err != nil {
+			return fmt.Errorf("generate json funcs: %s", err)
+		}
+	}
+	if v.Equal {
+		if err := v.writeEqualFuncs(exp, orig, true, &v.w); err != nil {
+			return fmt.Errorf("generate equal funcs: %s", err)
+		}
+	}
+	if err := v.writeKeyFuncs(exp, s, &v.w); err != nil {
+		return fmt.Errorf("generate key funcs: %s", err)
+	}
+	if v.SQL {
+		if err := v.writeSQLFuncs(exp, pragmas, &v.w); err != nil {
+			return fmt.Errorf("generate sql funcs: %s", err)
+		}
+	}
+	if msg, ok := pragmas["proto"]; ok {
+		if err := v.writeProtoFuncs(exp, orig, msg, &v.w); err != nil {
+			return fmt.Errorf("%s: generate proto funcs: %s", unexp, err)
+		}
+	}
+	if v.Bolt {
+		if err := v.writeBoltFuncs(unexp, exp, s, pragmas, &v.w); err != nil {
+			return fmt.Errorf("generate bolt funcs: %s", err)
+		}
+		if err := v.writeSchemaFuncs(unexp, exp, full, &v.w); err != nil {
+			return fmt.Errorf("generate schema funcs: %s", err)
+		}
+		v.imports[BoltImportPath] = true
+		v.imports["encoding/binary"] = true
+	}
+	fmt.Fprint(&v.w, "//raw:codegen:end\n\n")
+
+	return nil
+}
+
+// writeExportedType writes a generated exported type for a raw struct type.
+func (v *visitor) writeExportedType(name string, node *ast.StructType, pragmas map[string]string, w io.Writer) error {
+	fmt.Fprintf(w, "type %s struct {\n", name)
+
+	for _, f := range node.Fields.List {
+		typ, err := v.gotype(tostr(f.Type))
+		if err != nil {
+			return err
+		}
+
+		// Embedded raw structs embed their exported type.
+		if len(f.Names) == 0 {
+			fmt.Fprintf(w, "\t%s\n", typ)
+		}
+		if typ == "netip.Addr" {
+			v.imports["net/netip"] = true
+		}
+		for _, n := range f.Names {
+			typ, err := v.fieldType(n.Name, tostr(f.Type))
+			if err != nil {
+				return err
+			}
+			if v.isOptional(n.Name) {
+				fmt.Fprintf(w, "\t%s *%s\n", v.fieldname(n.Name), typ)
+				continue
+			}
+			fmt.Fprintf(w, "\t%s %s\n", v.fieldname(n.Name), typ)
+		}
+	}
+
+	// Retain the decoded bytes when requested.
+	if _, ok := pragmas["retain"]; ok {
+		fmt.Fprintf(w, "\n\traw []byte\n")
+	}
+
+	// Lazily decoded records keep the bytes they're decoded from along with
+	// a bit for each field that's been decoded.
+	if v.lazy {
+		fmt.Fprintf(w, "\n\tlazy   []byte\n")
+		fmt.Fprintf(w, "\tloaded uint64\n")
+	}
+
+	fmt.Fprintf(w, "}\n\n")
+	return nil
+}
+
+// writeLayoutType writes a generated type declaring the layout of a raw
+// struct with explicit padding fields.
+func (v *visitor) writeLayoutType(unexp string, node *ast.StructType, w io.Writer) error {
+	l, ok := layoutOf(node)
+	if !ok {
+		return fmt.Errorf("unknown layout: %s", unexp)
+	}
+
+	fmt.Fprintf(w, "// %sLayout is the memory layout of %s with padding declared explicitly.\n", unexp, unexp)
+	fmt.Fprintf(w, "// The layout is %d bytes.\n", l.size)
+	fmt.Fprintf(w, "type %sLayout struct {\n", unexp)
+	for _, sl := range l.slots {
+		if sl.pad > 0 {
+			fmt.Fprintf(w, "\t_ [%d]byte\n", sl.pad)
+		}
+		typ := sl.typ
+		if strings.HasPrefix(typ, "raw.") {
+			typ = v.pkg + strings.TrimPrefix(typ, "raw")
+		}
+		fmt.Fprintf(w, "\t%s %s // offset %d\n", sl.ident.Name, typ, sl.offset)
+	}
+	if l.tail > 0 {
+		fmt.Fprintf(w, "\t_ [%d]byte\n", l.tail)
+	}
+	fmt.Fprintf(w, "}\n\n")
+
+	// Array lengths must be non-negative so these fail to compile unless
+	// the sizes are equal.
+	fmt.Fprintf(w, "var _ [unsafe.Sizeof(%s{}) - unsafe.Sizeof(%sLayout{})]struct{}\n", unexp, unexp)
+	fmt.Fprintf(w, "var _ [unsafe.Sizeof(%sLayout{}) - unsafe.Sizeof(%s{})]struct{}\n\n", unexp, unexp)
+	return nil
+}
+
+// writeEncodeFunc writes a generated encoding function for a raw struct type.
+func (v *visitor) writeEncodeFunc(unexp, exp string, node *ast.StructType, w io.Writer) error {
+	fmt.Fprintf(w, "func (o *%s) Encode() []byte {\n", exp)
+
+	// Tagged records are appended after their tag instead.
+	if v.tag != "" {
+		v.writeEncodeBuffer(unexp, "0", v.checksumCapacity(v.pkg+".TypeTagSize+int(unsafe.Sizeof("+unexp+"{}))"), w)
+		fmt.Fprintf(w, "\treturn o.AppendEncode(b)\n")
+		fmt.Fprintf(w, "}\n\n")
+		return nil
+	}
+	v.writeLoad("o", w)
+	fmt.Fprintf(w, "\tvar r %s\n", unexp)
+	v.writeEncodeBuffer(unexp, "unsafe.Sizeof(r)", v.checksumCapacity("int(unsafe.Sizeof(r))"), w)
+	if err := v.writeEncodeFields(node, "b", w); err != nil {
+		return err
+	}
+	fmt.Fprintf(w, "\tcopy(b, unsafe.Slice((*byte)(unsafe.Pointer(&r)), unsafe.Sizeof(r)))\n")
+	fmt.Fprintf(w, "\treturn %s\n", v.checksumResult("b", "0"))
+	fmt.Fprintf(w, "}\n\n")
+	return nil
+}
+
+// writeAppendEncodeFunc writes a generated function appending the encoding
+// of a raw struct type to a slice. Each record is encoded into a slice
+// starting at its own offset so that string offsets remain relative to the
+// start of the record.
+func (v *visitor) writeAppendEncodeFunc(unexp, exp string, node *ast.StructType, w io.Writer) error {
+	fmt.Fprintf(w, "// AppendEncode appends the encoding of o to dst and returns the extended\n")
+	fmt.Fprintf(w, "// slice.\n")
+	fmt.Fprintf(w, "func (o *%s) AppendEncode(dst []byte) []byte {\n", exp)
+	v.writeLoad("o", w)
+	fmt.Fprintf(w, "\tvar r %s\n", unexp)
+	v.writeTypeTagAppend(w)
+	fmt.Fprintf(w, "\tstart := len(dst)\n")
+	fmt.Fprintf(w, "\tdst = append(dst, make([]byte, unsafe.Sizeof(r))...)\n")
+	fmt.Fprintf(w, "\tb := dst[start:]\n")
+	if err := v.writeEncodeFields(node, "b", w); err != nil {
+		return err
+	}
+	fmt.Fprintf(w, "\tcopy(b, unsafe.Slice((*byte)(unsafe.Pointer(&r)), unsafe.Sizeof(r)))\n")
+	fmt.Fprintf(w, "\treturn %s\n", v.checksumResult("append(dst[:start], b...)", v.tagStart()))
+	fmt.Fprintf(w, "}\n\n")
+	return nil
+}
+
+// writeEncodeArenaFunc writes a generated function encoding into a slice
+// from an arena. The slice's capacity covers the variable length data too,
+// including that of string lists and of optional and null fields, so it's
+// appended in place unless a field has a codec, whose size isn't known.
+func (v *visitor) writeEncodeArenaFunc(unexp, exp string, node *ast.StructType, w io.Writer) error {
+	fmt.Fprintf(w, "// EncodeArena encodes o into a slice from a, which is valid until a is reset.\n")
+	fmt.Fprintf(w, "func (o *%s) EncodeArena(a *%s.Arena) []byte {\n", exp, v.pkg)
+	v.writeLoad("o", w)
+	fmt.Fprintf(w, "\tvar r %s\n", unexp)
+	if v.tag != "" {
+		fmt.Fprintf(w, "\tn := %s.TypeTagSize+int(unsafe.Sizeof(r))", v.pkg)
+	} else {
+		fmt.Fprintf(w, "\tn := int(unsafe.Sizeof(r))")
+	}
+	var lists, optional []string
+	for _, f := range node.Fields.List {
+		typ := tostr(f.Type)
+		for _, n := range f.Names {
+			if v.isOptional(n.Name) {
+				if stringWidth(typ) > 0 {
+					optional = append(optional, v.fieldname(n.Name))
+				}
+			} else if elem := sliceElem(typ); elem != "" {
+				// Elements may be padded to align them.
+				size, _ := sizeof(elem)
+				fmt.Fprintf(w, "+len(o.%s)*%d+%d", v.fieldname(n.Name), size, size-1)
+			} else if typ == "raw.StringList" {
+				fmt.Fprintf(w, "+len(o.%s)*4+1", v.fieldname(n.Name))
+				lists = append(lists, v.fieldname(n.Name))
+			} else if stringWidth(typ) > 0 {
+				fmt.Fprintf(w, "+len(o.%s)", v.fieldname(n.Name))
+			}
+		}
+	}
+	fmt.Fprintf(w, "\n")
+	for _, name := range lists {
+		fmt.Fprintf(w, "\tfor _, s := range o.%s {\n", name)
+		fmt.Fprintf(w, "\t\tn += len(s)\n")
+		fmt.Fprintf(w, "\t}\n")
+	}
+	for _, name := range optional {
+		fmt.Fprintf(w, "\tif o.%s != nil {\n", name)
+		fmt.Fprintf(w, "\t\tn += len(*o.%s)\n", name)
+		fmt.Fprintf(w, "\t}\n")
+	}
+	if v.tag != "" {
+		fmt.Fprintf(w, "\tb := a.Alloc(0, %s)\n", v.checksumCapacity("n"))
+	} else {
+		fmt.Fprintf(w, "\tb := a.Alloc(int(unsafe.Sizeof(r)), %s)\n", v.checksumCapacity("n"))
+	}
+
+	// Tagged records are appended after their tag in place.
+	if v.tag != "" {
+		fmt.Fprintf(w, "\treturn o.AppendEncode(b)\n")
+		fmt.Fprintf(w, "}\n\n")
+		return nil
+	}
+	if err := v.writeEncodeFields(node, "b", w); err != nil {
+		return err
+	}
+	fmt.Fprintf(w, "\tcopy(b, unsafe.Slice((*byte)(unsafe.Pointer(&r)), unsafe.Sizeof(r)))\n")
+	fmt.Fprintf(w, "\treturn %s\n", v.checksumResult("b", "0"))
+	fmt.Fprintf(w, "}\n\n")
+	return nil
+}
+
+// writeEncodeFields writes the statements that copy each field of an exported
+// value, o, into a raw value, r. Variable length data is appended to buf.
+func (v *visitor) writeEncodeFields(node *ast.StructType, buf string, w io.Writer) error {
+	if v.version > 0 {
+		fmt.Fprintf(w, "\tr.version = %d\n", v.version)
+	}
+	for _, f := range node.Fields.List {
+		typ := tostr(f.Type)
+		for _, n := range f.Names {
+			if v.isOptional(n.Name) {
+				if err := v.writeOptionalEncode(typ, n.Name, buf, w); err != nil {
+					return err
+				}
+				continue
+			} else if _, ok := v.codecs[typ]; ok || stringWidth(typ) > 0 {
+				fmt.Fprintf(w, "\tr.%s.Encode(o.%s, &%s)\n", n.Name, v.fieldname(n.Name), buf)
+				continue
+			}
+			value, err := v.rawValue(typ, "o."+v.fieldname(n.Name))
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(w, "\tr.%s = %s\n", n.Name, value)
+		}
+	}
+	return nil
+}
+
+// rawValue returns an expression converting expr, a value of the exported
+// type, to a fixed size raw type.
+func (v *visitor) rawValue(typ, expr string) (string, error) {
+	switch typ {
+	case "bool":
+		return expr, nil
+	case "int8", "int16", "int32", "int64", "uint8", "uint16", "uint32", "uint64", "float32", "float64", "complex64", "complex128", "int", "uint":
+		return typ + "(" + expr + ")", nil
+	case "raw.Time", "raw.TimeMicro", "raw.TimeMilli", "raw.TimeSec":
+		return v.pkg + strings.TrimPrefix(typ, "raw") + "(" + timeUnix(typ, expr) + ")", nil
+	case "raw.ZonedTime":
+		return v.pkg + ".NewZonedTime(" + expr + ")", nil
+	case "raw.IP":
+		return v.pkg + ".NewIP(" + expr + ")", nil
+	case "raw.Decimal", "raw.Int128", "raw.Uint128":
+		return expr, nil
+	case "raw.Duration", "raw.Flags8", "raw.Flags16", "raw.Flags32":
+		return v.pkg + strings.TrimPrefix(typ, "raw") + "(" + expr + ")", nil
+	case "raw.NullInt64":
+		return v.pkg + ".NullInt64{Int64: int64(" + expr + "), Valid: true}", nil
+	case "raw.NullFloat64":
+		return v.pkg + ".NullFloat64{Float64: " + expr + ", Valid: true}", nil
+	}
+	if arrayLen(typ) > 0 {
+		return expr, nil
+	}
+	return "", fmt.Errorf("invalid raw type: %s", typ)
+}
+
+// writeEncoderType writes a generated encoder type that appends many encoded
+// records into a single reusable buffer.
+func (v *visitor) writeEncoderType(exp string, w io.Writer) {
+	fmt.Fprintf(w, "// %sEncoder encodes %s records into a single reusable buffer.\n", exp, exp)
+	fmt.Fprintf(w, "type %sEncoder struct {\n", exp)
+	fmt.Fprintf(w, "\tbuf []byte\n")
+	fmt.Fprintf(w, "}\n\n")
+
+	fmt.Fprintf(w, "// New%sEncoder returns an encoder with an empty buffer.\n", exp)
+	fmt.Fprintf(w, "func New%sEncoder() *%sEncoder {\n", exp, exp)
+	fmt.Fprintf(w, "\treturn &%sEncoder{}\n", exp)
+	fmt.Fprintf(w, "}\n\n")
+
+	fmt.Fprintf(w, "// Append appends the encoding of o to the buffer.\n")
+	fmt.Fprintf(w, "func (e *%sEncoder) Append(o *%s) {\n", exp, exp)
+	fmt.Fprintf(w, "\te.buf = o.AppendEncode(e.buf)\n")
+	fmt.Fprintf(w, "}\n\n")
+
+	fmt.Fprintf(w, "// Bytes returns the records encoded since the last reset.\n")
+	fmt.Fprintf(w, "func (e *%sEncoder) Bytes() []byte { return e.buf }\n\n", exp)
+	fmt.Fprintf(w, "// Reset empties the buffer, keeping its memory for reuse.\n")
+	fmt.Fprintf(w, "func (e *%sEncoder) Reset() { e.buf = e.buf[:0] }\n\n", exp)
+}
+
+// writeDecodeFunc writes a generated decoding function for a raw struct type.
+// The length of the record and the bounds of its strings are checked before
+// decoding. Returns io.ErrUnexpectedEOF if the record is too short.
+func (v *visitor) writeDecodeFunc(unexp, exp string, node *ast.StructType, pragmas map[string]string, w io.Writer) error {
+	fmt.Fprintf(w, "func (o *%s) Decode(b []byte) error {\n", exp)
+	v.writeUnwrap("", w)
+
+	// The version is checked first as other versions may be shorter.
+	if v.version > 0 {
+		fmt.Fprintf(w, "\tif len(b) > 0 && b[0] != %d {\n", v.version)
+		fmt.Fprintf(w, "\t\treturn %s.ErrVersion\n", v.pkg)
+		fmt.Fprintf(w, "\t}\n")
+	}
+	fmt.Fprintf(w, "\tif len(b) < int(unsafe.Sizeof(%s{})) {\n", unexp)
+	fmt.Fprintf(w, "\t\treturn io.ErrUnexpectedEOF\n")
+	fmt.Fprintf(w, "\t}\n")
+	fmt.Fprintf(w, "\tr := (*%s)(unsafe.Pointer(&b[0]))\n", unexp)
+	strs := writeBoundsCheck(node, "io.ErrUnexpectedEOF", w)
+	v.writeEnumCheck(node, v.pkg+".ErrInvalidEnum", w)
+	if _, ok := pragmas["retain"]; ok {
+		writeRecordLen("unsafe.Sizeof(*r)", "r", strs, w)
+		fmt.Fprintf(w, "\tif n > len(b) {\n")
+		fmt.Fprintf(w, "\t\treturn io.ErrUnexpectedEOF\n")
+		fmt.Fprintf(w, "\t}\n")
+	}
+	v.imports["io"] = true
+
+	// Lazily decoded fields are decoded from the record by their getters.
+	_, retain := pragmas["retain"]
+	if v.lazy {
+		fmt.Fprintf(w, "\t*o = %s{lazy: b}\n", exp)
+	} else {
+		for _, f := range node.Fields.List {
+			for _, n := range f.Names {
+				v.writeDecodeField(n.Name, tostr(f.Type), "b", w)
+			}
+		}
+	}
+
+	// Retain the bytes of the record, which end after the last string.
+	if retain {
+		fmt.Fprintf(w, "\to.raw = b[:n]\n")
+	}
+
+	fmt.Fprintf(w, "\treturn %s\n", v.decodeResult())
+	fmt.Fprintf(w, "}\n\n")
+
+	if retain {
+		fmt.Fprintf(w, "// Raw returns the bytes that o was decoded from. It reflects the record at\n")
+		fmt.Fprintf(w, "// the time of decoding, not any later changes to o, and shares memory with\n")
+		fmt.Fprintf(w, "// the slice passed to Decode.\n")
+		fmt.Fprintf(w, "func (o *%s) Raw() []byte { return o.raw }\n\n", exp)
+	}
+	return nil
+}
+
+// writeDecodeField writes the statements decoding a field of a raw value, r,
+// into an exported value, o, where buf is the record containing r.
+func (v *visitor) writeDecodeField(name, typ, buf string, w io.Writer) {
+	// Binary data is copied so it doesn't share memory with buf.
+	exp := v.fieldname(name)
+	if _, ok := v.codecs[typ]; ok || decodesCopy(typ) {
+		fmt.Fprintf(w, "\to.%s = r.%s.Decode(%s)\n", exp, name, buf)
+	} else if v.isOptional(name) {
+		if value, ok := v.defaults[name]; ok {
+			fmt.Fprintf(w, "\to.%s = %s\n", exp, value)
+		} else {
+			fmt.Fprintf(w, "\to.%s = nil\n", exp)
+		}
+		fmt.Fprintf(w, "\tif r.Has%s() {\n", exp)
+		fmt.Fprintf(w, "\t\tx := r.%s()\n", exp)
+		fmt.Fprintf(w, "\t\to.%s = &x\n", exp)
+		fmt.Fprintf(w, "\t}\n")
+	} else {
+		fmt.Fprintf(w, "\to.%s = r.%s()\n", exp, exp)
+	}
+}
+
+// writeBoundsCheck writes a statement returning err if the data of any
+// variable length field of a raw value, r, is outside of b. Returns the
+// names of the variable length fields.
+func writeBoundsCheck(node *ast.StructType, err string, w io.Writer) []string {
+	var strs, lists []string
+	for _, f := range node.Fields.List {
+		if typ := tostr(f.Type); stringWidth(typ) > 0 {
+			for _, n := range f.Names {
+				strs = append(strs, n.Name)
+				if typ == "raw.StringList" {
+					lists = append(lists, n.Name)
+				}
+			}
+		}
+	}
+	if len(strs) == 0 {
+		return nil
+	}
+
+	fmt.Fprintf(w, "\tif ")
+	for i, name := range strs {
+		if i > 0 {
+			fmt.Fprintf(w, " || ")
+		}
+		fmt.Fprintf(w, "r.%s.End() > len(b)", name)
+	}
+
+	// The strings of a list are checked individually.
+	for _, name := range lists {
+		fmt.Fprintf(w, " || !r.%s.Valid(b)", name)
+	}
+	fmt.Fprintf(w, " {\n")
+	fmt.Fprintf(w, "\t\treturn %s\n", err)
+	fmt.Fprintf(w, "\t}\n")
+	return strs
+}
+
+// writeRecordLen writes a statement setting n to the length of an encoded
+// record, which ends after its fixed section or its last variable length
+// field, whichever is later.
+func writeRecordLen(size, recv string, fields []string, w io.Writer) {
+	fmt.Fprintf(w, "\tn := int(%s)\n", size)
+	for _, name := range fields {
+		fmt.Fprintf(w, "\tif end := %s.%s.End(); end > n {\n", recv, name)
+		fmt.Fprintf(w, "\t\tn = end\n")
+		fmt.Fprintf(w, "\t}\n")
+	}
+}
+
+// writeIteratorType writes a generated iterator type that decodes records
+// encoded one after another, such as by an encoder type.
+func (v *visitor) writeIteratorType(unexp, exp string, node *ast.StructType, w io.Writer) error {
+	fmt.Fprintf(w, "// %sIterator iterates over %s records encoded one after another.\n", exp, exp)
+	fmt.Fprintf(w, "type %sIterator struct {\n", exp)
+	fmt.Fprintf(w, "\tb   []byte\n")
+	fmt.Fprintf(w, "\terr error\n")
+	fmt.Fprintf(w, "}\n\n")
+
+	fmt.Fprintf(w, "func Iter%s(b []byte) *%sIterator {\n", exp, exp)
+	fmt.Fprintf(w, "\treturn &%sIterator{b: b}\n", exp)
+	fmt.Fprintf(w, "}\n\n")
+
+	// Variable length data is stored after the fixed section so each record
+	// ends at the end of its last variable length field.
+	fmt.Fprintf(w, "// Next decodes the next record. Returns false at the end of the records or\n")
+	fmt.Fprintf(w, "// if the remaining bytes are not a valid record.\n")
+	fmt.Fprintf(w, "func (it *%sIterator) Next() (*%s, bool) {\n", exp, exp)
+	fmt.Fprintf(w, "\tif len(it.b) == 0 || it.err != nil {\n")
+	fmt.Fprintf(w, "\t\treturn nil, false\n")
+	fmt.Fprintf(w, "\t}\n")
+	fmt.Fprintf(w, "\tvar r %s\n", unexp)
+	fmt.Fprintf(w, "\tif len(it.b) < %s {\n", v.tagSize("int(unsafe.Sizeof(r))"))
+	fmt.Fprintf(w, "\t\tit.err = io.ErrUnexpectedEOF\n")
+	fmt.Fprintf(w, "\t\treturn nil, false\n")
+	fmt.Fprintf(w, "\t}\n")
+
+	var strs []string
+	for _, f := range node.Fields.List {
+		if stringWidth(tostr(f.Type)) > 0 {
+			for _, n := range f.Names {
+				strs = append(strs, n.Name)
+			}
+		}
+	}
+	if len(strs) > 0 {
+		fmt.Fprintf(w, "\tp := (*%s)(unsafe.Pointer(&it.b[%s]))\n", unexp, v.tagOffset())
+	}
+	writeRecordLen("unsafe.Sizeof(r)", "p", strs, w)
+	v.writeTypeTagLen(w)
+	v.writeChecksumLen(w)
+	fmt.Fprintf(w, "\tif n > len(it.b) {\n")
+	fmt.Fprintf(w, "\t\tit.err = io.ErrUnexpectedEOF\n")
+	fmt.Fprintf(w, "\t\treturn nil, false\n")
+	fmt.Fprintf(w, "\t}\n")
+	fmt.Fprintf(w, "\to := &%s{}\n", exp)
+	fmt.Fprintf(w, "\tif err := o.Decode(it.b[:n]); err != nil {\n")
+	fmt.Fprintf(w, "\t\tit.err = err\n")
+	fmt.Fprintf(w, "\t\treturn nil, false\n")
+	fmt.Fprintf(w, "\t}\n")
+	fmt.Fprintf(w, "\tit.b = it.b[n:]\n")
+	fmt.Fprintf(w, "\treturn o, true\n")
+	fmt.Fprintf(w, "}\n\n")
+
+	fmt.Fprintf(w, "// All returns a function for ranging over the remaining records.\n")
+	fmt.Fprintf(w, "func (it *%sIterator) All() func(yield func(*%s) bool) {\n", exp, exp)
+	fmt.Fprintf(w, "\treturn func(yield func(*%s) bool) {\n", exp)
+	fmt.Fprintf(w, "\t\tfor {\n")
+	fmt.Fprintf(w, "\t\t\tif o, ok := it.Next(); !ok || !yield(o) {\n")
+	fmt.Fprintf(w, "\t\t\t\treturn\n")
+	fmt.Fprintf(w, "\t\t\t}\n")
+	fmt.Fprintf(w, "\t\t}\n")
+	fmt.Fprintf(w, "\t}\n")
+	fmt.Fprintf(w, "}\n\n")
+
+	fmt.Fprintf(w, "// Err returns the error that stopped iteration, if any.\n")
+	fmt.Fprintf(w, "func (it *%sIterator) Err() error { return it.err }\n\n", exp)
+	return nil
+}
+
+// writePatchFuncs writes generated functions that overwrite a single field of
+// an encoded record in place. Strings are stored in the variable length tail
+// so they cannot be patched. The checksum of a checksummed record is verified
+// before the field is overwritten and then rewritten, so a corrupt record
+// isn't given a valid checksum, and so is the type tag of a tagged record.
+func (v *visitor) writePatchFuncs(unexp, exp string, node *ast.StructType, w io.Writer) error {
+	for _, f := range node.Fields.List {
+		typ := tostr(f.Type)
+		if _, ok := v.codecs[typ]; ok || stringWidth(typ) > 0 {
+			continue
+		}
+		for _, n := range f.Names {
+			gotyp, err := v.fieldType(n.Name, typ)
+			if err != nil {
+				return err
+			}
+			value, err := v.rawValue(typ, "v")
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(w, "// Patch%s%s overwrites the %s field of an encoded %s in place.\n", exp, v.fieldname(n.Name), v.fieldname(n.Name), exp)
+			fmt.Fprintf(w, "func Patch%s%s(b []byte, v %s) error {\n", exp, v.fieldname(n.Name), gotyp)
+			if v.Checksum {
+				fmt.Fprintf(w, "\tif _, err := %s.VerifyChecksum(b); err != nil {\n", v.pkg)
+				fmt.Fprintf(w, "\t\treturn err\n")
+				fmt.Fprintf(w, "\t}\n")
+			}
+			if v.tag != "" {
+				fmt.Fprintf(w, "\tif _, err := %s.VerifyTypeTag(b, %s); err != nil {\n", v.pkg, v.tag)
+				fmt.Fprintf(w, "\t\treturn err\n")
+				fmt.Fprintf(w, "\t}\n")
+			}
+			fmt.Fprintf(w, "\tif len(b) < %s {\n", v.checksumCapacity(v.tagSize(fmt.Sprintf("int(unsafe.Sizeof(%s{}))", unexp))))
+			fmt.Fprintf(w, "\t\treturn io.ErrUnexpectedEOF\n")
+			fmt.Fprintf(w, "\t}\n")
+			if v.isOptional(n.Name) {
+				fmt.Fprintf(w, "\tr := (*%s)(unsafe.Pointer(&b[%s]))\n", unexp, v.tagOffset())
+				fmt.Fprintf(w, "\tr.%s = %s\n", n.Name, value)
+				if bit, ok := v.optional[n.Name]; ok {
+					fmt.Fprintf(w, "\tr.%s.Set(%d)\n", v.presence, bit)
+				}
+			} else {
+				fmt.Fprintf(w, "\t(*%s)(unsafe.Pointer(&b[%s])).%s = %s\n", unexp, v.tagOffset(), n.Name, value)
+			}
+			if v.Checksum {
+				fmt.Fprintf(w, "\t%s.PutChecksum(b)\n", v.pkg)
+			}
+			v.imports["io"] = true
+			fmt.Fprintf(w, "\treturn nil\n")
+			fmt.Fprintf(w, "}\n\n")
+		}
+	}
+	return nil
+}
+
+// writeFieldFuncs writes generated functions that read a single field from an
+// encoded record without decoding the rest of it. Like Decode, they check the
+// length of the record and the bounds of the field before reading it, and
+// return the field's zero value if the record is too short or corrupt.
+func (v *visitor) writeFieldFuncs(unexp, exp string, node *ast.StructType, w io.Writer) error {
+	helpers := v.boltHelpers()
+	for _, f := range node.Fields.List {
+		typ := tostr(f.Type)
+		for _, n := range f.Names {
+			gotyp, err := v.fieldType(n.Name, typ)
+			if err != nil {
+				return err
+			}
+			name := v.fieldname(n.Name)
+			if other, ok := helpers[exp+name]; ok {
+				return fmt.Errorf("%s: field function %s%s conflicts with generated bolt helper of %s", n.Name, exp, name, other)
+			}
+			fmt.Fprintf(w, "// %s%s returns the %s field of an encoded %s, or the zero value if the\n", exp, name, name, exp)
+			fmt.Fprintf(w, "// record is too short or corrupt.\n")
+			fmt.Fprintf(w, "func %s%s(b []byte) (x %s) {\n", exp, name, gotyp)
+			size := fmt.Sprintf("int(unsafe.Sizeof(%s{}))", unexp)
+			if v.tag != "" {
+				size = v.tagOffset() + "+" + size
+			}
+			fmt.Fprintf(w, "\tif len(b) < %s {\n", size)
+			fmt.Fprintf(w, "\t\treturn x\n")
+			fmt.Fprintf(w, "\t}\n")
+			if v.tag != "" {
+				fmt.Fprintf(w, "\tb = %s\n", v.untagged("b"))
+			}
+			fmt.Fprintf(w, "\tr := (*%s)(unsafe.Pointer(&b[0]))\n", unexp)
+			writeBoundsCheck(&ast.StructType{Fields: &ast.FieldList{List: []*ast.Field{{Names: []*ast.Ident{n}, Type: f.Type}}}}, "x", w)
+			if _, ok := v.codecs[typ]; ok {
+				fmt.Fprintf(w, "\treturn r.%s.Decode(b)\n", n.Name)
+			} else {
+				fmt.Fprintf(w, "\treturn r.%s()\n", name)
+			}
+			fmt.Fprintf(w, "}\n\n")
+		}
+	}
+	return nil
+}
+
+// writeTouchFunc writes a generated function that sets the created and updated
+// times of a record. The pragma value names the created and updated time
+// fields, separated by a comma, and defaults to "createdAt,updatedAt".
+func (v *visitor) writeTouchFunc(exp string, node *ast.StructType, value string, w io.Writer) error {
+	if value == "" {
+		value = "createdAt,updatedAt"
+	}
+	names := strings.Split(value, ",")
+	if len(names) != 2 {
+		return fmt.Errorf("invalid timestamps: %q", value)
+	}
+	for _, name := range names {
+		if typ := fieldType(node, name); typ == "" {
+			return fmt.Errorf("timestamp field not found: %s", name)
+		} else if !isTime(typ) {
+			return fmt.Errorf("timestamp field must be a raw time type: %s", name)
+		} else if v.isOptional(name) {
+			return fmt.Errorf("timestamp field cannot be optional: %s", name)
+		}
+	}
+	created, updated := v.fieldname(names[0]), v.fieldname(names[1])
+
+	fmt.Fprintf(w, "// Touch sets %s to the current time. %s is also set if it is zero.\n", updated, created)
+	fmt.Fprintf(w, "func (o *%s) Touch() {\n", exp)
+	v.writeLoad("o", w)
+	fmt.Fprintf(w, "\tnow := time.Now().UTC()\n")
+	fmt.Fprintf(w, "\tif o.%s.IsZero() {\n", created)
+	fmt.Fprintf(w, "\t\to.%s = now\n", created)
+	fmt.Fprintf(w, "\t}\n")
+	fmt.Fprintf(w, "\to.%s = now\n", updated)
+	fmt.Fprintf(w, "}\n\n")
+	return nil
+}
+
+// writeMapFunc writes a generated function that returns the fields of an
+// exported type keyed by their exported names.
+func (v *visitor) writeMapFunc(exp string, node *ast.StructType, w io.Writer) error {
+	fmt.Fprintf(w, "// Map returns the fields of o keyed by name.\n")
+	fmt.Fprintf(w, "func (o *%s) Map() map[string]interface{} {\n", exp)
+	v.writeLoad("o", w)
+	fmt.Fprintf(w, "\treturn map[string]interface{}{\n")
+	for _, f := range node.Fields.List {
+		for _, n := range f.Names {
+			fmt.Fprintf(w, "\t\t%q: o.%s,\n", v.fieldname(n.Name), v.fieldname(n.Name))
+		}
+	}
+	fmt.Fprintf(w, "\t}\n")
+	fmt.Fprintf(w, "}\n\n")
+	return nil
+}
+
+// writeBinaryFuncs writes generated methods implementing
+// encoding.BinaryUnmarshaler and, if the type can be encoded,
+// encoding.BinaryMarshaler, along with compile-time assertions that it does.
+func (v *visitor) writeBinaryFuncs(exp string, pragmas map[string]string, encode bool, w io.Writer) error {
+	if encode {
+		fmt.Fprintf(w, "var _ encoding.BinaryMarshaler = (*%s)(nil)\n", exp)
+	}
+	fmt.Fprintf(w, "var _ encoding.BinaryUnmarshaler = (*%s)(nil)\n\n", exp)
+
+	if encode {
+		fmt.Fprintf(w, "// MarshalBinary implements encoding.BinaryMarshaler.\n")
+		if v.validate || v.narrowInts() {
+			fmt.Fprintf(w, "func (o *%s) MarshalBinary() ([]byte, error) {\n", exp)
+			v.writeValidateCheck("nil, ", w)
+			fmt.Fprintf(w, "\treturn o.Encode(), nil\n")
+			fmt.Fprintf(w, "}\n\n")
+		} else {
+			fmt.Fprintf(w, "func (o *%s) MarshalBinary() ([]byte, error) { return o.Encode(), nil }\n\n", exp)
+		}
+	}
+
+	// Retained bytes are copied as the caller may reuse them.
+	fmt.Fprintf(w, "// UnmarshalBinary implements encoding.BinaryUnmarshaler.\n")
+	if retainsBytes(pragmas) {
+		fmt.Fprintf(w, "func (o *%s) UnmarshalBinary(b []byte) error { return o.Decode(append([]byte(nil), b...)) }\n\n", exp)
+	} else {
+		fmt.Fprintf(w, "func (o *%s) UnmarshalBinary(b []byte) error { return o.Decode(b) }\n\n", exp)
+	}
+
+	v.imports["encoding"] = true
+	return nil
+}
+
+// writeBoltFuncs writes generated helpers for storing records in bolt. Records
+// are stored in a bucket named by the "bucket" pragma, which defaults to the
+// name of the raw struct. Put and Delete also maintain the index of each
+// field tagged with "index".
+func (v *visitor) writeBoltFuncs(unexp, exp string, node *ast.StructType, pragmas map[string]string, w io.Writer) error {
+	for _, f := range node.Fields.List {
+		for _, n := range f.Names {
+			if name := v.fieldname(n.Name); name == "Append" {
+				return fmt.Errorf("%s: exported name %s conflicts with generated %s method", n.Name, name, name)
+			}
+		}
+	}
+
+	bucket := pragmas["bucket"]
+	if bucket == "" {
+		bucket = unexp
+	}
+	fmt.Fprintf(w, "// %sBucket is the name of the bucket storing %s records.\n", exp, exp)
+	fmt.Fprintf(w, "const %sBucket = %q\n\n", exp, bucket)
+
+	indexed := len(indexFields(node)) > 0
+	if indexed {
+		if err := v.writeIndexFuncs(unexp, exp, bucket, node, w); err != nil {
+			return err
+		}
+	}
+
+	fmt.Fprintf(w, "// Put%s stores o under key, creating the bucket if it doesn't exist.\n", exp)
+	fmt.Fprintf(w, "func Put%s(tx *bolt.Tx, key []byte, o *%s) error {\n", exp, exp)
+	v.writeValidateCheck("", w)
+	fmt.Fprintf(w, "\tb, err := tx.CreateBucketIfNotExists([]byte(%sBucket))\n", exp)
+	fmt.Fprintf(w, "\tif err != nil {\n")
+	fmt.Fprintf(w, "\t\treturn err\n")
+	fmt.Fprintf(w, "\t}\n")
+	if indexed {
+		fmt.Fprintf(w, "\tif err := reindex%s(tx, key, b.Get(key), o); err != nil {\n", exp)
+		fmt.Fprintf(w, "\t\treturn err\n")
+		fmt.Fprintf(w, "\t}\n")
+	}
+	fmt.Fprintf(w, "\treturn b.Put(key, o.Encode())\n")
+	fmt.Fprintf(w, "}\n\n")
+
+	// Values are only valid during the transaction so retained bytes are
+	// copied.
+	fmt.Fprintf(w, "// Get%s returns the record stored under key, or nil if there is none.\n", exp)
+	fmt.Fprintf(w, "func Get%s(tx *bolt.Tx, key []byte) (*%s, error) {\n", exp, exp)
+	fmt.Fprintf(w, "\tb := tx.Bucket([]byte(%sBucket))\n", exp)
+	fmt.Fprintf(w, "\tif b == nil {\n")
+	fmt.Fprintf(w, "\t\treturn nil, nil\n")
+	fmt.Fprintf(w, "\t}\n")
+	fmt.Fprintf(w, "\tv := b.Get(key)\n")
+	fmt.Fprintf(w, "\tif v == nil {\n")
+	fmt.Fprintf(w, "\t\treturn nil, nil\n")
+	fmt.Fprintf(w, "\t}\n")
+	if retainsBytes(pragmas) {
+		fmt.Fprintf(w, "\tv = append([]byte(nil), v...)\n")
+	}
+	fmt.Fprintf(w, "\to := &%s{}\n", exp)
+	fmt.Fprintf(w, "\tif err := o.Decode(v); err != nil {\n")
+	fmt.Fprintf(w, "\t\treturn nil, err\n")
+	fmt.Fprintf(w, "\t}\n")
+	fmt.Fprintf(w, "\treturn o, nil\n")
+	fmt.Fprintf(w, "}\n\n")
+
+	fmt.Fprintf(w, "// Delete%s removes the record stored under key, if any.\n", exp)
+	fmt.Fprintf(w, "func Delete%s(tx *bolt.Tx, key []byte) error {\n", exp)
+	fmt.Fprintf(w, "\tb := tx.Bucket([]byte(%sBucket))\n", exp)
+	fmt.Fprintf(w, "\tif b == nil {\n")
+	fmt.Fprintf(w, "\t\treturn nil\n")
+	fmt.Fprintf(w, "\t}\n")
+	if indexed {
+		fmt.Fprintf(w, "\tif err := unindex%s(tx, key, b.Get(key)); err != nil {\n", exp)
+		fmt.Fprintf(w, "\t\treturn err\n")
+		fmt.Fprintf(w, "\t}\n")
+	}
+	fmt.Fprintf(w, "\treturn b.Delete(key)\n")
+	fmt.Fprintf(w, "}\n\n")
+
+	if err := v.writeBatchFunc(exp, node, w); err != nil {
+		return err
+	}
+	if err := v.writeCursorFuncs(exp, pragmas, w); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(w, "// Append stores o in a bucket using the bucket's next sequence number as\n")
+	fmt.Fprintf(w, "// an 8-byte big-endian key. Returns the sequence number.\n")
+	fmt.Fprintf(w, "func (o *%s) Append(b *bolt.Bucket) (uint64, error) {\n", exp)
+	v.writeValidateCheck("0, ", w)
+	fmt.Fprintf(w, "\tid, err := b.NextSequence()\n")
+	fmt.Fprintf(w, "\tif err != nil {\n")
+	fmt.Fprintf(w, "\t\treturn 0, err\n")
+	fmt.Fprintf(w, "\t}\n")
+	fmt.Fprintf(w, "\tvar k [8]byte\n")
+	fmt.Fprintf(w, "\tbinary.BigEndian.PutUint64(k[:], id)\n")
+	fmt.Fprintf(w, "\treturn id, b.Put(k[:], o.Encode())\n")
+	fmt.Fprintf(w, "}\n\n")
+	return nil
+}
+
+// boltHelpers returns the names of the bolt helpers generated for the raw
+// structs of the file being generated, such as PutUser, mapped to the name of
+// their raw struct. Field functions of a raw struct named put, get, delete,
+// new, or check could have the same names. Returns nil unless bolt helpers are generated.
+func (v *visitor) boltHelpers() map[string]string {
+	if !v.Bolt || v.file == nil {
+		return nil
+	}
+	m := make(map[string]string)
+	for _, decl := range v.file.Decls {
+		d, ok := decl.(*ast.GenDecl)
+		if !ok || d.Tok != token.TYPE {
+			continue
+		}
+		for _, spec := range d.Specs {
+			spec := spec.(*ast.TypeSpec)
+			if s, ok := spec.Type.(*ast.StructType); !ok || !v.isRawStruct(s) || unicode.IsUpper(rune(spec.Name.Name[0])) {
+				continue
+			}
+			exp := tocamelcase(spec.Name.Name)
+			for _, name := range []string{"Put" + exp, "Get" + exp, "Delete" + exp, "Put" + exp + "Batch", "New" + exp + "Cursor", "Check" + exp + "Schema"} {
+				m[name] = spec.Name.Name
+			}
+		}
+	}
+	return m
+}
+
+// writeCTypeDecodeFunc writes a generated decoding function for a raw struct
+// type marked with the "//raw:ctype" pragma. The encoded record is expected to
+// follow the layout of a packed C struct in network byte order:
+//
+//   - Fields are laid out in declaration order with no padding.
+//   - Integers and floats use their natural size and are big-endian.
+//   - A bool is one byte and is true when non-zero.
+//   - A raw.Time or raw.Duration is a big-endian int64 of nanoseconds.
+//   - A raw.TimeMicro or raw.TimeMilli is a big-endian int64 of microseconds
+//     or milliseconds and a raw.TimeSec is a big-endian uint32 of seconds.
+//   - A raw.String is a big-endian uint16 offset followed by a big-endian
+//     uint16 length. The offset is relative to the start of the record.
+//   - A [N]byte array is copied as-is.
+//
+// Decoding returns io.ErrUnexpectedEOF if the record is too short.
+func (v *visitor) writeCTypeDecodeFunc(exp string, node *ast.StructType, w io.Writer) error {
+	fmt.Fprintf(w, "func (o *%s) Decode(b []byte) error {\n", exp)
+
+	// Calculate the size of the fixed section.
+	var sz int
+	for _, f := range node.Fields.List {
+		n, err := csizeof(tostr(f.Type))
+		if err != nil {
+			return err
+		}
+		sz += n * len(f.Names)
+	}
+	fmt.Fprintf(w, "\tif len(b) < %d {\n", sz)
+	fmt.Fprintf(w, "\t\treturn io.ErrUnexpectedEOF\n")
+	fmt.Fprintf(w, "\t}\n")
+
+	var offset int
+	for _, f := range node.Fields.List {
+		typ := tostr(f.Type)
+		size, _ := csizeof(typ)
+		for _, n := range f.Names {
+			name := v.fieldname(n.Name)
+			switch typ {
+			case "bool":
+				fmt.Fprintf(w, "\to.%s = b[%d] != 0\n", name, offset)
+			case "int8":
+				fmt.Fprintf(w, "\to.%s = int(int8(b[%d]))\n", name, offset)
+			case "uint8":
+				fmt.Fprintf(w, "\to.%s = uint(b[%d])\n", name, offset)
+			case "int16", "int32", "int64":
+				fmt.Fprintf(w, "\to.%s = int(%s(binary.BigEndian.Uint%d(b[%d:])))\n", name, typ, size*8, offset)
+			case "uint16", "uint32", "uint64":
+				fmt.Fprintf(w, "\to.%s = uint(binary.BigEndian.Uint%d(b[%d:]))\n", name, size*8, offset)
+			case "float32", "float64":
+				fmt.Fprintf(w, "\to.%s = math.Float%dfrombits(binary.BigEndian.Uint%d(b[%d:]))\n", name, size*8, size*8, offset)
+			case "complex64", "complex128":
+				bits := size * 4
+				fmt.Fprintf(w, "\to.%s = complex(math.Float%dfrombits(binary.BigEndian.Uint%d(b[%d:])), math.Float%dfrombits(binary.BigEndian.Uint%d(b[%d:])))\n", name, bits, bits, offset, bits, bits, offset+size/2)
+			case "raw.Time", "raw.TimeMicro", "raw.TimeMilli", "raw.TimeSec":
+				fmt.Fprintf(w, "\to.%s = %s\n", name, timeValue(typ, fmt.Sprintf("int64(binary.BigEndian.Uint%d(b[%d:]))", size*8, offset)))
+			case "raw.Duration":
+				fmt.Fprintf(w, "\to.%s = time.Duration(binary.BigEndian.Uint64(b[%d:]))\n", name, offset)
+			case "raw.String":
+				fmt.Fprintf(w, "\tif off, n := int(binary.BigEndian.Uint16(b[%d:])), int(binary.BigEndian.Uint16(b[%d:])); off+n > len(b) {\n", offset, offset+2)
+				fmt.Fprintf(w, "\t\treturn io.ErrUnexpectedEOF\n")
+				fmt.Fprintf(w, "\t} else {\n")
+				fmt.Fprintf(w, "\t\to.%s = string(b[off : off+n])\n", name)
+				fmt.Fprintf(w, "\t}\n")
+			default:
+				fmt.Fprintf(w, "\tcopy(o.%s[:], b[%d:%d])\n", name, offset, offset+size)
+			}
+			offset += size
+		}
+	}
+
+	fmt.Fprintf(w, "\treturn %s\n", v.decodeResult())
+	fmt.Fprintf(w, "}\n\n")
+	return nil
+}
+
+// csizeof returns the size of a raw type within a packed C struct.
+func csizeof(typ string) (int, error) {
+	switch typ {
+	case "bool", "int8", "uint8":
+		return 1, nil
+	case "int16", "uint16":
+		return 2, nil
+	case "int32", "uint32", "float32", "raw.TimeSec", "raw.String":
+		return 4, nil
+	case "int64", "uint64", "float64", "complex64", "raw.Time", "raw.TimeMicro", "raw.TimeMilli", "raw.Duration":
+		return 8, nil
+	case "complex128":
+		return 16, nil
+	}
+	if n := arrayLen(typ); n > 0 {
+		return n, nil
+	}
+	return 0, fmt.Errorf("invalid raw type: %s", typ)
+}
+
+// writeAccessorFuncs writes a accessor functions for a raw struct type.
+func (v *visitor) writeAccessorFuncs(name string, node *ast.StructType, w io.Writer) error {
+	for _, f := range node.Fields.List {
+		typ := tostr(f.Type)
+
+		// User-defined types need the whole record so they're decoded by
+		// Decode instead. Nested raw structs know where their strings end
+		// so they're decoded from the record up to that point.
+		if exp, ok := v.codecs[typ]; ok {
+			if v.hasEnd(typ) {
+				for _, n := range f.Names {
+					fmt.Fprintf(w, "func (r *%s) %s() %s { return r.%s.Decode(unsafe.Slice((*byte)(unsafe.Pointer(r)), r.%s.End())) }\n\n", name, v.fieldname(n.Name), exp, n.Name, n.Name)
+				}
+			}
+			continue
+		}
+
+		for _, n := range f.Names {
+			if v.nulls[n.Name] {
+				fmt.Fprintf(w, "func (r *%s) Has%s() bool { return r.%s.Valid }\n", name, v.fieldname(n.Name), n.Name)
+			} else if v.isOptional(n.Name) {
+				fmt.Fprintf(w, "func (r *%s) Has%s() bool { return r.%s.Has(%d) }\n", name, v.fieldname(n.Name), v.presence, v.optional[n.Name])
+			}
+			switch typ {
+			case "bool":
+				fmt.Fprintf(w, "func (r *%s) %s() bool { return r.%s }\n\n", name, v.fieldname(n.Name), n.Name)
+			case "int8", "int16", "int32", "int64", "int":
+				fmt.Fprintf(w, "func (r *%s) %s() int { return int(r.%s) }\n\n", name, v.fieldname(n.Name), n.Name)
+			case "uint8", "uint16", "uint32", "uint64", "uint", "raw.Flags8", "raw.Flags16", "raw.Flags32":
+				gotyp, _ := v.fieldType(n.Name, typ)
+				fmt.Fprintf(w, "func (r *%s) %s() %s { return %s(r.%s) }\n\n", name, v.fieldname(n.Name), gotyp, gotyp, n.Name)
+			case "float32", "float64", "complex64", "complex128":
+				fmt.Fprintf(w, "func (r *%s) %s() %s { return r.%s }\n\n", name, v.fieldname(n.Name), typ, n.Name)
+			case "raw.Time":
+				fmt.Fprintf(w, "func (r *%s) %s() time.Time { return time.Unix(0, int64(r.%s)).UTC() }\n", name, v.fieldname(n.Name), n.Name)
+				fmt.Fprintf(w, "func (r *%s) %sUnix() int64 { return time.Unix(0, int64(r.%s)).Unix() }\n", name, v.fieldname(n.Name), n.Name)
+				fmt.Fprintf(w, "func (r *%s) %sUnixNano() int64 { return int64(r.%s) }\n\n", name, v.fieldname(n.Name), n.Name)
+			case "raw.TimeMicro", "raw.TimeMilli":
+				fmt.Fprintf(w, "func (r *%s) %s() time.Time { return %s }\n", name, v.fieldname(n.Name), timeValue(typ, "int64(r."+n.Name+")"))
+				fmt.Fprintf(w, "func (r *%s) %sUnix() int64 { return %s.Unix() }\n", name, v.fieldname(n.Name), timeValue(typ, "int64(r."+n.Name+")"))
+				fmt.Fprintf(w, "func (r *%s) %sUnix%s() int64 { return int64(r.%s) }\n\n", name, v.fieldname(n.Name), timeUnits[typ], n.Name)
+			case "raw.TimeSec":
+				fmt.Fprintf(w, "func (r *%s) %s() time.Time { return %s }\n", name, v.fieldname(n.Name), timeValue(typ, "int64(r."+n.Name+")"))
+				fmt.Fprintf(w, "func (r *%s) %sUnix() int64 { return int64(r.%s) }\n\n", name, v.fieldname(n.Name), n.Name)
+			case "raw.ZonedTime":
+				fmt.Fprintf(w, "func (r *%s) %s() time.Time { return r.%s.Time() }\n\n", name, v.fieldname(n.Name), n.Name)
+			case "raw.IP":
+				fmt.Fprintf(w, "func (r *%s) %s() netip.Addr { return r.%s.Addr() }\n\n", name, v.fieldname(n.Name), n.Name)
+			case "raw.Decimal":
+				fmt.Fprintf(w, "func (r *%s) %s() %s.Decimal { return r.%s }\n", name, v.fieldname(n.Name), v.pkg, n.Name)
+				fmt.Fprintf(w, "func (r *%s) %sUnscaled() (int64, int) { return r.%s.Unscaled, int(r.%s.Scale) }\n\n", name, v.fieldname(n.Name), n.Name, n.Name)
+			case "raw.Int128", "raw.Uint128":
+				fmt.Fprintf(w, "func (r *%s) %s() %s%s { return r.%s }\n", name, v.fieldname(n.Name), v.pkg, strings.TrimPrefix(typ, "raw"), n.Name)
+				fmt.Fprintf(w, "func (r *%s) %sBig() *big.Int { return r.%s.Big() }\n\n", name, v.fieldname(n.Name), n.Name)
+				v.imports["math/big"] = true
+			case "raw.Duration":
+				fmt.Fprintf(w, "func (r *%s) %s() time.Duration { return time.Duration(r.%s) }\n\n", name, v.fieldname(n.Name), n.Name)
+			case "raw.NullInt64":
+				fmt.Fprintf(w, "func (r *%s) %s() int { return int(r.%s.Int64) }\n\n", name, v.fieldname(n.Name), n.Name)
+			case "raw.NullFloat64":
+				fmt.Fprintf(w, "func (r *%s) %s() float64 { return r.%s.Float64 }\n\n", name, v.fieldname(n.Name), n.Name)
+			case "raw.String8", "raw.String", "raw.String32", "raw.NullString":
+				switch policy := v.utf8Policy(f); policy {
+				case "raw", "error":
+					fmt.Fprintf(w, "func (r *%s) %s() string { return r.%s.String(unsafe.Slice((*byte)(unsafe.Pointer(r)), r.%s.End())) }\n", name, v.fieldname(n.Name), n.Name, n.Name)
+				case "replace":
+					fmt.Fprintf(w, "func (r *%s) %s() string { return strings.ToValidUTF8(r.%s.String(unsafe.Slice((*byte)(unsafe.Pointer(r)), r.%s.End())), \"\\uFFFD\") }\n", name, v.fieldname(n.Name), n.Name, n.Name)
+					v.imports["strings"] = true
+				default:
+					return fmt.Errorf("invalid utf8 policy: %s", policy)
+				}
+				fmt.Fprintf(w, "func (r *%s) %sBytes() []byte { return r.%s.Bytes(unsafe.Slice((*byte)(unsafe.Pointer(r)), r.%s.End())) }\n", name, v.fieldname(n.Name), n.Name, n.Name)
+
+				// Strings with the error policy have an accessor that
+				// returns an error if the string is not valid UTF-8.
+				if v.utf8Policy(f) == "error" {
+					fmt.Fprintf(w, "func (r *%s) %sUTF8() (string, error) {\n", name, v.fieldname(n.Name))
+					fmt.Fprintf(w, "\tif s := r.%s(); !utf8.ValidString(s) {\n", v.fieldname(n.Name))
+					fmt.Fprintf(w, "\t\treturn s, %s.ErrInvalidUTF8\n", v.pkg)
+					fmt.Fprintf(w, "\t} else {\n")
+					fmt.Fprintf(w, "\t\treturn s, nil\n")
+					fmt.Fprintf(w, "\t}\n")
+					fmt.Fprintf(w, "}\n")
+					v.imports["unicode/utf8"] = true
+				}
+				fmt.Fprintf(w, "\n")
+			case "raw.Bytes":
+				fmt.Fprintf(w, "func (r *%s) %s() []byte { return r.%s.Bytes(unsafe.Slice((*byte)(unsafe.Pointer(r)), r.%s.End())) }\n\n", name, v.fieldname(n.Name), n.Name, n.Name)
+			case "raw.StringList":
+				fmt.Fprintf(w, "func (r *%s) %s() []string { return r.%s.Strings(unsafe.Slice((*byte)(unsafe.Pointer(r)), r.%s.End())) }\n\n", name, v.fieldname(n.Name), n.Name, n.Name)
+			default:
+				// Slices share memory with the record.
+				if elem := sliceElem(typ); elem != "" {
+					fmt.Fprintf(w, "func (r *%s) %s() []%s { return r.%s.View(unsafe.Slice((*byte)(unsafe.Pointer(r)), r.%s.End())) }\n\n", name, v.fieldname(n.Name), elem, n.Name, n.Name)
+					continue
+				}
+
+				// Arrays are returned by value so callers get a copy.
+				if arrayLen(typ) == 0 {
+					return fmt.Errorf("invalid raw type: %s", tostr(f.Type))
+				} else if typ == "raw.UUID" {
+					fmt.Fprintf(w, "func (r *%s) %s() [16]byte { return r.%s }\n", name, v.fieldname(n.Name), n.Name)
+					fmt.Fprintf(w, "func (r *%s) %sString() string { return r.%s.String() }\n\n", name, v.fieldname(n.Name), n.Name)
+					continue
+				}
+				fmt.Fprintf(w, "func (r *%s) %s() %s { return r.%s }\n\n", name, v.fieldname(n.Name), typ, n.Name)
+			}
+		}
+	}
+	return nil
+}
+
+// validateTags checks the raw struct tag options on every field of a struct.
+func validateTags(node *ast.StructType) error {
+	for _, f := range node.Fields.List {
+		tag := parseTag(f)
+		for _, n := range f.Names {
+			if v, ok := tag["utf8"]; ok {
+				if typ := tostr(f.Type); stringWidth(typ) == 0 || decodesCopy(typ) {
+					return fmt.Errorf("%s: utf8 policy requires a raw.String field", n.Name)
+				} else if v != "raw" && v != "replace" && v != "error" {
+					return fmt.Errorf("%s: invalid utf8 policy: %q", n.Name, v)
+				}
+			}
+
+			if v, ok := tag["default"]; ok {
+				typ := tostr(f.Type)
+				if value, ok := nullTypes[typ]; ok {
+					typ = value
+				}
+				if err := validateDefault(typ, v); err != nil && !isEnumDefault(f, v) {
+					return fmt.Errorf("%s: invalid default: %s", n.Name, err)
+				}
+
+				// Defaults only apply to fields that can be absent from a
+				// record, which are optional and null fields.
+				if _, ok := nullTypes[tostr(f.Type)]; !ok && !isOptionalField(f) {
+					return fmt.Errorf("%s: default requires an optional field", n.Name)
+				}
+			}
+
+			if err := validateLimits(f); err != nil {
+				return fmt.Errorf("%s: %s", n.Name, err)
+			}
+		}
+	}
+	return nil
+}
+
+// parsePragmas returns the "//raw:" pragmas in a doc comment. A pragma may
+// have a value, e.g. "//raw:name=value".
+func parsePragmas(doc *ast.CommentGroup) map[string]string {
+	m := make(map[string]string)
+	if doc == nil {
+		return m
+	}
+	for _, c := range doc.List {
+		if !strings.HasPrefix(c.Text, "//raw:") {
+			continue
+		}
+		kv := strings.SplitN(strings.TrimSpace(strings.TrimPrefix(c.Text, "//raw:")), "=", 2)
+		if len(kv) == 1 {
+			kv = append(kv, "")
+		}
+		m[kv[0]] = kv[1]
+	}
+	return m
+}
+
+// tagOptions represents the options set in a field's `raw:"..."` struct tag.
+type tagOptions map[string]string
+
+// parseTag returns the options in the raw struct tag of a field.
+// Options are comma separated and may have a value, e.g. `raw:"utf8=replace"`.
+func parseTag(f *ast.Field) tagOptions {
+	opts := make(tagOptions)
+	if f.Tag == nil {
+		return opts
+	}
+	s, err := strconv.Unquote(f.Tag.Value)
+	if err != nil {
+		return opts
+	}
+	for _, opt := range strings.Split(reflect.StructTag(s).Get("raw"), ",") {
+		if opt == "" {
+			continue
+		}
+		kv := strings.SplitN(opt, "=", 2)
+		if len(kv) == 1 {
+			kv = append(kv, "")
+		}
+		opts[kv[0]] = kv[1]
+	}
+	return opts
+}
+
+// isSkipped returns true if a field is tagged with "-" to leave it out of the
+// exported type. Blank fields, which declare padding, are always skipped.
+func isSkipped(f *ast.Field) bool {
+	_, ok := parseTag(f)["-"]
+	return ok || isBlank(f)
+}
+
+// isBlank returns true if every name of a field is blank.
+func isBlank(f *ast.Field) bool {
+	for _, n := range f.Names {
+		if n.Name != "_" {
+			return false
+		}
+	}
+	return len(f.Names) > 0
+}
+
+// withoutSkipped returns a struct without the fields tagged with "-". They're
+// left as zero values when encoding.
+func withoutSkipped(node *ast.StructType) *ast.StructType {
+	var list []*ast.Field
+	for _, f := range node.Fields.List {
+		if !isSkipped(f) {
+			list = append(list, f)
+		}
+	}
+	return &ast.StructType{Struct: node.Struct, Fields: &ast.FieldList{Opening: node.Fields.Opening, List: list, Closing: node.Fields.Closing}}
+}
+
+// validateDefault returns an error if a default literal is not a valid value
+// for a raw field type.
+func validateDefault(typ, v string) error {
+	var err error
+	switch typ {
+	case "bool":
+		_, err = strconv.ParseBool(v)
+	case "int8", "int16", "int32", "int64", "int":
+		_, err = strconv.ParseInt(v, 0, bitsize(typ))
+	case "uint8", "uint16", "uint32", "uint64", "uint":
+		_, err = strconv.ParseUint(v, 0, bitsize(typ))
+	case "float32", "float64":
+		_, err = strconv.ParseFloat(v, bitsize(typ))
+	case "complex64", "complex128":
+		_, err = strconv.ParseComplex(v, bitsize(typ))
+	case "raw.Time", "raw.TimeMicro", "raw.TimeMilli", "raw.TimeSec", "raw.ZonedTime":
+		_, err = time.Parse(time.RFC3339Nano, v)
+	case "raw.Duration":
+		_, err = time.ParseDuration(v)
+	case "raw.String8", "raw.String", "raw.String32", "raw.Bytes":
+		if max := uint64(1)<<uint(stringWidth(typ)) - 1; uint64(len(v)) > max {
+			err = fmt.Errorf("string too long: %d bytes", len(v))
+		}
+	default:
+		err = fmt.Errorf("invalid raw type: %s", typ)
+	}
+	return err
+}
+
+// bitsize returns the size, in bits, of a sized numeric type name.
+func bitsize(typ string) int {
+	n, _ := strconv.Atoi(strings.TrimLeft(typ, "abcdefghijklmnopqrstuvwxyz"))
+	return n
+}
+
+// timeUnits are the units since the Unix epoch of each raw time type.
+var timeUnits = map[string]string{"raw.Time": "Nano", "raw.TimeMicro": "Micro", "raw.TimeMilli": "Milli", "raw.TimeSec": ""}
+
+// isTime returns true if a raw type stores a time.Time.
+func isTime(typ string) bool {
+	_, ok := timeUnits[typ]
+	return ok
+}
+
+// timeValue returns an expression converting expr, an int64 count of the
+// units of a raw time type, to a UTC time.Time.
+func timeValue(typ, expr string) string {
+	switch typ {
+	case "raw.Time":
+		return "time.Unix(0, " + expr + ").UTC()"
+	case "raw.TimeSec":
+		return "time.Unix(" + expr + ", 0).UTC()"
+	}
+	return "time.Unix" + timeUnits[typ] + "(" + expr + ").UTC()"
+}
+
+// timeUnix returns an expression converting expr, a time.Time, to an int64
+// count of the units of a raw time type.
+func timeUnix(typ, expr string) string {
+	return expr + ".Unix" + timeUnits[typ] + "()"
+}
+
+// stringWidth returns the width, in bits, of the offset and length of a raw
+// string type. Returns zero if the type is not a string.
+func stringWidth(typ string) int {
+	switch typ {
+	case "raw.String8":
+		return 8
+	case "raw.String", "raw.NullString", "raw.Bytes", "raw.StringList":
+		return 16
+	case "raw.String32":
+		return 32
+	}
+	if sliceElem(typ) != "" {
+		return 16
+	}
+	return 0
+}
+
+// sliceElem returns the element type of a raw.Slice type. Returns a blank
+// string if the type is not a slice of a fixed width number.
+func sliceElem(typ string) string {
+	if !strings.HasPrefix(typ, "raw.Slice[") || !strings.HasSuffix(typ, "]") {
+		return ""
+	}
+	switch elem := strings.TrimSuffix(strings.TrimPrefix(typ, "raw.Slice["), "]"); elem {
+	case "int8", "int16", "int32", "int64", "uint8", "uint16", "uint32", "uint64", "float32", "float64":
+		return elem
+	}
+	return ""
+}
+
+// decodesCopy returns true if a variable length raw type is decoded with its
+// Decode method, which copies the data so it doesn't share memory with the
+// record.
+func decodesCopy(typ string) bool {
+	return typ == "raw.Bytes" || typ == "raw.StringList" || sliceElem(typ) != ""
+}
+
+// validateWidths checks that the fixed section of a struct can be addressed
+// by the offsets of its string fields. If the offset-width pragma is set
+// then every string field must use that width.
+func validateWidths(node *ast.StructType, pragmas map[string]string) error {
+	var width int
+	if v, ok := pragmas["offset-width"]; ok {
+		switch v {
+		case "8", "16", "32":
+			width, _ = strconv.Atoi(v)
+		default:
+			return fmt.Errorf("invalid offset width: %q", v)
+		}
+	}
+
+	l, ok := layoutOf(node)
+	for _, f := range node.Fields.List {
+		typ := tostr(f.Type)
+		w := stringWidth(typ)
+		if w == 0 {
+			continue
+		}
+		for _, n := range f.Names {
+			if width != 0 && w != width {
+				return fmt.Errorf("%s: offset width %d requires a %s field", n.Name, width, stringTypes[width])
+			} else if max := uint64(1)<<uint(w) - 1; ok && uint64(l.size) > max {
+				return fmt.Errorf("%s: %d byte struct cannot be addressed by %d-bit offsets", n.Name, l.size, w)
+			}
+		}
+	}
+	return nil
+}
+
+// stringTypes are the raw string types for each offset width.
+var stringTypes = map[int]string{8: "raw.String8", 16: "raw.String", 32: "raw.String32"}
+
+// isRawStructType returns true when a type declaration uses all raw types.
+func isRawStructType(node *ast.StructType) bool {
+	for _, f := range node.Fields.List {
+		switch tostr(f.Type) {
+		case "bool":
+		case "int8", "int16", "int32", "int64":
+		case "uint8", "uint16", "uint32", "uint64":
+		case "float32", "float64", "complex64", "complex128":
+		case "raw.Time", "raw.TimeMicro", "raw.TimeMilli", "raw.TimeSec", "raw.ZonedTime", "raw.Duration", "raw.Presence":
+		case "raw.Flags8", "raw.Flags16", "raw.Flags32":
+		case "raw.IP", "raw.Decimal", "raw.Int128", "raw.Uint128":
+		case "raw.NullInt64", "raw.NullFloat64", "raw.NullString":
+		case "raw.String8", "raw.String", "raw.String32", "raw.Bytes", "raw.StringList":
+		default:
+			if typ := tostr(f.Type); arrayLen(typ) == 0 && sliceElem(typ) == "" {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// gotype returns the type used by the exported type for a raw type.
+func (v *visitor) gotype(typ string) (string, error) {
+	if exp, ok := v.codecs[typ]; ok {
+		return exp, nil
+	}
+	switch typ {
+	case "bool", "float32", "float64", "complex64", "complex128", "int", "uint":
+		return typ, nil
+	case "int8", "int16", "int32", "int64":
+		return "int", nil
+	case "uint8", "uint16", "uint32", "uint64":
+		return "uint", nil
+	case "raw.Time", "raw.TimeMicro", "raw.TimeMilli", "raw.TimeSec", "raw.ZonedTime":
+		return "time.Time", nil
+	case "raw.Duration":
+		return "time.Duration", nil
+	case "raw.Presence":
+		return "uint64", nil
+	case "raw.Flags8", "raw.Flags16", "raw.Flags32":
+		return "uint" + strings.TrimPrefix(typ, "raw.Flags"), nil
+	case "raw.String8", "raw.String", "raw.String32":
+		return "string", nil
+	case "raw.Bytes":
+		return "[]byte", nil
+	case "raw.StringList":
+		return "[]string", nil
+	case "raw.UUID":
+		return "[16]byte", nil
+	case "raw.IP":
+		return "netip.Addr", nil
+	case "raw.Decimal", "raw.Int128", "raw.Uint128":
+		if v.pkg == "" {
+			return typ, nil
+		}
+		return v.pkg + strings.TrimPrefix(typ, "raw"), nil
+	}
+	if value, ok := nullTypes[typ]; ok {
+		return v.gotype(value)
+	} else if arrayLen(typ) > 0 {
+		return typ, nil
+	} else if elem := sliceElem(typ); elem != "" {
+		return "[]" + elem, nil
+	}
+	return "", fmt.Errorf("invalid raw type: %s", typ)
+}
+
+// fieldType returns the type of a named field in a struct. Returns a blank
+// string if the field does not exist.
+func fieldType(node *ast.StructType, name string) string {
+	for _, f := range node.Fields.List {
+		for _, n := range f.Names {
+			if n.Name == name {
+				return tostr(f.Type)
+			}
+		}
+	}
+	return ""
+}
+
+// tostr converts a node to a string. Byte arrays with a literal length are
+// normalized to "[N]byte".
+func tostr(node ast.Node) string {
+	switch node := node.(type) {
+	case *ast.Ident:
+		return node.Name
+	case *ast.SelectorExpr:
+		return tostr(node.X) + "." + tostr(node.Sel)
+	case *ast.IndexExpr:
+		return tostr(node.X) + "[" + tostr(node.Index) + "]"
+	case *ast.ArrayType:
+		lit, ok := node.Len.(*ast.BasicLit)
+		if !ok || lit.Kind != token.INT {
+			return ""
+		}
+		n, err := strconv.ParseInt(lit.Value, 0, 64)
+		if elt := tostr(node.Elt); err != nil || n <= 0 || (elt != "byte" && elt != "uint8") {
+			return ""
+		}
+		return fmt.Sprintf("[%d]byte", n)
+	}
+	return ""
+}
+
+// arrayLen returns the length of a byte array type, including raw.UUID.
+// Returns zero if the type is not a byte array.
+func arrayLen(typ string) int {
+	if typ == "raw.UUID" {
+		return 16
+	} else if !strings.HasPrefix(typ, "[") || !strings.HasSuffix(typ, "]byte") {
+		return 0
+	}
+	n, _ := strconv.Atoi(strings.TrimSuffix(strings.TrimPrefix(typ, "["), "]byte"))
+	return n
+}
+
+// fieldname returns the exported name of a raw field.
+func (g *Generator) fieldname(s string) string {
+	for _, m := range g.NameMaps {
+		s = m.Pattern.ReplaceAllString(s, m.Replacement)
+	}
+	return tocamelcase(s)
+}
+
+// exportedName returns the exported name of a named raw field. A name tag
+// takes precedence over the name maps.
+func (g *Generator) exportedName(f *ast.Field, s string) string {
+	if name, ok := parseTag(f)["name"]; ok {
+		return name
+	}
+	return g.fieldname(s)
+}
+
+// tagNames returns the exported names of the fields of a struct that are set
+// by name tags.
+func tagNames(node *ast.StructType) map[string]string {
+	m := make(map[string]string)
+	for _, f := range node.Fields.List {
+		if name, ok := parseTag(f)["name"]; ok {
+			for _, n := range f.Names {
+				m[n.Name] = name
+			}
+		}
+	}
+	return m
+}
+
+// fieldname returns the exported name of a field of the raw struct being
+// generated, including those set by name tags.
+func (v *visitor) fieldname(s string) string {
+	if name, ok := v.names[s]; ok {
+		return name
+	}
+	return v.Generator.fieldname(s)
+}
+
+// validateNames checks that the exported field names of a struct are legal
+// and unique.
+func (g *Generator) validateNames(node *ast.StructType) error {
+	names, generated := make(map[string]string), g.generatedNames(node)
+	for _, f := range node.Fields.List {
+		for _, n := range f.Names {
+			name := g.exportedName(f, n.Name)
+			if !token.IsIdentifier(name) || !ast.IsExported(name) {
+				return fmt.Errorf("%s: invalid exported name: %q", n.Name, name)
+			} else if other, ok := names[name]; ok {
+				return fmt.Errorf("%s: exported name %s conflicts with %s", n.Name, name, other)
+			} else if desc, ok := generated[name]; ok {
+				// Field functions are named after the exported type and
+				// field so these would conflict with the generated names.
+				return fmt.Errorf("%s: exported name %s conflicts with generated %s", n.Name, name, desc)
+			}
+			names[name] = n.Name
+		}
+	}
+
+	// Check that the accessors generated for each field, including those with
+	// a suffix, do not collide with the accessors of another field.
+	accessors := make(map[string]string)
+	for _, f := range node.Fields.List {
+		for _, n := range f.Names {
+			name := g.exportedName(f, n.Name)
+			for _, suffix := range append([]string{""}, accessorSuffixes(tostr(f.Type), g.utf8Policy(f))...) {
+				if other, ok := accessors[name+suffix]; ok {
+					return fmt.Errorf("accessor %s%s() of field %s conflicts with accessor of field %s", name, suffix, n.Name, other)
+				}
+				accessors[name+suffix] = n.Name
+			}
+		}
+	}
+	return nil
+}
+
+// generatedNames returns the names of the types, functions, and constants
+// generated for a raw struct that are prefixed with its exported type name,
+// e.g. View for UserView, mapped to a description of each. Field functions
+// are prefixed the same way, e.g. UserName, so no field can have these names.
+func (g *Generator) generatedNames(node *ast.StructType) map[string]string {
+	m := map[string]string{"Encoder": "Encoder type", "Iterator": "Iterator type", "View": "View type"}
+	if g.Bolt {
+		m["Bucket"] = "Bucket constant"
+		m["Cursor"] = "Cursor type"
+		m["Schema"] = "Schema constant"
+	}
+	if g.TypeTag {
+		m["TypeTag"] = "TypeTag constant"
+	}
+	if parts, _ := keyFields(node); len(parts) > 0 {
+		m["KeyFrom"] = "KeyFrom function"
+		for _, p := range parts[:len(parts)-1] {
+			name := g.exportedName(p.field, p.ident.Name)
+			m[name+"KeyPrefix"] = fmt.Sprintf("%sKeyPrefix function of %s", name, p.ident.Name)
+		}
+	}
+	for _, f := range node.Fields.List {
+		tag := parseTag(f)
+		for _, n := range f.Names {
+			name := g.exportedName(f, n.Name)
+			if _, ok := tag["enum"]; ok {
+				m[name+"Enum"] = fmt.Sprintf("%sEnum type of %s", name, n.Name)
+			}
+			if _, ok := tag["flags"]; ok {
+				m[name+"Flags"] = fmt.Sprintf("%sFlags type of %s", name, n.Name)
+			}
+			if _, ok := tag["index"]; ok && g.Bolt {
+				m[name+"IndexBucket"] = fmt.Sprintf("%sIndexBucket constant of %s", name, n.Name)
+			}
+		}
+	}
+	return m
+}
+
+// accessorSuffixes returns the suffixes of the additional accessors that are
+// generated for a raw type.
+func accessorSuffixes(typ, utf8Policy string) []string {
+	switch typ {
+	case "raw.Time":
+		return []string{"Unix", "UnixNano"}
+	case "raw.TimeMicro", "raw.TimeMilli":
+		return []string{"Unix", "Unix" + timeUnits[typ]}
+	case "raw.TimeSec":
+		return []string{"Unix"}
+	case "raw.UUID":
+		return []string{"String"}
+	case "raw.Decimal":
+		return []string{"Unscaled"}
+	case "raw.Int128", "raw.Uint128":
+		return []string{"Big"}
+	case "raw.String8", "raw.String", "raw.String32", "raw.NullString":
+		if utf8Policy == "error" {
+			return []string{"Bytes", "UTF8"}
+		}
+		return []string{"Bytes"}
+	}
+	return nil
+}
+
+// utf8Policy returns the policy for handling invalid UTF-8 in a string field.
+// The field's tag takes precedence over the generator's default.
+func (g *Generator) utf8Policy(f *ast.Field) string {
+	if v, ok := parseTag(f)["utf8"]; ok {
+		return v
+	} else if g.UTF8 != "" {
+		return g.UTF8
+	}
+	return "raw"
+}
+
+func tocamelcase(s string) string {
+	if s == "" {
+		return s
+	}
+	return string(unicode.ToUpper(rune(s[0]))) + string(s[1:])
+}
+
+// tracef writes a formatted trace message to the logger, if set.
+func (g *Generator) tracef(format string, v ...interface{}) {
+	if g.Logger != nil {
+		g.Logger.Printf(format, v...)
+	}
+}
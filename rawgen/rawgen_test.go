@@ -0,0 +1,4420 @@
+package rawgen
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/importer"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"io/ioutil"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+	"text/template"
+)
+
+// Ensure that a file is returned with code generated for its raw structs.
+func TestGenerateFile(t *testing.T) {
+	b, err := GenerateFile([]byte("package foo\n\nimport \"github.com/boltdb/raw\"\n\ntype user struct {\n\tname raw.String\n}\n\ntype other struct {\n\tp *int\n}\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := string(b)
+	if !strings.HasPrefix(s, "package foo\n") {
+		t.Fatalf("original source not preserved:\n%s", s)
+	} else if !strings.Contains(s, "type User struct {\n\tName string\n}") {
+		t.Fatalf("exported type not generated:\n%s", s)
+	} else if strings.Contains(s, "type Other struct") {
+		t.Fatalf("unexpected exported type for non-raw struct:\n%s", s)
+	}
+	if _, err := parser.ParseFile(token.NewFileSet(), "", b, 0); err != nil {
+		t.Fatalf("generated file does not parse: %s\n%s", err, s)
+	}
+
+	// Regenerating should return the same file.
+	if other, err := GenerateFile(b); err != nil {
+		t.Fatal(err)
+	} else if string(other) != s {
+		t.Fatalf("regenerated file differs:\n%s", other)
+	}
+}
+
+// Ensure that every raw struct in a grouped type declaration is generated.
+func TestGenerateFile_GroupedTypes(t *testing.T) {
+	mustRun(t, `
+type (
+	user struct {
+		name raw.String
+	}
+
+	other struct {
+		p *int
+	}
+
+	// packet is read from a C program.
+	//raw:ctype
+	packet struct {
+		port uint16
+	}
+
+	event struct {
+		id int64
+	}
+)
+`, `
+	var u User
+	u.Decode((&User{Name: "bob"}).Encode())
+	var e Event
+	e.Decode((&Event{Id: 10}).Encode())
+	var p Packet
+	if err := p.Decode([]byte{0x1F, 0x90}); err != nil {
+		panic(err)
+	}
+	if u.Name != "bob" || e.Id != 10 || p.Port != 8080 {
+		panic(fmt.Sprintf("unexpected values: %+v %+v %+v", u, e, p))
+	}
+`)
+}
+
+// Ensure that a raw struct marked with a skip pragma is not generated.
+func TestGenerateFile_Skip(t *testing.T) {
+	var buf bytes.Buffer
+	g := &Generator{Logger: log.New(&buf, "", 0)}
+	b, err := g.GenerateFile([]byte("package foo\n\nimport \"github.com/boltdb/raw\"\n\n// Header is used directly.\n//raw:skip\ntype Header struct {\n\tname raw.String\n}\n\ntype (\n\t//raw:skip\n\tfooter struct {\n\t\tid int64\n\t}\n\n\tuser struct {\n\t\tid int64\n\t}\n)\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s := string(b); strings.Contains(s, "func (o *Header)") || strings.Contains(s, "type Footer") || !strings.Contains(s, "type User struct") {
+		t.Fatalf("unexpected generated code:\n%s", s)
+	}
+	if !strings.Contains(buf.String(), "skipping by request: Header\n") || !strings.Contains(buf.String(), "skipping by request: footer\n") {
+		t.Fatalf("unexpected log: %s", buf.String())
+	}
+}
+
+// Ensure that generated files are formatted with gofmt.
+func TestGenerateFile_Format(t *testing.T) {
+	src := []byte("package foo\n\nimport \"github.com/boltdb/raw\"\n\ntype user struct {\n\tid int64\n\tname raw.String\n}\n")
+	for _, g := range []*Generator{{AllowPadding: true}, {TinyGo: true}} {
+		b, err := g.GenerateFile(src)
+		if err != nil {
+			t.Fatal(err)
+		} else if other, err := format.Source(b); err != nil {
+			t.Fatal(err)
+		} else if !bytes.Equal(b, other) {
+			t.Fatalf("generated file is not formatted:\n%s", b)
+		}
+	}
+
+	// Code that doesn't parse returns an error.
+	g := &Generator{Template: template.Must(template.New("").Parse("func {")), AllowPadding: true}
+	if _, err := g.GenerateFile(src); err == nil || !strings.HasPrefix(err.Error(), "format generated code: ") {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+// Ensure that a vendored raw package imported with an alias is recognized.
+func TestGenerateFile_VendoredAlias(t *testing.T) {
+	src := []byte("package foo\n\nimport rawx \"example.com/app/internal/raw\"\n\ntype event struct {\n\tat rawx.Time\n\tname rawx.String\n}\n")
+
+	// The canonical import path doesn't match the vendored path.
+	if b, err := GenerateFile(src); err != nil {
+		t.Fatal(err)
+	} else if strings.Contains(string(b), "type Event struct") {
+		t.Fatalf("unexpected generated code:\n%s", b)
+	}
+
+	g := &Generator{ImportPaths: []string{"example.com/app/internal/raw"}, AllowPadding: true}
+	b, err := g.GenerateFile(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		"type Event struct {\n\tAt   time.Time\n\tName string\n}",
+		"\tr.at = rawx.Time(o.At.UnixNano())\n",
+		"import rawx \"example.com/app/internal/raw\"\n",
+	} {
+		if !strings.Contains(string(b), want) {
+			t.Fatalf("expected %q in generated code:\n%s", want, b)
+		}
+	}
+}
+
+// Ensure that the raw package name is derived from its import.
+func TestGenerator_PackageName(t *testing.T) {
+	g := &Generator{ImportPaths: []string{DefaultImportPath, "example.com/app/internal/raw", "example.com/store/v2"}}
+	for _, tt := range []struct {
+		imports string
+		name    string
+	}{
+		{`"github.com/boltdb/raw"`, "raw"},
+		{`r "github.com/boltdb/raw"`, "r"},
+		{`"example.com/app/internal/raw"`, "raw"},
+		{`rawx "example.com/app/internal/raw"`, "rawx"},
+		{`"example.com/store/v2"`, "store"},
+		{`"example.com/other"`, "raw"},
+	} {
+		f, err := parser.ParseFile(token.NewFileSet(), "", "package foo\n\nimport "+tt.imports+"\n", 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if name := g.packageName(f); name != tt.name {
+			t.Errorf("%s: unexpected name: %s", tt.imports, name)
+		}
+	}
+}
+
+// Ensure that invalid source returns an error.
+func TestGenerateFile_ParseError(t *testing.T) {
+	if _, err := GenerateFile([]byte("package foo\n\ntype x struct {")); err == nil {
+		t.Fatal("expected error")
+	}
+}
+
+// Ensure that code can be generated from a struct spec.
+func TestGenerateStruct(t *testing.T) {
+	b, err := (&Generator{AllowPadding: true}).GenerateStruct(StructSpec{
+		Name: "user",
+		Fields: []FieldSpec{
+			{Name: "id", Type: "int64"},
+			{Name: "name", Type: "raw.String"},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := string(b)
+	for _, want := range []string{
+		"type User struct {\n\tId int\n\tName string\n}",
+		"func (o *User) Encode() []byte {",
+		"func (o *User) Decode(b []byte) error {",
+		"func (r *user) Name() string {",
+	} {
+		if !strings.Contains(s, want) {
+			t.Fatalf("expected %q in generated code:\n%s", want, s)
+		}
+	}
+}
+
+// Ensure that struct spec pragmas are passed to the generator.
+func TestGenerateStruct_Pragmas(t *testing.T) {
+	b, err := GenerateStruct(StructSpec{
+		Name:    "packet",
+		Pragmas: map[string]string{"ctype": ""},
+		Fields:  []FieldSpec{{Name: "port", Type: "uint16"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	} else if !strings.Contains(string(b), "func (o *Packet) Decode(b []byte) error {") {
+		t.Fatalf("expected ctype decode func:\n%s", b)
+	}
+}
+
+// Ensure that a struct spec with a non-raw field returns an error.
+func TestGenerateStruct_NotRaw(t *testing.T) {
+	if _, err := GenerateStruct(StructSpec{Name: "user", Fields: []FieldSpec{{Name: "p", Type: "*int"}}}); err == nil || err.Error() != "not a raw struct: user" {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+// Ensure that a struct spec with an invalid tag returns an error.
+func TestGenerateStruct_InvalidTag(t *testing.T) {
+	_, err := GenerateStruct(StructSpec{Name: "user", Fields: []FieldSpec{{Name: "n", Type: "int8", Tag: `raw:"default=1000"`}}})
+	if err == nil || !strings.Contains(err.Error(), "n: invalid default") {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+// Ensure that a default tag with a valid literal is accepted by the parser.
+func TestParseTag(t *testing.T) {
+	s := mustParseStruct(t, "type foo struct { count int32 `raw:\"default=1\"` }")
+	if v := parseTag(s.Fields.List[0])["default"]; v != "1" {
+		t.Fatalf("unexpected default: %q", v)
+	}
+}
+
+// Ensure that default literals are validated against the field type.
+func TestValidateDefault(t *testing.T) {
+	for _, tt := range []struct {
+		typ, v string
+		ok     bool
+	}{
+		{"bool", "true", true},
+		{"bool", "yes", false},
+		{"int8", "127", true},
+		{"int8", "128", false},
+		{"uint16", "0xFFFF", true},
+		{"uint16", "-1", false},
+		{"float32", "1.5", true},
+		{"float64", "abc", false},
+		{"raw.Time", "2014-01-01T00:00:00Z", true},
+		{"raw.Time", "yesterday", false},
+		{"raw.Duration", "5s", true},
+		{"raw.Duration", "5", false},
+		{"raw.String", "foo", true},
+	} {
+		if err := validateDefault(tt.typ, tt.v); (err == nil) != tt.ok {
+			t.Errorf("%s=%q: unexpected result: %v", tt.typ, tt.v, err)
+		}
+	}
+}
+
+// Ensure that a default on a field that is always present is rejected.
+func TestValidateTags_DefaultRequiresOptional(t *testing.T) {
+	s := mustParseStruct(t, "type foo struct { count int32 `raw:\"default=1\"` }")
+	if err := validateTags(s); err == nil || !strings.Contains(err.Error(), "requires an optional field") {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+// Ensure that unset fields with a default are decoded as it.
+func TestDefault(t *testing.T) {
+	for _, g := range []*Generator{{}, {Endian: "big"}} {
+		mustRunWith(t, g, `
+type user struct {
+	presence raw.Presence
+	status   uint8          `+"`raw:\"enum=active|suspended,optional,default=suspended\"`"+`
+	limit    int32          `+"`raw:\"optional,default=10\"`"+`
+	name     raw.NullString `+"`raw:\"default=anon\"`"+`
+	count    int64          `+"`raw:\"optional,default=1\"`"+`
+	score    float64        `+"`raw:\"optional\"`"+`
+}
+`, `
+	if u := NewUser(); *u.Status != UserStatusSuspended || *u.Limit != 10 || *u.Name != "anon" || *u.Count != 1 || u.Score != nil {
+		panic(fmt.Sprintf("unexpected user: %s", u.String()))
+	}
+
+	// Absent fields decode to their defaults, or nil without one.
+	limit := 0
+	var u User
+	if err := u.Decode((&User{Limit: &limit}).Encode()); err != nil {
+		panic(err)
+	} else if *u.Status != UserStatusSuspended || *u.Limit != 0 || *u.Name != "anon" || *u.Count != 1 || u.Score != nil {
+		panic(fmt.Sprintf("unexpected user: %s", u.String()))
+	}
+
+	// Present fields keep their values, including zero values.
+	status, name, count, score := UserStatusActive, "bob", 0, 0.5
+	if err := u.Decode((&User{Status: &status, Limit: &limit, Name: &name, Count: &count, Score: &score}).Encode()); err != nil {
+		panic(err)
+	} else if *u.Status != UserStatusActive || *u.Limit != 0 || *u.Name != "bob" || *u.Count != 0 || *u.Score != 0.5 {
+		panic(fmt.Sprintf("unexpected user: %s", u.String()))
+	}
+`)
+	}
+}
+
+// Ensure that records outside of the limits set by their tags fail to validate
+// and, with the validate pragma, to decode.
+func TestValidate(t *testing.T) {
+	mustRun(t, `
+//raw:validate
+type user struct {
+	age  int32      `+"`raw:\"min=0,max=150\"`"+`
+	name raw.String `+"`raw:\"nonzero,max=8\"`"+`
+}
+`, `
+	if err := (&User{Age: 30, Name: "bob"}).Validate(); err != nil {
+		panic(err)
+	} else if err := (&User{Age: 151, Name: "bob"}).Validate(); err == nil || err.Error() != "raw: invalid field: Age must be at most 150" {
+		panic(fmt.Sprintf("unexpected error: %v", err))
+	}
+
+	var u User
+	if err := u.Decode((&User{Age: 30}).Encode()); err == nil || err.Error() != "raw: invalid field: Name must not be zero" {
+		panic(fmt.Sprintf("unexpected error: %v", err))
+	} else if _, err := (&User{Age: 30, Name: "too long"}).MarshalBinary(); err != nil {
+		panic(err)
+	} else if _, err := (&User{Age: 30, Name: "too long!"}).MarshalBinary(); err == nil || err.Error() != "raw: invalid field: length of Name must be at most 8" {
+		panic(fmt.Sprintf("unexpected error: %v", err))
+	}
+`)
+}
+
+// Ensure that invalid validation tags are rejected.
+func TestValidate_Invalid(t *testing.T) {
+	for _, tt := range []struct {
+		src string
+		err string
+	}{
+		{"type user struct {\n\tage int8 `raw:\"max=200\"`\n}", "age: invalid max: strconv.ParseInt: parsing \"200\": value out of range"},
+		{"type user struct {\n\tname raw.String `raw:\"min=-1\"`\n}", "name: invalid min: strconv.ParseUint: parsing \"-1\": invalid syntax"},
+		{"type user struct {\n\tok bool `raw:\"min=1\"`\n}", "ok: min is not supported for bool fields"},
+		{"type user struct {\n\tstatus uint8 `raw:\"enum=a|b,max=1\"`\n}", "status: max is not supported for enum fields"},
+		{"//raw:validate\ntype user struct {\n\tage int8\n}", "user: validate requires a field with a min, max, or nonzero tag"},
+	} {
+		_, err := GenerateFile([]byte("package foo\n\nimport \"github.com/boltdb/raw\"\n\n" + tt.src + "\n"))
+		if err == nil || !strings.HasSuffix(err.Error(), tt.err) {
+			t.Errorf("%s: unexpected error: %v", tt.src, err)
+		}
+	}
+}
+
+// Ensure that an invalid default literal is rejected.
+func TestValidateTags_InvalidDefault(t *testing.T) {
+	s := mustParseStruct(t, "type foo struct { count int8 `raw:\"default=1000\"` }")
+	if err := validateTags(s); err == nil || !strings.Contains(err.Error(), "count: invalid default") {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+// Ensure that an encoder appends records which can each be mapped back.
+func TestEncoder(t *testing.T) {
+	mustRun(t, `
+type event struct {
+	id   int64
+	name raw.String
+	tag  raw.String
+}
+`, `
+	e := NewEventEncoder()
+	e.Append(&Event{Id: 1, Name: "foo", Tag: "x"})
+	e.Append(&Event{Id: 2, Name: "barbaz", Tag: "yz"})
+	b := e.Bytes()
+
+	var a, c Event
+	a.Decode(b)
+	n := len((&Event{Id: 1, Name: "foo", Tag: "x"}).Encode())
+	c.Decode(b[n:])
+	if a.Id != 1 || a.Name != "foo" || a.Tag != "x" {
+		panic(fmt.Sprintf("unexpected record(0): %+v", a))
+	}
+	if c.Id != 2 || c.Name != "barbaz" || c.Tag != "yz" {
+		panic(fmt.Sprintf("unexpected record(1): %+v", c))
+	}
+
+	e.Reset()
+	if len(e.Bytes()) != 0 {
+		panic("reset failed")
+	}
+`)
+}
+
+// Ensure that the functions of the encoder type are documented.
+func TestEncoder_Doc(t *testing.T) {
+	b, err := GenerateFile([]byte("package foo\n\nimport \"github.com/boltdb/raw\"\n\ntype event struct {\n\tname raw.String\n}\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, err := parser.ParseFile(token.NewFileSet(), "", b, parser.ParseComments)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var n int
+	for _, decl := range f.Decls {
+		fn, ok := decl.(*ast.FuncDecl)
+		if !ok || (fn.Recv == nil && fn.Name.Name != "NewEventEncoder") {
+			continue
+		} else if fn.Recv != nil && types.ExprString(fn.Recv.List[0].Type) != "*EventEncoder" {
+			continue
+		} else if fn.Doc == nil || !strings.HasPrefix(fn.Doc.Text(), fn.Name.Name+" ") {
+			t.Errorf("%s is not documented", fn.Name.Name)
+		}
+		n++
+	}
+	if n != 4 {
+		t.Fatalf("unexpected encoder function count: %d", n)
+	}
+}
+
+// Ensure that records appended to a buffer decode from their own offsets.
+func TestAppendEncode(t *testing.T) {
+	for _, g := range []*Generator{{}, {Endian: "big"}} {
+		mustRunWith(t, g, `
+type event struct {
+	id     int64
+	active bool
+	name   raw.String
+	ids    raw.Slice[uint32]
+}
+`, `
+	a := &Event{Id: 1, Active: true, Name: "foo", Ids: []uint32{1, 2}}
+	c := &Event{Id: 2, Name: "barbaz"}
+	b := make([]byte, 0, 1024)
+	b = a.AppendEncode(b)
+	n := len(b)
+	b = c.AppendEncode(b)
+	if n != len(a.Encode()) || len(b) != n+len(c.Encode()) {
+		panic(fmt.Sprintf("unexpected encoding: %x", b))
+	}
+
+	var x, y Event
+	if err := x.Decode(b[:n]); err != nil {
+		panic(err)
+	} else if err := y.Decode(b[n:]); err != nil {
+		panic(err)
+	} else if fmt.Sprint(x) != fmt.Sprint(*a) || fmt.Sprint(y) != fmt.Sprint(*c) {
+		panic(fmt.Sprintf("unexpected decode: %+v, %+v", x, y))
+	}
+`)
+	}
+}
+
+// Ensure that records written to a writer decode like their encoding.
+func TestEncodeTo(t *testing.T) {
+	for _, g := range []*Generator{{Equal: true}, {Equal: true, Endian: "big"}} {
+		mustRunWith(t, g, `
+type event struct {
+	id       int64
+	active   bool
+	name     raw.String8
+	note     raw.String `+"`raw:\"optional\"`"+`
+	count    int32      `+"`raw:\"optional\"`"+`
+	data     raw.Bytes
+	flags    raw.Slice[int8]
+	ids      raw.Slice[uint64]
+	tags     raw.StringList
+	presence raw.Presence
+}
+`, `
+	note := "hello"
+	for _, o := range []*Event{
+		{Id: 1, Active: true, Name: "foo", Note: &note, Data: []byte{1, 2}, Flags: []int8{-1}, Ids: []uint64{1, 2}, Tags: []string{"x", "yz"}},
+		{Id: 2},
+	} {
+		var sb strings.Builder
+		n, err := o.EncodeTo(&sb)
+		if err != nil {
+			panic(err)
+		} else if n != sb.Len() || n != len(o.Encode()) {
+			panic(fmt.Sprintf("unexpected length: %d, %d", n, sb.Len()))
+		}
+
+		var other Event
+		if err := other.Decode([]byte(sb.String())); err != nil {
+			panic(err)
+		} else if !other.Equal(o) {
+			panic(fmt.Sprintf("unexpected decode: %+v", other))
+		}
+	}
+`)
+	}
+}
+
+// Ensure that a stream of records can be read back one at a time.
+func TestDecodeFrom(t *testing.T) {
+	for _, g := range []*Generator{{}, {Endian: "big"}} {
+		mustRunWith(t, g, `
+type event struct {
+	id   int64
+	name raw.String8
+	ids  raw.Slice[uint64]
+	tags raw.StringList
+	body raw.String32
+}
+`, `
+	records := []*Event{
+		{Id: 1, Name: "foo", Ids: []uint64{1, 2}, Tags: []string{"x", "yz"}, Body: "hello"},
+		{Id: 2},
+		{Id: 3, Body: "world"},
+	}
+	var sb strings.Builder
+	for _, o := range records {
+		if _, err := o.EncodeTo(&sb); err != nil {
+			panic(err)
+		}
+	}
+
+	rd := strings.NewReader(sb.String())
+	for _, o := range records {
+		var other Event
+		if err := other.DecodeFrom(rd); err != nil {
+			panic(err)
+		} else if fmt.Sprint(other) != fmt.Sprint(*o) {
+			panic(fmt.Sprintf("unexpected decode: %+v", other))
+		}
+	}
+	var other Event
+	if err := other.DecodeFrom(rd); err != io.EOF {
+		panic(fmt.Sprintf("expected EOF: %v", err))
+	}
+
+	// Records cut off in their fixed or variable length data are errors.
+	s := sb.String()
+	for _, n := range []int{4, len(records[0].Encode()) - 1} {
+		if err := other.DecodeFrom(strings.NewReader(s[:n])); err != io.ErrUnexpectedEOF {
+			panic(fmt.Sprintf("expected unexpected EOF at %d: %v", n, err))
+		}
+	}
+`)
+	}
+}
+
+// Ensure that records encoded into an arena match their encoding, including
+// after the arena is reset, and are encoded in place.
+func TestEncodeArena(t *testing.T) {
+	mustRunWith(t, &Generator{Arena: true}, `
+type event struct {
+	id       int64
+	name     raw.String
+	ids      raw.Slice[uint32]
+	tags     raw.StringList
+	nick     raw.NullString
+	presence raw.Presence
+	note     raw.String `+"`raw:\"optional\"`"+`
+}
+`, `
+	// Slices encoded in place end where the arena's next slice starts.
+	inPlace := func(a *raw.Arena, b []byte) bool {
+		return uintptr(unsafe.Pointer(unsafe.SliceData(b)))+uintptr(cap(b)) == uintptr(unsafe.Pointer(unsafe.SliceData(a.Alloc(0, 1))))
+	}
+
+	a := raw.NewArena(1024)
+	for i := 0; i < 2; i++ {
+		nick, note := "nickname", "a longer note"
+		o := &Event{Id: 1, Name: "foo", Ids: []uint32{1, 2}, Tags: []string{"x", "yz", "a longer tag"}, Nick: &nick, Note: &note}
+		b := o.EncodeArena(a)
+		if len(b) != len(o.Encode()) {
+			panic(fmt.Sprintf("unexpected encoding: %x", b))
+		} else if !inPlace(a, b) {
+			panic("record not encoded in place")
+		}
+		var other Event
+		if err := other.Decode(b); err != nil {
+			panic(err)
+		} else if *other.Nick != nick || *other.Note != note || fmt.Sprint(other.Tags) != fmt.Sprint(o.Tags) {
+			panic(fmt.Sprintf("unexpected decode: %+v", other))
+		}
+
+		o = &Event{Id: 2, Name: "bar"}
+		if c := o.EncodeArena(a); len(c) != len(o.Encode()) {
+			panic(fmt.Sprintf("unexpected encoding: %x", c))
+		} else if !inPlace(a, c) {
+			panic("record not encoded in place")
+		}
+		a.Reset()
+	}
+`)
+}
+
+// Ensure that released buffers are reused by Encode without leaking the
+// previous record's fields.
+func TestPool(t *testing.T) {
+	for _, g := range []*Generator{{Pool: true}, {Pool: true, Endian: "big"}} {
+		mustRunWith(t, g, `
+type event struct {
+	id     int64
+	active bool
+	name   raw.String
+}
+`, `
+	o := &Event{Id: 1, Active: true, Name: "foobar"}
+	b := o.Encode()
+	ReleaseEvent(b)
+
+	for i := 0; i < 10; i++ {
+		o := &Event{Id: 2, Name: "baz"}
+		c := o.Encode()
+		var other Event
+		if err := other.Decode(c); err != nil {
+			panic(err)
+		} else if other != *o {
+			panic(fmt.Sprintf("unexpected decode: %+v", other))
+		}
+		ReleaseEvent(c)
+	}
+`)
+	}
+}
+
+// Ensure that decoding a short or corrupt record returns an error instead of
+// reading past the end of the buffer.
+func TestDecode_ErrUnexpectedEOF(t *testing.T) {
+	for _, g := range []*Generator{{}, {Endian: "big"}} {
+		mustRunWith(t, g, `
+type user struct {
+	id   int64
+	name raw.String
+}
+`, `
+	b := (&User{Id: 1, Name: "bob"}).Encode()
+
+	var u User
+	if err := u.Decode(b); err != nil {
+		panic(err)
+	} else if u.Id != 1 || u.Name != "bob" {
+		panic(fmt.Sprintf("unexpected user: %+v", u))
+	}
+	if err := u.Decode(nil); err == nil {
+		panic("expected error for empty buffer")
+	}
+	if err := u.Decode(b[:4]); err == nil {
+		panic("expected error for short buffer")
+	}
+	if err := u.Decode(b[:len(b)-1]); err == nil {
+		panic("expected error for truncated string")
+	}
+`)
+	}
+}
+
+// Ensure that checksummed records are verified when they're decoded and that
+// patching a record rewrites its checksum.
+func TestChecksum(t *testing.T) {
+	for _, g := range []*Generator{{Checksum: true}, {Checksum: true, Endian: "big"}} {
+		mustRunWith(t, g, `
+type user struct {
+	id   int64
+	name raw.String
+}
+`, `
+	o := &User{Id: 1, Name: "bob"}
+	b := o.Encode()
+	if len(b) != int(unsafe.Sizeof(user{}))+3+raw.ChecksumSize {
+		panic(fmt.Sprintf("unexpected length: %d", len(b)))
+	}
+
+	var u User
+	if err := u.Decode(b); err != nil {
+		panic(err)
+	} else if u != *o {
+		panic(fmt.Sprintf("unexpected user: %+v", u))
+	}
+	if err := u.Decode(b[:len(b)-1]); err != raw.ErrChecksum {
+		panic(fmt.Sprintf("unexpected error: %v", err))
+	}
+
+	// Append each record after the other and read them back.
+	c := o.AppendEncode(o.AppendEncode(nil))
+	if string(c) != string(b)+string(b) {
+		panic(fmt.Sprintf("unexpected encoding: %x", c))
+	}
+	c[len(b)+2] ^= 0xff
+	if err := u.Decode(c[:len(b)]); err != nil {
+		panic(err)
+	} else if err := u.Decode(c[len(b):]); err != raw.ErrChecksum {
+		panic(fmt.Sprintf("unexpected error: %v", err))
+	}
+`)
+	}
+
+	mustRunWith(t, &Generator{Checksum: true}, `
+type user struct {
+	id   int64
+	name raw.String
+}
+`, `
+	b := (&User{Id: 1, Name: "bob"}).Encode()
+	if err := PatchUserId(b, 2); err != nil {
+		panic(err)
+	} else if v, err := ViewUser(b); err != nil {
+		panic(err)
+	} else if v.Id() != 2 || v.Name() != "bob" {
+		panic(fmt.Sprintf("unexpected view: %d %q", v.Id(), v.Name()))
+	}
+
+	b[0] ^= 0xff
+	if err := PatchUserId(b, 3); err != raw.ErrChecksum {
+		panic(fmt.Sprintf("unexpected error: %v", err))
+	} else if _, err := ViewUser(b); err != raw.ErrChecksum {
+		panic(fmt.Sprintf("unexpected error: %v", err))
+	}
+
+	// Records are read one after another, including their checksums.
+	var e UserEncoder
+	e.Append(&User{Id: 1, Name: "bob"})
+	e.Append(&User{Id: 2, Name: "susy"})
+	it := IterUser(e.Bytes())
+	for _, want := range []string{"bob", "susy"} {
+		if u, ok := it.Next(); !ok {
+			panic(it.Err())
+		} else if u.Name != want {
+			panic(fmt.Sprintf("unexpected name: %q", u.Name))
+		}
+	}
+	if _, ok := it.Next(); ok || it.Err() != nil {
+		panic("expected end of records")
+	}
+`)
+}
+
+// Ensure that tagged records are rejected when they're decoded as another type.
+func TestTypeTag(t *testing.T) {
+	for _, g := range []*Generator{{TypeTag: true}, {TypeTag: true, Checksum: true}, {TypeTag: true, Endian: "big"}} {
+		mustRunWith(t, g, `
+type user struct {
+	id   int64
+	name raw.String
+}
+
+type group struct {
+	id   int64
+	name raw.String
+}
+`, `
+	if UserTypeTag == GroupTypeTag {
+		panic("expected different type tags")
+	}
+
+	b := (&User{Id: 1, Name: "bob"}).Encode()
+	var u User
+	if err := u.Decode(b); err != nil {
+		panic(err)
+	} else if u.Id != 1 || u.Name != "bob" {
+		panic(fmt.Sprintf("unexpected user: %+v", u))
+	}
+	var grp Group
+	if err := grp.Decode(b); err != raw.ErrTypeTag {
+		panic(fmt.Sprintf("unexpected error: %v", err))
+	} else if err := u.Decode(b[:2]); err != io.ErrUnexpectedEOF && err != raw.ErrChecksum {
+		panic(fmt.Sprintf("unexpected error: %v", err))
+	}
+
+	// Records are appended after their tags.
+	c := (&User{Id: 2, Name: "susy"}).AppendEncode(b)
+	if err := u.Decode(c[len(b):]); err != nil {
+		panic(err)
+	} else if u.Id != 2 || u.Name != "susy" {
+		panic(fmt.Sprintf("unexpected user: %+v", u))
+	}
+`)
+	}
+
+	mustRunWith(t, &Generator{TypeTag: true}, `
+type user struct {
+	id   int64
+	name raw.String
+}
+
+type group struct {
+	id int64
+}
+`, `
+	b := (&User{Id: 1, Name: "bob"}).Encode()
+	if err := PatchUserId(b, 2); err != nil {
+		panic(err)
+	} else if UserId(b) != 2 || UserName(b) != "bob" {
+		panic(fmt.Sprintf("unexpected fields: %d %q", UserId(b), UserName(b)))
+	} else if err := PatchUserId((&Group{Id: 1}).Encode(), 2); err != raw.ErrTypeTag {
+		panic(fmt.Sprintf("unexpected error: %v", err))
+	}
+
+	var e UserEncoder
+	e.Append(&User{Id: 1, Name: "bob"})
+	e.Append(&User{Id: 2, Name: "susy"})
+	it := IterUser(e.Bytes())
+	for _, want := range []string{"bob", "susy"} {
+		if u, ok := it.Next(); !ok {
+			panic(it.Err())
+		} else if u.Name != want {
+			panic(fmt.Sprintf("unexpected name: %q", u.Name))
+		}
+	}
+`)
+
+	// Fields can't be named after the type tag constant.
+	_, err := (&Generator{TypeTag: true}).GenerateFile([]byte("package foo\n\nimport \"github.com/boltdb/raw\"\n\ntype user struct {\n\ttypeTag raw.String\n}\n"))
+	if err == nil || !strings.HasSuffix(err.Error(), "typeTag: exported name TypeTag conflicts with generated TypeTag constant") {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+// Ensure that a C struct record in network byte order can be decoded.
+func TestCType(t *testing.T) {
+	mustRun(t, `
+//raw:ctype
+type packet struct {
+	flag    bool
+	kind    int8
+	port    uint16
+	seq     int32
+	ratio   float32
+	total   int64
+	elapsed raw.Duration
+	name    raw.String
+}
+`, `
+	b := []byte{
+		0x01,                   // flag
+		0xFE,                   // kind
+		0x1F, 0x90,             // port
+		0xFF, 0xFF, 0xFF, 0x9C, // seq
+		0x3F, 0xC0, 0x00, 0x00, // ratio
+		0x00, 0x00, 0x00, 0x01, 0x00, 0x00, 0x00, 0x00, // total
+		0x00, 0x00, 0x00, 0x00, 0x3B, 0x9A, 0xCA, 0x00, // elapsed
+		0x00, 0x20, 0x00, 0x03, // name
+		'f', 'o', 'o',
+	}
+
+	var p Packet
+	if err := p.Decode(b); err != nil {
+		panic(err)
+	}
+	if !p.Flag || p.Kind != -2 || p.Port != 8080 || p.Seq != -100 || p.Ratio != 1.5 {
+		panic(fmt.Sprintf("unexpected packet: %+v", p))
+	}
+	if p.Total != 1<<32 || p.Elapsed != time.Second || p.Name != "foo" {
+		panic(fmt.Sprintf("unexpected packet: %+v", p))
+	}
+
+	// Short and corrupt records should not decode.
+	if err := p.Decode(b[:10]); err == nil {
+		panic("expected short buffer error")
+	}
+	if err := p.Decode(b[:len(b)-1]); err == nil {
+		panic("expected string bounds error")
+	}
+`)
+}
+
+// Ensure that each UTF-8 policy handles strings with invalid UTF-8.
+func TestUTF8Policy(t *testing.T) {
+	mustRunWith(t, &Generator{UTF8: "replace"}, `
+type note struct {
+	def     raw.String
+	asis    raw.String `+"`raw:\"utf8=raw\"`"+`
+	checked raw.String `+"`raw:\"utf8=error\"`"+`
+}
+`, `
+	b := (&Note{Def: "a\xffb", Asis: "a\xffb", Checked: "a\xffb"}).Encode()
+	r := (*note)(unsafe.Pointer(&b[0]))
+	if s := r.Def(); s != "a\uFFFDb" {
+		panic(fmt.Sprintf("unexpected replaced string: %q", s))
+	}
+	if s := r.Asis(); s != "a\xffb" {
+		panic(fmt.Sprintf("unexpected raw string: %q", s))
+	}
+	if s, err := r.CheckedUTF8(); err != raw.ErrInvalidUTF8 || s != "a\xffb" {
+		panic(fmt.Sprintf("unexpected checked string: %q, %v", s, err))
+	}
+
+	// Valid strings are unchanged under all policies.
+	b = (&Note{Def: "héllo", Asis: "héllo", Checked: "héllo"}).Encode()
+	r = (*note)(unsafe.Pointer(&b[0]))
+	if s, err := r.CheckedUTF8(); err != nil || s != "héllo" || r.Def() != "héllo" || r.Asis() != "héllo" {
+		panic(fmt.Sprintf("unexpected valid strings: %q, %v", s, err))
+	}
+
+	// Decoding uses the policy of each accessor.
+	var n Note
+	n.Decode((&Note{Def: "\xff", Asis: "\xff", Checked: "\xff"}).Encode())
+	if n.Def != "\uFFFD" || n.Asis != "\xff" || n.Checked != "\xff" {
+		panic(fmt.Sprintf("unexpected decoded note: %+v", n))
+	}
+`)
+}
+
+// Ensure that invalid UTF-8 policy tags are rejected.
+func TestValidateTags_UTF8(t *testing.T) {
+	if err := validateTags(mustParseStruct(t, "type foo struct { s raw.String `raw:\"utf8=drop\"` }")); err == nil || err.Error() != `s: invalid utf8 policy: "drop"` {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := validateTags(mustParseStruct(t, "type foo struct { n int64 `raw:\"utf8=error\"` }")); err == nil || err.Error() != "n: utf8 policy requires a raw.String field" {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+// Ensure that touching a record sets its created and updated times.
+func TestTimestamps_Touch(t *testing.T) {
+	mustRun(t, `
+//raw:timestamps
+type post struct {
+	createdAt raw.Time
+	updatedAt raw.Time
+	title     raw.String
+}
+
+//raw:timestamps=created,modified
+type comment struct {
+	created  raw.Time
+	modified raw.Time
+}
+`, `
+	var p Post
+	before := time.Now()
+	p.Touch()
+	if p.CreatedAt.Before(before) || !p.UpdatedAt.Equal(p.CreatedAt) {
+		panic(fmt.Sprintf("unexpected first touch: %+v", p))
+	}
+
+	// Touching again only changes the updated time.
+	created := p.CreatedAt
+	time.Sleep(time.Millisecond)
+	p.Touch()
+	if !p.CreatedAt.Equal(created) || !p.UpdatedAt.After(created) {
+		panic(fmt.Sprintf("unexpected second touch: %+v", p))
+	}
+
+	// Both times round trip.
+	var other Post
+	other.Decode(p.Encode())
+	if !other.CreatedAt.Equal(p.CreatedAt) || !other.UpdatedAt.Equal(p.UpdatedAt) {
+		panic(fmt.Sprintf("unexpected decoded post: %+v", other))
+	}
+
+	var c Comment
+	c.Touch()
+	if c.Created.IsZero() || !c.Modified.Equal(c.Created) {
+		panic(fmt.Sprintf("unexpected comment: %+v", c))
+	}
+`)
+}
+
+// Ensure that timestamps must name existing time fields.
+func TestTimestamps_Invalid(t *testing.T) {
+	for _, tt := range []struct {
+		src string
+		err string
+	}{
+		{"//raw:timestamps\ntype post struct {\n\tcreatedAt raw.Time\n}", "timestamp field not found: updatedAt"},
+		{"//raw:timestamps=a,b\ntype post struct {\n\ta raw.Time\n\tb int64\n}", "timestamp field must be a raw time type: b"},
+		{"//raw:timestamps=a\ntype post struct {\n\ta raw.Time\n}", `invalid timestamps: "a"`},
+	} {
+		_, err := GenerateFile([]byte("package foo\n\nimport \"github.com/boltdb/raw\"\n\n" + tt.src + "\n"))
+		if err == nil || !strings.HasSuffix(err.Error(), tt.err) {
+			t.Errorf("%s: unexpected error: %v", tt.src, err)
+		}
+	}
+}
+
+// Ensure that an explicit layout matches the size and offsets of the raw struct.
+func TestExplicitLayout(t *testing.T) {
+	mustRunWith(t, &Generator{ExplicitLayout: true}, `
+type event struct {
+	ok      bool
+	at      raw.Time
+	kind    int16
+	name    raw.String
+	ratio   float32
+	flagged bool
+}
+`, `
+	if unsafe.Sizeof(eventLayout{}) != unsafe.Sizeof(event{}) {
+		panic(fmt.Sprintf("size mismatch: %d != %d", unsafe.Sizeof(eventLayout{}), unsafe.Sizeof(event{})))
+	}
+	var e event
+	var l eventLayout
+	if unsafe.Offsetof(l.at) != unsafe.Offsetof(e.at) || unsafe.Offsetof(l.name) != unsafe.Offsetof(e.name) ||
+		unsafe.Offsetof(l.ratio) != unsafe.Offsetof(e.ratio) || unsafe.Offsetof(l.flagged) != unsafe.Offsetof(e.flagged) {
+		panic("offset mismatch")
+	}
+`)
+
+	b, err := (&Generator{ExplicitLayout: true, AllowPadding: true}).GenerateFile([]byte("package foo\n\nimport \"github.com/boltdb/raw\"\n\ntype event struct {\n\tok bool\n\tat raw.Time\n}\n"))
+	if err != nil {
+		t.Fatal(err)
+	} else if !strings.Contains(string(b), "type eventLayout struct {\n\tok bool // offset 0\n\t_  [7]byte\n\tat raw.Time // offset 8\n}") {
+		t.Fatalf("unexpected layout:\n%s", b)
+	}
+}
+
+// Ensure that native code isn't generated for raw structs with implicit
+// padding unless padding is allowed.
+func TestImplicitPadding(t *testing.T) {
+	for _, tt := range []struct {
+		src string
+		err string
+	}{
+		{"type event struct {\n\tok bool\n\tat raw.Time\n}", "event: 7 bytes of implicit padding before at; declare it with a blank field, _ [7]byte, or allow padding"},
+		{"type event struct {\n\tat raw.Time\n\tok bool\n}", "event: 7 bytes of implicit padding after the last field; declare it with a blank field, _ [7]byte, or allow padding"},
+		{"type event struct {\n\tok bool\n\t_ [7]byte\n\tat raw.Time\n\tn int32 `raw:\"-\"`\n}", "event: 4 bytes of implicit padding after the last field; declare it with a blank field, _ [4]byte, or allow padding"},
+	} {
+		src := []byte("package foo\n\nimport \"github.com/boltdb/raw\"\n\n" + tt.src + "\n")
+		if _, err := GenerateFile(src); err == nil || err.Error() != tt.err {
+			t.Errorf("%s: unexpected error: %v", tt.src, err)
+		}
+		for _, g := range []*Generator{{AllowPadding: true}, {Safe: true}, {Endian: "big"}} {
+			if _, err := g.GenerateFile(src); err != nil {
+				t.Errorf("%s: %s", tt.src, err)
+			}
+		}
+	}
+
+	// Declared padding is zeroed and left out of the exported type.
+	if _, err := GenerateFile([]byte("package foo\n\nimport \"github.com/boltdb/raw\"\n\n//raw:ctype\ntype header struct {\n\tok bool\n\tn uint32\n}\n")); err != nil {
+		t.Fatal(err)
+	}
+	mustRun(t, `
+type event struct {
+	ok   bool
+	_    [3]byte
+	n    int32
+	name raw.String
+	id   uint16
+	_, _ [1]byte
+}
+`, `
+	if unsafe.Sizeof(event{}) != 16 {
+		panic(fmt.Sprintf("unexpected size: %d", unsafe.Sizeof(event{})))
+	}
+	b := (&Event{Ok: true, N: 2, Name: "bob", Id: 3}).Encode()
+	if string(b[1:4]) != "\x00\x00\x00" || string(b[14:16]) != "\x00\x00" {
+		panic(fmt.Sprintf("padding not zeroed: %x", b))
+	}
+	var o Event
+	if err := o.Decode(b); err != nil {
+		panic(err)
+	} else if o != (Event{Ok: true, N: 2, Name: "bob", Id: 3}) {
+		panic(fmt.Sprintf("unexpected decode: %+v", o))
+	}
+`)
+}
+
+// Ensure that implicit padding is declared with blank fields without
+// changing the layout of raw structs.
+func TestInsertPadding(t *testing.T) {
+	src := []byte("package foo\n\nimport \"github.com/boltdb/raw\"\n\n" +
+		"type event struct {\n\tok bool\n\t// at is when it happened.\n\tat raw.Time\n\tname raw.String\n}\n\n" +
+		"type point struct{ x int64; ok bool }\n\n" +
+		"//raw:ctype\ntype header struct {\n\tok bool\n\tn uint32\n}\n\n" +
+		"type user struct {\n\tid int64\n\tname raw.String\n\tage int32\n}\n")
+	b, n, err := (&Generator{}).InsertPadding(src)
+	if err != nil {
+		t.Fatal(err)
+	} else if n != 3 {
+		t.Fatalf("unexpected count: %d", n)
+	}
+	for _, want := range []string{
+		"type event struct {\n\tok bool\n\t_  [7]byte\n\t// at is when it happened.\n\tat   raw.Time\n\tname raw.String\n\t_    [4]byte\n}\n",
+		"type point struct {\n\tx  int64\n\tok bool\n\t_  [7]byte\n}\n",
+		"type header struct {\n\tok bool\n\tn  uint32\n}\n",
+		"type user struct {\n\tid   int64\n\tname raw.String\n\tage  int32\n}\n",
+	} {
+		if !strings.Contains(string(b), want) {
+			t.Fatalf("expected %q in padded source:\n%s", want, b)
+		}
+	}
+	if _, err := GenerateFile(b); err != nil {
+		t.Fatal(err)
+	} else if other, n, err := (&Generator{}).InsertPadding(b); err != nil {
+		t.Fatal(err)
+	} else if n != 0 || !bytes.Equal(other, b) {
+		t.Fatalf("unexpected padding inserted again:\n%s", other)
+	}
+
+	// Declaring padding doesn't change fingerprints, while reserving space does.
+	g := &Generator{}
+	before, err := g.Fingerprints(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	after, err := g.Fingerprints(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, fp := range before {
+		if after[name] != fp {
+			t.Fatalf("fingerprint of %s changed: %s != %s", name, after[name], fp)
+		}
+	}
+	if fps := mustFingerprints(t, "type point struct {\n\tx int64\n\tok bool\n\t_ [15]byte\n}"); fps["point"] == before["point"] {
+		t.Fatal("expected reserved space to change the fingerprint")
+	}
+
+	// C headers declare blank fields as their own padding.
+	h, err := g.GenerateCHeader(b)
+	if err != nil {
+		t.Fatal(err)
+	} else if !strings.Contains(string(h), "struct event {\n\tbool ok;\n\tuint8_t _pad0[7];\n\tint64_t at;\n\traw_string name;\n\tuint8_t _pad1[4];\n};") {
+		t.Fatalf("unexpected header:\n%s", h)
+	}
+}
+
+// Ensure that the layouts of raw structs match the sizes computed by go/types
+// for each platform.
+func TestLayoutFor_Sizes(t *testing.T) {
+	requirePackage(t, DefaultImportPath)
+	src := "package foo\n\nimport \"github.com/boltdb/raw\"\n\ntype event struct {\n\tok bool\n\tn int16\n\tid [3]byte\n\tf float64\n\ti8 int8\n\tu32 uint32\n\ti int\n\tat raw.Time\n\tz raw.ZonedTime\n\tb bool\n" +
+		"\td raw.Decimal\n\tn64 raw.NullInt64\n\tname raw.String\n\tx raw.Int128\n\tip raw.IP\n\tp raw.Presence\n\tids raw.Slice[int64]\n\tf64 raw.NullFloat64\n\tf32 float32\n}\n"
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, "", src, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	node := f.Decls[1].(*ast.GenDecl).Specs[0].(*ast.TypeSpec).Type.(*ast.StructType)
+
+	imp := importer.ForCompiler(fset, "source", nil)
+	for _, arch := range []string{"amd64", "arm64", "386", "arm", "mips", "amd64p32"} {
+		sizes := types.SizesFor("gc", arch)
+		conf := types.Config{Sizes: sizes, Importer: imp}
+		pkg, err := conf.Check("foo", fset, []*ast.File{f}, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		st := pkg.Scope().Lookup("event").Type().Underlying().(*types.Struct)
+		var fields []*types.Var
+		for i := 0; i < st.NumFields(); i++ {
+			fields = append(fields, st.Field(i))
+		}
+		offsets := sizes.Offsetsof(fields)
+
+		l, ok := (&Generator{Arch: arch}).layout(node)
+		if !ok {
+			t.Fatal("unknown layout")
+		} else if l.size != int(sizes.Sizeof(st)) {
+			t.Fatalf("%s: size is %d, go/types has %d", arch, l.size, sizes.Sizeof(st))
+		}
+		for i, sl := range l.slots {
+			if sl.offset != int(offsets[i]) {
+				t.Fatalf("%s: %s: offset is %d, go/types has %d", arch, sl.ident.Name, sl.offset, offsets[i])
+			}
+		}
+	}
+}
+
+// Ensure that records written by native code on a 32-bit platform are read,
+// and written identically, by code generated for its layout on this one.
+func TestArch(t *testing.T) {
+	decls := `
+type event struct {
+	ok    bool
+	at    raw.Time
+	zone  raw.ZonedTime
+	price raw.Decimal
+	n     raw.NullInt64
+	name  raw.String
+	ids   raw.Slice[int64]
+	f     float64
+}
+`
+	value := `Event{Ok: true, At: time.Unix(1, 2).UTC(), Zone: time.Unix(3, 0).In(time.FixedZone("", 3600)), Price: raw.Decimal{Unscaled: 1999, Scale: 2}, N: &n, Name: "bob", Ids: []int64{4, 5}, F: 1.5}`
+
+	// Encode a record with native code on 386.
+	src := "package main\n\nimport (\n\t\"fmt\"\n\t\"time\"\n\t\"unsafe\"\n\n\t\"github.com/boltdb/raw\"\n)\n\nvar _ = unsafe.Sizeof(0)\n" + decls +
+		"\nfunc main() {\n\tn := 7\n\tfmt.Printf(\"%q\", (&" + value + ").Encode())\n}\n"
+	b, err := (&Generator{AllowPadding: true}).GenerateFile([]byte(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := mustTempDir(t)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "main.go")
+	if err := ioutil.WriteFile(path, b, 0600); err != nil {
+		t.Fatal(err)
+	}
+	bin := filepath.Join(dir, "main")
+	cmd := exec.Command("go", "build", "-o", bin, path)
+	cmd.Env = append(os.Environ(), "GOARCH=386")
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("build: %s\n%s\n\n%s", err, out, b)
+	}
+	out, err := exec.Command(bin).Output()
+	if err != nil {
+		t.Skipf("cannot run 386 binaries: %s", err)
+	}
+
+	// Decode and re-encode it with code generated for the layout of 386.
+	mustRunWith(t, &Generator{Arch: "386"}, decls, `
+	b := []byte(`+string(out)+`)
+	n := 7
+	want := `+value+`
+	var o Event
+	if err := o.Decode(b); err != nil {
+		panic(err)
+	} else if o.At != want.At || !o.Zone.Equal(want.Zone) || o.Price != want.Price || *o.N != 7 || o.Name != "bob" || fmt.Sprint(o.Ids) != "[4 5]" || o.F != 1.5 {
+		panic(fmt.Sprintf("unexpected decode: %+v", o))
+	} else if other := want.Encode(); string(other) != string(b) {
+		panic(fmt.Sprintf("unexpected encoding: %q", other))
+	}
+`)
+
+	if _, err := (&Generator{Arch: "z80"}).GenerateFile([]byte(src)); err == nil || err.Error() != "unknown architecture: z80" {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+// Ensure that int and uint fields are only raw with an int width and are
+// encoded with that width.
+func TestIntWidth(t *testing.T) {
+	decls := `
+type event struct {
+	n    int
+	u    uint
+	name raw.String
+}
+`
+	src := []byte("package foo\n\nimport \"github.com/boltdb/raw\"\n" + decls)
+	if b, err := GenerateFile(src); err != nil {
+		t.Fatal(err)
+	} else if strings.Contains(string(b), "type Event struct") {
+		t.Fatalf("unexpected exported type without an int width:\n%s", b)
+	}
+	if _, err := (&Generator{IntWidth: 16}).GenerateFile(src); err == nil || err.Error() != "invalid int width: 16" {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// Native records map ints directly.
+	mustRunWith(t, &Generator{IntWidth: 64}, decls, `
+	var o Event
+	if err := o.Decode((&Event{N: -3, U: 4, Name: "bob"}).Encode()); err != nil {
+		panic(err)
+	} else if o.N != -3 || o.U != 4 || o.Name != "bob" {
+		panic(fmt.Sprintf("unexpected decode: %+v", o))
+	}
+`)
+
+	// Portable records use the declared width and reject values that don't
+	// fit in it.
+	mustRunWith(t, &Generator{IntWidth: 32, Endian: "little"}, decls, `
+	b, err := (&Event{N: -3, U: 4, Name: "bob"}).MarshalBinary()
+	if err != nil {
+		panic(err)
+	} else if string(b[:8]) != "\xfd\xff\xff\xff\x04\x00\x00\x00" {
+		panic(fmt.Sprintf("unexpected encoding: %x", b))
+	}
+	var o Event
+	if err := o.Decode(b); err != nil {
+		panic(err)
+	} else if o.N != -3 || o.U != 4 || o.Name != "bob" {
+		panic(fmt.Sprintf("unexpected decode: %+v", o))
+	}
+	if _, err := (&Event{N: -1 << 31, U: 1<<32 - 1}).MarshalBinary(); err != nil {
+		panic(err)
+	} else if _, err := (&Event{N: 1 << 31}).MarshalBinary(); fmt.Sprint(err) != "raw: integer overflow: N does not fit in 32 bits" {
+		panic(fmt.Sprintf("unexpected error: %v", err))
+	} else if _, err := (&Event{U: 1 << 32}).MarshalBinary(); fmt.Sprint(err) != "raw: integer overflow: U does not fit in 32 bits" {
+		panic(fmt.Sprintf("unexpected error: %v", err))
+	}
+`)
+}
+
+// Ensure that a retained record returns the bytes it was decoded from.
+func TestRetain(t *testing.T) {
+	mustRun(t, `
+//raw:retain
+type user struct {
+	id   int64
+	name raw.String
+	bio  raw.String
+}
+`, `
+	b := (&User{Id: 1, Name: "bob", Bio: "hello"}).Encode()
+
+	// Decode from a buffer with trailing data.
+	var u User
+	u.Decode(append(append([]byte{}, b...), 0xFF, 0xFF))
+	if string(u.Raw()) != string(b) {
+		panic(fmt.Sprintf("unexpected raw bytes: %x != %x", u.Raw(), b))
+	}
+
+	// Changes after decoding are not reflected.
+	u.Name = "alice"
+	if string(u.Raw()) != string(b) {
+		panic("raw bytes changed")
+	}
+`)
+}
+
+// Ensure that the Unix accessors of a time field match its time.Time accessor.
+func TestTimeAccessors(t *testing.T) {
+	mustRun(t, `
+type event struct {
+	createdAt raw.Time
+}
+`, `
+	for _, tm := range []time.Time{
+		time.Date(2014, 5, 1, 12, 30, 15, 500, time.UTC),
+		time.Date(1969, 12, 31, 23, 59, 59, 0, time.UTC),
+		time.Unix(-1, 500).UTC(),
+		time.Unix(0, 0).UTC(),
+	} {
+		b := (&Event{CreatedAt: tm}).Encode()
+		r := (*event)(unsafe.Pointer(&b[0]))
+		if r.CreatedAtUnix() != r.CreatedAt().Unix() {
+			panic(fmt.Sprintf("unix mismatch: %d != %d", r.CreatedAtUnix(), r.CreatedAt().Unix()))
+		}
+		if r.CreatedAtUnixNano() != r.CreatedAt().UnixNano() {
+			panic(fmt.Sprintf("unix nano mismatch: %d != %d", r.CreatedAtUnixNano(), r.CreatedAt().UnixNano()))
+		}
+	}
+`)
+}
+
+// Ensure that lower precision times are truncated and read back by their
+// accessors.
+func TestTimePrecision(t *testing.T) {
+	mustRun(t, `
+type event struct {
+	sec   raw.TimeSec
+	milli raw.TimeMilli
+	micro raw.TimeMicro
+}
+`, `
+	if unsafe.Sizeof(event{}) != 24 {
+		panic(fmt.Sprintf("unexpected size: %d", unsafe.Sizeof(event{})))
+	}
+	tm := time.Date(2014, 5, 1, 12, 30, 15, 123456789, time.UTC)
+	b := (&Event{Sec: tm, Milli: tm, Micro: tm}).Encode()
+	var e Event
+	if err := e.Decode(b); err != nil {
+		panic(err)
+	} else if !e.Sec.Equal(tm.Truncate(time.Second)) || !e.Milli.Equal(tm.Truncate(time.Millisecond)) || !e.Micro.Equal(tm.Truncate(time.Microsecond)) {
+		panic(fmt.Sprintf("unexpected times: %+v", e))
+	}
+
+	r := (*event)(unsafe.Pointer(&b[0]))
+	if r.SecUnix() != tm.Unix() || r.MilliUnix() != tm.Unix() || r.MicroUnix() != tm.Unix() {
+		panic("unix mismatch")
+	} else if r.MilliUnixMilli() != tm.UnixMilli() || r.MicroUnixMicro() != tm.UnixMicro() {
+		panic("unit mismatch")
+	}
+`)
+}
+
+// Ensure that a zoned time is read back in the offset it was encoded with.
+func TestZonedTime(t *testing.T) {
+	mustRun(t, `
+type event struct {
+	at raw.ZonedTime
+}
+`, `
+	tm := time.Date(2014, 5, 1, 12, 30, 15, 500, time.FixedZone("EST", -5*3600))
+	b := (&Event{At: tm}).Encode()
+	var e Event
+	if err := e.Decode(b); err != nil {
+		panic(err)
+	} else if _, offset := e.At.Zone(); !e.At.Equal(tm) || offset != -5*3600 {
+		panic(fmt.Sprintf("unexpected time: %s", e.At))
+	}
+
+	r := (*event)(unsafe.Pointer(&b[0]))
+	if r.At().String() != e.At.String() {
+		panic(fmt.Sprintf("unexpected accessor: %s", r.At()))
+	}
+`)
+}
+
+// Ensure that UUID fields map to byte arrays and keep their order in keys.
+func TestUUID(t *testing.T) {
+	mustRun(t, `
+type session struct {
+	id   raw.UUID `+"`raw:\"key\"`"+`
+	name raw.String
+}
+`, `
+	id, err := raw.ParseUUID("0123abcd-4567-89ab-cdef-0123456789ab")
+	if err != nil {
+		panic(err)
+	}
+	b := (&Session{Id: id, Name: "foo"}).Encode()
+	r := (*session)(unsafe.Pointer(&b[0]))
+	if r.Id() != [16]byte(id) || r.IdString() != "0123abcd-4567-89ab-cdef-0123456789ab" {
+		panic(fmt.Sprintf("unexpected id: %s", r.IdString()))
+	}
+
+	var s Session
+	if err := s.Decode(b); err != nil {
+		panic(err)
+	} else if s.Id != id {
+		panic(fmt.Sprintf("unexpected id: %x", s.Id))
+	} else if string(s.Key()) != string(id[:]) {
+		panic(fmt.Sprintf("unexpected key: %x", s.Key()))
+	}
+`)
+}
+
+// Ensure that IP addresses map to netip.Addr and keep their family.
+func TestIP(t *testing.T) {
+	mustRun(t, `
+type conn struct {
+	src raw.IP
+	dst raw.IP
+	at  raw.IP
+}
+`, `
+	src, dst := netip.MustParseAddr("192.0.2.1"), netip.MustParseAddr("2001:db8::1")
+	b := (&Conn{Src: src, Dst: dst}).Encode()
+	var c Conn
+	if err := c.Decode(b); err != nil {
+		panic(err)
+	} else if c.Src != src || !c.Src.Is4() || c.Dst != dst || c.At.IsValid() {
+		panic(fmt.Sprintf("unexpected addresses: %+v", c))
+	}
+
+	r := (*conn)(unsafe.Pointer(&b[0]))
+	if r.Src() != src || r.Dst() != dst {
+		panic(fmt.Sprintf("unexpected accessors: %s, %s", r.Src(), r.Dst()))
+	}
+`)
+}
+
+// Ensure that decimals are stored exactly.
+func TestDecimal(t *testing.T) {
+	mustRun(t, `
+type item struct {
+	price raw.Decimal
+	qty   int32
+}
+`, `
+	price, err := raw.ParseDecimal("19.99")
+	if err != nil {
+		panic(err)
+	}
+	b := (&Item{Price: price, Qty: 3}).Encode()
+	var i Item
+	if err := i.Decode(b); err != nil {
+		panic(err)
+	} else if i.Price.String() != "19.99" {
+		panic(fmt.Sprintf("unexpected price: %s", i.Price))
+	}
+
+	r := (*item)(unsafe.Pointer(&b[0]))
+	if unscaled, scale := r.PriceUnscaled(); unscaled != 1999 || scale != 2 || r.Price() != price {
+		panic(fmt.Sprintf("unexpected accessors: %d, %d", unscaled, scale))
+	}
+`)
+}
+
+// Ensure that 128-bit integer fields can be encoded and read as big integers.
+func TestInt128(t *testing.T) {
+	mustRun(t, `
+type account struct {
+	balance raw.Int128
+	supply  raw.Uint128
+}
+`, `
+	var balance raw.Int128
+	if err := balance.UnmarshalText([]byte("-18446744073709551621")); err != nil {
+		panic(err)
+	}
+	b := (&Account{Balance: balance, Supply: raw.Uint128{Hi: 1<<64 - 1, Lo: 1<<64 - 1}}).Encode()
+	var a Account
+	if err := a.Decode(b); err != nil {
+		panic(err)
+	} else if a.Balance != balance || a.Supply.String() != "340282366920938463463374607431768211455" {
+		panic(fmt.Sprintf("unexpected account: %+v", a))
+	}
+
+	r := (*account)(unsafe.Pointer(&b[0]))
+	if r.Balance() != balance || r.BalanceBig().String() != "-18446744073709551621" {
+		panic(fmt.Sprintf("unexpected balance: %s", r.BalanceBig()))
+	} else if r.SupplyBig().BitLen() != 128 {
+		panic(fmt.Sprintf("unexpected supply: %s", r.SupplyBig()))
+	}
+`)
+}
+
+// Ensure that complex fields are encoded natively, portably, and as JSON.
+func TestComplex(t *testing.T) {
+	decls := `
+type coeff struct {
+	bin  int32
+	c64  complex64
+	c    complex128
+	name raw.String
+}
+`
+	main := `
+	want := Coeff{Bin: 3, C64: 1.5 - 2i, C: complex(-1e300, 0.25), Name: "fft"}
+	b := want.Encode()
+	var o Coeff
+	if err := o.Decode(b); err != nil {
+		panic(err)
+	} else if o != want {
+		panic(fmt.Sprintf("unexpected decode: %+v", o))
+	}
+`
+	mustRun(t, decls, main+`
+	r := (*coeff)(unsafe.Pointer(&b[0]))
+	if r.C64() != 1.5-2i || r.C() != complex(-1e300, 0.25) {
+		panic(fmt.Sprintf("unexpected accessors: %v, %v", r.C64(), r.C()))
+	}
+`)
+	mustRunWith(t, &Generator{Endian: "big"}, decls, main+`
+	if fmt.Sprintf("%x", b[4:12]) != "3fc00000c0000000" {
+		panic(fmt.Sprintf("unexpected encoding: %x", b))
+	}
+`)
+	mustRunWith(t, &Generator{JSON: true}, decls, `
+	b, err := Coeff{C64: 1.5 - 2i, C: 3i}.MarshalJSON()
+	if err != nil {
+		panic(err)
+	} else if string(b) != `+"`"+`{"bin":0,"c64":[1.5,-2],"c":[0,3],"name":""}`+"`"+` {
+		panic(fmt.Sprintf("unexpected json: %s", b))
+	}
+	var o Coeff
+	if err := o.UnmarshalJSON(b); err != nil {
+		panic(err)
+	} else if o.C64 != 1.5-2i || o.C != 3i {
+		panic(fmt.Sprintf("unexpected decode: %+v", o))
+	}
+`)
+}
+
+// Ensure that enum fields have typed constants and reject unknown values.
+func TestEnum(t *testing.T) {
+	mustRun(t, `
+type user struct {
+	status uint8 `+"`raw:\"enum=active|suspended|deleted\"`"+`
+	name   raw.String
+}
+`, `
+	b := (&User{Status: UserStatusSuspended, Name: "bob"}).Encode()
+	var u User
+	if err := u.Decode(b); err != nil {
+		panic(err)
+	} else if u.Status != UserStatusSuspended || u.Status.String() != "suspended" {
+		panic(fmt.Sprintf("unexpected status: %v", u.Status))
+	} else if s := UserStatusEnum(7).String(); s != "UserStatusEnum(7)" {
+		panic(fmt.Sprintf("unexpected string: %s", s))
+	}
+
+	b[0] = 3
+	if err := u.Decode(b); err != raw.ErrInvalidEnum {
+		panic(fmt.Sprintf("unexpected error: %v", err))
+	}
+`)
+}
+
+// Ensure that invalid enum tags are rejected.
+func TestEnum_Invalid(t *testing.T) {
+	for _, tt := range []struct {
+		src string
+		err string
+	}{
+		{"type user struct {\n\tstatus int8 `raw:\"enum=a|b\"`\n}", "status: enum requires a uint8 or uint16 field"},
+		{"type user struct {\n\tstatus uint8 `raw:\"enum=a|1b\"`\n}", `status: invalid enum value: "1b"`},
+		{"type user struct {\n\tstatus uint8 `raw:\"enum=a|b|a\"`\n}", "status: duplicate enum value: a"},
+		{"type user struct {\n\tstatus uint8 `raw:\"enum=a|b\"`\n\tstatusA int32\n}", "status: enum constant UserStatusA conflicts with generated UserStatusA function"},
+	} {
+		_, err := GenerateFile([]byte("package foo\n\nimport \"github.com/boltdb/raw\"\n\n" + tt.src + "\n"))
+		if err == nil || !strings.HasSuffix(err.Error(), tt.err) {
+			t.Errorf("%s: unexpected error: %v", tt.src, err)
+		}
+	}
+}
+
+// Ensure that flag fields pack named bools into a single field.
+func TestFlags(t *testing.T) {
+	mustRun(t, `
+type user struct {
+	perms raw.Flags8  `+"`raw:\"flags=read|write|exec\"`"+`
+	_     [1]byte
+	opts  raw.Flags16 `+"`raw:\"flags=admin|active\"`"+`
+	name  raw.String
+}
+`, `
+	o := User{Perms: UserPermsRead | UserPermsExec, Name: "bob"}
+	o.Opts.SetActive(true)
+	var u User
+	if err := u.Decode(o.Encode()); err != nil {
+		panic(err)
+	} else if !u.Perms.Read() || u.Perms.Write() || !u.Perms.Exec() || u.Opts.Admin() || !u.Opts.Active() {
+		panic(fmt.Sprintf("unexpected flags: %v, %v", u.Perms, u.Opts))
+	} else if s := u.Perms.String(); s != "read|exec" {
+		panic(fmt.Sprintf("unexpected string: %s", s))
+	} else if s := UserPermsFlags(0x81).String(); s != "read|0x80" {
+		panic(fmt.Sprintf("unexpected string: %s", s))
+	}
+
+	u.Perms.SetRead(false)
+	if u.Perms != UserPermsExec {
+		panic(fmt.Sprintf("unexpected flags: %v", u.Perms))
+	}
+`)
+}
+
+// Ensure that invalid flag fields are rejected.
+func TestFlags_Invalid(t *testing.T) {
+	for _, tt := range []struct {
+		src string
+		err string
+	}{
+		{"type user struct {\n\tperms uint8 `raw:\"flags=a|b\"`\n}", "perms: flags requires a raw.Flags8, raw.Flags16, or raw.Flags32 field"},
+		{"type user struct {\n\tperms raw.Flags8\n}", "perms: raw.Flags8 field requires a flags tag"},
+		{"type user struct {\n\tperms raw.Flags8 `raw:\"flags=a|b|c|d|e|f|g|h|i\"`\n}", "perms: too many flags for raw.Flags8: 9"},
+		{"type user struct {\n\tperms raw.Flags8 `raw:\"flags=a|1b\"`\n}", `perms: invalid flag: "1b"`},
+		{"type user struct {\n\tperms raw.Flags8 `raw:\"flags=a|b|a\"`\n}", "perms: duplicate flag: a"},
+		{"type user struct {\n\tperms raw.Flags8 `raw:\"flags=a|string\"`\n}", "perms: flag string conflicts with another method of UserPermsFlags"},
+		{"type user struct {\n\tperms raw.Flags8 `raw:\"flags=a|b\"`\n\tpermsA int32\n}", "perms: flag constant UserPermsA conflicts with generated UserPermsA function"},
+	} {
+		_, err := GenerateFile([]byte("package foo\n\nimport \"github.com/boltdb/raw\"\n\n" + tt.src + "\n"))
+		if err == nil || !strings.HasSuffix(err.Error(), tt.err) {
+			t.Errorf("%s: unexpected error: %v", tt.src, err)
+		}
+	}
+}
+
+// Ensure that null fields map to pointers that are nil when they're unset.
+func TestNull(t *testing.T) {
+	mustRun(t, `
+type user struct {
+	age   raw.NullInt64
+	score raw.NullFloat64
+	name  raw.NullString
+}
+`, `
+	age, name := 0, ""
+	var u User
+	if err := u.Decode((&User{Age: &age, Name: &name}).Encode()); err != nil {
+		panic(err)
+	} else if u.Age == nil || *u.Age != 0 || u.Score != nil || u.Name == nil || *u.Name != "" {
+		panic(fmt.Sprintf("unexpected user: %s", u.String()))
+	}
+
+	if err := u.Decode((&User{}).Encode()); err != nil {
+		panic(err)
+	} else if u.Age != nil || u.Score != nil || u.Name != nil {
+		panic(fmt.Sprintf("unexpected user: %s", u.String()))
+	}
+`)
+}
+
+// Ensure that null fields can't also be optional.
+func TestNull_Invalid(t *testing.T) {
+	_, err := GenerateFile([]byte("package foo\n\nimport \"github.com/boltdb/raw\"\n\ntype user struct {\n\tage raw.NullInt64 `raw:\"optional\"`\n\tpresence raw.Presence\n}\n"))
+	if err == nil || !strings.HasSuffix(err.Error(), "age: optional is not supported for raw.NullInt64 fields") {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+// Ensure that name maps can strip a prefix from generated field names.
+func TestNameMap_StripPrefix(t *testing.T) {
+	g := &Generator{NameMaps: []NameMap{{regexp.MustCompile("^m_"), ""}}}
+	mustRunWith(t, g, `
+type user struct {
+	m_age  int32
+	m_name raw.String
+}
+`, `
+	var u User
+	u.Decode((&User{Age: 30, Name: "bob"}).Encode())
+	if u.Age != 30 || u.Name != "bob" {
+		panic(fmt.Sprintf("unexpected user: %+v", u))
+	}
+`)
+}
+
+// Ensure that name maps can replace part of a generated field name.
+func TestNameMap_Replace(t *testing.T) {
+	g := &Generator{NameMaps: []NameMap{{regexp.MustCompile("Id$"), "ID"}, {regexp.MustCompile("^url"), "URL"}}}
+	if name := g.fieldname("userId"); name != "UserID" {
+		t.Fatalf("unexpected name: %s", name)
+	} else if name := g.fieldname("urlPath"); name != "URLPath" {
+		t.Fatalf("unexpected name: %s", name)
+	}
+}
+
+// Ensure that name maps which produce duplicate or illegal names are rejected.
+func TestNameMap_Invalid(t *testing.T) {
+	g := &Generator{NameMaps: []NameMap{{regexp.MustCompile("^m_"), ""}, {regexp.MustCompile("^bad$"), "1x"}}}
+	if err := g.validateNames(mustParseStruct(t, "type foo struct { m_id, id int32 }")); err == nil || err.Error() != "id: exported name Id conflicts with m_id" {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := g.validateNames(mustParseStruct(t, "type foo struct { bad int32 }")); err == nil || err.Error() != `bad: invalid exported name: "1x"` {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := g.validateNames(mustParseStruct(t, "type foo struct { iterator int32 }")); err == nil || err.Error() != "iterator: exported name Iterator conflicts with generated Iterator type" {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+// Ensure that name tags set the exported name of a field.
+func TestNameTag(t *testing.T) {
+	mustRun(t, `
+type user struct {
+	userId int64      `+"`"+`raw:"name=UserID"`+"`"+`
+	url    raw.String `+"`"+`raw:"name=URL"`+"`"+`
+}
+`, `
+	b := (&User{UserID: 10, URL: "http://example.com"}).Encode()
+	var u User
+	if err := u.Decode(b); err != nil {
+		panic(err)
+	} else if u.UserID != 10 || u.URL != "http://example.com" {
+		panic(fmt.Sprintf("unexpected user: %+v", u))
+	}
+	r := (*user)(unsafe.Pointer(&b[0]))
+	if r.UserID() != 10 || string(r.URLBytes()) != "http://example.com" || UserURL(b) != "http://example.com" {
+		panic("unexpected accessors")
+	}
+`)
+
+	// Tagged names are validated like any other exported name.
+	g := &Generator{}
+	if err := g.validateNames(mustParseStruct(t, "type foo struct { a int32 `raw:\"name=b\"` }")); err == nil || err.Error() != `a: invalid exported name: "b"` {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := g.validateNames(mustParseStruct(t, "type foo struct { id int32; other int32 `raw:\"name=Id\"` }")); err == nil || err.Error() != "other: exported name Id conflicts with id" {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+// Ensure that fields tagged with "-" are encoded as zero values without an
+// exported field or accessor.
+func TestSkipTag(t *testing.T) {
+	for _, g := range []*Generator{{}, {Endian: "big"}} {
+		mustRunWith(t, g, `
+type user struct {
+	id       int32
+	_        [4]byte    `+"`"+`raw:"-"`+"`"+`
+	internal raw.String `+"`"+`raw:"-"`+"`"+`
+	name     raw.String
+}
+`, `
+	b := (&User{Id: 1, Name: "bob"}).Encode()
+	if len(b) != 19 {
+		panic(fmt.Sprintf("unexpected length: %d", len(b)))
+	}
+	var u User
+	if err := u.Decode(b); err != nil {
+		panic(err)
+	} else if u.Id != 1 || u.Name != "bob" {
+		panic(fmt.Sprintf("unexpected user: %+v", u))
+	}
+`)
+	}
+
+	b, err := GenerateFile([]byte("package foo\n\nimport \"github.com/boltdb/raw\"\n\ntype user struct {\n\tid int32\n\tinternal raw.String `raw:\"-\"`\n}\n"))
+	if err != nil {
+		t.Fatal(err)
+	} else if s := string(b); strings.Contains(s, "Internal") {
+		t.Fatalf("unexpected exported field or accessor:\n%s", s)
+	}
+}
+
+// Ensure that accessors with implicit suffixes cannot collide with the
+// accessors of other fields.
+func TestValidateNames_AccessorCollision(t *testing.T) {
+	for _, tt := range []struct {
+		src string
+		err string
+	}{
+		{"type foo struct { name raw.String; nameBytes raw.String }", "accessor NameBytes() of field nameBytes conflicts with accessor of field name"},
+		{"type foo struct { nameBytes int64; name raw.String }", "accessor NameBytes() of field name conflicts with accessor of field nameBytes"},
+		{"type foo struct { created raw.Time; createdUnix int64 }", "accessor CreatedUnix() of field createdUnix conflicts with accessor of field created"},
+		{"type foo struct { createdUnixNano int64; created raw.Time }", "accessor CreatedUnixNano() of field created conflicts with accessor of field createdUnixNano"},
+		{"type foo struct { nick raw.NullString; nickBytes raw.String }", "accessor NickBytes() of field nickBytes conflicts with accessor of field nick"},
+		{"type foo struct { nickUTF8 int64; nick raw.NullString `raw:\"utf8=error\"` }", "accessor NickUTF8() of field nick conflicts with accessor of field nickUTF8"},
+	} {
+		if err := (&Generator{}).validateNames(mustParseStruct(t, tt.src)); err == nil || err.Error() != tt.err {
+			t.Errorf("%s: unexpected error: %v", tt.src, err)
+		}
+	}
+
+	// Suffixes on unrelated types are allowed.
+	if err := (&Generator{}).validateNames(mustParseStruct(t, "type foo struct { count int64; countBytes int64 }")); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// Ensure that fields can't have the names of generated types, functions, and
+// constants, which would conflict with their field functions.
+func TestValidateNames_Generated(t *testing.T) {
+	for _, tt := range []struct {
+		src string
+		err string
+	}{
+		{"type foo struct { view int32 }", "view: exported name View conflicts with generated View type"},
+		{"type foo struct { encoder int32 }", "encoder: exported name Encoder conflicts with generated Encoder type"},
+		{"type foo struct { id int32 `raw:\"key\"`; keyFrom int32 }", "keyFrom: exported name KeyFrom conflicts with generated KeyFrom function"},
+		{"type foo struct { a int32 `raw:\"key=1\"`; b int32 `raw:\"key=2\"`; aKeyPrefix int32 }", "aKeyPrefix: exported name AKeyPrefix conflicts with generated AKeyPrefix function of a"},
+		{"type foo struct { statusEnum int32; status uint8 `raw:\"enum=a|b\"` }", "statusEnum: exported name StatusEnum conflicts with generated StatusEnum type of status"},
+		{"type foo struct { perms raw.Flags8 `raw:\"flags=a|b\"`; permsFlags int32 }", "permsFlags: exported name PermsFlags conflicts with generated PermsFlags type of perms"},
+	} {
+		if err := (&Generator{}).validateNames(mustParseStruct(t, tt.src)); err == nil || err.Error() != tt.err {
+			t.Errorf("%s: unexpected error: %v", tt.src, err)
+		}
+	}
+
+	// A name tag avoids the conflict.
+	mustRun(t, `
+type user struct {
+	id   int32
+	name raw.String `+"`"+`raw:"name=ViewName"`+"`"+`
+}
+`, `
+	b := (&User{Id: 1, ViewName: "bob"}).Encode()
+	if UserViewName(b) != "bob" {
+		panic("unexpected name")
+	}
+`)
+}
+
+// Ensure that an iterator decodes each record encoded by an encoder.
+func TestIterator(t *testing.T) {
+	mustRun(t, `
+type event struct {
+	id   int64
+	name raw.String
+	tag  raw.String
+}
+`, `
+	e := NewEventEncoder()
+	for i := 0; i < 5; i++ {
+		e.Append(&Event{Id: i, Name: fmt.Sprint("name", i), Tag: "t"})
+	}
+
+	// Iterate over all records.
+	var ids []int
+	it := IterEvent(e.Bytes())
+	for o := range it.All() {
+		if o.Name != fmt.Sprint("name", o.Id) || o.Tag != "t" {
+			panic(fmt.Sprintf("unexpected event: %+v", o))
+		}
+		ids = append(ids, o.Id)
+	}
+	if it.Err() != nil || fmt.Sprint(ids) != "[0 1 2 3 4]" {
+		panic(fmt.Sprintf("unexpected iteration: %v: %v", ids, it.Err()))
+	}
+
+	// Break early and resume with the pull-style iterator.
+	it = IterEvent(e.Bytes())
+	for o := range it.All() {
+		if o.Id == 1 {
+			break
+		}
+	}
+	var next func() (*Event, bool) = it.Next
+	if o, ok := next(); !ok || o.Id != 2 {
+		panic(fmt.Sprintf("unexpected next event: %+v", o))
+	}
+`)
+}
+
+// Ensure that an iterator stops with an error on corrupt trailing bytes.
+func TestIterator_Corrupt(t *testing.T) {
+	mustRun(t, `
+type event struct {
+	id   int64
+	name raw.String
+}
+`, `
+	e := NewEventEncoder()
+	e.Append(&Event{Id: 1, Name: "foo"})
+	e.Append(&Event{Id: 2, Name: "bar"})
+	b := e.Bytes()
+
+	for _, tt := range []struct {
+		b []byte
+		n int
+	}{
+		{b[:len(b)-1], 1}, // truncated string
+		{b[:len(b)-5], 1}, // truncated fixed section
+		{append(append([]byte{}, b...), 0xFF), 2},
+	} {
+		var n int
+		it := IterEvent(tt.b)
+		for range it.All() {
+			n++
+		}
+		if n != tt.n || it.Err() != io.ErrUnexpectedEOF {
+			panic(fmt.Sprintf("unexpected iteration: n=%d, err=%v", n, it.Err()))
+		}
+	}
+`)
+}
+
+// Ensure that fixed size fields can be patched in an encoded record.
+func TestPatch(t *testing.T) {
+	mustRun(t, `
+type event struct {
+	name raw.String
+	count int32
+	at raw.Time
+}
+`, `
+	b := (&Event{Name: "foo", Count: 1, At: time.Unix(1, 0)}).Encode()
+	if err := PatchEventCount(b, 20); err != nil {
+		panic(err)
+	}
+	if err := PatchEventAt(b, time.Unix(300, 0)); err != nil {
+		panic(err)
+	}
+
+	var e Event
+	e.Decode(b)
+	if e.Name != "foo" || e.Count != 20 || !e.At.Equal(time.Unix(300, 0)) {
+		panic(fmt.Sprintf("unexpected event: %+v", e))
+	}
+
+	if err := PatchEventCount(b[:4], 1); err == nil {
+		panic("expected error for short buffer")
+	}
+`)
+}
+
+// Ensure that TinyGo mode generates code that doesn't use unsafe and encodes
+// records in the same format as the native code.
+func TestGenerateFile_TinyGo(t *testing.T) {
+	src := []byte("package foo\n\nimport \"github.com/boltdb/raw\"\n\ntype event struct {\n\tname raw.String\n\tat raw.Time\n}\n")
+	b, err := (&Generator{TinyGo: true}).GenerateFile(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range []string{"unsafe.", "Iterator", "Encoder"} {
+		if strings.Contains(string(b), s) {
+			t.Fatalf("unexpected %q in generated code:\n%s", s, b)
+		}
+	}
+
+	mustRunWith(t, &Generator{TinyGo: true}, `
+type event struct {
+	ok bool
+	name raw.String
+	i8 int8
+	i64 int64
+	u16 uint16
+	f32 float32
+	f64 float64
+	at raw.Time
+	d raw.Duration
+	desc raw.String
+}
+`, `
+	o := Event{true, "foo", -2, -1 << 40, 65535, 1.5, -2.5, time.Unix(10, 5).UTC(), time.Second, "bar"}
+	b := o.Encode()
+
+	var other Event
+	other.Decode(b)
+	if other != o {
+		panic(fmt.Sprintf("unexpected decode: %+v", other))
+	}
+
+	// Records match the native layout.
+	if len(b) != int(unsafe.Sizeof(event{}))+6 {
+		panic(fmt.Sprintf("unexpected size: %d", len(b)))
+	}
+	r := (*event)(unsafe.Pointer(&b[0]))
+	if !r.ok || r.name.String(b) != "foo" || r.i8 != -2 || r.i64 != -1<<40 || r.u16 != 65535 ||
+		r.f32 != 1.5 || r.f64 != -2.5 || r.at != raw.Time(o.At.UnixNano()) || r.d != raw.Duration(time.Second) || r.desc.String(b) != "bar" {
+		panic(fmt.Sprintf("unexpected raw struct: %+v", *r))
+	}
+`)
+}
+
+// Ensure that safe mode generates code without any reference to unsafe.
+func TestGenerateFile_Safe(t *testing.T) {
+	src := []byte("package foo\n\nimport \"github.com/boltdb/raw\"\n\ntype event struct {\n\tid int64\n\tname raw.String\n\tdata raw.Bytes\n}\n")
+	b, err := (&Generator{Safe: true}).GenerateFile(src)
+	if err != nil {
+		t.Fatal(err)
+	} else if strings.Contains(string(b), "unsafe") {
+		t.Fatalf("unexpected unsafe in generated code:\n%s", b)
+	}
+	if _, err := parser.ParseFile(token.NewFileSet(), "", b, 0); err != nil {
+		t.Fatalf("generated file does not parse: %s\n%s", err, b)
+	}
+}
+
+// Ensure that records can be encoded in big-endian byte order.
+func TestGenerateFile_BigEndian(t *testing.T) {
+	mustRunWith(t, &Generator{Endian: "big"}, `
+type event struct {
+	count int32
+	name raw.String
+}
+`, `
+	o := Event{1, "foo"}
+	b := o.Encode()
+	if b[0] != 0 || b[3] != 1 {
+		panic(fmt.Sprintf("unexpected encoding: %x", b))
+	} else if b[4] != 0 || b[5] != 8 || b[6] != 0 || b[7] != 3 {
+		panic(fmt.Sprintf("unexpected string encoding: %x", b))
+	}
+
+	var other Event
+	other.Decode(b)
+	if other != o {
+		panic(fmt.Sprintf("unexpected decode: %+v", other))
+	}
+`)
+}
+
+// Ensure that an invalid byte order returns an error.
+func TestGenerateFile_ErrInvalidEndian(t *testing.T) {
+	src := []byte("package foo\n\nimport \"github.com/boltdb/raw\"\n\ntype event struct {\n\tname raw.String\n}\n")
+	if _, err := (&Generator{Endian: "middle"}).GenerateFile(src); err == nil || err.Error() != "invalid byte order: middle" {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+// Ensure that comparison benchmarks can be generated and run.
+func TestGenerateBenchmarks(t *testing.T) {
+	src := []byte("package foo\n\nimport (\n\t\"time\"\n\t\"unsafe\"\n\n\t\"github.com/boltdb/raw\"\n)\n\nvar _, _ = time.Now, unsafe.Sizeof(0)\n\n" +
+		"type event struct {\n\tname raw.String\n\tcount int32\n\tat raw.Time\n}\n\n//raw:skip\ntype other struct {\n\tname raw.String\n}\n")
+	g := &Generator{}
+	b, err := g.GenerateFile(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bench, err := g.GenerateBenchmarks(b)
+	if err != nil {
+		t.Fatal(err)
+	} else if strings.Contains(string(bench), "Other") {
+		t.Fatalf("unexpected benchmarks for skipped struct:\n%s", bench)
+	}
+
+	dir := mustTempDir(t)
+	defer os.RemoveAll(dir)
+	if err := ioutil.WriteFile(filepath.Join(dir, "foo.go"), b, 0600); err != nil {
+		t.Fatal(err)
+	} else if err := ioutil.WriteFile(filepath.Join(dir, "foo_rawbench_test.go"), bench, 0600); err != nil {
+		t.Fatal(err)
+	}
+	cmd := exec.Command("go", "test", "-run", "^$", "-bench", ".", "-benchtime", "1x")
+	cmd.Dir = dir
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("test: %s\n%s\n\n%s", err, out, bench)
+	}
+	for _, name := range []string{"EncodeRaw", "DecodeRaw", "EncodeGob", "DecodeGob", "EncodeJSON", "DecodeJSON"} {
+		if !regexp.MustCompile(`BenchmarkEvent` + name + `\S*\s.* B/record`).Match(out) {
+			t.Fatalf("expected %s benchmark with record size:\n%s", name, out)
+		}
+	}
+}
+
+// Ensure that benchmarks of the generated code can be generated and run.
+func TestGenerateRawBenchmarks(t *testing.T) {
+	src := []byte("package foo\n\nimport (\n\t\"time\"\n\t\"unsafe\"\n\n\t\"github.com/boltdb/raw\"\n)\n\nvar _, _ = time.Now, unsafe.Sizeof(0)\n\n" +
+		"type event struct {\n\tname raw.String\n\tcount int32\n\tat raw.Time\n}\n")
+	for _, g := range []*Generator{{}, {Safe: true}} {
+		b, err := g.GenerateFile(src)
+		if err != nil {
+			t.Fatal(err)
+		}
+		bench, err := g.GenerateRawBenchmarks(b)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		dir := mustTempDir(t)
+		defer os.RemoveAll(dir)
+		if err := ioutil.WriteFile(filepath.Join(dir, "foo.go"), b, 0600); err != nil {
+			t.Fatal(err)
+		} else if err := ioutil.WriteFile(filepath.Join(dir, "foo_rawgen_bench_test.go"), bench, 0600); err != nil {
+			t.Fatal(err)
+		}
+		cmd := exec.Command("go", "test", "-run", "^$", "-bench", ".", "-benchtime", "1x")
+		cmd.Dir = dir
+		out, err := cmd.CombinedOutput()
+		if err != nil {
+			t.Fatalf("test: %s\n%s\n\n%s", err, out, bench)
+		}
+
+		names := []string{"Encode", "Decode"}
+		if !g.Safe {
+			names = append(names, "AccessName", "AccessCount", "AccessAt")
+		} else if strings.Contains(string(bench), "Access") {
+			t.Fatalf("unexpected accessor benchmarks for portable code:\n%s", bench)
+		}
+		for _, name := range names {
+			if !regexp.MustCompile(`BenchmarkEvent` + name + `\S*\s`).Match(out) {
+				t.Fatalf("expected %s benchmark:\n%s", name, out)
+			}
+		}
+	}
+}
+
+// Ensure that fuzz tests can be generated and run against their seed corpus.
+func TestGenerateFuzzTests(t *testing.T) {
+	src := []byte("package foo\n\nimport (\n\t\"time\"\n\t\"unsafe\"\n\n\t\"github.com/boltdb/raw\"\n)\n\nvar _, _ = time.Now, unsafe.Sizeof(0)\n\n" +
+		"type event struct {\n\tname raw.String\n\ttags raw.StringList\n\tat raw.Time\n}\n")
+	g := &Generator{AllowPadding: true}
+	b, err := g.GenerateFile(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fuzz, err := g.GenerateFuzzTests(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir := mustTempDir(t)
+	defer os.RemoveAll(dir)
+	if err := ioutil.WriteFile(filepath.Join(dir, "foo.go"), b, 0600); err != nil {
+		t.Fatal(err)
+	} else if err := ioutil.WriteFile(filepath.Join(dir, "foo_rawgen_fuzz_test.go"), fuzz, 0600); err != nil {
+		t.Fatal(err)
+	}
+	cmd := exec.Command("go", "test", "-run", "FuzzEventDecode", "-v")
+	cmd.Dir = dir
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("test: %s\n%s\n\n%s", err, out, fuzz)
+	} else if !strings.Contains(string(out), "--- PASS: FuzzEventDecode") {
+		t.Fatalf("expected fuzz test to run:\n%s", out)
+	}
+}
+
+// Ensure that round-trip tests can be generated and pass for every field type.
+func TestGenerateRoundTripTests(t *testing.T) {
+	src := []byte("package foo\n\nimport (\n\t\"time\"\n\t\"unsafe\"\n\n\t\"github.com/boltdb/raw\"\n)\n\nvar _, _ = time.Now, unsafe.Sizeof(0)\n\n" +
+		"//raw:retain\ntype event struct {\n\tok bool\n\ti8 int8\n\ti64 int64\n\tu16 uint16\n\tu64 uint64\n\tf32 float32\n\tf64 float64\n" +
+		"\tat raw.Time\n\td raw.Duration\n\tname raw.String8\n\tbody raw.String\n\tdata raw.Bytes\n\ttags raw.StringList\n\tids raw.Slice[int32]\n\tid [16]byte\n}\n")
+	for _, g := range []*Generator{{AllowPadding: true}, {Safe: true}} {
+		if g.Safe {
+			src = bytes.Replace(src, []byte("//raw:retain\n"), nil, 1)
+		}
+		b, err := g.GenerateFile(src)
+		if err != nil {
+			t.Fatal(err)
+		}
+		tests, err := g.GenerateRoundTripTests(b)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		dir := mustTempDir(t)
+		defer os.RemoveAll(dir)
+		if err := ioutil.WriteFile(filepath.Join(dir, "foo.go"), b, 0600); err != nil {
+			t.Fatal(err)
+		} else if err := ioutil.WriteFile(filepath.Join(dir, "foo_rawgen_test.go"), tests, 0600); err != nil {
+			t.Fatal(err)
+		}
+		cmd := exec.Command("go", "test", "-v")
+		cmd.Dir = dir
+		out, err := cmd.CombinedOutput()
+		if err != nil {
+			t.Fatalf("test: %s\n%s\n\n%s", err, out, tests)
+		}
+		for _, name := range []string{"zero", "min", "max", "max_length_Name", "max_length_Body", "max_length_Data", "typical"} {
+			if !strings.Contains(string(out), "--- PASS: TestEventRoundTrip/"+name) {
+				t.Fatalf("expected %s case to pass:\n%s", name, out)
+			}
+		}
+	}
+}
+
+// Ensure that Decode rejects a list with a string outside the record.
+func TestGenerateFile_StringListBounds(t *testing.T) {
+	mustRun(t, `
+type event struct {
+	tags raw.StringList
+}
+`, `
+	b := (&Event{Tags: []string{"foo", "bar"}}).Encode()
+	r := (*event)(unsafe.Pointer(&b[0]))
+	b[r.tags.Offset+4] = 0xff
+	var o Event
+	if err := o.Decode(b); err == nil {
+		panic("expected error")
+	}
+`)
+}
+
+// Ensure that encoding data past the offset or length limit of a field
+// panics instead of truncating it, in native and portable code.
+func TestGenerateFile_OffsetOverflow(t *testing.T) {
+	for _, g := range []*Generator{{}, {Safe: true}} {
+		mustRunWith(t, g, `
+type event struct {
+	name raw.String8
+	tags raw.StringList
+}
+
+type discard int
+
+func (discard) Write(b []byte) (int, error) { return len(b), nil }
+
+func mustPanic(name string, fn func()) {
+	defer func() {
+		if r := recover(); r == nil {
+			panic(name + ": expected panic")
+		} else if s := fmt.Sprint(r); s[:4] != "raw:" {
+			panic(name + ": unexpected panic: " + s)
+		}
+	}()
+	fn()
+}
+`, `
+	long := func(n int) string { return fmt.Sprintf("%0*d", n, 0) }
+	(&Event{Name: long(200), Tags: []string{long(60000)}}).Encode()
+
+	for _, o := range []*Event{
+		{Name: long(300)},
+		{Tags: []string{long(70000)}},
+		{Tags: []string{long(40000), long(40000)}},
+	} {
+		mustPanic("Encode", func() { o.Encode() })
+		mustPanic("EncodeTo", func() { o.EncodeTo(discard(0)) })
+	}
+`)
+	}
+}
+
+// Ensure that fields can use user-defined types implementing raw.Encoder and
+// raw.Decoder.
+func TestGenerateFile_Codec(t *testing.T) {
+	mustRun(t, `
+type reading struct {
+	name raw.String
+	temp celsius
+	unit label
+}
+
+// celsius stores a temperature in hundredths of a degree.
+type celsius struct {
+	v int32
+}
+
+func (c *celsius) Encode(v float64, value *[]byte) { c.v = int32(v * 100) }
+func (c *celsius) Decode(value []byte) float64   { return float64(c.v) / 100 }
+
+// label stores a string with a prefix in the variable length section.
+type label struct {
+	s raw.String
+}
+
+func (l *label) Encode(v string, value *[]byte) { l.s.Encode("#"+v, value) }
+func (l *label) Decode(value []byte) string     { return l.s.String(value)[1:] }
+`, `
+	var _ raw.Encoder[string] = (*raw.String)(nil)
+	var _ raw.Decoder[string] = (*raw.String)(nil)
+
+	var o Reading
+	o.Decode((&Reading{Name: "foo", Temp: 21.5, Unit: "C"}).Encode())
+	if o.Name != "foo" || o.Temp != 21.5 || o.Unit != "C" {
+		panic(fmt.Sprintf("unexpected reading: %+v", o))
+	}
+`)
+}
+
+// Ensure that a single field can be read from an encoded record.
+func TestFieldFuncs(t *testing.T) {
+	mustRun(t, `
+type event struct {
+	name raw.String
+	count int32
+	at raw.Time
+}
+`, `
+	b := (&Event{Name: "foo", Count: 20, At: time.Unix(300, 0)}).Encode()
+	if s := EventName(b); s != "foo" {
+		panic(fmt.Sprintf("unexpected name: %q", s))
+	} else if n := EventCount(b); n != 20 {
+		panic(fmt.Sprintf("unexpected count: %d", n))
+	} else if at := EventAt(b); !at.Equal(time.Unix(300, 0)) {
+		panic(fmt.Sprintf("unexpected time: %s", at))
+	}
+
+	// Short and corrupt records read as zero values instead of past b.
+	if s, n := EventName(b[:4]), EventCount(nil); s != "" || n != 0 {
+		panic(fmt.Sprintf("unexpected fields of short record: %q %d", s, n))
+	} else if s, n := EventName(b[:len(b)-1]), EventCount(b[:len(b)-1]); s != "" || n != 20 {
+		panic(fmt.Sprintf("unexpected fields of corrupt record: %q %d", s, n))
+	}
+`)
+
+	// Type tags are skipped before checking the record.
+	mustRunWith(t, &Generator{TypeTag: true}, `
+type event struct {
+	name raw.String
+	count int32
+}
+`, `
+	b := (&Event{Name: "foo", Count: 20}).Encode()
+	if s, n := EventName(b), EventCount(b); s != "foo" || n != 20 {
+		panic(fmt.Sprintf("unexpected fields: %q %d", s, n))
+	} else if n := EventCount(b[:len(b)-4]); n != 0 {
+		panic(fmt.Sprintf("unexpected count of short record: %d", n))
+	}
+`)
+}
+
+// Ensure that a view reads fields in place and rejects corrupt records.
+func TestView(t *testing.T) {
+	mustRun(t, `
+type event struct {
+	name     raw.String
+	count    int32      `+"`raw:\"optional\"`"+`
+	ids      raw.Slice[uint64]
+	tags     raw.StringList
+	presence raw.Presence
+}
+`, `
+	count := 20
+	b := (&Event{Name: "foo", Count: &count, Ids: []uint64{1, 2}, Tags: []string{"x"}}).Encode()
+	v, err := ViewEvent(b)
+	if err != nil {
+		panic(err)
+	} else if v.Name() != "foo" || !v.HasCount() || v.Count() != 20 || len(v.Tags()) != 1 {
+		panic(fmt.Sprintf("unexpected view: %q, %d, %q", v.Name(), v.Count(), v.Tags()))
+	}
+
+	// Slices share memory with the record.
+	v.Ids()[0] = 10
+	if EventIds(b)[0] != 10 {
+		panic("view copied the slice")
+	}
+
+	if _, err := ViewEvent(b[:len(b)-1]); err != io.ErrUnexpectedEOF {
+		panic(fmt.Sprintf("expected unexpected EOF: %v", err))
+	} else if _, err := ViewEvent(nil); err != io.ErrUnexpectedEOF {
+		panic(fmt.Sprintf("expected unexpected EOF: %v", err))
+	}
+`)
+}
+
+// Ensure that a lazily decoded record decodes each field on first use and
+// that fields set before loading aren't overwritten.
+func TestLazy(t *testing.T) {
+	mustRun(t, `
+//raw:lazy
+type event struct {
+	id   int64
+	name raw.String
+	ids  raw.Slice[uint64]
+}
+`, `
+	b := (&Event{Id: 1, Name: "foo", Ids: []uint64{1, 2}}).Encode()
+	var e Event
+	if err := e.Decode(b); err != nil {
+		panic(err)
+	} else if e.Name != "" {
+		panic("decoded eagerly")
+	} else if e.GetName() != "foo" || e.GetId() != 1 {
+		panic(fmt.Sprintf("unexpected fields: %d, %q", e.GetId(), e.GetName()))
+	}
+
+	e.SetId(2)
+	e.Load()
+	if e.Id != 2 || e.Name != "foo" || len(e.Ids) != 2 {
+		panic(fmt.Sprintf("unexpected record: %+v", e))
+	}
+
+	// Encoding a record that hasn't been loaded loads it first.
+	var e2 Event
+	e2.Decode(b)
+	if string(e2.Encode()) != string(b) {
+		panic("unexpected encoding")
+	}
+`)
+}
+
+// Ensure that strings round trip with each offset width, up to the largest
+// record each width can address.
+func TestOffsetWidth(t *testing.T) {
+	for _, g := range []*Generator{{}, {TinyGo: true}} {
+		mustRunWith(t, g, `
+//raw:offset-width=8
+type small struct {
+	id int8
+	name raw.String8
+}
+
+type medium struct {
+	name raw.String
+}
+
+//raw:offset-width=32
+type large struct {
+	id int64
+	name raw.String32
+	desc raw.String32
+}
+`, `
+	s := Small{Id: 1, Name: string(make([]byte, 255-int(unsafe.Sizeof(small{}))))}
+	var s2 Small
+	if b := s.Encode(); len(b) != 255 {
+		panic(fmt.Sprintf("unexpected small size: %d", len(b)))
+	} else if s2.Decode(b); s2 != s {
+		panic(fmt.Sprintf("unexpected small: %d %d", s2.Id, len(s2.Name)))
+	}
+
+	m := Medium{Name: string(make([]byte, 0xFFFF-int(unsafe.Sizeof(medium{}))))}
+	var m2 Medium
+	if b := m.Encode(); len(b) != 0xFFFF {
+		panic(fmt.Sprintf("unexpected medium size: %d", len(b)))
+	} else if m2.Decode(b); m2 != m {
+		panic(fmt.Sprintf("unexpected medium: %d", len(m2.Name)))
+	}
+
+	l := Large{Id: 1, Name: string(make([]byte, 0x10000)), Desc: "foo"}
+	var l2 Large
+	if l2.Decode(l.Encode()); l2 != l {
+		panic(fmt.Sprintf("unexpected large: %d %d %q", l2.Id, len(l2.Name), l2.Desc))
+	}
+`)
+	}
+}
+
+// Ensure that byte array fields are stored inline and copied on access.
+func TestByteArray(t *testing.T) {
+	for _, g := range []*Generator{{}, {Endian: "big"}} {
+		mustRunWith(t, g, `
+type file struct {
+	id   [16]byte
+	mac  [6]uint8
+	name raw.String
+	sum  [0x20]byte
+}
+`, `
+	o := File{Id: [16]byte{1, 2, 3}, Mac: [6]byte{0xAA, 5: 0xFF}, Name: "foo", Sum: [32]byte{31: 9}}
+	b := o.Encode()
+
+	var other File
+	if err := other.Decode(b); err != nil {
+		panic(err)
+	} else if other != o {
+		panic(fmt.Sprintf("unexpected decode: %+v", other))
+	}
+	if err := other.Decode(b[:20]); err == nil {
+		panic("expected error for short buffer")
+	}
+`)
+	}
+
+	mustRun(t, `
+var _ raw.String
+
+type file struct {
+	id  [16]byte
+	sum [32]byte
+}
+`, `
+	b := (&File{Id: [16]byte{1, 2, 3}}).Encode()
+
+	// Accessors return a copy of the array.
+	r := (*file)(unsafe.Pointer(&b[0]))
+	id := r.Id()
+	id[0] = 100
+	if b[0] != 1 || FileId(b) != [16]byte{1, 2, 3} {
+		panic("accessor did not copy")
+	}
+
+	if err := PatchFileSum(b, [32]byte{0: 7}); err != nil {
+		panic(err)
+	} else if b[16] != 7 {
+		panic(fmt.Sprintf("unexpected patch: %x", b))
+	}
+`)
+}
+
+// Ensure that variable length binary fields round trip and are copied when
+// decoded.
+func TestBytes(t *testing.T) {
+	for _, g := range []*Generator{{}, {Endian: "big"}} {
+		mustRunWith(t, g, `
+type blob struct {
+	name raw.String
+	data raw.Bytes
+	id   int32
+}
+`, `
+	o := Blob{Name: "foo", Data: []byte{0, 1, 0xFF}, Id: 7}
+	b := o.Encode()
+
+	var other Blob
+	if err := other.Decode(b); err != nil {
+		panic(err)
+	} else if other.Name != "foo" || string(other.Data) != "\x00\x01\xff" || other.Id != 7 {
+		panic(fmt.Sprintf("unexpected decode: %+v", other))
+	}
+	other.Data[0] = 100
+	if b[len(b)-3] != 0 {
+		panic("decoded bytes share memory with the record")
+	}
+	if err := other.Decode(b[:len(b)-1]); err == nil {
+		panic("expected error for truncated bytes")
+	}
+`)
+	}
+
+	mustRun(t, `
+type blob struct {
+	data raw.Bytes
+}
+`, `
+	b := (&Blob{Data: []byte("abc")}).Encode()
+	if r := (*blob)(unsafe.Pointer(&b[0])); string(r.Data()) != "abc" || string(BlobData(b)) != "abc" {
+		panic("unexpected accessor")
+	}
+`)
+}
+
+// Ensure that numeric slice fields round trip with each encoding.
+func TestSlice(t *testing.T) {
+	for _, g := range []*Generator{{}, {Endian: "little"}, {Endian: "big"}} {
+		mustRunWith(t, g, `
+type series struct {
+	name   raw.String
+	ids    raw.Slice[uint64]
+	values raw.Slice[float32]
+	flags  raw.Slice[int8]
+	deltas raw.Slice[int16]
+}
+`, `
+	o := Series{Name: "abc", Ids: []uint64{1, 1 << 40}, Values: []float32{1.5, -2}, Flags: []int8{-1}, Deltas: []int16{-300, 300}}
+	b := o.Encode()
+
+	var other Series
+	if err := other.Decode(b); err != nil {
+		panic(err)
+	} else if fmt.Sprint(other) != fmt.Sprint(o) {
+		panic(fmt.Sprintf("unexpected decode: %+v", other))
+	}
+	if err := other.Decode(b[:len(b)-1]); err == nil {
+		panic("expected error for truncated slice")
+	}
+
+	// Empty slices decode as nil.
+	if err := other.Decode((&Series{}).Encode()); err != nil {
+		panic(err)
+	} else if other.Ids != nil || other.Flags != nil {
+		panic(fmt.Sprintf("unexpected empty decode: %+v", other))
+	}
+`)
+	}
+
+	mustRun(t, `
+type series struct {
+	name raw.String
+	ids  raw.Slice[uint64]
+}
+`, `
+	b := (&Series{Name: "abc", Ids: []uint64{1, 2, 3}}).Encode()
+
+	// Elements are aligned after the string and viewed without copying.
+	r := (*series)(unsafe.Pointer(&b[0]))
+	if r.ids.Offset != 16 || len(b) != 40 {
+		panic(fmt.Sprintf("unexpected layout: offset=%d, len=%d", r.ids.Offset, len(b)))
+	}
+	ids := r.Ids()
+	ids[0] = 10
+	if SeriesIds(b)[0] != 10 {
+		panic("accessor copied the elements")
+	}
+
+	// Iterating uses the end of the last element.
+	e := NewSeriesEncoder()
+	e.Append(&Series{Name: "a", Ids: []uint64{1}})
+	e.Append(&Series{Name: "bb", Ids: []uint64{2, 3}})
+	var n int
+	for o := range IterSeries(e.Bytes()).All() {
+		n += len(o.Ids)
+	}
+	if n != 3 {
+		panic(fmt.Sprintf("unexpected count: %d", n))
+	}
+`)
+}
+
+// Ensure that string list fields round trip with each encoding.
+func TestStringList(t *testing.T) {
+	for _, g := range []*Generator{{}, {Endian: "little"}, {Endian: "big"}} {
+		mustRunWith(t, g, `
+type post struct {
+	id    int64
+	title raw.String
+	tags  raw.StringList
+}
+`, `
+	o := Post{Id: 1, Title: "abc", Tags: []string{"go", "", "databases"}}
+	b := o.Encode()
+	if len(b) != 51 {
+		panic(fmt.Sprintf("unexpected length: %d", len(b)))
+	}
+
+	var other Post
+	if err := other.Decode(b); err != nil {
+		panic(err)
+	} else if fmt.Sprintf("%q", other) != fmt.Sprintf("%q", o) {
+		panic(fmt.Sprintf("unexpected decode: %+v", other))
+	}
+	if err := other.Decode(b[:len(b)-1]); err == nil {
+		panic("expected error for truncated list")
+	}
+
+	// Empty lists decode as nil.
+	if err := other.Decode((&Post{}).Encode()); err != nil {
+		panic(err)
+	} else if other.Tags != nil {
+		panic(fmt.Sprintf("unexpected empty decode: %+v", other))
+	}
+`)
+	}
+
+	mustRun(t, `
+type post struct {
+	title raw.String
+	tags  raw.StringList
+}
+`, `
+	b := (&Post{Title: "a", Tags: []string{"x", "yz"}}).Encode()
+	r := (*post)(unsafe.Pointer(&b[0]))
+	if tags := r.Tags(); len(tags) != 2 || tags[0] != "x" || tags[1] != "yz" {
+		panic(fmt.Sprintf("unexpected tags: %q", tags))
+	}
+
+	// Iterating uses the end of the list.
+	e := NewPostEncoder()
+	e.Append(&Post{Title: "a", Tags: []string{"x"}})
+	e.Append(&Post{Tags: []string{"y", "z"}})
+	var n int
+	for o := range IterPost(e.Bytes()).All() {
+		n += len(o.Tags)
+	}
+	if n != 3 {
+		panic(fmt.Sprintf("unexpected count: %d", n))
+	}
+`)
+}
+
+// Ensure that records of older versions are migrated by DecodeAny.
+func TestVersion(t *testing.T) {
+	mustRun(t, `
+//raw:version=1
+type userV1 struct {
+	version uint8
+	name    raw.String
+}
+
+//raw:version=2
+type userV2 struct {
+	version uint8
+	age     int32
+	name    raw.String
+}
+
+//raw:version=4
+type user struct {
+	version uint8
+	age     int32
+	name    raw.String
+	email   raw.String
+}
+
+func MigrateUserV1toV2(o *UserV1) *UserV2 { return &UserV2{Age: 0, Name: o.Name} }
+func MigrateUserV2toV4(o *UserV2) *User   { return &User{Age: o.Age, Name: o.Name, Email: "unknown"} }
+`, `
+	b := (&User{Age: 30, Name: "bob", Email: "bob@example.com"}).Encode()
+	if b[0] != 4 {
+		panic(fmt.Sprintf("unexpected version byte: %d", b[0]))
+	}
+
+	var o User
+	if err := o.DecodeAny(b); err != nil {
+		panic(err)
+	} else if o.Age != 30 || o.Email != "bob@example.com" {
+		panic(fmt.Sprintf("unexpected decode: %+v", o))
+	}
+	if err := o.DecodeAny((&UserV2{Age: 20, Name: "alice"}).Encode()); err != nil {
+		panic(err)
+	} else if o.Age != 20 || o.Name != "alice" || o.Email != "unknown" {
+		panic(fmt.Sprintf("unexpected v2 decode: %+v", o))
+	}
+	if err := o.DecodeAny((&UserV1{Name: "eve"}).Encode()); err != nil {
+		panic(err)
+	} else if o.Name != "eve" || o.Email != "unknown" {
+		panic(fmt.Sprintf("unexpected v1 decode: %+v", o))
+	}
+
+	// Decode only accepts the current version.
+	if err := o.Decode((&UserV2{}).Encode()); err != raw.ErrVersion {
+		panic(fmt.Sprintf("unexpected error: %v", err))
+	}
+	b[0] = 3
+	if err := o.DecodeAny(b); err != raw.ErrVersion {
+		panic(fmt.Sprintf("unexpected error: %v", err))
+	}
+`)
+}
+
+// Ensure that invalid versioned structs return an error.
+func TestVersion_Err(t *testing.T) {
+	for _, tt := range []struct {
+		src string
+		err string
+	}{
+		{"//raw:version=1\ntype user struct {\n\tname raw.String\n}\n", "user: version requires a first field: version uint8"},
+		{"//raw:version=256\ntype user struct {\n\tversion uint8\n}\n", `user: invalid version: "256"`},
+		{"//raw:version=2\ntype userV1 struct {\n\tversion uint8\n}\n\n//raw:version=1\ntype user struct {\n\tversion uint8\n}\n", "generate decode any func: userV1: version pragma must be 1"},
+	} {
+		if _, err := GenerateFile([]byte("package foo\n\nimport \"github.com/boltdb/raw\"\n\nvar _ raw.String\n\n" + tt.src)); err == nil || err.Error() != tt.err {
+			t.Errorf("unexpected error: %v", err)
+		}
+	}
+	if _, err := (&Generator{Endian: "big"}).GenerateFile([]byte("package foo\n\n//raw:version=1\ntype user struct {\n\tversion uint8\n\tid int64\n}\n")); err == nil || !strings.Contains(err.Error(), "version is not supported with portable encoding") {
+		t.Errorf("unexpected portable error: %v", err)
+	}
+}
+
+// Ensure that only byte arrays with a literal length are raw types.
+func TestTostr_Array(t *testing.T) {
+	for _, tt := range []struct{ src, typ string }{
+		{"[16]byte", "[16]byte"},
+		{"[0x10]uint8", "[16]byte"},
+		{"[16]int8", ""},
+		{"[n]byte", ""},
+		{"[]byte", ""},
+		{"[0]byte", ""},
+	} {
+		s := mustParseStruct(t, "type foo struct { b "+tt.src+" }")
+		if typ := tostr(s.Fields.List[0].Type); typ != tt.typ {
+			t.Errorf("%s: unexpected type: %q", tt.src, typ)
+		}
+	}
+}
+
+// Ensure that offset widths are validated.
+func TestOffsetWidth_Invalid(t *testing.T) {
+	var fields bytes.Buffer
+	for i := 0; i < 32; i++ {
+		fmt.Fprintf(&fields, "\tf%d int64\n", i)
+	}
+	for _, tt := range []struct {
+		src string
+		err string
+	}{
+		{"//raw:offset-width=12\ntype foo struct {\n\tname raw.String\n}\n", `foo: invalid offset width: "12"`},
+		{"//raw:offset-width=32\ntype foo struct {\n\tname raw.String\n}\n", "foo: name: offset width 32 requires a raw.String32 field"},
+		{"type foo struct {\n" + fields.String() + "\tname raw.String8\n}\n", "foo: name: 264 byte struct cannot be addressed by 8-bit offsets"},
+	} {
+		_, err := GenerateFile([]byte("package foo\n\nimport \"github.com/boltdb/raw\"\n\n" + tt.src))
+		if err == nil || err.Error() != tt.err {
+			t.Errorf("%q: unexpected error: %v", tt.src, err)
+		}
+	}
+}
+
+// Ensure that a map of fields is generated when requested.
+func TestMap(t *testing.T) {
+	mustRunWith(t, &Generator{NameMaps: []NameMap{{regexp.MustCompile("Id$"), "ID"}}}, `
+//raw:map
+type event struct {
+	userId int32
+	name raw.String
+	at raw.Time
+}
+`, `
+	at := time.Unix(300, 0).UTC()
+	m := (&Event{UserID: 1, Name: "foo", At: at}).Map()
+	if len(m) != 3 || m["UserID"] != 1 || m["Name"] != "foo" || m["At"] != at {
+		panic(fmt.Sprintf("unexpected map: %v", m))
+	}
+`)
+
+	// Map is opt-in.
+	b, err := GenerateFile([]byte("package foo\n\nimport \"github.com/boltdb/raw\"\n\ntype event struct {\n\tname raw.String\n}\n"))
+	if err != nil {
+		t.Fatal(err)
+	} else if strings.Contains(string(b), "Map()") {
+		t.Fatalf("unexpected map func:\n%s", b)
+	}
+}
+
+// Ensure that raw structs can be nested within other raw structs.
+func TestNested(t *testing.T) {
+	mustRun(t, `
+type event struct {
+	header rawHeader
+	name   raw.String
+	count  int32
+}
+
+type rawHeader struct {
+	source raw.String
+	meta   rawMeta
+}
+
+type rawMeta struct {
+	version int16
+	tag     raw.String8
+}
+`, `
+	o := Event{Header: RawHeader{Source: "src", Meta: RawMeta{Version: 2, Tag: "tag"}}, Name: "foo", Count: 10}
+	b := o.Encode()
+
+	var other Event
+	if err := other.Decode(b); err != nil {
+		panic(err)
+	} else if other != o {
+		panic(fmt.Sprintf("unexpected decode: %+v", other))
+	}
+
+	// Accessors delegate to the nested raw structs.
+	r := (*event)(unsafe.Pointer(&b[0]))
+	if h := r.Header(); h != o.Header {
+		panic(fmt.Sprintf("unexpected header: %+v", h))
+	} else if EventHeader(b).Source != "src" {
+		panic("unexpected field func")
+	}
+
+	// Nested raw structs can still be used on their own.
+	var h RawHeader
+	if err := h.Decode(o.Header.Encode()); err != nil {
+		panic(err)
+	} else if h != o.Header {
+		panic(fmt.Sprintf("unexpected standalone decode: %+v", h))
+	}
+`)
+}
+
+// Ensure that the fields of embedded raw structs are promoted.
+func TestEmbedded(t *testing.T) {
+	mustRun(t, `
+type event struct {
+	id int64
+	rawHeader
+	name raw.String
+}
+
+type rawHeader struct {
+	version int16
+	source  raw.String
+}
+`, `
+	o := Event{Id: 1, RawHeader: RawHeader{Version: 2, Source: "src"}, Name: "foo"}
+	b := o.Encode()
+
+	var other Event
+	if err := other.Decode(b); err != nil {
+		panic(err)
+	} else if other != o {
+		panic(fmt.Sprintf("unexpected decode: %+v", other))
+	}
+
+	// Accessors are generated on the outer raw struct.
+	r := (*event)(unsafe.Pointer(&b[0]))
+	if r.Source() != "src" || r.Version() != 2 || r.Name() != "foo" {
+		panic(fmt.Sprintf("unexpected accessors: %q %d %q", r.Source(), r.Version(), r.Name()))
+	} else if EventSource(b) != "src" {
+		panic("unexpected field func")
+	}
+	if err := PatchEventVersion(b, 3); err != nil {
+		panic(err)
+	} else if r.Version() != 3 {
+		panic("unexpected patch")
+	}
+
+	// Records can be iterated over.
+	enc := NewEventEncoder()
+	enc.Append(&o)
+	enc.Append(&o)
+	var n int
+	for e := range IterEvent(enc.Bytes()).All() {
+		if e.Source != "src" {
+			panic(fmt.Sprintf("unexpected event: %+v", e))
+		}
+		n++
+	}
+	if n != 2 {
+		panic(fmt.Sprintf("unexpected count: %d", n))
+	}
+`)
+}
+
+// Ensure that embedded raw structs are rejected with portable encoding.
+func TestEmbedded_Portable(t *testing.T) {
+	src := []byte("package foo\n\nimport \"github.com/boltdb/raw\"\n\ntype event struct {\n\theader\n\tname raw.String\n}\n\ntype header struct {\n\tid int64\n}\n")
+	if _, err := (&Generator{TinyGo: true}).GenerateFile(src); err == nil || err.Error() != "event: embedded raw structs are not supported with portable encoding" {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+// Ensure that structs nesting non-raw structs are not raw.
+func TestNested_NotRaw(t *testing.T) {
+	src := []byte("package foo\n\nimport \"github.com/boltdb/raw\"\n\ntype event struct {\n\theader header\n\tname raw.String\n}\n\ntype header struct {\n\tp *int\n}\n")
+	b, err := GenerateFile(src)
+	if err != nil {
+		t.Fatal(err)
+	} else if strings.Contains(string(b), "type Event struct") {
+		t.Fatalf("unexpected generated code:\n%s", b)
+	}
+}
+
+// Ensure that raw structs exported by another package can be used as fields.
+func TestGenerateFile_Export(t *testing.T) {
+	gopath := mustTempDir(t)
+	defer os.RemoveAll(gopath)
+	t.Setenv("GOPATH", gopath+string(os.PathListSeparator)+os.Getenv("GOPATH"))
+	t.Setenv("GO111MODULE", "off")
+
+	root := filepath.Join(gopath, "src", "example.com", "m")
+	for _, dir := range []string{root, filepath.Join(root, "shared")} {
+		if err := os.MkdirAll(dir, 0700); err != nil {
+			t.Fatal(err)
+		}
+	}
+	main := "package main\n\nimport (\n\t\"fmt\"\n\t\"unsafe\"\n\n\t\"example.com/m/shared\"\n\t\"github.com/boltdb/raw\"\n)\n\n" +
+		"type event struct {\n\tname raw.String\n\thdr shared.RawHeader\n}\n\n" +
+		"func main() {\n" +
+		"\to := Event{Name: \"foo\", Hdr: shared.Header{Version: 2, Host: \"bar\"}}\n" +
+		"\tvar other Event\n" +
+		"\tother.Decode(o.Encode())\n" +
+		"\tif other != o {\n" +
+		"\t\tpanic(fmt.Sprintf(\"unexpected event: %+v\", other))\n" +
+		"\t}\n" +
+		"\t_ = unsafe.Sizeof(0)\n" +
+		"}\n"
+	shared := "package shared\n\nimport (\n\t\"unsafe\"\n\n\t\"github.com/boltdb/raw\"\n)\n\nvar _ = unsafe.Sizeof(0)\n\n" +
+		"//raw:export\ntype header struct {\n\tversion int32\n\thost raw.String\n}\n"
+
+	// The other package must be generated first.
+	g := &Generator{Dir: root}
+	if err := ioutil.WriteFile(filepath.Join(root, "shared", "shared.go"), []byte(shared), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := g.GenerateFile([]byte(main)); err == nil || err.Error() != "event: hdr: shared.RawHeader is not a raw struct exported with //raw:export: generate example.com/m/shared first" {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	b, err := GenerateFile([]byte(shared))
+	if err != nil {
+		t.Fatal(err)
+	} else if err := ioutil.WriteFile(filepath.Join(root, "shared", "shared.go"), b, 0600); err != nil {
+		t.Fatal(err)
+	}
+	g = &Generator{Dir: root}
+	if b, err = g.GenerateFile([]byte(main)); err != nil {
+		t.Fatal(err)
+	} else if err := ioutil.WriteFile(filepath.Join(root, "main.go"), b, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	cmd := exec.Command("go", "run", ".")
+	cmd.Dir = root
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("run: %s\n%s\n\n%s", err, out, b)
+	}
+}
+
+// Ensure that stripping generated code restores the original file and that
+// regenerating it returns the same code.
+func TestStrip(t *testing.T) {
+	for _, src := range []string{
+		"package foo\n\nimport \"github.com/boltdb/raw\"\n\ntype event struct {\n\tname raw.String\n}\n",
+		"package foo\n\nimport (\n\t\"time\"\n\n\t\"github.com/boltdb/raw\"\n)\n\nvar epoch time.Time\n\n//raw:map\ntype event struct {\n\tname raw.String\n\tat   raw.Time\n}\n\ntype other struct {\n\tname raw.String\n}\n",
+	} {
+		g := &Generator{UTF8: "replace", Bolt: true, AllowPadding: true}
+		b, err := g.GenerateFile([]byte(src))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		stripped, n, err := Strip(b)
+		if err != nil {
+			t.Fatal(err)
+		} else if string(stripped) != src {
+			t.Fatalf("unexpected stripped file:\n%s\n\nexpected:\n%s", stripped, src)
+		} else if want := strings.Count(string(b), "//raw:codegen:begin"); n != want {
+			t.Fatalf("unexpected block count: %d != %d", n, want)
+		}
+
+		if other, err := g.GenerateFile(stripped); err != nil {
+			t.Fatal(err)
+		} else if !bytes.Equal(other, b) {
+			t.Fatalf("unexpected regenerated file:\n%s\n\nexpected:\n%s", other, b)
+		}
+	}
+
+	// Files without generated code are unchanged.
+	if b, n, err := Strip([]byte("package foo\n")); err != nil || n != 0 || string(b) != "package foo\n" {
+		t.Fatalf("unexpected strip: %q %d %v", b, n, err)
+	}
+}
+
+// Ensure that only begin/end comments mark generated code so comments and
+// strings that mention them are preserved.
+func TestStrip_Markers(t *testing.T) {
+	src := "//go:build linux\n\n// Copyright notice.\npackage foo\n\nimport \"github.com/boltdb/raw\"\n\n" +
+		"const doc = `//raw:codegen:begin`\n\n/* //raw:codegen:end */\n\ntype event struct {\n\tname raw.String\n}\n"
+	b, err := GenerateFile([]byte(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stripped, n, err := Strip(b); err != nil {
+		t.Fatal(err)
+	} else if n != 1 || string(stripped) != src {
+		t.Fatalf("unexpected stripped file (%d):\n%s", n, stripped)
+	}
+
+	for _, tt := range []struct {
+		src string
+		err string
+	}{
+		{"package foo\n\n//raw:codegen:begin\n\n//raw:codegen:begin\n\n//raw:codegen:end\n", "line 5: nested //raw:codegen:begin"},
+		{"package foo\n\n//raw:codegen:begin\n\ntype x int\n", "line 3: //raw:codegen:begin without //raw:codegen:end"},
+		{"package foo\n\n//raw:codegen:end\n", "line 3: //raw:codegen:end without //raw:codegen:begin"},
+	} {
+		if _, _, err := Strip([]byte(tt.src)); err == nil || err.Error() != tt.err {
+			t.Errorf("unexpected error: %v", err)
+		} else if _, err := GenerateFile([]byte(tt.src)); err == nil || err.Error() != tt.err {
+			t.Errorf("unexpected generate error: %v", err)
+		}
+	}
+}
+
+// Ensure that code can be generated into a separate file with its own imports.
+func TestGenerateSeparateFile(t *testing.T) {
+	src := "package main\n\nimport (\n\t\"fmt\"\n\n\trawpkg \"github.com/boltdb/raw\"\n)\n\n" +
+		"type event struct {\n\tname rawpkg.String\n\tat rawpkg.Time\n}\n\n" +
+		"func main() {\n" +
+		"\to := Event{Name: \"foo\"}\n" +
+		"\tvar other Event\n" +
+		"\tother.Decode(o.Encode())\n" +
+		"\tfmt.Println(other.Name)\n" +
+		"}\n"
+	b, err := (&Generator{AllowPadding: true}).GenerateSeparateFile([]byte(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"package main\n", "\t\"time\"\n", "\t\"unsafe\"\n", "\trawpkg \"github.com/boltdb/raw\"\n", "func (o *Event) Encode() []byte {"} {
+		if !strings.Contains(string(b), want) {
+			t.Fatalf("expected %q in generated file:\n%s", want, b)
+		}
+	}
+
+	dir := mustTempDir(t)
+	defer os.RemoveAll(dir)
+	if err := ioutil.WriteFile(filepath.Join(dir, "main.go"), []byte(src), 0600); err != nil {
+		t.Fatal(err)
+	} else if err := ioutil.WriteFile(filepath.Join(dir, SeparateFileName("main.go")), b, 0600); err != nil {
+		t.Fatal(err)
+	}
+	cmd := exec.Command("go", "run", "main.go", "main_rawgen.go")
+	cmd.Dir = dir
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("run: %s\n%s\n\n%s", err, out, b)
+	} else if string(out) != "foo\n" {
+		t.Fatalf("unexpected output: %q", out)
+	}
+
+	// Files without raw structs have nothing to generate.
+	if b, err := (&Generator{}).GenerateSeparateFile([]byte("package foo\n")); err != nil || b != nil {
+		t.Fatalf("unexpected generated file: %q %v", b, err)
+	}
+}
+
+// Ensure that a separate file imports raw structs exported by another package
+// of the module with the import path of the module root.
+func TestGenerateSeparateFile_RootImport(t *testing.T) {
+	t.Setenv("GO111MODULE", "off")
+	root := mustTempDir(t)
+	defer os.RemoveAll(root)
+	if err := os.MkdirAll(filepath.Join(root, "shared"), 0700); err != nil {
+		t.Fatal(err)
+	}
+
+	shared := "package shared\n\nimport (\n\t\"unsafe\"\n\n\t\"github.com/boltdb/raw\"\n)\n\nvar _ = unsafe.Sizeof(0)\n\n" +
+		"//raw:export\ntype header struct {\n\tversion int32\n\thost raw.String\n}\n"
+	b, err := GenerateFile([]byte(shared))
+	if err != nil {
+		t.Fatal(err)
+	} else if err := ioutil.WriteFile(filepath.Join(root, "shared", "shared.go"), b, 0600); err != nil {
+		t.Fatal(err)
+	}
+	src := "package main\n\nimport (\n\t\"example.com/app/shared\"\n\t\"github.com/boltdb/raw\"\n)\n\n" +
+		"type event struct {\n\tname raw.String\n\thdr shared.RawHeader\n}\n"
+
+	// The package can't be found with the go command outside of a module.
+	if _, err := (&Generator{Dir: root}).GenerateSeparateFile([]byte(src)); err == nil || !strings.HasPrefix(err.Error(), "event: find package example.com/app/shared: ") {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	want := "\t\"example.com/app/shared\"\n"
+	if b, err := (&Generator{Dir: root, RootImport: "example.com/app"}).GenerateSeparateFile([]byte(src)); err != nil {
+		t.Fatal(err)
+	} else if !strings.Contains(string(b), want) || !strings.Contains(string(b), "shared.Header") {
+		t.Fatalf("expected %q in generated file:\n%s", want, b)
+	}
+
+	// The root import path defaults to the module path of go.mod.
+	if err := ioutil.WriteFile(filepath.Join(root, "go.mod"), []byte("module example.com/app\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if b, err := (&Generator{Dir: root}).GenerateSeparateFile([]byte(src)); err != nil {
+		t.Fatal(err)
+	} else if !strings.Contains(string(b), want) {
+		t.Fatalf("expected %q in generated file:\n%s", want, b)
+	}
+}
+
+// Ensure that the code generated for the raw package's test fixture, which
+// its benchmarks use, is up to date.
+func TestGenerateSeparateFile_Fixture(t *testing.T) {
+	src, err := ioutil.ReadFile(filepath.Join("..", "record_test.go"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, err := ioutil.ReadFile(filepath.Join("..", SeparateFileName("record_test.go")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := (&Generator{Arena: true}).GenerateSeparateFile(src)
+	if err != nil {
+		t.Fatal(err)
+	} else if !bytes.Equal(b, want) {
+		t.Fatalf("record_rawgen_test.go is out of date; run go generate in the raw package:\n%s", Diff("record_rawgen_test.go", want, b))
+	}
+}
+
+// Ensure that separate files are named after the original file.
+func TestSeparateFileName(t *testing.T) {
+	if name := SeparateFileName("a/event.go"); name != "a/event_rawgen.go" {
+		t.Fatalf("unexpected name: %s", name)
+	} else if name := SeparateFileName("a/event_test.go"); name != "a/event_rawgen_test.go" {
+		t.Fatalf("unexpected name: %s", name)
+	}
+}
+
+// Ensure that bolt helpers are only generated when enabled.
+func TestGenerateFile_Bolt(t *testing.T) {
+	src := []byte("package foo\n\nimport \"github.com/boltdb/raw\"\n\ntype event struct {\n\tname raw.String\n}\n")
+	if b, err := GenerateFile(src); err != nil {
+		t.Fatal(err)
+	} else if strings.Contains(string(b), "bolt.Bucket") {
+		t.Fatalf("unexpected bolt helpers:\n%s", b)
+	}
+
+	b, err := (&Generator{Bolt: true}).GenerateFile(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		"import \"github.com/boltdb/bolt\"\n",
+		"func (o *Event) Append(b *bolt.Bucket) (uint64, error) {",
+		"const EventBucket = \"event\"\n",
+		"func PutEvent(tx *bolt.Tx, key []byte, o *Event) error {",
+		"func GetEvent(tx *bolt.Tx, key []byte) (*Event, error) {",
+		"func DeleteEvent(tx *bolt.Tx, key []byte) error {",
+		"func PutEventBatch(db *bolt.DB, items []*Event) error {",
+		"func NewEventCursor(tx *bolt.Tx) *EventCursor {",
+		"func RangeEvent(tx *bolt.Tx, min, max []byte, fn func(key []byte, o *Event) error) error {",
+		"func CheckEventSchema(db *bolt.DB) error {",
+	} {
+		if !strings.Contains(string(b), want) {
+			t.Fatalf("expected %q in generated code:\n%s", want, b)
+		}
+	}
+}
+
+// Ensure that a record can be appended to a bucket with a sequential key.
+func TestBolt_Append(t *testing.T) {
+	requirePackage(t, BoltImportPath)
+	mustRunWith(t, &Generator{Bolt: true}, `
+type event struct {
+	name raw.String
+}
+`, `
+	f, err := os.CreateTemp("", "bolt-")
+	if err != nil {
+		panic(err)
+	}
+	f.Close()
+	defer os.Remove(f.Name())
+
+	db, err := bolt.Open(f.Name(), 0600, nil)
+	if err != nil {
+		panic(err)
+	}
+	defer db.Close()
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		b, err := tx.CreateBucket([]byte("events"))
+		if err != nil {
+			return err
+		}
+		for i, name := range []string{"foo", "bar"} {
+			if id, err := (&Event{Name: name}).Append(b); err != nil {
+				return err
+			} else if id != uint64(i+1) {
+				return fmt.Errorf("unexpected id: %d", id)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		panic(err)
+	}
+
+	db.View(func(tx *bolt.Tx) error {
+		var e Event
+		e.Decode(tx.Bucket([]byte("events")).Get([]byte{0, 0, 0, 0, 0, 0, 0, 2}))
+		if e.Name != "bar" {
+			panic(fmt.Sprintf("unexpected event: %+v", e))
+		}
+		return nil
+	})
+`)
+}
+
+// Ensure that the layout fingerprint of a raw struct is recorded in a database
+// and that a database with another layout is refused.
+func TestBolt_CheckSchema(t *testing.T) {
+	requirePackage(t, BoltImportPath)
+	mustRunWith(t, &Generator{Bolt: true}, `
+type event struct {
+	name raw.String
+}
+`, `
+	f, err := os.CreateTemp("", "bolt-")
+	if err != nil {
+		panic(err)
+	}
+	f.Close()
+	defer os.Remove(f.Name())
+
+	db, err := bolt.Open(f.Name(), 0600, nil)
+	if err != nil {
+		panic(err)
+	}
+	defer db.Close()
+
+	if err := CheckEventSchema(db); err != nil {
+		panic(err)
+	} else if err := CheckEventSchema(db); err != nil {
+		panic(err)
+	}
+	db.View(func(tx *bolt.Tx) error {
+		if v := tx.Bucket([]byte(raw.SchemaBucket)).Get([]byte(EventBucket)); string(v) != EventSchema {
+			panic(fmt.Sprintf("unexpected schema: %q", v))
+		}
+		return nil
+	})
+
+	db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket([]byte(raw.SchemaBucket)).Put([]byte(EventBucket), []byte("0000000000000000"))
+	})
+	want := "raw: incompatible schema: event bucket has layout 0000000000000000, not " + EventSchema
+	if err := CheckEventSchema(db); err == nil || err.Error() != want {
+		panic(fmt.Sprintf("unexpected error: %v", err))
+	}
+`)
+}
+
+// Ensure that JSON methods use raw field names, json tags, and RFC 3339 times.
+func TestJSON(t *testing.T) {
+	mustRunWith(t, &Generator{JSON: true}, `
+type point struct {
+	x int32
+	y int32
+}
+
+type event struct {
+	userId    int64 `+"`json:\"user_id\"`"+`
+	name      raw.String
+	secret    raw.String `+"`json:\"-\"`"+`
+	createdAt raw.Time
+	at        point
+}
+`, `
+	e := Event{UserId: 1, Name: "foo", Secret: "bar", CreatedAt: time.Date(2000, 1, 2, 3, 4, 5, 0, time.UTC), At: Point{X: 2}}
+	b, err := json.Marshal(e)
+	if err != nil {
+		panic(err)
+	} else if s := string(b); s != `+"`"+`{"user_id":1,"name":"foo","createdAt":"2000-01-02T03:04:05Z","at":{"x":2,"y":0}}`+"`"+` {
+		panic("unexpected json: " + s)
+	}
+
+	other := Event{Secret: "baz"}
+	if err := json.Unmarshal(b, &other); err != nil {
+		panic(err)
+	} else if other.UserId != 1 || other.Name != "foo" || other.Secret != "baz" || !other.CreatedAt.Equal(e.CreatedAt) || other.At.X != 2 {
+		panic(fmt.Sprintf("unexpected event: %+v", other))
+	}
+`)
+}
+
+// Ensure that exported types implement the encoding binary interfaces.
+func TestBinaryMarshaler(t *testing.T) {
+	mustRun(t, `
+type event struct {
+	id   int64
+	name raw.String
+}
+
+//raw:ctype
+type packet struct {
+	port uint16
+}
+`, `
+	b, err := (&Event{Id: 1, Name: "foo"}).MarshalBinary()
+	if err != nil {
+		panic(err)
+	}
+	var e Event
+	if err := e.UnmarshalBinary(b); err != nil {
+		panic(err)
+	} else if e.Id != 1 || e.Name != "foo" {
+		panic(fmt.Sprintf("unexpected event: %+v", e))
+	}
+
+	var p Packet
+	if err := p.UnmarshalBinary([]byte{0x1F, 0x90}); err != nil || p.Port != 8080 {
+		panic(fmt.Sprintf("unexpected packet: %+v, %v", p, err))
+	}
+`)
+}
+
+// Ensure that exported and raw types print the name and value of each field.
+func TestString(t *testing.T) {
+	mustRun(t, `
+type event struct {
+	id   int64
+	name raw.String
+	hash [2]byte
+	tags raw.StringList
+}
+`, `
+	e := Event{Id: 1, Name: "foo", Hash: [2]byte{0xAB, 0xCD}, Tags: []string{"a"}}
+	if s := fmt.Sprint(e); s != `+"`"+`Event{Id: 1, Name: "foo", Hash: abcd, Tags: ["a"]}`+"`"+` {
+		panic("unexpected string: " + s)
+	}
+	b := e.Encode()
+	if s := (*event)(unsafe.Pointer(&b[0])).String(); s != `+"`"+`event{Id: 1, Name: "foo", Hash: abcd, Tags: ["a"]}`+"`"+` {
+		panic("unexpected raw string: " + s)
+	}
+`)
+
+	// Fields named String conflict with the generated method.
+	_, err := GenerateFile([]byte("package foo\n\nimport \"github.com/boltdb/raw\"\n\ntype event struct {\n\tstring raw.String\n}\n"))
+	if err == nil || !strings.Contains(err.Error(), "exported name String conflicts with generated String method") {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+// Ensure that Equal compares each field and Hash is stable for equal records.
+func TestEqual(t *testing.T) {
+	mustRunWith(t, &Generator{Equal: true}, `
+type point struct {
+	x int32
+}
+
+type event struct {
+	id        int64
+	name      raw.String
+	data      raw.Bytes
+	tags      raw.StringList
+	createdAt raw.Time
+	at        point
+}
+`, `
+	a := &Event{Id: 1, Name: "foo", Data: []byte{1}, Tags: []string{"a"}, CreatedAt: time.Unix(1, 0), At: Point{X: 2}}
+	var b Event
+	b.Decode(a.Encode())
+	if !a.Equal(&b) || !b.Equal(a) {
+		panic(fmt.Sprintf("expected equal: %+v %+v", a, b))
+	} else if a.Hash() != b.Hash() {
+		panic("expected equal hashes")
+	}
+
+	b.At.X = 3
+	if a.Equal(&b) || a.Hash() == b.Hash() {
+		panic("expected different records")
+	}
+	b.At.X, b.Tags = 2, nil
+	if a.Equal(&b) {
+		panic("expected different tags")
+	}
+`)
+}
+
+// Ensure that a clone shares no memory with the original.
+func TestClone(t *testing.T) {
+	mustRun(t, `
+type point struct {
+	xs raw.Slice[int32]
+}
+
+type shape struct {
+	at point
+}
+
+//raw:retain
+type event struct {
+	name raw.String
+	data raw.Bytes
+	tags raw.StringList
+}
+`, `
+	b := (&Event{Name: "foo", Data: []byte{1}, Tags: []string{"a"}}).Encode()
+	var e Event
+	if err := e.Decode(b); err != nil {
+		panic(err)
+	}
+	c := e.Clone()
+	e.Data[0], e.Tags[0] = 9, "z"
+	for i := range b {
+		b[i] = 0
+	}
+	if c.Name != "foo" || c.Data[0] != 1 || c.Tags[0] != "a" {
+		panic(fmt.Sprintf("unexpected clone: %+v", c))
+	} else if len(c.Raw()) == 0 || c.Raw()[0] == 0 {
+		panic("retained bytes not cloned")
+	}
+
+	s := &Shape{At: Point{Xs: []int32{2}}}
+	other := s.Clone()
+	s.At.Xs[0] = 9
+	if other.At.Xs[0] != 2 {
+		panic(fmt.Sprintf("unexpected clone: %+v", other))
+	}
+`)
+}
+
+// Ensure that keys sort in the same order as the values of the key field.
+func TestKey(t *testing.T) {
+	mustRun(t, `
+type event struct {
+	id   int64 `+"`raw:\"key\"`"+`
+	name raw.String
+}
+
+type reading struct {
+	value float64 `+"`raw:\"key\"`"+`
+}
+
+type log struct {
+	at raw.Time `+"`raw:\"key\"`"+`
+}
+`, `
+	var prev []byte
+	for i, id := range []int{-1 << 40, -2, -1, 0, 1, 1 << 40} {
+		k := (&Event{Id: id, Name: "foo"}).Key()
+		if string(k) != string(EventKeyFrom(id)) {
+			panic("key differs from key func")
+		} else if i > 0 && string(prev) >= string(k) {
+			panic(fmt.Sprintf("key out of order: %d", id))
+		}
+		prev = k
+	}
+	for i, v := range []float64{-100.5, -1, 0, 0.25, 100} {
+		k := ReadingKeyFrom(v)
+		if i > 0 && string(prev) >= string(k) {
+			panic(fmt.Sprintf("key out of order: %v", v))
+		}
+		prev = k
+	}
+	if a, b := LogKeyFrom(time.Unix(-1, 0)), LogKeyFrom(time.Unix(1, 0)); string(a) >= string(b) {
+		panic("time keys out of order")
+	}
+`)
+
+	// Only one field can be the key.
+	_, err := GenerateFile([]byte("package foo\n\nimport \"github.com/boltdb/raw\"\n\ntype event struct {\n\ta, b int64 `raw:\"key\"`\n}\n"))
+	if err == nil || !strings.Contains(err.Error(), "b: only one field can be tagged as the key") {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+// Ensure that composite keys sort by each field in order and parse back.
+func TestKey_Composite(t *testing.T) {
+	mustRun(t, `
+type event struct {
+	at     raw.Time   `+"`raw:\"key=2\"`"+`
+	tenant raw.String `+"`raw:\"key=1\"`"+`
+	seq    int32      `+"`raw:\"key=3\"`"+`
+}
+`, `
+	var prev []byte
+	for i, e := range []Event{
+		{Tenant: "", At: time.Unix(5, 0).UTC(), Seq: 1},
+		{Tenant: "a", At: time.Unix(-1, 0).UTC(), Seq: 1},
+		{Tenant: "a", At: time.Unix(1, 0).UTC(), Seq: -1},
+		{Tenant: "a", At: time.Unix(1, 0).UTC(), Seq: 2},
+		{Tenant: "a\x00", At: time.Unix(0, 0).UTC(), Seq: 0},
+		{Tenant: "ab", At: time.Unix(0, 0).UTC(), Seq: 0},
+	} {
+		k := e.Key()
+		if i > 0 && string(prev) >= string(k) {
+			panic(fmt.Sprintf("key out of order: %v", e))
+		} else if tenant, at, seq, err := ParseEventKey(k); err != nil || tenant != e.Tenant || at != e.At || seq != e.Seq {
+			panic(fmt.Sprintf("unexpected parse: %q, %v, %d, %v", tenant, at, seq, err))
+		}
+		prev = k
+	}
+
+	k := EventKeyFrom("a", time.Unix(1, 0), 2)
+	if p := EventTenantKeyPrefix("a"); string(k[:len(p)]) != string(p) {
+		panic("key doesn't start with tenant prefix")
+	} else if p := EventAtKeyPrefix("a", time.Unix(1, 0)); string(k[:len(p)]) != string(p) {
+		panic("key doesn't start with tenant and time prefix")
+	} else if p := EventTenantKeyPrefix("ab"); string(k[:len(p)]) == string(p) {
+		panic("key starts with longer tenant prefix")
+	} else if _, _, _, err := ParseEventKey(k[:len(k)-1]); err != io.ErrUnexpectedEOF {
+		panic(fmt.Sprintf("unexpected error: %v", err))
+	} else if _, _, _, err := ParseEventKey(append(k, 0)); err == nil {
+		panic("expected trailing bytes error")
+	}
+
+	// The terminator after a string must be 0x00 0x01.
+	k[2] = 2
+	if _, _, _, err := ParseEventKey(k); err == nil || err.Error() != "invalid terminator after tenant in key: 0x2" {
+		panic(fmt.Sprintf("unexpected error: %v", err))
+	}
+`)
+
+	// Fields named after packages used by key functions are renamed.
+	mustRun(t, `
+type tag struct {
+	fmt raw.String `+"`raw:\"key=1\"`"+`
+	n   int32      `+"`raw:\"key=2\"`"+`
+}
+`, `
+	if f, n, err := ParseTagKey(TagKeyFrom("%d", 2)); err != nil || f != "%d" || n != 2 {
+		panic(fmt.Sprintf("unexpected parse: %q, %d, %v", f, n, err))
+	}
+`)
+
+	for _, tt := range []struct{ fields, err string }{
+		{"a int64 `raw:\"key=1\"`\n\tb int64 `raw:\"key=1\"`", "b: duplicate key position: 1"},
+		{"a int64 `raw:\"key=x\"`", "a: invalid key position: x"},
+		{"a int64 `raw:\"key=1\"`\n\tb int64 `raw:\"key\"`", "b: only one field can be tagged as the key"},
+	} {
+		_, err := GenerateFile([]byte("package foo\n\nimport \"github.com/boltdb/raw\"\n\ntype event struct {\n\t" + tt.fields + "\n}\n"))
+		if err == nil || !strings.Contains(err.Error(), tt.err) {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+}
+
+// Ensure that SQL methods round-trip a record through its raw encoding.
+func TestSQL(t *testing.T) {
+	mustRunWith(t, &Generator{SQL: true}, `
+type event struct {
+	id   int64
+	name raw.String
+}
+`, `
+	var _ interface{ Scan(interface{}) error } = (*Event)(nil)
+	v, err := driver.Valuer(Event{Id: 1, Name: "foo"}).Value()
+	if err != nil {
+		panic(err)
+	}
+
+	var e Event
+	if err := e.Scan(v); err != nil {
+		panic(err)
+	} else if e.Id != 1 || e.Name != "foo" {
+		panic(fmt.Sprintf("unexpected event: %+v", e))
+	} else if err := e.Scan(nil); err != nil || e != (Event{}) {
+		panic(fmt.Sprintf("unexpected null scan: %+v, %v", e, err))
+	} else if err := e.Scan(1); err == nil || err.Error() != "cannot scan int into Event" {
+		panic(fmt.Sprintf("unexpected error: %v", err))
+	}
+`)
+}
+
+// Ensure that records can be stored, read, and deleted by key.
+func TestBolt_PutGetDelete(t *testing.T) {
+	requirePackage(t, BoltImportPath)
+	mustRunWith(t, &Generator{Bolt: true}, `
+//raw:bucket=events
+type event struct {
+	name raw.String
+}
+`, `
+	f, err := os.CreateTemp("", "bolt-")
+	if err != nil {
+		panic(err)
+	}
+	f.Close()
+	defer os.Remove(f.Name())
+
+	db, err := bolt.Open(f.Name(), 0600, nil)
+	if err != nil {
+		panic(err)
+	}
+	defer db.Close()
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		if e, err := GetEvent(tx, []byte("a")); err != nil || e != nil {
+			return fmt.Errorf("unexpected event before put: %v, %v", e, err)
+		} else if err := PutEvent(tx, []byte("a"), &Event{Name: "foo"}); err != nil {
+			return err
+		} else if tx.Bucket([]byte("events")) == nil {
+			return fmt.Errorf("bucket not created")
+		}
+
+		if e, err := GetEvent(tx, []byte("a")); err != nil || e == nil || e.Name != "foo" {
+			return fmt.Errorf("unexpected event: %v, %v", e, err)
+		} else if err := DeleteEvent(tx, []byte("a")); err != nil {
+			return err
+		} else if e, err := GetEvent(tx, []byte("a")); err != nil || e != nil {
+			return fmt.Errorf("unexpected event after delete: %v, %v", e, err)
+		}
+		return nil
+	})
+	if err != nil {
+		panic(err)
+	}
+`)
+}
+
+// Ensure that fields can't have the names of the generated bolt helpers.
+func TestBolt_NameConflicts(t *testing.T) {
+	for _, tt := range []struct {
+		src string
+		err string
+	}{
+		{"type event struct {\n\tbucket raw.String\n}", "bucket: exported name Bucket conflicts with generated Bucket constant"},
+		{"type event struct {\n\tappend raw.String\n}", "append: exported name Append conflicts with generated Append method"},
+		{"type event struct {\n\tid int64\n}\n\ntype put struct {\n\tevent raw.String\n}", "event: field function PutEvent conflicts with generated bolt helper of event"},
+		{"type event struct {\n\tid int64\n}\n\ntype delete struct {\n\tevent raw.String\n}", "event: field function DeleteEvent conflicts with generated bolt helper of event"},
+		{"type event struct {\n\tcursor raw.String\n}", "cursor: exported name Cursor conflicts with generated Cursor type"},
+		{"type event struct {\n\tid int64\n}\n\ntype new struct {\n\teventCursor raw.String\n}", "eventCursor: field function NewEventCursor conflicts with generated bolt helper of event"},
+		{"type event struct {\n\tschema raw.String\n}", "schema: exported name Schema conflicts with generated Schema constant"},
+		{"type event struct {\n\tid int64\n}\n\ntype check struct {\n\teventSchema raw.String\n}", "eventSchema: field function CheckEventSchema conflicts with generated bolt helper of event"},
+	} {
+		_, err := (&Generator{Bolt: true}).GenerateFile([]byte("package foo\n\nimport \"github.com/boltdb/raw\"\n\n" + tt.src + "\n"))
+		if err == nil || !strings.HasSuffix(err.Error(), tt.err) {
+			t.Errorf("%s: unexpected error: %v", tt.src, err)
+		}
+	}
+
+	// The names are only generated with bolt helpers.
+	if _, err := GenerateFile([]byte("package foo\n\nimport \"github.com/boltdb/raw\"\n\ntype event struct {\n\tbucket raw.String\n}\n")); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// Ensure that Put and Delete maintain the indexes of fields tagged as indexed.
+func TestBolt_Index(t *testing.T) {
+	requirePackage(t, BoltImportPath)
+	mustRunWith(t, &Generator{Bolt: true}, `
+type user struct {
+	email raw.String `+"`raw:\"index\"`"+`
+	age   int32      `+"`raw:\"index\"`"+`
+}
+`, `
+	f, err := os.CreateTemp("", "bolt-")
+	if err != nil {
+		panic(err)
+	}
+	f.Close()
+	defer os.Remove(f.Name())
+
+	db, err := bolt.Open(f.Name(), 0600, nil)
+	if err != nil {
+		panic(err)
+	}
+	defer db.Close()
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		if u, err := FindUserByEmail(tx, "a@example.com"); err != nil || u != nil {
+			return fmt.Errorf("unexpected user before put: %v, %v", u, err)
+		} else if err := PutUser(tx, []byte("1"), &User{Email: "a@example.com", Age: 30}); err != nil {
+			return err
+		} else if u, err := FindUserByEmail(tx, "a@example.com"); err != nil || u == nil || u.Age != 30 {
+			return fmt.Errorf("unexpected user by email: %v, %v", u, err)
+		} else if u, err := FindUserByAge(tx, 30); err != nil || u == nil || u.Email != "a@example.com" {
+			return fmt.Errorf("unexpected user by age: %v, %v", u, err)
+		}
+
+		// Changing a value replaces its index entry.
+		if err := PutUser(tx, []byte("1"), &User{Email: "b@example.com", Age: 30}); err != nil {
+			return err
+		} else if u, err := FindUserByEmail(tx, "a@example.com"); err != nil || u != nil {
+			return fmt.Errorf("unexpected stale user: %v, %v", u, err)
+		} else if u, err := FindUserByEmail(tx, "b@example.com"); err != nil || u == nil {
+			return fmt.Errorf("unexpected user by new email: %v, %v", u, err)
+		}
+
+		// Another record can't have the same indexed value.
+		if err := PutUser(tx, []byte("2"), &User{Email: "b@example.com", Age: 40}); err == nil || err.Error() != raw.ErrDuplicateIndex.Error()+": user.email" {
+			return fmt.Errorf("unexpected duplicate put error: %v", err)
+		} else if u, err := FindUserByEmail(tx, "b@example.com"); err != nil || u == nil || u.Age != 30 {
+			return fmt.Errorf("unexpected user after duplicate put: %v, %v", u, err)
+		}
+
+		if err := DeleteUser(tx, []byte("1")); err != nil {
+			return err
+		} else if u, err := FindUserByAge(tx, 30); err != nil || u != nil {
+			return fmt.Errorf("unexpected user after delete: %v, %v", u, err)
+		}
+		return nil
+	})
+	if err != nil {
+		panic(err)
+	}
+`)
+}
+
+// Ensure that a put rejected for a duplicate indexed value changes no index,
+// so the transaction can still be committed and the values reused.
+func TestBolt_IndexDuplicate(t *testing.T) {
+	requirePackage(t, BoltImportPath)
+	mustRunWith(t, &Generator{Bolt: true}, `
+type user struct {
+	age   int32      `+"`raw:\"index\"`"+`
+	email raw.String `+"`raw:\"index\"`"+`
+}
+`, `
+	f, err := os.CreateTemp("", "bolt-")
+	if err != nil {
+		panic(err)
+	}
+	f.Close()
+	defer os.Remove(f.Name())
+
+	db, err := bolt.Open(f.Name(), 0600, nil)
+	if err != nil {
+		panic(err)
+	}
+	defer db.Close()
+
+	if err := db.Update(func(tx *bolt.Tx) error {
+		return PutUser(tx, []byte("1"), &User{Age: 30, Email: "a@x"})
+	}); err != nil {
+		panic(err)
+	}
+
+	// The age of a rejected record isn't indexed before its email conflicts,
+	// and an existing record keeps its entries when its update is rejected.
+	if err := db.Update(func(tx *bolt.Tx) error {
+		if err := PutUser(tx, []byte("2"), &User{Age: 40, Email: "a@x"}); err == nil || err.Error() != raw.ErrDuplicateIndex.Error()+": user.email" {
+			return fmt.Errorf("unexpected duplicate put error: %v", err)
+		} else if err := PutUser(tx, []byte("3"), &User{Age: 40, Email: "c@x"}); err != nil {
+			return err
+		} else if err := PutUser(tx, []byte("1"), &User{Age: 50, Email: "c@x"}); err == nil {
+			return fmt.Errorf("expected duplicate update error")
+		}
+		return nil
+	}); err != nil {
+		panic(err)
+	}
+
+	if err := db.Update(func(tx *bolt.Tx) error {
+		if u, err := FindUserByAge(tx, 30); err != nil || u == nil || u.Email != "a@x" {
+			return fmt.Errorf("unexpected user by age: %v, %v", u, err)
+		} else if u, err := FindUserByAge(tx, 50); err != nil || u != nil {
+			return fmt.Errorf("unexpected user by rejected age: %v, %v", u, err)
+		} else if u, err := FindUserByEmail(tx, "c@x"); err != nil || u == nil || u.Age != 40 {
+			return fmt.Errorf("unexpected user by email: %v, %v", u, err)
+		}
+
+		// The rejected values can be put once they're free.
+		if err := DeleteUser(tx, []byte("3")); err != nil {
+			return err
+		} else if err := PutUser(tx, []byte("2"), &User{Age: 40, Email: "c@x"}); err != nil {
+			return err
+		} else if u, err := FindUserByAge(tx, 40); err != nil || u == nil || u.Email != "c@x" {
+			return fmt.Errorf("unexpected user by reused age: %v, %v", u, err)
+		}
+		return nil
+	}); err != nil {
+		panic(err)
+	}
+`)
+}
+
+// Ensure that records can be iterated over in key order.
+func TestBolt_Cursor(t *testing.T) {
+	requirePackage(t, BoltImportPath)
+	mustRunWith(t, &Generator{Bolt: true}, `
+type event struct {
+	id int64 `+"`raw:\"key\"`"+`
+}
+
+var _ raw.String
+`, `
+	f, err := os.CreateTemp("", "bolt-")
+	if err != nil {
+		panic(err)
+	}
+	f.Close()
+	defer os.Remove(f.Name())
+
+	db, err := bolt.Open(f.Name(), 0600, nil)
+	if err != nil {
+		panic(err)
+	}
+	defer db.Close()
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		if k, e := NewEventCursor(tx).First(); k != nil || e != nil {
+			return fmt.Errorf("unexpected event in missing bucket: %v", e)
+		}
+		for _, id := range []int{3, -1, 2, 1} {
+			e := &Event{Id: id}
+			if err := PutEvent(tx, e.Key(), e); err != nil {
+				return err
+			}
+		}
+
+		var ids []int
+		c := NewEventCursor(tx)
+		for k, e := c.First(); k != nil; k, e = c.Next() {
+			ids = append(ids, e.Id)
+		}
+		if fmt.Sprint(ids) != "[-1 1 2 3]" || c.Err() != nil {
+			return fmt.Errorf("unexpected ids: %v, %v", ids, c.Err())
+		} else if _, e := c.Seek(EventKeyFrom(2)); e == nil || e.Id != 2 {
+			return fmt.Errorf("unexpected seek: %v", e)
+		} else if _, e := c.Prev(); e == nil || e.Id != 1 {
+			return fmt.Errorf("unexpected prev: %v", e)
+		}
+
+		ids = nil
+		if err := RangeEvent(tx, EventKeyFrom(1), EventKeyFrom(2), func(k []byte, e *Event) error {
+			ids = append(ids, e.Id)
+			return nil
+		}); err != nil {
+			return err
+		} else if fmt.Sprint(ids) != "[1 2]" {
+			return fmt.Errorf("unexpected range: %v", ids)
+		}
+
+		// Keys of positive ids share their first seven bytes.
+		ids = nil
+		if err := RangeEventPrefix(tx, EventKeyFrom(1)[:7], func(k []byte, e *Event) error {
+			ids = append(ids, e.Id)
+			return nil
+		}); err != nil {
+			return err
+		} else if fmt.Sprint(ids) != "[1 2 3]" {
+			return fmt.Errorf("unexpected prefix range: %v", ids)
+		}
+		return nil
+	})
+	if err != nil {
+		panic(err)
+	}
+`)
+}
+
+// Ensure that batch puts store records under their key or next sequence.
+func TestBolt_Batch(t *testing.T) {
+	requirePackage(t, BoltImportPath)
+	mustRunWith(t, &Generator{Bolt: true}, `
+type user struct {
+	id    int64 `+"`raw:\"key\"`"+`
+	email raw.String `+"`raw:\"index\"`"+`
+}
+
+type event struct {
+	name raw.String
+}
+`, `
+	f, err := os.CreateTemp("", "bolt-")
+	if err != nil {
+		panic(err)
+	}
+	f.Close()
+	defer os.Remove(f.Name())
+
+	db, err := bolt.Open(f.Name(), 0600, nil)
+	if err != nil {
+		panic(err)
+	}
+	defer db.Close()
+
+	if err := PutUserBatch(db, []*User{{Id: 2, Email: "b@x"}, {Id: 1, Email: "a@x"}}); err != nil {
+		panic(err)
+	} else if err := PutEventBatch(db, []*Event{{Name: "x"}, {Name: "y"}}); err != nil {
+		panic(err)
+	}
+
+	err = db.View(func(tx *bolt.Tx) error {
+		if u, err := FindUserByEmail(tx, "a@x"); err != nil || u == nil || u.Id != 1 {
+			return fmt.Errorf("unexpected user: %v, %v", u, err)
+		} else if e, err := GetEvent(tx, []byte{0, 0, 0, 0, 0, 0, 0, 2}); err != nil || e == nil || e.Name != "y" {
+			return fmt.Errorf("unexpected event: %v, %v", e, err)
+		}
+		return nil
+	})
+	if err != nil {
+		panic(err)
+	}
+`)
+}
+
+// Ensure that a custom template replaces the built-in code.
+func TestGenerateFile_Template(t *testing.T) {
+	tmpl := template.Must(template.New("").Parse(
+		`{{range .Fields}}// {{$.Exported}}.{{.Exported}} {{.GoType}} @{{.Offset}}+{{.Size}} {{index .Tag "utf8"}}
+{{end}}const {{.Name}}Size = {{.Size}}`))
+	src := []byte("package foo\n\nimport \"github.com/boltdb/raw\"\n\ntype event struct {\n\tok bool\n\tname raw.String `raw:\"utf8=error\"`\n}\n")
+	b, err := (&Generator{Template: tmpl, AllowPadding: true}).GenerateFile(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		"// Event.Ok bool @0+1\n",
+		"// Event.Name string @2+4 error\n",
+		"const eventSize = 6\n\n//raw:codegen:end\n",
+	} {
+		if !strings.Contains(string(b), want) {
+			t.Fatalf("expected %q in generated code:\n%s", want, b)
+		}
+	}
+	if strings.Contains(string(b), "func (o *Event) Encode()") {
+		t.Fatalf("unexpected built-in code:\n%s", b)
+	}
+}
+
+// Ensure that fields rendered by a template have the offsets of the full
+// struct, including the skipped and presence fields left out of the data.
+func TestGenerateFile_TemplateSkipped(t *testing.T) {
+	tmpl := template.Must(template.New("").Parse(
+		`{{range .Fields}}// {{.Name}} @{{.Offset}}+{{.Size}}
+{{end}}const {{.Name}}Size = {{.Size}}`))
+	src := []byte("package foo\n\nimport \"github.com/boltdb/raw\"\n\ntype event struct {\n\tpad int32 `raw:\"-\"`\n\tx int32\n\tpresence raw.Presence\n\tat raw.Time\n\tn int32 `raw:\"optional\"`\n}\n")
+	b, err := (&Generator{Template: tmpl, AllowPadding: true}).GenerateFile(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"// x @4+4\n", "// at @16+8\n", "// n @24+4\n", "const eventSize = 32\n"} {
+		if !strings.Contains(string(b), want) {
+			t.Fatalf("expected %q in generated code:\n%s", want, b)
+		}
+	}
+	if strings.Contains(string(b), "// pad ") || strings.Contains(string(b), "// presence ") {
+		t.Fatalf("unexpected field in generated code:\n%s", b)
+	}
+}
+
+// Ensure that a schema describes the layout of every field.
+func TestSchema(t *testing.T) {
+	src := []byte("package foo\n\nimport \"github.com/boltdb/raw\"\n\ntype event struct {\n\tok bool\n\tname raw.String\n\tpad int32 `raw:\"-\"`\n\tat raw.Time\n}\n\n//raw:ctype\ntype header struct {\n\tok bool\n\tid int64\n}\n\n//raw:skip\ntype other struct {\n\tid int64\n}\n")
+	s, err := (&Generator{Endian: "little"}).Schema(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Package != "foo" || s.Endian != "little" || len(s.Structs) != 2 {
+		t.Fatalf("unexpected schema: %+v", s)
+	}
+
+	type field struct {
+		name, typ    string
+		offset, size int
+	}
+	for i, want := range []struct {
+		name   string
+		size   int
+		fields []field
+	}{
+		{"event", 24, []field{{"ok", "bool", 0, 1}, {"name", "raw.String", 2, 4}, {"pad", "int32", 8, 4}, {"at", "raw.Time", 16, 8}}},
+		{"header", 9, []field{{"ok", "bool", 0, 1}, {"id", "int64", 1, 8}}},
+	} {
+		st := s.Structs[i]
+		if st.Name != want.name || st.Size != want.size || len(st.Fields) != len(want.fields) {
+			t.Fatalf("unexpected struct: %+v", st)
+		}
+		for j, f := range want.fields {
+			if got := st.Fields[j]; got.Name != f.name || got.RawType != f.typ || got.Offset != f.offset || got.Size != f.size {
+				t.Fatalf("%s: unexpected field: %+v", want.name, got)
+			}
+		}
+	}
+
+	// Nested raw structs have no fixed layout.
+	if _, err := (&Generator{}).Schema([]byte("package foo\n\nimport \"github.com/boltdb/raw\"\n\ntype point struct {\n\tx, y int32\n}\n\ntype event struct {\n\tname raw.String\n\tp point\n}\n")); err == nil || !strings.Contains(err.Error(), "layout of user-defined field types is unknown") {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+// Ensure that raw structs can be generated from a schema.
+func TestGenerateFromSchema(t *testing.T) {
+	src := []byte("package foo\n\nimport \"github.com/boltdb/raw\"\n\n//raw:retain\ntype event struct {\n\tok bool\n\tname raw.String `raw:\"utf8=error\"`\n\tpad int32 `raw:\"-\"`\n}\n")
+	s, err := (&Generator{}).Schema(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := (&Generator{AllowPadding: true}).GenerateFromSchema(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !IsGeneratedFile(b) {
+		t.Fatalf("expected generated file header:\n%s", b)
+	}
+	for _, want := range []string{
+		"package foo\n",
+		"\"github.com/boltdb/raw\"\n",
+		"//raw:retain\ntype event struct {\n\tok   bool\n\tname raw.String `raw:\"utf8=error\"`\n\tpad  int32      `raw:\"-\"`\n}\n",
+		"\t\"unsafe\"\n",
+		"func (o *Event) Encode() []byte {",
+		"func (r *event) NameUTF8() (string, error) {",
+	} {
+		if !strings.Contains(string(b), want) {
+			t.Fatalf("expected %q in generated code:\n%s", want, b)
+		}
+	}
+
+	// Layouts must match the schema when sizes are set.
+	s.Structs[0].Fields[2].Offset = 6
+	if _, err := (&Generator{AllowPadding: true}).GenerateFromSchema(s); err == nil || err.Error() != "event.pad: layout is 8+4, schema has 6+4" {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	s.Structs[0].Size = 0
+	if _, err := (&Generator{AllowPadding: true}).GenerateFromSchema(s); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// Ensure that a C header matches the layout of each raw struct.
+func TestGenerateCHeader(t *testing.T) {
+	src := []byte("package foo\n\nimport \"github.com/boltdb/raw\"\n\ntype event struct {\n\tok bool\n\tname raw.String\n\tid [3]byte\n\tat raw.Time\n\tvals raw.Slice[float64]\n}\n\n//raw:ctype\ntype packet struct {\n\tport uint16\n\tseq int32\n}\n")
+	h, err := (&Generator{}).GenerateCHeader(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		"struct event {\n\tbool ok;\n\tuint8_t _pad0[1];\n\traw_string name;\n\tuint8_t id[3];\n\tuint8_t _pad1[7];\n\tint64_t at;\n\traw_slice vals; // double elements\n\tuint8_t _pad2[4];\n};\n",
+		"RAW_STATIC_ASSERT(sizeof(struct event) == 32, \"size of event\");\n",
+		"RAW_STATIC_ASSERT(offsetof(struct event, at) == 16, \"offset of event.at\");\n",
+		"// Encoded in big-endian byte order.\n#pragma pack(push, 1)\nstruct packet {\n\tuint16_t port;\n\tint32_t seq;\n};\n",
+	} {
+		if !strings.Contains(string(h), want) {
+			t.Fatalf("expected %q in header:\n%s", want, h)
+		}
+	}
+
+	// Check the assertions with a C and C++ compiler, if available.
+	dir := mustTempDir(t)
+	defer os.RemoveAll(dir)
+	if err := ioutil.WriteFile(filepath.Join(dir, "foo.h"), h, 0600); err != nil {
+		t.Fatal(err)
+	} else if err := ioutil.WriteFile(filepath.Join(dir, "foo.c"), []byte("#include \"foo.h\"\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	for _, args := range [][]string{{"cc", "-std=c11", "-x", "c"}, {"c++", "-std=c++11", "-x", "c++"}} {
+		if _, err := exec.LookPath(args[0]); err != nil {
+			continue
+		}
+		cmd := exec.Command(args[0], append(args[1:], "-fsyntax-only", "-Wall", "-Werror", "foo.c")...)
+		cmd.Dir = dir
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("%s: %s\n%s\n\n%s", args[0], err, out, h)
+		}
+	}
+
+	// Field names must be valid in C.
+	if _, err := (&Generator{}).GenerateCHeader([]byte("package foo\n\nimport \"github.com/boltdb/raw\"\n\ntype event struct {\n\tlong int64\n\tname raw.String\n}\n")); err == nil || err.Error() != "event: field name is a C keyword: long" {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+// Ensure that Rust bindings match the layout of each raw struct.
+func TestGenerateRust(t *testing.T) {
+	src := []byte("package foo\n\nimport \"github.com/boltdb/raw\"\n\ntype event struct {\n\tok bool\n\tname raw.String\n\tdata raw.Bytes\n\tid [3]byte\n\tat raw.Time\n\tscore float64\n\ttags raw.StringList\n\tvals raw.Slice[int32]\n\tpad uint8 `raw:\"-\"`\n}\n\n//raw:ctype\ntype packet struct {\n\tport uint16\n\tseq int32\n}\n")
+	for _, g := range []*Generator{{}, {Endian: "big"}} {
+		b, err := g.GenerateRust(src)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, want := range []string{
+			"#[repr(C)]\n#[derive(Clone, Copy, Debug)]\n#[allow(dead_code, non_snake_case)]\npub struct Event {\n    pub ok: u8,\n    _pad0: [u8; 1],\n    pub name: RawString,\n",
+			"const _: () = assert!(std::mem::size_of::<Event>() == 48);\n",
+			"const _: () = assert!(std::mem::offset_of!(Event, at) == 16);\n",
+			"    pub fn name<'a>(&self, record: &'a [u8]) -> Option<&'a str> {\n",
+			"    pub fn tags<'a>(&self, record: &'a [u8]) -> Option<Vec<&'a str>> {\n",
+			"    pub fn vals(&self, record: &[u8]) -> Option<Vec<i32>> {\n",
+			"#[repr(C, packed)]\n#[derive(Clone, Copy, Debug)]\n#[allow(dead_code, non_snake_case)]\npub struct Packet {\n    pub port: u16,\n    pub seq: i32,\n}\n",
+			"        i32::from_be(self.seq)\n",
+		} {
+			if !strings.Contains(string(b), want) {
+				t.Fatalf("expected %q in Rust source:\n%s", want, b)
+			}
+		}
+		if strings.Contains(string(b), "pub fn pad(") {
+			t.Fatalf("unexpected accessor for skipped field:\n%s", b)
+		}
+
+		// Check the assertions with the Rust compiler, if available.
+		if _, err := exec.LookPath("rustc"); err != nil {
+			continue
+		}
+		dir := mustTempDir(t)
+		defer os.RemoveAll(dir)
+		if err := ioutil.WriteFile(filepath.Join(dir, "foo.rs"), b, 0600); err != nil {
+			t.Fatal(err)
+		}
+		cmd := exec.Command("rustc", "--edition", "2021", "--crate-type", "lib", "-D", "warnings", "--emit", "metadata", "foo.rs")
+		cmd.Dir = dir
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("rustc: %s\n%s\n\n%s", err, out, b)
+		}
+	}
+
+	// Field names must be valid in Rust.
+	if _, err := (&Generator{}).GenerateRust([]byte("package foo\n\nimport \"github.com/boltdb/raw\"\n\ntype event struct {\n\tmatch int64\n\tname raw.String\n}\n")); err == nil || err.Error() != "event: field name is a Rust keyword: match" {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+// Ensure that optional fields distinguish unset fields from zero values.
+func TestGenerateFile_Optional(t *testing.T) {
+	for _, g := range []*Generator{{Equal: true}, {Equal: true, Endian: "big"}} {
+		mustRunWith(t, g, `
+type event struct {
+	id      int64
+	present raw.Presence
+	count   int32       `+"`raw:\"optional\"`"+`
+	at      raw.Time    `+"`raw:\"optional\"`"+`
+	name    raw.String  `+"`raw:\"optional\"`"+`
+	tag     raw.String
+}
+`, `
+	count, name := 0, "foo"
+	o := Event{Id: 1, Count: &count, Name: &name, Tag: "x"}
+	var other Event
+	if err := other.Decode(o.Encode()); err != nil {
+		panic(err)
+	} else if other.Count == nil || *other.Count != 0 || other.At != nil || other.Name == nil || *other.Name != "foo" {
+		panic(fmt.Sprintf("unexpected decode: %s", other))
+	} else if !other.Equal(&o) || other.Equal(&Event{Id: 1, Name: &name, Tag: "x"}) {
+		panic("unexpected equality")
+	} else if s := other.String(); s != "Event{Id: 1, Count: 0, At: nil, Name: \"foo\", Tag: \"x\"}" {
+		panic(s)
+	}
+
+	c := other.Clone()
+	*c.Count = 2
+	if *other.Count != 0 {
+		panic("clone shares memory")
+	}
+`)
+	}
+}
+
+// Ensure that accessors report whether an optional field is set and that
+// patching a field sets it.
+func TestGenerateFile_OptionalAccessors(t *testing.T) {
+	mustRun(t, `
+type event struct {
+	present raw.Presence
+	count   int32 `+"`raw:\"optional\"`"+`
+	size    int32 `+"`raw:\"optional\"`"+`
+}
+`, `
+	b := (&Event{}).Encode()
+	r := (*event)(unsafe.Pointer(&b[0]))
+	if r.HasCount() || r.HasSize() {
+		panic("unexpected presence")
+	} else if err := PatchEventSize(b, 5); err != nil {
+		panic(err)
+	} else if r.HasCount() || !r.HasSize() || r.Size() != 5 {
+		panic(r.String())
+	} else if s := r.String(); s != "event{Count: nil, Size: 5}" {
+		panic(s)
+	}
+`)
+}
+
+// Ensure that invalid optional fields return an error.
+func TestGenerateFile_ErrOptional(t *testing.T) {
+	for _, tt := range []struct{ decl, err string }{
+		{"count int32 `raw:\"optional\"`", "event: optional fields require a raw.Presence field"},
+		{"p raw.Presence\n\tcount int32", "event: p: raw.Presence field requires an optional field"},
+		{"p, q raw.Presence\n\tcount int32 `raw:\"optional\"`", "event: q: only one raw.Presence field is allowed"},
+		{"p raw.Presence\n\tdata raw.Bytes `raw:\"optional\"`", "event: data: optional is not supported for raw.Bytes fields"},
+		{"p raw.Presence\n\tid int64 `raw:\"optional,key\"`", "event: id: key fields cannot be optional"},
+		{"p raw.Presence\n\tcount int32 `raw:\"optional\"`\n\thasCount bool", "event: accessor HasCount() of field count conflicts with field hasCount"},
+	} {
+		src := []byte("package foo\n\nimport \"github.com/boltdb/raw\"\n\ntype event struct {\n\t" + tt.decl + "\n}\n")
+		if _, err := GenerateFile(src); err == nil || err.Error() != tt.err {
+			t.Errorf("%s: unexpected error: %v", tt.decl, err)
+		}
+	}
+}
+
+// Ensure that round-trip tests cover unset and set optional fields.
+func TestGenerateRoundTripTests_Optional(t *testing.T) {
+	src := []byte("package foo\n\nimport (\n\t\"time\"\n\t\"unsafe\"\n\n\t\"github.com/boltdb/raw\"\n)\n\nvar _, _ = time.Now, unsafe.Sizeof(0)\n\n" +
+		"type event struct {\n\tp raw.Presence\n\tok bool `raw:\"optional\"`\n\tn int16 `raw:\"optional\"`\n\tat raw.Time `raw:\"optional\"`\n" +
+		"\tname raw.String `raw:\"optional\"`\n\tid [4]byte `raw:\"optional\"`\n}\n")
+	for _, g := range []*Generator{{AllowPadding: true}, {Safe: true}} {
+		b, err := g.GenerateFile(src)
+		if err != nil {
+			t.Fatal(err)
+		}
+		tests, err := g.GenerateRoundTripTests(b)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		dir := mustTempDir(t)
+		defer os.RemoveAll(dir)
+		if err := ioutil.WriteFile(filepath.Join(dir, "foo.go"), b, 0600); err != nil {
+			t.Fatal(err)
+		} else if err := ioutil.WriteFile(filepath.Join(dir, "foo_rawgen_test.go"), tests, 0600); err != nil {
+			t.Fatal(err)
+		}
+		cmd := exec.Command("go", "test", "-v")
+		cmd.Dir = dir
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("test: %s\n%s\n\n%s\n\n%s", err, out, b, tests)
+		} else if !strings.Contains(string(out), "--- PASS: TestEventRoundTrip/max_length_Name") {
+			t.Fatalf("expected max length case to pass:\n%s", out)
+		}
+	}
+}
+
+// Ensure that records can be converted to and from protobuf messages.
+func TestGenerateFile_Proto(t *testing.T) {
+	mustRun(t, `
+type eventProto struct {
+	Id     int64
+	UserId uint32
+	Name   string
+	Count  *int32
+	Tags   []string
+	Sum    []byte
+}
+
+//raw:proto=eventProto
+type event struct {
+	id      int64
+	userID  uint16     `+"`raw:\"proto=user_id\"`"+`
+	name    raw.String
+	present raw.Presence
+	count   int32      `+"`raw:\"optional\"`"+`
+	tags    raw.StringList
+	sum     [4]byte
+	secret  raw.String `+"`raw:\"proto=-\"`"+`
+}
+`, `
+	count := 0
+	o := Event{Id: 1, UserID: 2, Name: "foo", Count: &count, Tags: []string{"a", "b"}, Sum: [4]byte{1, 2}, Secret: "x"}
+	m := o.ToProto()
+	if m.Id != 1 || m.UserId != 2 || m.Name != "foo" || m.Count == nil || *m.Count != 0 || len(m.Tags) != 2 || len(m.Sum) != 4 {
+		panic(fmt.Sprintf("unexpected message: %+v", m))
+	}
+	m.Sum[0] = 100
+	if o.Sum[0] != 1 {
+		panic("message shares memory with array")
+	}
+
+	var other Event
+	other.FromProto(o.ToProto())
+	if other.Secret = "x"; other.String() != o.String() {
+		panic(other.String())
+	}
+	other.FromProto(&eventProto{})
+	if other.Count != nil {
+		panic("expected unset field")
+	}
+`)
+}
+
+// Ensure that times and durations are converted to well-known types.
+func TestGenerateFile_ProtoTime(t *testing.T) {
+	src := []byte("package foo\n\nimport \"github.com/boltdb/raw\"\n\n//raw:proto=pb.Event\ntype event struct {\n\tcreatedAt raw.Time `raw:\"proto=created_at\"`\n\ttimeout raw.Duration\n}\n")
+	b, err := GenerateFile(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range []string{
+		"m.CreatedAt = timestamppb.New(o.CreatedAt)",
+		"o.CreatedAt = m.CreatedAt.AsTime()",
+		"m.Timeout = durationpb.New(o.Timeout)",
+		"o.Timeout = m.Timeout.AsDuration()",
+		strconv.Quote(TimestampImportPath),
+		strconv.Quote(DurationImportPath),
+	} {
+		if !strings.Contains(string(b), s) {
+			t.Fatalf("expected %q in generated code:\n%s", s, b)
+		}
+	}
+}
+
+// Ensure that fields without a protobuf type return an error.
+func TestGenerateFile_ErrProto(t *testing.T) {
+	for _, tt := range []struct{ decl, err string }{
+		{"//raw:proto=pb.Event()\ntype event struct {\n\tid int64\n}", `event: generate proto funcs: invalid proto message type: "pb.Event()"`},
+		{"//raw:proto=pb.Event\ntype event struct {\n\tids raw.Slice[int8]\n}", "event: generate proto funcs: ids: no protobuf type for raw.Slice[int8]"},
+	} {
+		src := []byte("package foo\n\nimport \"github.com/boltdb/raw\"\n\n" + tt.decl + "\n")
+		if _, err := GenerateFile(src); err == nil || err.Error() != tt.err {
+			t.Errorf("unexpected error: %v", err)
+		}
+	}
+}
+
+// Ensure that a FlatBuffers schema declares every field with its raw layout.
+func TestGenerateFlatBuffers(t *testing.T) {
+	src := []byte("package foo\n\nimport \"github.com/boltdb/raw\"\n\ntype event struct {\n\tok bool\n\tname raw.String\n\tid [3]byte\n\tat raw.Time\n\tvals raw.Slice[float64]\n" +
+		"\tp raw.Presence\n\tcount int32 `raw:\"optional\"`\n\ttags raw.StringList\n}\n\n//raw:ctype\ntype packet struct {\n\tport uint16\n}\n")
+	b, err := (&Generator{}).GenerateFlatBuffers(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		"namespace foo;\n\nattribute \"raw_size\";\nattribute \"raw_offset\";\n",
+		"table Event (raw_size: 56) {\n  ok: bool (raw_offset: 0, raw_size: 1);\n  name: string (raw_offset: 2, raw_size: 4);\n",
+		"  /// Exactly 3 bytes.\n  id: [ubyte] (raw_offset: 6, raw_size: 3);\n",
+		"  /// Nanoseconds since the Unix epoch.\n  at: long (raw_offset: 16, raw_size: 8);\n",
+		"  vals: [double] (raw_offset: 24, raw_size: 4);\n",
+		"  /// Bits set for each optional field with a value.\n  p: ulong (raw_offset: 32, raw_size: 8);\n",
+		"  count: int = null (raw_offset: 40, raw_size: 4);\n  tags: [string] (raw_offset: 44, raw_size: 6);\n}\n",
+		"/// Layout of the raw struct packet, encoded in big-endian byte order.\ntable Packet (raw_size: 2) {\n",
+	} {
+		if !strings.Contains(string(b), want) {
+			t.Fatalf("expected %q in schema:\n%s", want, b)
+		}
+	}
+
+	// Files without raw structs have no schema.
+	if b, err := (&Generator{}).GenerateFlatBuffers([]byte("package foo\n")); err != nil || b != nil {
+		t.Fatalf("unexpected schema: %s, %v", b, err)
+	}
+}
+
+// Ensure that structs larger than 64KB of fixed fields can be encoded.
+func TestGenerateFile_Large(t *testing.T) {
+	var decl bytes.Buffer
+	decl.WriteString("type big struct {\n")
+	for i := 0; i < 8200; i++ {
+		fmt.Fprintf(&decl, "\tf%d int64\n", i)
+	}
+	decl.WriteString("}\n")
+
+	decl.WriteString("\nvar _ raw.String\n")
+
+	mustRun(t, decl.String(), `
+	if n := unsafe.Sizeof(big{}); n <= 0xFFFF {
+		panic(fmt.Sprintf("struct too small: %d", n))
+	}
+	var o Big
+	o.F0, o.F8199 = 1, 2
+	var other Big
+	other.Decode(o.Encode())
+	if other.F0 != 1 || other.F8199 != 2 {
+		panic(fmt.Sprintf("unexpected decode: %d %d", other.F0, other.F8199))
+	}
+`)
+}
+
+// requirePackage skips a test if a package is not available to the go tool.
+func requirePackage(t *testing.T, path string) {
+	if err := exec.Command("go", "list", path).Run(); err != nil {
+		t.Skipf("package not available: %s", path)
+	}
+}
+
+// mustRun generates code for a set of raw struct declarations and then
+// compiles and runs it with main as the body of the main function.
+func mustRun(t *testing.T, decls, main string) {
+	mustRunWith(t, &Generator{}, decls, main)
+}
+
+// mustRunWith generates code using g and then compiles and runs it. Most
+// declarations leave padding implicit so it's allowed.
+func mustRunWith(t *testing.T, g *Generator, decls, main string) {
+	dir, err := ioutil.TempDir("", "bolt-rawgen-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	src := "package main\n\n" +
+		"import (\n\t\"fmt\"\n\t\"os\"\n\t\"time\"\n\t\"unsafe\"\n\n\t\"github.com/boltdb/raw\"\n)\n\n" +
+		"var _, _, _, _ = fmt.Sprint, os.Exit, time.Now, unsafe.Sizeof(0)\n" +
+		decls + "\n" +
+		"func main() {" + main + "}\n"
+	gen := *g
+	gen.AllowPadding = true
+	b, err := gen.GenerateFile([]byte(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, "main.go")
+	if err := ioutil.WriteFile(path, b, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if out, err := exec.Command("go", "run", path).CombinedOutput(); err != nil {
+		b, _ := ioutil.ReadFile(path)
+		t.Fatalf("run: %s\n%s\n\n%s", err, out, b)
+	}
+}
+
+// mustParseStruct parses a single struct declaration.
+func mustParseStruct(t *testing.T, src string) *ast.StructType {
+	f, err := parser.ParseFile(token.NewFileSet(), "", "package x\n\n"+src, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return f.Decls[0].(*ast.GenDecl).Specs[0].(*ast.TypeSpec).Type.(*ast.StructType)
+}
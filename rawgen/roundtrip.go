@@ -0,0 +1,239 @@
+package rawgen
+
+import (
+	"fmt"
+	"go/ast"
+	"io"
+	"strings"
+)
+
+// GenerateRoundTripTests returns a Go test file for the package of the source
+// file, src, with a table-driven test for each raw struct that encodes and
+// decodes records and compares the result with the original. Records are
+// built with every field at its zero, minimum, and maximum value, with
+// representative values, and with each string as long as its offset allows.
+//
+// Code must have been generated for the file, with the same Generator, before
+// the tests can be compiled.
+func (g *Generator) GenerateRoundTripTests(src []byte) ([]byte, error) {
+	return g.generateTestFile(src, []string{"reflect", "testing"}, g.writeRoundTripTest)
+}
+
+// writeRoundTripTest writes the round-trip test for a single raw struct.
+func (g *Generator) writeRoundTripTest(unexp, exp string, node *ast.StructType, pragmas map[string]string, w io.Writer) error {
+	if err := g.writeBenchRecord("newRoundTrip"+exp, exp, node, w); err != nil {
+		return err
+	}
+
+	// Zero times can't be encoded as nanoseconds so records start at the
+	// Unix epoch instead. Optional times are left unset. Unset fields with a
+	// default are decoded as it so records start with it.
+	var base []string
+	for _, f := range node.Fields.List {
+		for _, n := range f.Names {
+			value, err := g.defaultValue(exp, f, n.Name)
+			if err != nil {
+				return err
+			} else if typ := tostr(f.Type); (isTime(typ) || typ == "raw.ZonedTime") && !isOptionalField(f) {
+				value = "time.Unix(0, 0).UTC()"
+			}
+			if value != "" {
+				base = append(base, g.exportedName(f, n.Name)+": "+value)
+			}
+		}
+	}
+
+	type testCase struct{ name, fields string }
+	cases := []testCase{{"zero", strings.Join(base, ", ")}}
+	for _, max := range []bool{false, true} {
+		fields, err := g.boundaryFields(exp, node, max)
+		if err != nil {
+			return err
+		}
+		name := "min"
+		if max {
+			name = "max"
+		}
+		cases = append(cases, testCase{name, strings.Join(fields, ", ")})
+	}
+
+	// Each string is made as long as its offset allows while the others are
+	// empty, less an allowance for the padding added before empty lists and
+	// slices.
+	l, _ := g.layout(node)
+	for _, f := range node.Fields.List {
+		typ := tostr(f.Type)
+		limit := 1<<16 - 1
+		switch typ {
+		case "raw.String8":
+			limit = 1<<8 - 1
+		case "raw.String", "raw.String32", "raw.Bytes", "raw.NullString":
+		default:
+			continue
+		}
+		n := limit - l.size - 16
+		if n <= 0 {
+			continue
+		}
+		for _, ident := range f.Names {
+			name := g.exportedName(f, ident.Name)
+			value := fmt.Sprintf("string(make([]byte, %d))", n)
+			if typ == "raw.Bytes" {
+				value = fmt.Sprintf("make([]byte, %d)", n)
+			} else if isNullableField(f) {
+				gotyp, err := g.exportedType(exp, f, ident.Name)
+				if err != nil {
+					return err
+				}
+				value = optionalValue(gotyp, value)
+			}
+			var fields []string
+			for _, field := range base {
+				if !strings.HasPrefix(field, name+": ") {
+					fields = append(fields, field)
+				}
+			}
+			cases = append(cases, testCase{"max length " + name, strings.Join(append(fields, name+": "+value), ", ")})
+		}
+	}
+
+	fmt.Fprintf(w, "func Test%sRoundTrip(t *testing.T) {\n", exp)
+	fmt.Fprintf(w, "\tfor _, tt := range []struct {\n")
+	fmt.Fprintf(w, "\t\tname string\n")
+	fmt.Fprintf(w, "\t\to    *%s\n", exp)
+	fmt.Fprintf(w, "\t}{\n")
+	for _, c := range cases {
+		fmt.Fprintf(w, "\t\t{%q, &%s{%s}},\n", c.name, exp, c.fields)
+	}
+	fmt.Fprintf(w, "\t\t{\"typical\", newRoundTrip%s()},\n", exp)
+	fmt.Fprintf(w, "\t} {\n")
+	fmt.Fprintf(w, "\t\tt.Run(tt.name, func(t *testing.T) {\n")
+	fmt.Fprintf(w, "\t\t\tvar got %s\n", exp)
+	if _, ok := pragmas["validate"]; ok {
+		// Records outside of their limits must fail to decode.
+		fmt.Fprintf(w, "\t\t\terr := got.Decode(tt.o.Encode())\n")
+		fmt.Fprintf(w, "\t\t\tif want := tt.o.Validate(); want != nil {\n")
+		fmt.Fprintf(w, "\t\t\t\tif err == nil || err.Error() != want.Error() {\n")
+		fmt.Fprintf(w, "\t\t\t\t\tt.Fatalf(\"unexpected error: %%v, want %%v\", err, want)\n")
+		fmt.Fprintf(w, "\t\t\t\t}\n")
+		fmt.Fprintf(w, "\t\t\t\treturn\n")
+		fmt.Fprintf(w, "\t\t\t} else if err != nil {\n")
+	} else {
+		fmt.Fprintf(w, "\t\t\tif err := got.Decode(tt.o.Encode()); err != nil {\n")
+	}
+	fmt.Fprintf(w, "\t\t\t\tt.Fatal(err)\n")
+	fmt.Fprintf(w, "\t\t\t}\n")
+	if _, ok := pragmas["retain"]; ok {
+		fmt.Fprintf(w, "\t\t\tgot.raw = nil\n")
+	}
+	if _, ok := pragmas["lazy"]; ok {
+		fmt.Fprintf(w, "\t\t\tgot.Load()\n")
+	}
+	fmt.Fprintf(w, "\t\t\tif !reflect.DeepEqual(&got, tt.o) {\n")
+	fmt.Fprintf(w, "\t\t\t\tt.Fatalf(\"unexpected record: %%+v, want %%+v\", got, *tt.o)\n")
+	fmt.Fprintf(w, "\t\t\t}\n")
+	fmt.Fprintf(w, "\t\t})\n")
+	fmt.Fprintf(w, "\t}\n")
+	fmt.Fprintf(w, "}\n\n")
+	return nil
+}
+
+// boundaryFields returns the fields of a record literal setting every field
+// to its minimum value or, if max is set, its maximum value. Strings and
+// slices are empty at their minimum and hold extreme values at their maximum.
+// Enums are at their last value at their maximum. Int and uint fields are
+// limited to IntWidth bits.
+func (g *Generator) boundaryFields(exp string, node *ast.StructType, max bool) ([]string, error) {
+	var fields []string
+	for _, f := range g.fixedInts(node).Fields.List {
+		lo, hi, err := boundaryValues(tostr(f.Type))
+		if err != nil {
+			return nil, err
+		}
+		value := lo
+		if values := enumValues(f); values != nil && max {
+			value = fmt.Sprint(len(values) - 1)
+		} else if max {
+			value = hi
+		}
+		for _, n := range f.Names {
+			value := value
+
+			// Optional and null fields are set even to zero values, which
+			// differ from being unset.
+			if isNullableField(f) {
+				gotyp, err := g.exportedType(exp, f, n.Name)
+				if err != nil {
+					return nil, err
+				}
+				if value == "" {
+					value = zeroValue(gotyp)
+				}
+				value = optionalValue(gotyp, value)
+			}
+			if value != "" {
+				fields = append(fields, g.exportedName(f, n.Name)+": "+value)
+			}
+		}
+	}
+	return fields, nil
+}
+
+// boundaryValues returns the minimum and maximum values of a raw type as
+// expressions of its exported type. A blank value is the zero value.
+// Constants are spelled out so the tests don't need to import math.
+func boundaryValues(typ string) (lo, hi string, err error) {
+	switch typ {
+	case "bool":
+		return "", "true", nil
+	case "int8", "int16", "int32", "int64":
+		bits := bitsize(typ)
+		return fmt.Sprintf("-1 << %d", bits-1), fmt.Sprintf("1<<%d - 1", bits-1), nil
+	case "uint8", "uint16", "uint32", "uint64", "raw.Flags8", "raw.Flags16", "raw.Flags32":
+		return "", fmt.Sprintf("1<<%d - 1", bitsize(typ)), nil
+	case "float32":
+		return "-3.4028234663852886e+38", "3.4028234663852886e+38", nil
+	case "float64":
+		return "-1.7976931348623157e+308", "1.7976931348623157e+308", nil
+	case "complex64":
+		return "complex(-3.4028234663852886e+38, 3.4028234663852886e+38)", "complex(3.4028234663852886e+38, -3.4028234663852886e+38)", nil
+	case "complex128":
+		return "complex(-1.7976931348623157e+308, 1.7976931348623157e+308)", "complex(1.7976931348623157e+308, -1.7976931348623157e+308)", nil
+	case "raw.Time":
+		return "time.Unix(0, -1<<63).UTC()", "time.Unix(0, 1<<63-1).UTC()", nil
+	case "raw.TimeMicro", "raw.TimeMilli":
+		return timeValue(typ, "-1<<63"), timeValue(typ, "1<<63-1"), nil
+	case "raw.TimeSec":
+		return "time.Unix(0, 0).UTC()", "time.Unix(1<<32-1, 0).UTC()", nil
+	case "raw.Decimal":
+		return "", "raw.Decimal{Unscaled: 1<<63 - 1, Scale: 1<<31 - 1}", nil
+	case "raw.Int128":
+		return "raw.Int128{Hi: -1 << 63}", "raw.Int128{Hi: 1<<63 - 1, Lo: 1<<64 - 1}", nil
+	case "raw.Uint128":
+		return "", "raw.Uint128{Hi: 1<<64 - 1, Lo: 1<<64 - 1}", nil
+	case "raw.IP":
+		return "", "netip.MustParseAddr(\"ffff:ffff:ffff:ffff:ffff:ffff:ffff:ffff\")", nil
+	case "raw.ZonedTime":
+		return "time.Unix(0, -1<<63).In(time.FixedZone(\"\", -12*3600))", "time.Unix(0, 1<<63-1).In(time.FixedZone(\"\", 14*3600))", nil
+	case "raw.Duration":
+		return "-1 << 63", "1<<63 - 1", nil
+	case "raw.String8", "raw.String", "raw.String32":
+		return "", `"\x00\U0010ffff"`, nil
+	case "raw.Bytes":
+		return "", "[]byte{0, 0xff}", nil
+	case "raw.StringList":
+		return "", `[]string{"", "\x00\U0010ffff"}`, nil
+	}
+	if value, ok := nullTypes[typ]; ok {
+		return boundaryValues(value)
+	} else if elem := sliceElem(typ); elem != "" {
+		lo, hi, _ := boundaryValues(elem)
+		if lo == "" {
+			lo = "0"
+		}
+		return "", fmt.Sprintf("[]%s{%s, %s}", elem, lo, hi), nil
+	} else if n := arrayLen(typ); n > 0 {
+		return "", fmt.Sprintf("[%d]byte{%d: 0xff}", n, n-1), nil
+	}
+	return "", "", fmt.Errorf("invalid raw type: %s", typ)
+}
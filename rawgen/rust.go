@@ -0,0 +1,465 @@
+package rawgen
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// rustTypes are the Rust types of raw types with a fixed Rust equivalent. The
+// Raw* types are declared at the top of every file.
+var rustTypes = map[string]string{
+	"bool":            "u8",
+	"int8":            "i8",
+	"int16":           "i16",
+	"int32":           "i32",
+	"int64":           "i64",
+	"int":             "i64",
+	"uint8":           "u8",
+	"uint16":          "u16",
+	"uint32":          "u32",
+	"uint64":          "u64",
+	"uint":            "u64",
+	"uintptr":         "u64",
+	"float32":         "f32",
+	"float64":         "f64",
+	"complex64":       "[f32; 2]",
+	"complex128":      "[f64; 2]",
+	"raw.Time":        "i64",
+	"raw.TimeMicro":   "i64",
+	"raw.TimeMilli":   "i64",
+	"raw.TimeSec":     "u32",
+	"raw.ZonedTime":   "RawZonedTime",
+	"raw.IP":          "RawIp",
+	"raw.Decimal":     "RawDecimal",
+	"raw.Int128":      "RawInt128",
+	"raw.Uint128":     "RawUint128",
+	"raw.NullInt64":   "RawNullInt64",
+	"raw.NullFloat64": "RawNullFloat64",
+	"raw.NullString":  "RawNullString",
+	"raw.Duration":    "i64",
+	"raw.Presence":    "u64",
+	"raw.Flags8":      "u8",
+	"raw.Flags16":     "u16",
+	"raw.Flags32":     "u32",
+	"raw.String8":     "RawString8",
+	"raw.String":      "RawString",
+	"raw.String32":    "RawString32",
+	"raw.Bytes":       "RawString",
+	"raw.StringList":  "RawStringList",
+}
+
+// rustKeywords are Rust keywords that are valid Go field names.
+var rustKeywords = map[string]bool{
+	"abstract": true, "as": true, "async": true, "await": true, "become": true,
+	"box": true, "crate": true, "do": true, "dyn": true, "enum": true,
+	"extern": true, "false": true, "final": true, "fn": true, "impl": true,
+	"in": true, "let": true, "loop": true, "macro": true, "match": true,
+	"mod": true, "move": true, "mut": true, "override": true, "priv": true,
+	"pub": true, "ref": true, "self": true, "Self": true, "static": true,
+	"super": true, "trait": true, "true": true, "try": true, "typeof": true,
+	"unsafe": true, "unsized": true, "use": true, "virtual": true,
+	"where": true, "while": true, "yield": true,
+}
+
+// rustPrelude declares the Rust layout of the raw package's types and the
+// helpers used by accessors.
+const rustPrelude = `/// Offset and length of a raw.String8 within a record.
+#[repr(C)]
+#[derive(Clone, Copy, Debug, Default, PartialEq, Eq)]
+#[allow(dead_code)]
+pub struct RawString8 {
+    pub offset: u8,
+    pub length: u8,
+}
+
+/// Offset and length of a raw.String or raw.Bytes within a record.
+#[repr(C)]
+#[derive(Clone, Copy, Debug, Default, PartialEq, Eq)]
+#[allow(dead_code)]
+pub struct RawString {
+    pub offset: u16,
+    pub length: u16,
+}
+
+/// Offset and length of a raw.String32 within a record.
+#[repr(C)]
+#[derive(Clone, Copy, Debug, Default, PartialEq, Eq)]
+#[allow(dead_code)]
+pub struct RawString32 {
+    pub offset: u32,
+    pub length: u32,
+}
+
+/// Offset, count, and size of a raw.StringList within a record. The list
+/// starts with a RawString for each element.
+#[repr(C)]
+#[derive(Clone, Copy, Debug, Default, PartialEq, Eq)]
+#[allow(dead_code)]
+pub struct RawStringList {
+    pub offset: u16,
+    pub length: u16,
+    pub size: u16,
+}
+
+/// Offset and element count of a raw.Slice within a record.
+#[repr(C)]
+#[derive(Clone, Copy, Debug, Default, PartialEq, Eq)]
+#[allow(dead_code)]
+pub struct RawSlice {
+    pub offset: u16,
+    pub length: u16,
+}
+
+/// Nanoseconds since the Unix epoch and zone offset, in seconds east of UTC,
+/// of a raw.ZonedTime.
+#[repr(C)]
+#[derive(Clone, Copy, Debug, Default, PartialEq, Eq)]
+#[allow(dead_code)]
+pub struct RawZonedTime {
+    pub nano: i64,
+    pub offset: i32,
+    _pad: [u8; 4],
+}
+
+/// Address of a raw.IP, stored as an IPv6 address, and its family, which is
+/// 4 for IPv4-mapped addresses, 6, or 0 for no address.
+#[repr(C)]
+#[derive(Clone, Copy, Debug, Default, PartialEq, Eq)]
+#[allow(dead_code)]
+pub struct RawIp {
+    pub addr: [u8; 16],
+    pub family: u8,
+}
+
+/// Unscaled value and scale of a raw.Decimal, which is unscaled * 10^-scale.
+#[repr(C)]
+#[derive(Clone, Copy, Debug, Default, PartialEq, Eq)]
+#[allow(dead_code)]
+pub struct RawDecimal {
+    pub unscaled: i64,
+    pub scale: i32,
+    _pad: [u8; 4],
+}
+
+/// High and low 64 bits of a raw.Int128. Rust's i128 is 16-byte aligned so
+/// it can't be used in the record directly.
+#[repr(C)]
+#[derive(Clone, Copy, Debug, Default, PartialEq, Eq)]
+#[allow(dead_code)]
+pub struct RawInt128 {
+    pub hi: i64,
+    pub lo: u64,
+}
+
+/// High and low 64 bits of a raw.Uint128.
+#[repr(C)]
+#[derive(Clone, Copy, Debug, Default, PartialEq, Eq)]
+#[allow(dead_code)]
+pub struct RawUint128 {
+    pub hi: u64,
+    pub lo: u64,
+}
+
+/// Value of a raw.NullInt64 and whether it's set.
+#[repr(C)]
+#[derive(Clone, Copy, Debug, Default, PartialEq, Eq)]
+#[allow(dead_code)]
+pub struct RawNullInt64 {
+    pub value: i64,
+    pub valid: u8,
+    _pad: [u8; 7],
+}
+
+/// Value of a raw.NullFloat64 and whether it's set.
+#[repr(C)]
+#[derive(Clone, Copy, Debug, Default, PartialEq)]
+#[allow(dead_code)]
+pub struct RawNullFloat64 {
+    pub value: f64,
+    pub valid: u8,
+    _pad: [u8; 7],
+}
+
+/// Offset and length of a raw.NullString within a record and whether it's
+/// set.
+#[repr(C)]
+#[derive(Clone, Copy, Debug, Default, PartialEq, Eq)]
+#[allow(dead_code)]
+pub struct RawNullString {
+    pub offset: u16,
+    pub length: u16,
+    pub valid: u8,
+    _pad: u8,
+}
+
+/// Returns length bytes of a record starting at offset, if within the record.
+#[allow(dead_code)]
+fn raw_bytes(record: &[u8], offset: usize, length: usize) -> Option<&[u8]> {
+    record.get(offset..offset.checked_add(length)?)
+}
+`
+
+// GenerateRust returns Rust source declaring a #[repr(C)] struct for each raw
+// struct in the Go source file, src, with accessors reading each field, so
+// Rust programs can read the same records. Padding inserted by the Go
+// compiler is declared as private padding fields and the size and offset of
+// every field is checked with compile-time assertions. Returns nil if the
+// file has no raw structs.
+func (g *Generator) GenerateRust(src []byte) ([]byte, error) {
+	s, err := g.Schema(src)
+	if err != nil {
+		return nil, err
+	} else if len(s.Structs) == 0 {
+		return nil, nil
+	}
+
+	var buf bytes.Buffer
+	fmt.Fprint(&buf, generatedHeader)
+	fmt.Fprintf(&buf, "// Records of package %s are encoded in %s byte order unless noted.\n\n", s.Package, s.Endian)
+	fmt.Fprint(&buf, rustPrelude)
+	for _, st := range s.Structs {
+		order := s.Endian
+		if _, ok := st.Pragmas["ctype"]; ok {
+			order = "big"
+		}
+		if err := writeRustStruct(st, order, &buf); err != nil {
+			return nil, fmt.Errorf("%s: %s", st.Name, err)
+		}
+	}
+	return buf.Bytes(), nil
+}
+
+// writeRustStruct writes the Rust struct, layout assertions, and accessors
+// for a raw struct whose fields are encoded in a given byte order.
+func writeRustStruct(st *Struct, order string, w io.Writer) error {
+	if strings.Contains(rustPrelude, "pub struct "+st.Exported+" {") {
+		return fmt.Errorf("exported name %s conflicts with generated Rust type", st.Exported)
+	}
+	for _, f := range st.Fields {
+		if rustKeywords[f.Name] {
+			return fmt.Errorf("field name is a Rust keyword: %s", f.Name)
+		} else if f.Name == "from_bytes" {
+			return fmt.Errorf("field name from_bytes conflicts with generated from_bytes function")
+		}
+	}
+
+	// C structs are packed so they're declared without alignment.
+	repr := "C"
+	if _, ok := st.Pragmas["ctype"]; ok {
+		repr = "C, packed"
+	}
+
+	fmt.Fprint(w, "\n")
+	fmt.Fprintf(w, "/// Layout of the raw struct %s, encoded in %s byte order.\n", st.Name, order)
+	fmt.Fprintf(w, "#[repr(%s)]\n", repr)
+	fmt.Fprint(w, "#[derive(Clone, Copy, Debug)]\n")
+	fmt.Fprint(w, "#[allow(dead_code, non_snake_case)]\n")
+	fmt.Fprintf(w, "pub struct %s {\n", st.Exported)
+	var end, padN int
+	for _, f := range st.Fields {
+		// Blank fields declare padding, which is declared again below.
+		if f.Name == "_" {
+			continue
+		} else if f.Offset > end {
+			fmt.Fprintf(w, "    _pad%d: [u8; %d],\n", padN, f.Offset-end)
+			padN++
+		}
+		end = f.Offset + f.Size
+
+		if typ, ok := rustTypes[f.RawType]; ok {
+			fmt.Fprintf(w, "    pub %s: %s,\n", f.Name, typ)
+		} else if n := arrayLen(f.RawType); n > 0 {
+			fmt.Fprintf(w, "    pub %s: [u8; %d],\n", f.Name, n)
+		} else if sliceElem(f.RawType) != "" {
+			fmt.Fprintf(w, "    pub %s: RawSlice,\n", f.Name)
+		} else {
+			return fmt.Errorf("no Rust type for %s", f.RawType)
+		}
+	}
+	if st.Size > end {
+		fmt.Fprintf(w, "    _pad%d: [u8; %d],\n", padN, st.Size-end)
+	}
+	fmt.Fprint(w, "}\n\n")
+
+	fmt.Fprintf(w, "const _: () = assert!(std::mem::size_of::<%s>() == %d);\n", st.Exported, st.Size)
+	for _, f := range st.Fields {
+		if f.Name == "_" {
+			continue
+		}
+		fmt.Fprintf(w, "const _: () = assert!(std::mem::offset_of!(%s, %s) == %d);\n", st.Exported, f.Name, f.Offset)
+	}
+	fmt.Fprint(w, "\n")
+
+	fmt.Fprint(w, "#[allow(dead_code, non_snake_case)]\n")
+	fmt.Fprintf(w, "impl %s {\n", st.Exported)
+	fmt.Fprint(w, "    /// Returns the record in b without copying. Returns None if b is too\n")
+	fmt.Fprint(w, "    /// short or isn't aligned.\n")
+	fmt.Fprintf(w, "    pub fn from_bytes(b: &[u8]) -> Option<&%s> {\n", st.Exported)
+	fmt.Fprintf(w, "        if b.len() < std::mem::size_of::<%s>() || b.as_ptr() as usize %% std::mem::align_of::<%s>() != 0 {\n", st.Exported, st.Exported)
+	fmt.Fprint(w, "            return None;\n")
+	fmt.Fprint(w, "        }\n")
+	fmt.Fprint(w, "        // SAFETY: b is long enough and aligned, and every bit pattern is a\n")
+	fmt.Fprint(w, "        // valid value of every field.\n")
+	fmt.Fprintf(w, "        Some(unsafe { &*(b.as_ptr() as *const %s) })\n", st.Exported)
+	fmt.Fprint(w, "    }\n")
+	for _, f := range st.Fields {
+		if _, ok := f.Tag["-"]; ok || f.Name == "_" {
+			continue
+		}
+		fmt.Fprint(w, "\n")
+		writeRustAccessor(f, order, w)
+	}
+	fmt.Fprint(w, "}\n")
+	return nil
+}
+
+// writeRustAccessor writes the accessor function for a single field. Strings
+// and slices are read from the record, which must be passed in.
+func writeRustAccessor(f *Field, order string, w io.Writer) {
+	typ := f.RawType
+	switch {
+	case typ == "bool":
+		fmt.Fprintf(w, "    pub fn %s(&self) -> bool {\n", f.Name)
+		fmt.Fprintf(w, "        self.%s != 0\n", f.Name)
+	case isTime(typ), typ == "raw.Duration":
+		unit := map[string]string{"raw.TimeMicro": "microseconds", "raw.TimeMilli": "milliseconds", "raw.TimeSec": "seconds"}[typ]
+		if unit == "" {
+			unit = "nanoseconds"
+		}
+		if isTime(typ) {
+			fmt.Fprintf(w, "    /// Returns %s since the Unix epoch.\n", unit)
+		} else {
+			fmt.Fprint(w, "    /// Returns nanoseconds.\n")
+		}
+		rtyp := rustTypes[typ]
+		fmt.Fprintf(w, "    pub fn %s(&self) -> %s {\n", f.Name, rtyp)
+		fmt.Fprintf(w, "        %s\n", rustConv(order, rtyp, "self."+f.Name))
+	case typ == "complex64", typ == "complex128":
+		part := rustTypes[map[string]string{"complex64": "float32", "complex128": "float64"}[typ]]
+		fmt.Fprint(w, "    /// Returns the real and imaginary parts.\n")
+		fmt.Fprintf(w, "    pub fn %s(&self) -> (%s, %s) {\n", f.Name, part, part)
+		fmt.Fprintf(w, "        let c = self.%s;\n", f.Name)
+		fmt.Fprintf(w, "        (%s, %s)\n", rustConv(order, part, "c[0]"), rustConv(order, part, "c[1]"))
+	case typ == "raw.Decimal":
+		fmt.Fprint(w, "    /// Returns the unscaled value and scale of the decimal.\n")
+		fmt.Fprintf(w, "    pub fn %s(&self) -> (i64, i32) {\n", f.Name)
+		fmt.Fprintf(w, "        let d = self.%s;\n", f.Name)
+		fmt.Fprintf(w, "        (%s, %s)\n", rustConv(order, "i64", "d.unscaled"), rustConv(order, "i32", "d.scale"))
+	case typ == "raw.Int128", typ == "raw.Uint128":
+		rtyp, hi := "i128", "i64"
+		if typ == "raw.Uint128" {
+			rtyp, hi = "u128", "u64"
+		}
+		fmt.Fprintf(w, "    pub fn %s(&self) -> %s {\n", f.Name, rtyp)
+		fmt.Fprintf(w, "        let x = self.%s;\n", f.Name)
+		fmt.Fprintf(w, "        ((%s as %s) << 64) | %s as %s\n", rustConv(order, hi, "x.hi"), rtyp, rustConv(order, "u64", "x.lo"), rtyp)
+	case typ == "raw.ZonedTime":
+		fmt.Fprint(w, "    /// Returns nanoseconds since the Unix epoch and the zone offset in seconds.\n")
+		fmt.Fprintf(w, "    pub fn %s(&self) -> (i64, i32) {\n", f.Name)
+		fmt.Fprintf(w, "        let t = self.%s;\n", f.Name)
+		fmt.Fprintf(w, "        (%s, %s)\n", rustConv(order, "i64", "t.nano"), rustConv(order, "i32", "t.offset"))
+	case typ == "raw.IP":
+		fmt.Fprintf(w, "    pub fn %s(&self) -> Option<std::net::IpAddr> {\n", f.Name)
+		fmt.Fprintf(w, "        let ip = std::net::Ipv6Addr::from(self.%s.addr);\n", f.Name)
+		fmt.Fprintf(w, "        match self.%s.family {\n", f.Name)
+		fmt.Fprint(w, "            4 => ip.to_ipv4_mapped().map(std::net::IpAddr::V4),\n")
+		fmt.Fprint(w, "            6 => Some(std::net::IpAddr::V6(ip)),\n")
+		fmt.Fprint(w, "            _ => None,\n")
+		fmt.Fprint(w, "        }\n")
+	case typ == "raw.NullInt64", typ == "raw.NullFloat64":
+		rtyp := rustTypes[nullTypes[typ]]
+		fmt.Fprint(w, "    /// Returns None if the field isn't set.\n")
+		fmt.Fprintf(w, "    pub fn %s(&self) -> Option<%s> {\n", f.Name, rtyp)
+		fmt.Fprintf(w, "        let n = self.%s;\n", f.Name)
+		fmt.Fprint(w, "        if n.valid == 0 {\n")
+		fmt.Fprint(w, "            return None;\n")
+		fmt.Fprint(w, "        }\n")
+		fmt.Fprintf(w, "        Some(%s)\n", rustConv(order, rtyp, "n.value"))
+	case typ == "raw.NullString":
+		fmt.Fprint(w, "    /// Returns None if the field isn't set.\n")
+		fmt.Fprintf(w, "    pub fn %s<'a>(&self, record: &'a [u8]) -> Option<&'a str> {\n", f.Name)
+		fmt.Fprintf(w, "        let s = self.%s;\n", f.Name)
+		fmt.Fprint(w, "        if s.valid == 0 {\n")
+		fmt.Fprint(w, "            return None;\n")
+		fmt.Fprint(w, "        }\n")
+		fmt.Fprintf(w, "        let b = raw_bytes(record, %s as usize, %s as usize)?;\n", rustConv(order, "u16", "s.offset"), rustConv(order, "u16", "s.length"))
+		fmt.Fprint(w, "        std::str::from_utf8(b).ok()\n")
+	case typ == "raw.String8", typ == "raw.String", typ == "raw.String32", typ == "raw.Bytes":
+		result := "Option<&'a str>"
+		if typ == "raw.Bytes" {
+			result = "Option<&'a [u8]>"
+		}
+		width := map[string]string{"raw.String8": "u8", "raw.String32": "u32"}[typ]
+		if width == "" {
+			width = "u16"
+		}
+		fmt.Fprintf(w, "    pub fn %s<'a>(&self, record: &'a [u8]) -> %s {\n", f.Name, result)
+		fmt.Fprintf(w, "        let s = self.%s;\n", f.Name)
+		fmt.Fprintf(w, "        let b = raw_bytes(record, %s as usize, %s as usize)?;\n", rustConv(order, width, "s.offset"), rustConv(order, width, "s.length"))
+		if typ == "raw.Bytes" {
+			fmt.Fprint(w, "        Some(b)\n")
+		} else {
+			fmt.Fprint(w, "        std::str::from_utf8(b).ok()\n")
+		}
+	case typ == "raw.StringList":
+		fmt.Fprintf(w, "    pub fn %s<'a>(&self, record: &'a [u8]) -> Option<Vec<&'a str>> {\n", f.Name)
+		fmt.Fprintf(w, "        let l = self.%s;\n", f.Name)
+		fmt.Fprintf(w, "        let table = raw_bytes(record, %s as usize, %s as usize * 4)?;\n", rustConv(order, "u16", "l.offset"), rustConv(order, "u16", "l.length"))
+		fmt.Fprint(w, "        table\n")
+		fmt.Fprint(w, "            .chunks_exact(4)\n")
+		fmt.Fprint(w, "            .map(|e| {\n")
+		fmt.Fprintf(w, "                let offset = u16::%s([e[0], e[1]]) as usize;\n", rustFromBytes(order))
+		fmt.Fprintf(w, "                let length = u16::%s([e[2], e[3]]) as usize;\n", rustFromBytes(order))
+		fmt.Fprint(w, "                std::str::from_utf8(raw_bytes(record, offset, length)?).ok()\n")
+		fmt.Fprint(w, "            })\n")
+		fmt.Fprint(w, "            .collect()\n")
+	case sliceElem(typ) != "":
+		elem := rustTypes[sliceElem(typ)]
+		size, _ := sizeof(sliceElem(typ))
+		fmt.Fprintf(w, "    pub fn %s(&self, record: &[u8]) -> Option<Vec<%s>> {\n", f.Name, elem)
+		fmt.Fprintf(w, "        let s = self.%s;\n", f.Name)
+		fmt.Fprintf(w, "        let b = raw_bytes(record, %s as usize, %s as usize * %d)?;\n", rustConv(order, "u16", "s.offset"), rustConv(order, "u16", "s.length"), size)
+		fmt.Fprintf(w, "        Some(b.chunks_exact(%d).map(|e| %s::%s(e.try_into().unwrap())).collect())\n", size, elem, rustFromBytes(order))
+	case arrayLen(typ) > 0:
+		fmt.Fprintf(w, "    pub fn %s(&self) -> [u8; %d] {\n", f.Name, arrayLen(typ))
+		fmt.Fprintf(w, "        self.%s\n", f.Name)
+	default:
+		rtyp := rustTypes[typ]
+		fmt.Fprintf(w, "    pub fn %s(&self) -> %s {\n", f.Name, rtyp)
+		fmt.Fprintf(w, "        %s\n", rustConv(order, rtyp, "self."+f.Name))
+	}
+	fmt.Fprint(w, "    }\n")
+}
+
+// rustConv returns a Rust expression converting expr, of type typ, from a
+// byte order to the platform's byte order.
+func rustConv(order, typ, expr string) string {
+	if order == "native" {
+		return expr
+	}
+	fn := "from_le"
+	if order == "big" {
+		fn = "from_be"
+	}
+	switch typ {
+	case "f32":
+		return fmt.Sprintf("f32::from_bits(u32::%s(%s.to_bits()))", fn, expr)
+	case "f64":
+		return fmt.Sprintf("f64::from_bits(u64::%s(%s.to_bits()))", fn, expr)
+	}
+	return fmt.Sprintf("%s::%s(%s)", typ, fn, expr)
+}
+
+// rustFromBytes returns the Rust function converting bytes in a byte order
+// to a number.
+func rustFromBytes(order string) string {
+	switch order {
+	case "little":
+		return "from_le_bytes"
+	case "big":
+		return "from_be_bytes"
+	}
+	return "from_ne_bytes"
+}
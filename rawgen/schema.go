@@ -0,0 +1,170 @@
+package rawgen
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"sort"
+	"strings"
+)
+
+// Schema describes the on-disk layout of the raw structs in a file so tools
+// written in other languages, or audits, can read encoded records without
+// parsing Go source.
+type Schema struct {
+	File    string    `json:"file,omitempty"` // path of the file, set by the caller
+	Package string    `json:"package"`        // name of the Go package
+	Endian  string    `json:"endian"`         // byte order of encoded records
+	Structs []*Struct `json:"structs"`
+}
+
+// Schema returns the schema of the raw structs in the Go source file, src.
+// Structs skipped with a pragma are left out. Offsets and sizes are those of
+// 64-bit platforms, or of the platform set by Arch, except for structs marked
+// with the "//raw:ctype" pragma, which are packed.
+func (g *Generator) Schema(src []byte) (*Schema, error) {
+	b, err := strip(src)
+	if err != nil {
+		return nil, err
+	}
+	_, f, pkg, err := g.parse(b)
+	if err != nil {
+		return nil, err
+	}
+
+	// Portable code is little-endian unless the byte order is set.
+	endian := "native"
+	if g.Endian == "big" {
+		endian = "big"
+	} else if g.portable() {
+		endian = "little"
+	}
+	schema := &Schema{Package: f.Name.Name, Endian: endian, Structs: []*Struct{}}
+	v := visitor{Generator: g, imports: make(map[string]bool), pkg: pkg, codecs: findCodecs(f), file: f, schema: schema}
+	v.findNested(f)
+	ast.Walk(&v, f)
+	if v.err != nil {
+		return nil, v.err
+	}
+	return schema, nil
+}
+
+// describeStruct returns the description of a raw struct in a schema. Returns
+// an error if the size of a field isn't known, such as for user-defined field
+// types.
+func (v *visitor) describeStruct(unexp, exp string, node *ast.StructType, pragmas map[string]string) (*Struct, error) {
+	if _, ok := layoutOf(node); !ok {
+		return nil, fmt.Errorf("layout of user-defined field types is unknown")
+	}
+	s, err := v.newStruct(unexp, exp, node, node, pragmas)
+	if err != nil {
+		return nil, err
+	}
+
+	// C structs are packed with fields at their C sizes.
+	if _, ok := pragmas["ctype"]; ok {
+		s.Size = 0
+		for _, f := range s.Fields {
+			n, err := csizeof(f.RawType)
+			if err != nil {
+				return nil, err
+			}
+			f.Offset, f.Size = s.Size, n
+			s.Size += n
+		}
+	}
+	return s, nil
+}
+
+// GenerateFromSchema returns a Go source file declaring the raw structs
+// described by a schema, along with their generated code, so a schema can be
+// the source of truth instead of Go source. Only the names, pragmas, raw
+// types, and tags of the schema are used. If a struct's size is set, the
+// sizes and offsets of the generated layout must match the schema.
+func (g *Generator) GenerateFromSchema(s *Schema) ([]byte, error) {
+	if s.Package == "" {
+		return nil, fmt.Errorf("package name required")
+	}
+	path := DefaultImportPath
+	if len(g.ImportPaths) > 0 {
+		path = g.ImportPaths[0]
+	}
+
+	// Native code maps records with unsafe, which raw structs declared in
+	// Go source import themselves.
+	imports := fmt.Sprintf("\t%q\n", path)
+	if !g.portable() {
+		imports = "\t\"unsafe\"\n\n" + imports
+	}
+
+	var buf bytes.Buffer
+	fmt.Fprint(&buf, generatedHeader)
+	fmt.Fprintf(&buf, "\npackage %s\n\nimport (\n%s)\n", s.Package, imports)
+	for _, st := range s.Structs {
+		spec := StructSpec{Name: st.Name, Pragmas: st.Pragmas}
+		for _, f := range st.Fields {
+			spec.Fields = append(spec.Fields, FieldSpec{Name: f.Name, Type: f.RawType, Tag: formatTag(f.Tag)})
+		}
+		buf.WriteString("\n")
+		writeStructSpec(&buf, spec)
+	}
+
+	b, err := g.GenerateFile(buf.Bytes())
+	if err != nil {
+		return nil, err
+	} else if err := g.checkSchema(b, s); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+// checkSchema returns an error if the layout of a raw struct in src differs
+// from a struct in the schema with its size set.
+func (g *Generator) checkSchema(src []byte, s *Schema) error {
+	var sized bool
+	for _, st := range s.Structs {
+		sized = sized || st.Size != 0
+	}
+	if !sized {
+		return nil
+	}
+
+	other, err := g.Schema(src)
+	if err != nil {
+		return err
+	}
+	structs := make(map[string]*Struct)
+	for _, st := range other.Structs {
+		structs[st.Name] = st
+	}
+	for _, want := range s.Structs {
+		got := structs[want.Name]
+		if want.Size == 0 || got == nil {
+			continue
+		} else if got.Size != want.Size {
+			return fmt.Errorf("%s: size is %d, schema has %d", want.Name, got.Size, want.Size)
+		}
+		for i, f := range want.Fields {
+			if got.Fields[i].Offset != f.Offset || got.Fields[i].Size != f.Size {
+				return fmt.Errorf("%s.%s: layout is %d+%d, schema has %d+%d", want.Name, f.Name, got.Fields[i].Offset, got.Fields[i].Size, f.Offset, f.Size)
+			}
+		}
+	}
+	return nil
+}
+
+// formatTag returns a struct tag setting the raw options in opts.
+func formatTag(opts map[string]string) string {
+	if len(opts) == 0 {
+		return ""
+	}
+	var a []string
+	for k, v := range opts {
+		if v != "" {
+			k += "=" + v
+		}
+		a = append(a, k)
+	}
+	sort.Strings(a)
+	return `raw:"` + strings.Join(a, ",") + `"`
+}
@@ -0,0 +1,131 @@
+package rawgen
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// SeparateFileName returns the name of the file that code generated for the
+// Go file at name is written to in separate file mode.
+func SeparateFileName(name string) string {
+	if strings.HasSuffix(name, "_test.go") {
+		return strings.TrimSuffix(name, "_test.go") + "_rawgen_test.go"
+	}
+	return strings.TrimSuffix(name, ".go") + "_rawgen.go"
+}
+
+// GenerateSeparateFile returns a Go source file containing the code generated
+// for each raw struct in the source file, src, along with the imports it
+// requires. Any code previously generated in src is ignored. Returns nil if
+// src has no raw structs.
+func (g *Generator) GenerateSeparateFile(src []byte) ([]byte, error) {
+	b, err := strip(src)
+	if err != nil {
+		return nil, err
+	}
+	_, f, pkg, err := g.parse(b)
+	if err != nil {
+		return nil, err
+	}
+
+	v := visitor{Generator: g, imports: make(map[string]bool), pkg: pkg, codecs: findCodecs(f), file: f}
+	v.findNested(f)
+	ast.Walk(&v, f)
+	if v.err != nil {
+		return nil, v.err
+	} else if v.w.Len() == 0 {
+		return nil, nil
+	}
+
+	// Import every package referenced by the generated code. Packages are
+	// matched to the source file's imports by name, falling back to the
+	// packages that generated code may use.
+	code := v.w.Bytes()
+	gen, err := parser.ParseFile(token.NewFileSet(), "", append([]byte("package x\n\n"), code...), 0)
+	if err != nil {
+		return nil, fmt.Errorf("parse generated code: %s", err)
+	}
+	names := make(map[string]bool)
+	ast.Inspect(gen, func(node ast.Node) bool {
+		if sel, ok := node.(*ast.SelectorExpr); ok {
+			if x, ok := sel.X.(*ast.Ident); ok && x.Obj == nil {
+				names[x.Name] = true
+			}
+		}
+		return true
+	})
+
+	var std, other []string
+	for name := range names {
+		spec := g.importSpec(f, name, pkg)
+		if spec == "" {
+			continue
+		} else if p, _ := strconv.Unquote(spec[strings.Index(spec, `"`):]); !strings.Contains(strings.Split(p, "/")[0], ".") {
+			std = append(std, spec)
+		} else {
+			other = append(other, spec)
+		}
+	}
+	sort.Strings(std)
+	sort.Strings(other)
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "package %s\n\n", f.Name.Name)
+	fmt.Fprint(&buf, "//\n")
+	fmt.Fprint(&buf, "// DO NOT CHANGE\n")
+	fmt.Fprint(&buf, generatedHeader)
+	fmt.Fprint(&buf, "//\n\n")
+	fmt.Fprint(&buf, "import (\n")
+	for _, spec := range std {
+		fmt.Fprintf(&buf, "\t%s\n", spec)
+	}
+	if len(std) > 0 && len(other) > 0 {
+		fmt.Fprint(&buf, "\n")
+	}
+	for _, spec := range other {
+		fmt.Fprintf(&buf, "\t%s\n", spec)
+	}
+	fmt.Fprint(&buf, ")\n\n")
+	buf.Write(bytes.TrimRight(code, "\n"))
+	buf.WriteString("\n")
+	return formatSource(buf.Bytes())
+}
+
+// importSpec returns the import spec, as source, for a package name used by
+// generated code. The raw package and other packages imported by the file
+// keep the file's import path and alias. Returns a blank string if the name
+// is unknown.
+func (g *Generator) importSpec(f *ast.File, name, pkg string) string {
+	for _, i := range f.Imports {
+		p, _ := strconv.Unquote(i.Path.Value)
+		if name == pkg {
+			for _, rawPath := range g.importPaths() {
+				if p == rawPath && i.Name != nil {
+					return i.Name.Name + " " + i.Path.Value
+				} else if p == rawPath {
+					return i.Path.Value
+				}
+			}
+		} else if i.Name != nil && i.Name.Name == name {
+			return name + " " + i.Path.Value
+		} else if i.Name == nil && path.Base(p) == name {
+			return i.Path.Value
+		}
+	}
+	for p, n := range generatedImports {
+		if n == name {
+			return strconv.Quote(p)
+		}
+	}
+	if name == "unsafe" {
+		return `"unsafe"`
+	}
+	return ""
+}
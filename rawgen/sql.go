@@ -0,0 +1,37 @@
+package rawgen
+
+import (
+	"fmt"
+	"io"
+)
+
+// writeSQLFuncs writes generated methods implementing driver.Valuer and
+// sql.Scanner so records can be stored in a BLOB column with their raw
+// encoding. A NULL value scans as the zero value.
+func (v *visitor) writeSQLFuncs(exp string, pragmas map[string]string, w io.Writer) error {
+	fmt.Fprintf(w, "// Value implements driver.Valuer by encoding o.\n")
+	fmt.Fprintf(w, "func (o %s) Value() (driver.Value, error) { return o.Encode(), nil }\n\n", exp)
+
+	fmt.Fprintf(w, "// Scan implements sql.Scanner by decoding an encoded %s.\n", exp)
+	fmt.Fprintf(w, "func (o *%s) Scan(src interface{}) error {\n", exp)
+	fmt.Fprintf(w, "\tswitch src := src.(type) {\n")
+	fmt.Fprintf(w, "\tcase nil:\n")
+	fmt.Fprintf(w, "\t\t*o = %s{}\n", exp)
+	fmt.Fprintf(w, "\t\treturn nil\n")
+	fmt.Fprintf(w, "\tcase []byte:\n")
+
+	// Drivers may reuse the scanned bytes so retained bytes are copied.
+	if retainsBytes(pragmas) {
+		fmt.Fprintf(w, "\t\treturn o.Decode(append([]byte(nil), src...))\n")
+	} else {
+		fmt.Fprintf(w, "\t\treturn o.Decode(src)\n")
+	}
+	fmt.Fprintf(w, "\tdefault:\n")
+	fmt.Fprintf(w, "\t\treturn fmt.Errorf(\"cannot scan %%T into %s\", src)\n", exp)
+	fmt.Fprintf(w, "\t}\n")
+	fmt.Fprintf(w, "}\n\n")
+
+	v.imports["database/sql/driver"] = true
+	v.imports["fmt"] = true
+	return nil
+}
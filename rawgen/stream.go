@@ -0,0 +1,287 @@
+package rawgen
+
+import (
+	"fmt"
+	"go/ast"
+	"io"
+)
+
+// writeEncodeToFunc writes a generated function writing the encoding of a
+// raw struct type to an io.Writer. The offsets of the variable length data
+// are computed up front so the raw struct is written as-is, followed by the
+// data of each field in order. Portable records, records with custom field
+// types, and checksummed or tagged records are encoded to a slice and then
+// written instead.
+func (v *visitor) writeEncodeToFunc(unexp, exp string, node *ast.StructType, w io.Writer) error {
+	v.imports["io"] = true
+	fmt.Fprintf(w, "// EncodeTo writes the encoding of o to w. Returns the number of bytes written.\n")
+	fmt.Fprintf(w, "func (o *%s) EncodeTo(w io.Writer) (int, error) {\n", exp)
+	v.writeValidateCheck("0, ", w)
+	if v.portable() || v.hasCodecs(node) || v.Checksum || v.tag != "" {
+		fmt.Fprintf(w, "\tb := o.Encode()\n")
+		fmt.Fprintf(w, "\tn, err := w.Write(b)\n")
+		if v.Pool {
+			fmt.Fprintf(w, "\tRelease%s(b)\n", exp)
+		}
+		fmt.Fprintf(w, "\treturn n, err\n")
+		fmt.Fprintf(w, "}\n\n")
+		return nil
+	}
+
+	var data, pad, lists bool
+	for _, f := range node.Fields.List {
+		typ := tostr(f.Type)
+		if stringWidth(typ) > 0 {
+			data = true
+		}
+		if size, _ := sizeof(sliceElem(typ)); size > 1 || typ == "raw.StringList" {
+			pad = true
+		}
+		if typ == "raw.StringList" {
+			lists = true
+		}
+	}
+
+	// Set the fixed size fields along with the offset of each field's data.
+	v.writeLoad("o", w)
+	fmt.Fprintf(w, "\tvar r %s\n", unexp)
+	if data {
+		fmt.Fprintf(w, "\toff := int(unsafe.Sizeof(r))\n")
+	}
+	if v.version > 0 {
+		fmt.Fprintf(w, "\tr.version = %d\n", v.version)
+	}
+	for _, f := range node.Fields.List {
+		typ := tostr(f.Type)
+		for _, n := range f.Names {
+			exp := v.fieldname(n.Name)
+			if stringWidth(typ) == 0 {
+				if v.isOptional(n.Name) {
+					if err := v.writeOptionalEncode(typ, n.Name, "", w); err != nil {
+						return err
+					}
+					continue
+				}
+				value, err := v.rawValue(typ, "o."+exp)
+				if err != nil {
+					return err
+				}
+				fmt.Fprintf(w, "\tr.%s = %s\n", n.Name, value)
+				continue
+			}
+
+			switch elem := sliceElem(typ); {
+			case elem != "":
+				size, _ := sizeof(elem)
+				if size > 1 {
+					fmt.Fprintf(w, "\toff += (%d - off%%%d) %% %d\n", size, size, size)
+				}
+				fmt.Fprintf(w, "\t%s.CheckOffset(off, len(o.%s), 16)\n", v.pkg, exp)
+				fmt.Fprintf(w, "\tr.%s.Offset, r.%s.Length = uint16(off), uint16(len(o.%s))\n", n.Name, n.Name, exp)
+				fmt.Fprintf(w, "\toff += len(o.%s) * %d\n", exp, size)
+			case typ == "raw.StringList":
+				fmt.Fprintf(w, "\toff += off %% 2\n")
+				fmt.Fprintf(w, "\t%s.CheckOffset(off, len(o.%s), 16)\n", v.pkg, exp)
+				fmt.Fprintf(w, "\tr.%s.Offset, r.%s.Length = uint16(off), uint16(len(o.%s))\n", n.Name, n.Name, exp)
+				fmt.Fprintf(w, "\tr.%s.Size = uint16(len(o.%s) * int(unsafe.Sizeof(%s.String{})))\n", n.Name, exp, v.pkg)
+				fmt.Fprintf(w, "\tfor _, s := range o.%s {\n", exp)
+				fmt.Fprintf(w, "\t\t%s.CheckOffset(off+int(r.%s.Size), len(s), 16)\n", v.pkg, n.Name)
+				fmt.Fprintf(w, "\t\t%s.CheckOffset(off, int(r.%s.Size)+len(s), 16)\n", v.pkg, n.Name)
+				fmt.Fprintf(w, "\t\tr.%s.Size += uint16(len(s))\n", n.Name)
+				fmt.Fprintf(w, "\t}\n")
+				fmt.Fprintf(w, "\toff += int(r.%s.Size)\n", n.Name)
+			default:
+				bits := stringWidth(typ)
+				value := "o." + exp
+				if v.isOptional(n.Name) {
+					fmt.Fprintf(w, "\tif o.%s != nil {\n", exp)
+					value = "*o." + exp
+				}
+				if bits < 32 {
+					fmt.Fprintf(w, "\t%s.CheckOffset(off, len(%s), %d)\n", v.pkg, value, bits)
+				}
+				fmt.Fprintf(w, "\tr.%s.Offset, r.%s.Length = uint%d(off), uint%d(len(%s))\n", n.Name, n.Name, bits, bits, value)
+				fmt.Fprintf(w, "\toff += len(%s)\n", value)
+				if v.nulls[n.Name] {
+					fmt.Fprintf(w, "\t\tr.%s.Valid = true\n", n.Name)
+					fmt.Fprintf(w, "\t}\n")
+				} else if v.isOptional(n.Name) {
+					fmt.Fprintf(w, "\t\tr.%s.Set(%d)\n", v.presence, v.optional[n.Name])
+					fmt.Fprintf(w, "\t}\n")
+				}
+			}
+		}
+	}
+
+	fmt.Fprintf(w, "\tn, err := w.Write(unsafe.Slice((*byte)(unsafe.Pointer(&r)), unsafe.Sizeof(r)))\n")
+	if !data {
+		fmt.Fprintf(w, "\treturn n, err\n")
+		fmt.Fprintf(w, "}\n\n")
+		return nil
+	}
+	fmt.Fprintf(w, "\tif err != nil {\n")
+	fmt.Fprintf(w, "\t\treturn n, err\n")
+	fmt.Fprintf(w, "\t}\n")
+	fmt.Fprintf(w, "\tvar m int\n")
+	if pad {
+		fmt.Fprintf(w, "\tvar zero [8]byte\n")
+	}
+	if lists {
+		fmt.Fprintf(w, "\tvar loff int\n")
+	}
+
+	// Write the data of each field at the offsets set above, padding slices
+	// and string lists to their alignment.
+	write := func(expr string) {
+		fmt.Fprintf(w, "\tm, err = %s\n", expr)
+		fmt.Fprintf(w, "\tif n += m; err != nil {\n")
+		fmt.Fprintf(w, "\t\treturn n, err\n")
+		fmt.Fprintf(w, "\t}\n")
+	}
+	for _, f := range node.Fields.List {
+		typ := tostr(f.Type)
+		for _, n := range f.Names {
+			exp := v.fieldname(n.Name)
+			switch elem := sliceElem(typ); {
+			case stringWidth(typ) == 0:
+			case elem != "":
+				if size, _ := sizeof(elem); size > 1 {
+					write(fmt.Sprintf("w.Write(zero[:int(r.%s.Offset)-n])", n.Name))
+				}
+				fmt.Fprintf(w, "\tif len(o.%s) > 0 {\n", exp)
+				fmt.Fprintf(w, "\t\tm, err = w.Write(unsafe.Slice((*byte)(unsafe.Pointer(&o.%s[0])), r.%s.End()-int(r.%s.Offset)))\n", exp, n.Name, n.Name)
+				fmt.Fprintf(w, "\t\tif n += m; err != nil {\n")
+				fmt.Fprintf(w, "\t\t\treturn n, err\n")
+				fmt.Fprintf(w, "\t\t}\n")
+				fmt.Fprintf(w, "\t}\n")
+			case typ == "raw.StringList":
+				// The table of strings is followed by their contents.
+				write(fmt.Sprintf("w.Write(zero[:int(r.%s.Offset)-n])", n.Name))
+				fmt.Fprintf(w, "\tloff = n + len(o.%s)*int(unsafe.Sizeof(%s.String{}))\n", exp, v.pkg)
+				fmt.Fprintf(w, "\tfor _, str := range o.%s {\n", exp)
+				fmt.Fprintf(w, "\t\ts := %s.String{Offset: uint16(loff), Length: uint16(len(str))}\n", v.pkg)
+				fmt.Fprintf(w, "\t\tm, err = w.Write(unsafe.Slice((*byte)(unsafe.Pointer(&s)), unsafe.Sizeof(s)))\n")
+				fmt.Fprintf(w, "\t\tif n += m; err != nil {\n")
+				fmt.Fprintf(w, "\t\t\treturn n, err\n")
+				fmt.Fprintf(w, "\t\t}\n")
+				fmt.Fprintf(w, "\t\tloff += len(str)\n")
+				fmt.Fprintf(w, "\t}\n")
+				fmt.Fprintf(w, "\tfor _, str := range o.%s {\n", exp)
+				fmt.Fprintf(w, "\t\tm, err = io.WriteString(w, str)\n")
+				fmt.Fprintf(w, "\t\tif n += m; err != nil {\n")
+				fmt.Fprintf(w, "\t\t\treturn n, err\n")
+				fmt.Fprintf(w, "\t\t}\n")
+				fmt.Fprintf(w, "\t}\n")
+			default:
+				value, fn := "o."+exp, "io.WriteString(w, %s)"
+				if typ == "raw.Bytes" {
+					fn = "w.Write(%s)"
+				}
+				if v.isOptional(n.Name) {
+					fmt.Fprintf(w, "\tif o.%s != nil {\n", exp)
+					value = "*o." + exp
+				}
+				write(fmt.Sprintf(fn, value))
+				if v.isOptional(n.Name) {
+					fmt.Fprintf(w, "\t}\n")
+				}
+			}
+		}
+	}
+	fmt.Fprintf(w, "\treturn n, nil\n")
+	fmt.Fprintf(w, "}\n\n")
+	return nil
+}
+
+// writeDecodeFromFunc writes a generated function reading a single record
+// from an io.Reader. The fixed size fields are read first and the end of the
+// record's variable length data is found from their offsets, as records are
+// stored one after another without a length prefix.
+func (v *visitor) writeDecodeFromFunc(unexp, exp string, node *ast.StructType, w io.Writer) error {
+	v.imports["io"] = true
+	fmt.Fprintf(w, "// DecodeFrom reads a single record from rd and decodes it into o. Returns\n")
+	fmt.Fprintf(w, "// io.EOF if there are no more records and io.ErrUnexpectedEOF if rd ends\n")
+	fmt.Fprintf(w, "// partway through a record.\n")
+	fmt.Fprintf(w, "func (o *%s) DecodeFrom(rd io.Reader) error {\n", exp)
+	if v.portable() {
+		l, ok := v.layout(node)
+		if !ok {
+			return fmt.Errorf("unknown layout")
+		}
+		order := v.byteOrder()
+
+		// The offsets of tagged records are after their tag.
+		base := 0
+		if v.tag != "" {
+			base = typeTagSize
+		}
+		fmt.Fprintf(w, "\tb := make([]byte, %d)\n", base+l.size)
+		fmt.Fprintf(w, "\tif _, err := io.ReadFull(rd, b); err != nil {\n")
+		fmt.Fprintf(w, "\t\treturn err\n")
+		fmt.Fprintf(w, "\t}\n")
+		fmt.Fprintf(w, "\tn := %d\n", l.size)
+		for _, s := range l.slots {
+			var end string
+			s.offset += base
+			switch elem := sliceElem(s.typ); {
+			case s.typ == "raw.String8":
+				end = fmt.Sprintf("int(b[%d]) + int(b[%d])", s.offset, s.offset+1)
+			case s.typ == "raw.String", s.typ == "raw.NullString", s.typ == "raw.Bytes":
+				end = fmt.Sprintf("int(%s.Uint16(b[%d:])) + int(%s.Uint16(b[%d:]))", order, s.offset, order, s.offset+2)
+			case s.typ == "raw.String32":
+				end = fmt.Sprintf("int(%s.Uint32(b[%d:])) + int(%s.Uint32(b[%d:]))", order, s.offset, order, s.offset+4)
+			case s.typ == "raw.StringList":
+				end = fmt.Sprintf("int(%s.Uint16(b[%d:])) + int(%s.Uint16(b[%d:]))", order, s.offset, order, s.offset+4)
+			case elem != "":
+				size, _ := sizeof(elem)
+				end = fmt.Sprintf("int(%s.Uint16(b[%d:])) + int(%s.Uint16(b[%d:]))*%d", order, s.offset, order, s.offset+2, size)
+			default:
+				continue
+			}
+			fmt.Fprintf(w, "\tif end := %s; end > n {\n", end)
+			fmt.Fprintf(w, "\t\tn = end\n")
+			fmt.Fprintf(w, "\t}\n")
+		}
+		v.writeTypeTagLen(w)
+		v.writeChecksumLen(w)
+		writeReadRest(fmt.Sprint(base+l.size), w)
+		return nil
+	}
+
+	fmt.Fprintf(w, "\tvar r %s\n", unexp)
+	fmt.Fprintf(w, "\tb := make([]byte, %s)\n", v.tagSize("unsafe.Sizeof(r)"))
+	fmt.Fprintf(w, "\tif _, err := io.ReadFull(rd, b); err != nil {\n")
+	fmt.Fprintf(w, "\t\treturn err\n")
+	fmt.Fprintf(w, "\t}\n")
+	var strs []string
+	for _, f := range node.Fields.List {
+		if stringWidth(tostr(f.Type)) > 0 {
+			for _, n := range f.Names {
+				strs = append(strs, n.Name)
+			}
+		}
+	}
+	if len(strs) > 0 {
+		fmt.Fprintf(w, "\tp := (*%s)(unsafe.Pointer(&b[%s]))\n", unexp, v.tagOffset())
+	}
+	writeRecordLen("unsafe.Sizeof(r)", "p", strs, w)
+	v.writeTypeTagLen(w)
+	v.writeChecksumLen(w)
+	writeReadRest(v.tagSize("unsafe.Sizeof(r)"), w)
+	return nil
+}
+
+// writeReadRest writes the end of a DecodeFrom function, which reads the
+// rest of a record of length n after its fixed size fields and decodes it.
+func writeReadRest(size string, w io.Writer) {
+	fmt.Fprintf(w, "\tif n > len(b) {\n")
+	fmt.Fprintf(w, "\t\tb = append(b, make([]byte, n-len(b))...)\n")
+	fmt.Fprintf(w, "\t\tif _, err := io.ReadFull(rd, b[%s:]); err == io.EOF {\n", size)
+	fmt.Fprintf(w, "\t\t\treturn io.ErrUnexpectedEOF\n")
+	fmt.Fprintf(w, "\t\t} else if err != nil {\n")
+	fmt.Fprintf(w, "\t\t\treturn err\n")
+	fmt.Fprintf(w, "\t\t}\n")
+	fmt.Fprintf(w, "\t}\n")
+	fmt.Fprintf(w, "\treturn o.Decode(b)\n")
+	fmt.Fprintf(w, "}\n\n")
+}
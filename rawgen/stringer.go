@@ -0,0 +1,131 @@
+package rawgen
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"io"
+	"strings"
+)
+
+// writeStringFunc writes a generated String method on an exported type that
+// prints the name and value of each field.
+func (v *visitor) writeStringFunc(exp string, node *ast.StructType, w io.Writer) error {
+	var names, verbs, args []string
+	var optional bytes.Buffer
+	for _, f := range node.Fields.List {
+		typ := tostr(f.Type)
+
+		// Embedded raw structs are printed with their own String method.
+		if len(f.Names) == 0 {
+			name, err := v.gotype(typ)
+			if err != nil {
+				return err
+			}
+			names, verbs, args = append(names, name), append(verbs, "%v"), append(args, "o."+name)
+		}
+		for _, n := range f.Names {
+			name := v.fieldname(n.Name)
+			if v.isOptional(n.Name) {
+				writeOptionalString(name, formatVerb(typ), "o."+name+" != nil", "*o."+name, &optional)
+				names, verbs, args = append(names, name), append(verbs, "%s"), append(args, "s"+name)
+				continue
+			}
+			names, verbs, args = append(names, name), append(verbs, formatVerb(typ)), append(args, "o."+name)
+		}
+	}
+	if err := checkStringConflict(names); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(w, "// String returns the name and value of each field of o.\n")
+	fmt.Fprintf(w, "func (o %s) String() string {\n", exp)
+	v.writeLoad("o", w)
+	optional.WriteTo(w)
+	writeSprintf(exp, names, verbs, args, w)
+	fmt.Fprintf(w, "}\n\n")
+
+	v.imports["fmt"] = true
+	return nil
+}
+
+// writeRawStringFunc writes a generated String method on a raw struct type
+// that prints the name and value of each field read through its accessors.
+// User-defined field types without accessors are left out.
+func (v *visitor) writeRawStringFunc(unexp string, node *ast.StructType, w io.Writer) error {
+	var names, verbs, args []string
+	var optional bytes.Buffer
+	for _, f := range node.Fields.List {
+		typ := tostr(f.Type)
+		if _, ok := v.codecs[typ]; ok && !v.hasEnd(typ) {
+			continue
+		}
+		for _, n := range f.Names {
+			name := v.fieldname(n.Name)
+			if v.isOptional(n.Name) {
+				writeOptionalString(name, formatVerb(typ), "r.Has"+name+"()", "r."+name+"()", &optional)
+				names, verbs, args = append(names, name), append(verbs, "%s"), append(args, "s"+name)
+				continue
+			}
+			names, verbs, args = append(names, name), append(verbs, formatVerb(typ)), append(args, "r."+name+"()")
+		}
+	}
+	if err := checkStringConflict(names); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(w, "// String returns the name and value of each field of r.\n")
+	fmt.Fprintf(w, "func (r *%s) String() string {\n", unexp)
+	optional.WriteTo(w)
+	writeSprintf(unexp, names, verbs, args, w)
+	fmt.Fprintf(w, "}\n\n")
+
+	v.imports["fmt"] = true
+	return nil
+}
+
+// writeSprintf writes a statement returning a struct formatted as
+// "Name{Field: value, ...}".
+func writeSprintf(typ string, names, verbs, args []string, w io.Writer) {
+	var format []string
+	for i := range names {
+		format = append(format, names[i]+": "+verbs[i])
+	}
+	fmt.Fprintf(w, "\treturn fmt.Sprintf(%q", typ+"{"+strings.Join(format, ", ")+"}")
+	for _, arg := range args {
+		fmt.Fprintf(w, ", %s", arg)
+	}
+	fmt.Fprintf(w, ")\n")
+}
+
+// writeOptionalString writes the statements formatting an optional field into
+// a local variable named after it. Unset fields are printed as "nil".
+func writeOptionalString(name, verb, cond, expr string, w io.Writer) {
+	fmt.Fprintf(w, "\ts%s := \"nil\"\n", name)
+	fmt.Fprintf(w, "\tif %s {\n", cond)
+	fmt.Fprintf(w, "\t\ts%s = fmt.Sprintf(%q, %s)\n", name, verb, expr)
+	fmt.Fprintf(w, "\t}\n")
+}
+
+// formatVerb returns the fmt verb used to print a field of a raw type.
+// Strings are quoted and binary data is printed as hex.
+func formatVerb(typ string) string {
+	switch {
+	case typ == "raw.String8", typ == "raw.String", typ == "raw.String32", typ == "raw.NullString", typ == "raw.StringList":
+		return "%q"
+	case typ == "raw.Bytes", arrayLen(typ) > 0:
+		return "%x"
+	}
+	return "%v"
+}
+
+// checkStringConflict returns an error if a field's exported name conflicts
+// with the generated String method.
+func checkStringConflict(names []string) error {
+	for _, name := range names {
+		if name == "String" {
+			return fmt.Errorf("exported name String conflicts with generated String method")
+		}
+	}
+	return nil
+}
@@ -0,0 +1,176 @@
+package rawgen
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/scanner"
+	"go/token"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// generatedHeader marks whole files generated by bolt-rawgen.
+const generatedHeader = "// This file has been generated by bolt-rawgen.\n"
+
+// Strip returns the Go source file, src, with all generated code removed
+// along with any imports that were only used by the generated code. Returns
+// the number of generated blocks removed.
+func Strip(src []byte) ([]byte, int, error) {
+	regions, err := generatedRegions(src)
+	if err != nil {
+		return nil, 0, err
+	} else if len(regions) == 0 {
+		return src, 0, nil
+	}
+	n := len(regions)
+	b, _ := strip(src)
+	b = append(b, '\n')
+
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, "", b, parser.ImportsOnly)
+	if err != nil {
+		return nil, 0, err
+	}
+	full, err := parser.ParseFile(token.NewFileSet(), "", b, 0)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	// Find the packages still referenced by the file.
+	used := make(map[string]bool)
+	ast.Inspect(full, func(node ast.Node) bool {
+		if sel, ok := node.(*ast.SelectorExpr); ok {
+			if x, ok := sel.X.(*ast.Ident); ok {
+				used[x.Name] = true
+			}
+		}
+		return true
+	})
+
+	// Remove unused imports that the generator adds, along with the
+	// whitespace preceding them, starting from the end of the file.
+	type span struct{ start, end int }
+	var spans []span
+	for _, decl := range f.Decls {
+		d, ok := decl.(*ast.GenDecl)
+		if !ok || d.Tok != token.IMPORT {
+			continue
+		}
+		for _, spec := range d.Specs {
+			spec := spec.(*ast.ImportSpec)
+			p, _ := strconv.Unquote(spec.Path.Value)
+			name, ok := generatedImports[p]
+			if !ok || spec.Name != nil || used[name] {
+				continue
+			}
+			var node ast.Node = spec
+			if !d.Lparen.IsValid() {
+				node = d
+			}
+			start, end := fset.Position(node.Pos()).Offset, fset.Position(node.End()).Offset
+			for start > 0 && bytes.IndexByte([]byte(" \t\n"), b[start-1]) != -1 {
+				start--
+			}
+			spans = append(spans, span{start, end})
+		}
+	}
+	sort.Slice(spans, func(i, j int) bool { return spans[i].start > spans[j].start })
+	for _, s := range spans {
+		b = append(b[:s.start], b[s.end:]...)
+	}
+	return b, n, nil
+}
+
+// strip returns src with the generated blocks removed.
+func strip(src []byte) ([]byte, error) {
+	regions, err := generatedRegions(src)
+	if err != nil {
+		return nil, err
+	}
+	var b []byte
+	var prev int
+	for _, r := range regions {
+		b = append(b, src[prev:r.start]...)
+		prev = r.end
+	}
+	b = append(b, src[prev:]...)
+	return bytes.TrimRight(b, " \n\r"), nil
+}
+
+// region is a range of byte offsets within a source file.
+type region struct{ start, end int }
+
+// generatedRegions returns the blocks of src between begin/end pragma
+// comments. The source is scanned, rather than parsed, so that blocks are
+// found even when the generated code is invalid, while markers within strings
+// and other comments are ignored. Returns an error if the markers are nested
+// or unbalanced.
+func generatedRegions(src []byte) ([]region, error) {
+	fset := token.NewFileSet()
+	file := fset.AddFile("", fset.Base(), len(src))
+	var s scanner.Scanner
+	s.Init(file, src, nil, scanner.ScanComments)
+
+	var regions []region
+	start := -1
+	for {
+		pos, tok, lit := s.Scan()
+		if tok == token.EOF {
+			break
+		} else if tok != token.COMMENT {
+			continue
+		}
+		switch strings.TrimRight(lit, " \t") {
+		case "//raw:codegen:begin":
+			if start != -1 {
+				return nil, fmt.Errorf("line %d: nested //raw:codegen:begin", fset.Position(pos).Line)
+			}
+			start = file.Offset(pos)
+		case "//raw:codegen:end":
+			if start == -1 {
+				return nil, fmt.Errorf("line %d: //raw:codegen:end without //raw:codegen:begin", fset.Position(pos).Line)
+			}
+			regions = append(regions, region{start, file.Offset(pos) + len(lit)})
+			start = -1
+		}
+	}
+	if start != -1 {
+		return nil, fmt.Errorf("line %d: //raw:codegen:begin without //raw:codegen:end", fset.Position(file.Pos(start)).Line)
+	}
+	return regions, nil
+}
+
+// generatedImports are the packages imported by generated code, mapped to
+// their package names.
+var generatedImports = map[string]string{
+	"bytes":               "bytes",
+	"database/sql/driver": "driver",
+	"encoding":            "encoding",
+	"encoding/binary":     "binary",
+	"encoding/json":       "json",
+	"errors":              "errors",
+	"fmt":                 "fmt",
+	"hash/fnv":            "fnv",
+	"io":                  "io",
+	"math":                "math",
+	"math/big":            "big",
+	"net/netip":           "netip",
+	"reflect":             "reflect",
+	"slices":              "slices",
+	"strings":             "strings",
+	"sync":                "sync",
+	"time":                "time",
+	"unicode/utf8":        "utf8",
+	BoltImportPath:        "bolt",
+	TimestampImportPath:   "timestamppb",
+	DurationImportPath:    "durationpb",
+}
+
+// IsGeneratedFile returns true if src is a whole file generated by
+// bolt-rawgen, such as a benchmark file.
+func IsGeneratedFile(src []byte) bool {
+	return bytes.Contains(src, []byte(generatedHeader))
+}
@@ -0,0 +1,101 @@
+package rawgen
+
+import (
+	"crypto/sha1"
+	"encoding/binary"
+	"fmt"
+	"go/ast"
+	"io"
+)
+
+// typeTagSize is the size of raw.TypeTagSize, for portable code that reads
+// records at constant offsets.
+const typeTagSize = 4
+
+// typeTag returns the type tag of a raw struct, the first four bytes of a hash
+// of its name and layout, so records of other raw structs or of an earlier
+// layout of the same raw struct are rejected.
+func typeTag(name string, node *ast.StructType) uint32 {
+	h := sha1.New()
+	fmt.Fprintf(h, "%s %s", name, fingerprint(node))
+	return binary.BigEndian.Uint32(h.Sum(nil))
+}
+
+// writeTypeTagConst writes a generated constant holding the type tag of the
+// raw struct being generated.
+func (v *visitor) writeTypeTagConst(unexp, exp string, node *ast.StructType, w io.Writer) {
+	fmt.Fprintf(w, "// %s identifies encoded %s records, which start with it.\n", v.tag, exp)
+	fmt.Fprintf(w, "const %s = 0x%08x\n\n", v.tag, typeTag(unexp, node))
+}
+
+// tagOffset returns the expression of the offset of a record after its type
+// tag, or "0" if records aren't tagged.
+func (v *visitor) tagOffset() string {
+	if v.tag != "" {
+		return v.pkg + ".TypeTagSize"
+	}
+	return "0"
+}
+
+// untagged returns the expression of a slice, b, of an encoded record without
+// its type tag.
+func (v *visitor) untagged(b string) string {
+	if v.tag != "" {
+		return b + "[" + v.tagOffset() + ":]"
+	}
+	return b
+}
+
+// writeUnwrap writes the statements, at the start of a generated function
+// reading an encoded record, b, that verify the checksum and type tag around
+// the record and then strip them from b. The error is preceded by the zero
+// values in ret.
+func (v *visitor) writeUnwrap(ret string, w io.Writer) {
+	v.writeChecksumVerify(ret, w)
+	if v.tag == "" {
+		return
+	}
+	op := ":="
+	if v.Checksum {
+		op = "="
+	}
+	fmt.Fprintf(w, "\tb, err %s %s.VerifyTypeTag(b, %s)\n", op, v.pkg, v.tag)
+	fmt.Fprintf(w, "\tif err != nil {\n")
+	fmt.Fprintf(w, "\t\treturn %serr\n", ret)
+	fmt.Fprintf(w, "\t}\n")
+}
+
+// writeTypeTagLen writes a statement adding the size of the type tag to n, the
+// length of an encoded record, when records are tagged.
+func (v *visitor) writeTypeTagLen(w io.Writer) {
+	if v.tag != "" {
+		fmt.Fprintf(w, "\tn += %s.TypeTagSize\n", v.pkg)
+	}
+}
+
+// writeTypeTagAppend writes a statement, at the start of an AppendEncode
+// function, appending the type tag of a record to dst when records are tagged.
+func (v *visitor) writeTypeTagAppend(w io.Writer) {
+	if v.tag != "" {
+		fmt.Fprintf(w, "\tdst = %s.AppendTypeTag(dst, %s)\n", v.pkg, v.tag)
+	}
+}
+
+// tagStart returns the expression of the start of a record, including its
+// type tag, in an AppendEncode function where start is the offset of the
+// record after its tag.
+func (v *visitor) tagStart() string {
+	if v.tag != "" {
+		return "start-" + v.tagOffset()
+	}
+	return "start"
+}
+
+// tagSize returns the expression of size, the size of a record, plus the size
+// of its type tag when records are tagged.
+func (v *visitor) tagSize(size string) string {
+	if v.tag != "" {
+		return v.pkg + ".TypeTagSize+" + size
+	}
+	return size
+}
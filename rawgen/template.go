@@ -0,0 +1,65 @@
+package rawgen
+
+import (
+	"go/ast"
+)
+
+// Struct describes a raw struct type. It is the data passed to a custom
+// template for each raw struct.
+type Struct struct {
+	Name     string            `json:"name"`              // name of the unexported raw struct
+	Exported string            `json:"exported"`          // name of the exported type
+	Package  string            `json:"-"`                 // name of the raw package within the file
+	Pragmas  map[string]string `json:"pragmas,omitempty"` // "//raw:" pragmas set on the struct
+	Size     int               `json:"size"`              // size, in bytes, of the raw struct
+	Fields   []*Field          `json:"fields"`
+}
+
+// Field describes a single field of a raw struct.
+type Field struct {
+	Name     string            `json:"name"`          // name of the raw field
+	Exported string            `json:"exported"`      // name of the exported field and accessor
+	RawType  string            `json:"rawType"`       // raw type, e.g. "raw.String"
+	GoType   string            `json:"goType"`        // exported type, e.g. "string"
+	Offset   int               `json:"offset"`        // offset, in bytes, within the raw struct
+	Size     int               `json:"size"`          // size, in bytes, within the raw struct
+	Tag      map[string]string `json:"tag,omitempty"` // options set in the field's raw struct tag
+}
+
+// newStruct returns the template data for the fields of a raw struct, node,
+// with offsets and sizes from the layout of the full struct, which includes
+// the skipped, blank, and presence fields left out of node. Offsets and sizes
+// are those of 64-bit platforms, or of the platform set by Arch.
+func (v *visitor) newStruct(unexp, exp string, node, full *ast.StructType, pragmas map[string]string) (*Struct, error) {
+	s := &Struct{Name: unexp, Exported: exp, Package: v.pkg, Pragmas: pragmas}
+
+	l, _ := v.layout(full)
+	s.Size = l.size
+	slots := make(map[string]slot)
+	for _, sl := range l.slots {
+		slots[sl.ident.Name] = sl
+	}
+	for _, f := range node.Fields.List {
+		typ, err := v.gotype(tostr(f.Type))
+		if err != nil {
+			return nil, err
+		}
+		for _, n := range f.Names {
+			gotyp := typ
+			if v.isOptional(n.Name) {
+				gotyp = "*" + typ
+			}
+			sl := slots[n.Name]
+			s.Fields = append(s.Fields, &Field{
+				Name:     n.Name,
+				Exported: v.fieldname(n.Name),
+				RawType:  tostr(f.Type),
+				GoType:   gotyp,
+				Offset:   sl.offset,
+				Size:     sl.size,
+				Tag:      parseTag(f),
+			})
+		}
+	}
+	return s, nil
+}
@@ -0,0 +1,206 @@
+package rawgen
+
+import (
+	"fmt"
+	"go/ast"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// limitKind returns how the min and max tags of a field of a raw type are
+// compared: "value" for numbers and durations, "len" for strings, binary
+// data, lists, and slices, or a blank string if they aren't supported.
+func limitKind(typ string) string {
+	if value, ok := nullTypes[typ]; ok {
+		typ = value
+	}
+	switch typ {
+	case "int8", "int16", "int32", "int64", "uint8", "uint16", "uint32", "uint64", "float32", "float64", "int", "uint", "raw.Duration":
+		return "value"
+	case "raw.String8", "raw.String", "raw.String32", "raw.Bytes", "raw.StringList":
+		return "len"
+	}
+	if sliceElem(typ) != "" {
+		return "len"
+	}
+	return ""
+}
+
+// validateLimits returns an error if the min and max tags of a field aren't
+// valid for its type. Numbers and durations are limited to the values of
+// their type and lengths can't be negative.
+func validateLimits(f *ast.Field) error {
+	tag, typ := parseTag(f), tostr(f.Type)
+	for _, key := range []string{"min", "max"} {
+		v, ok := tag[key]
+		if !ok {
+			continue
+		}
+		switch limitKind(typ) {
+		case "value":
+			if value, ok := nullTypes[typ]; ok {
+				typ = value
+			}
+			if enumValues(f) != nil {
+				return fmt.Errorf("%s is not supported for enum fields", key)
+			} else if err := validateDefault(typ, v); err != nil {
+				return fmt.Errorf("invalid %s: %s", key, err)
+			}
+		case "len":
+			if _, err := strconv.ParseUint(v, 10, 32); err != nil {
+				return fmt.Errorf("invalid %s: %s", key, err)
+			}
+		default:
+			return fmt.Errorf("%s is not supported for %s fields", key, typ)
+		}
+	}
+	if v, ok := tag["nonzero"]; ok && v != "" {
+		return fmt.Errorf("nonzero has no value")
+	}
+	return nil
+}
+
+// hasConstraints returns true if a field of a raw struct is tagged with min,
+// max, or nonzero.
+func hasConstraints(node *ast.StructType) bool {
+	for _, f := range node.Fields.List {
+		tag := parseTag(f)
+		for _, key := range []string{"min", "max", "nonzero"} {
+			if _, ok := tag[key]; ok && len(f.Names) > 0 {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// writeValidateFunc writes a generated Validate method returning an error if
+// a field of an exported value is outside of the limits set by its tags.
+// Limits on optional and null fields only apply when they're set, unless
+// they're also tagged with nonzero. Nothing is written if no field has one.
+func (v *visitor) writeValidateFunc(exp string, node *ast.StructType, w io.Writer) error {
+	if !hasConstraints(node) {
+		return nil
+	}
+	for _, f := range node.Fields.List {
+		for _, n := range f.Names {
+			if v.fieldname(n.Name) == "Validate" {
+				return fmt.Errorf("%s: exported name Validate conflicts with generated Validate method", n.Name)
+			}
+		}
+	}
+	fmt.Fprintf(w, "// Validate returns an error wrapping %s.ErrInvalidField if a field of o\n", v.pkg)
+	fmt.Fprintf(w, "// is outside of the limits set by its tags.\n")
+	fmt.Fprintf(w, "func (o *%s) Validate() error {\n", exp)
+	v.writeLoad("o", w)
+	for _, f := range node.Fields.List {
+		tag, typ := parseTag(f), tostr(f.Type)
+		for _, n := range f.Names {
+			name := v.fieldname(n.Name)
+			gotyp, err := v.fieldType(n.Name, typ)
+			if err != nil {
+				return err
+			}
+
+			// Optional fields are checked through a copy of their value
+			// when they're set.
+			var conds, msgs []string
+			expr, indent := "o."+name, "\t"
+			if v.isOptional(n.Name) {
+				expr, indent = "x", "\t\t"
+			}
+			if _, ok := tag["nonzero"]; ok {
+				conds, msgs = append(conds, nonzeroCond(gotyp, expr)), append(msgs, name+" must not be zero")
+			}
+			for _, key := range []string{"min", "max"} {
+				lit, ok := tag[key]
+				if !ok {
+					continue
+				}
+				value, op, msg := lit, "<", "at least"
+				if key == "max" {
+					op, msg = ">", "at most"
+				}
+				if limitKind(typ) == "len" {
+					conds, msgs = append(conds, fmt.Sprintf("len(%s) %s %s", expr, op, value)), append(msgs, fmt.Sprintf("length of %s must be %s %s", name, msg, lit))
+					continue
+				} else if typ == "raw.Duration" {
+					d, _ := time.ParseDuration(lit)
+					value = fmt.Sprintf("time.Duration(%d)", d)
+				}
+				conds, msgs = append(conds, fmt.Sprintf("%s %s %s", expr, op, value)), append(msgs, fmt.Sprintf("%s must be %s %s", name, msg, lit))
+			}
+			if len(conds) == 0 {
+				continue
+			}
+
+			if v.isOptional(n.Name) {
+				if _, ok := tag["nonzero"]; ok {
+					fmt.Fprintf(w, "\tif o.%s == nil {\n", name)
+					fmt.Fprintf(w, "\t\treturn fmt.Errorf(\"%%w: %s\", %s.ErrInvalidField)\n", msgs[0], v.pkg)
+					fmt.Fprintf(w, "\t}\n")
+				}
+				fmt.Fprintf(w, "\tif o.%s != nil {\n", name)
+				fmt.Fprintf(w, "\t\tx := *o.%s\n", name)
+			}
+			for i, cond := range conds {
+				fmt.Fprintf(w, "%sif %s {\n", indent, cond)
+				fmt.Fprintf(w, "%s\treturn fmt.Errorf(\"%%w: %s\", %s.ErrInvalidField)\n", indent, msgs[i], v.pkg)
+				fmt.Fprintf(w, "%s}\n", indent)
+			}
+			if v.isOptional(n.Name) {
+				fmt.Fprintf(w, "\t}\n")
+			}
+		}
+	}
+	fmt.Fprintf(w, "\treturn nil\n")
+	fmt.Fprintf(w, "}\n\n")
+	v.imports["fmt"] = true
+	return nil
+}
+
+// nonzeroCond returns a condition that is true if expr, a value of an
+// exported type, is its zero value.
+func nonzeroCond(gotyp, expr string) string {
+	switch zero := zeroValue(gotyp); {
+	case gotyp == "time.Time":
+		return expr + ".IsZero()"
+	case gotyp == "netip.Addr":
+		return "!" + expr + ".IsValid()"
+	case zero == "nil":
+		return "len(" + expr + ") == 0"
+	case strings.HasSuffix(zero, "}"):
+		return expr + " == (" + zero + ")"
+	default:
+		return expr + " == " + zero
+	}
+}
+
+// decodeResult returns the expression returned by a generated Decode method
+// that decoded a record, which validates the decoded value if the raw struct
+// has the "validate" pragma.
+func (v *visitor) decodeResult() string {
+	if v.validate {
+		return "o.Validate()"
+	}
+	return "nil"
+}
+
+// writeValidateCheck writes a statement returning the error from validating
+// an exported value, o, before it's encoded if the raw struct has the
+// "validate" pragma, or from checking its int and uint fields if they can
+// overflow. The error is preceded by the zero values in ret.
+func (v *visitor) writeValidateCheck(ret string, w io.Writer) {
+	if v.narrowInts() {
+		fmt.Fprintf(w, "\tif err := o.checkOverflow(); err != nil {\n")
+		fmt.Fprintf(w, "\t\treturn %serr\n", ret)
+		fmt.Fprintf(w, "\t}\n")
+	}
+	if v.validate {
+		fmt.Fprintf(w, "\tif err := o.Validate(); err != nil {\n")
+		fmt.Fprintf(w, "\t\treturn %serr\n", ret)
+		fmt.Fprintf(w, "\t}\n")
+	}
+}
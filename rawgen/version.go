@@ -0,0 +1,139 @@
+package rawgen
+
+import (
+	"fmt"
+	"go/ast"
+	"go/token"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// parseVersion returns the version set by the version pragma of a raw struct.
+// Versioned structs must start with a version field so the version is the
+// first byte of every record. Returns zero if the struct is not versioned.
+func parseVersion(node *ast.StructType, pragmas map[string]string) (int, error) {
+	value, ok := pragmas["version"]
+	if !ok {
+		return 0, nil
+	}
+	version, err := strconv.Atoi(value)
+	if err != nil || version < 1 || version > 255 {
+		return 0, fmt.Errorf("invalid version: %q", value)
+	}
+	if list := node.Fields.List; len(list) == 0 || len(list[0].Names) != 1 || list[0].Names[0].Name != "version" || tostr(list[0].Type) != "uint8" {
+		return 0, fmt.Errorf("version requires a first field: version uint8")
+	}
+	return version, nil
+}
+
+// withoutVersion returns a struct without its version field, which is set by
+// the generated code instead of the exported type.
+func withoutVersion(node *ast.StructType) *ast.StructType {
+	return &ast.StructType{Struct: node.Struct, Fields: &ast.FieldList{Opening: node.Fields.Opening, List: node.Fields.List[1:], Closing: node.Fields.Closing}}
+}
+
+// olderVersions returns the older versions of a raw struct declared in the
+// file, mapped to their type names. Older versions are named after the
+// struct with a "V" and their version as a suffix, e.g. userV1.
+func (v *visitor) olderVersions(unexp string, version int) (map[int]string, error) {
+	m := make(map[int]string)
+	if v.file == nil {
+		return m, nil
+	}
+	for _, decl := range v.file.Decls {
+		d, ok := decl.(*ast.GenDecl)
+		if !ok || d.Tok != token.TYPE {
+			continue
+		}
+		for _, spec := range d.Specs {
+			spec := spec.(*ast.TypeSpec)
+			if !strings.HasPrefix(spec.Name.Name, unexp+"V") {
+				continue
+			}
+			n, err := strconv.Atoi(strings.TrimPrefix(spec.Name.Name, unexp+"V"))
+			if err != nil {
+				continue
+			}
+
+			doc := spec.Doc
+			if doc == nil && len(d.Specs) == 1 {
+				doc = d.Doc
+			}
+			if value, ok := parsePragmas(doc)["version"]; !ok || value != strconv.Itoa(n) {
+				return nil, fmt.Errorf("%s: version pragma must be %d", spec.Name.Name, n)
+			} else if n >= version {
+				return nil, fmt.Errorf("%s: version %d is not older than %s", spec.Name.Name, n, unexp)
+			}
+			m[n] = spec.Name.Name
+		}
+	}
+	return m, nil
+}
+
+// isOlderVersion returns true if a raw struct is an older version of another
+// struct, based on its name.
+func isOlderVersion(unexp string, version int) bool {
+	return strings.HasSuffix(unexp, "V"+strconv.Itoa(version))
+}
+
+// writeDecodeAnyFunc writes a generated function decoding a record of any
+// version of a raw struct. Older records are decoded with the type of their
+// version and then upgraded by user-defined migration hooks, one version at
+// a time, e.g. MigrateUserV1toV2(*UserV1) *UserV2. Fields with a default
+// that the hooks leave unset are set to it.
+func (v *visitor) writeDecodeAnyFunc(unexp, exp string, version int, node *ast.StructType, w io.Writer) error {
+	older, err := v.olderVersions(unexp, version)
+	if err != nil {
+		return err
+	}
+	versions := make([]int, 0, len(older))
+	for n := range older {
+		versions = append(versions, n)
+	}
+	sort.Ints(versions)
+	versions = append(versions, version)
+
+	// typename returns the exported type of the i-th version.
+	typename := func(i int) string {
+		if i == len(versions)-1 {
+			return exp
+		}
+		return tocamelcase(older[versions[i]])
+	}
+
+	fmt.Fprintf(w, "// DecodeAny decodes a record of any version of %s. Records of older\n", exp)
+	fmt.Fprintf(w, "// versions are upgraded to version %d by their migration hooks.\n", version)
+	fmt.Fprintf(w, "func (o *%s) DecodeAny(b []byte) error {\n", exp)
+	if v.tag != "" {
+		fmt.Fprintf(w, "\tif len(b) <= %s {\n", v.tagOffset())
+	} else {
+		fmt.Fprintf(w, "\tif len(b) == 0 {\n")
+	}
+	fmt.Fprintf(w, "\t\treturn io.ErrUnexpectedEOF\n")
+	fmt.Fprintf(w, "\t}\n")
+	if len(versions) > 1 {
+		fmt.Fprintf(w, "\tswitch b[%s] {\n", v.tagOffset())
+		for i, n := range versions[:len(versions)-1] {
+			fmt.Fprintf(w, "\tcase %d:\n", n)
+			fmt.Fprintf(w, "\t\tvar v%d %s\n", n, typename(i))
+			fmt.Fprintf(w, "\t\tif err := v%d.Decode(b); err != nil {\n", n)
+			fmt.Fprintf(w, "\t\t\treturn err\n")
+			fmt.Fprintf(w, "\t\t}\n")
+			prev := fmt.Sprintf("&v%d", n)
+			for j := i; j < len(versions)-2; j++ {
+				fmt.Fprintf(w, "\t\tv%d := Migrate%sV%dtoV%d(%s)\n", versions[j+1], exp, versions[j], versions[j+1], prev)
+				prev = fmt.Sprintf("v%d", versions[j+1])
+			}
+			fmt.Fprintf(w, "\t\t*o = *Migrate%sV%dtoV%d(%s)\n", exp, versions[len(versions)-2], version, prev)
+			v.writeApplyDefaults(node, w)
+			fmt.Fprintf(w, "\t\treturn %s\n", v.decodeResult())
+		}
+		fmt.Fprintf(w, "\t}\n")
+	}
+	fmt.Fprintf(w, "\treturn o.Decode(b)\n")
+	fmt.Fprintf(w, "}\n\n")
+	v.imports["io"] = true
+	return nil
+}
@@ -0,0 +1,63 @@
+package rawgen
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"io"
+)
+
+// writeViewType writes a generated view type wrapping an encoded record with
+// a method reading each field in place, for reading a few fields of many
+// records without decoding them. The record is checked once when the view is
+// created so its methods can't read outside of it.
+func (v *visitor) writeViewType(unexp, exp string, node *ast.StructType, w io.Writer) error {
+	fmt.Fprintf(w, "// %sView reads the fields of an encoded %s in place. Slices share memory\n", exp, exp)
+	fmt.Fprintf(w, "// with the record.\n")
+	fmt.Fprintf(w, "type %sView struct {\n", exp)
+	fmt.Fprintf(w, "\tb []byte\n")
+	fmt.Fprintf(w, "}\n\n")
+
+	fmt.Fprintf(w, "// View%s returns a view of an encoded %s. Returns io.ErrUnexpectedEOF\n", exp, exp)
+	fmt.Fprintf(w, "// if the record is too short or corrupt.\n")
+	fmt.Fprintf(w, "func View%s(b []byte) (%sView, error) {\n", exp, exp)
+	v.writeUnwrap(exp+"View{}, ", w)
+	if v.version > 0 {
+		fmt.Fprintf(w, "\tif len(b) > 0 && b[0] != %d {\n", v.version)
+		fmt.Fprintf(w, "\t\treturn %sView{}, %s.ErrVersion\n", exp, v.pkg)
+		fmt.Fprintf(w, "\t}\n")
+	}
+	fmt.Fprintf(w, "\tif len(b) < int(unsafe.Sizeof(%s{})) {\n", unexp)
+	fmt.Fprintf(w, "\t\treturn %sView{}, io.ErrUnexpectedEOF\n", exp)
+	fmt.Fprintf(w, "\t}\n")
+	var buf bytes.Buffer
+	writeBoundsCheck(node, exp+"View{}, io.ErrUnexpectedEOF", &buf)
+	v.writeEnumCheck(node, exp+"View{}, "+v.pkg+".ErrInvalidEnum", &buf)
+	if buf.Len() > 0 {
+		fmt.Fprintf(w, "\tr := (*%s)(unsafe.Pointer(&b[0]))\n", unexp)
+		w.Write(buf.Bytes())
+	}
+	fmt.Fprintf(w, "\treturn %sView{b: b}, nil\n", exp)
+	fmt.Fprintf(w, "}\n\n")
+	v.imports["io"] = true
+
+	for _, f := range node.Fields.List {
+		typ := tostr(f.Type)
+		for _, n := range f.Names {
+			gotyp, err := v.fieldType(n.Name, typ)
+			if err != nil {
+				return err
+			}
+			name := v.fieldname(n.Name)
+			if v.isOptional(n.Name) {
+				fmt.Fprintf(w, "func (v %sView) Has%s() bool { return (*%s)(unsafe.Pointer(&v.b[0])).Has%s() }\n", exp, name, unexp, name)
+			}
+			if _, ok := v.codecs[typ]; ok {
+				fmt.Fprintf(w, "func (v %sView) %s() %s { return (*%s)(unsafe.Pointer(&v.b[0])).%s.Decode(v.b) }\n\n", exp, name, gotyp, unexp, n.Name)
+			} else {
+				fmt.Fprintf(w, "func (v %sView) %s() %s { return (*%s)(unsafe.Pointer(&v.b[0])).%s() }\n\n", exp, name, gotyp, unexp, name)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,326 @@
+package raw_test
+
+//
+// DO NOT CHANGE
+// This file has been generated by bolt-rawgen.
+//
+
+import (
+	"encoding"
+	"fmt"
+	"io"
+	"strings"
+	"unsafe"
+
+	"github.com/boltdb/raw"
+)
+
+//raw:codegen:begin
+
+//
+// DO NOT CHANGE
+// This section has been generated by bolt-rawgen.
+//
+
+type Record struct {
+	MyInt     int
+	MyString1 string
+	MyString2 string
+}
+
+func (o *Record) Encode() []byte {
+	var r record
+	b := make([]byte, unsafe.Sizeof(r), int(unsafe.Sizeof(r)))
+	r.myInt = int64(o.MyInt)
+	r.myString1.Encode(o.MyString1, &b)
+	r.myString2.Encode(o.MyString2, &b)
+	copy(b, unsafe.Slice((*byte)(unsafe.Pointer(&r)), unsafe.Sizeof(r)))
+	return b
+}
+
+// AppendEncode appends the encoding of o to dst and returns the extended
+// slice.
+func (o *Record) AppendEncode(dst []byte) []byte {
+	var r record
+	start := len(dst)
+	dst = append(dst, make([]byte, unsafe.Sizeof(r))...)
+	b := dst[start:]
+	r.myInt = int64(o.MyInt)
+	r.myString1.Encode(o.MyString1, &b)
+	r.myString2.Encode(o.MyString2, &b)
+	copy(b, unsafe.Slice((*byte)(unsafe.Pointer(&r)), unsafe.Sizeof(r)))
+	return append(dst[:start], b...)
+}
+
+// EncodeArena encodes o into a slice from a, which is valid until a is reset.
+func (o *Record) EncodeArena(a *raw.Arena) []byte {
+	var r record
+	n := int(unsafe.Sizeof(r)) + len(o.MyString1) + len(o.MyString2)
+	b := a.Alloc(int(unsafe.Sizeof(r)), n)
+	r.myInt = int64(o.MyInt)
+	r.myString1.Encode(o.MyString1, &b)
+	r.myString2.Encode(o.MyString2, &b)
+	copy(b, unsafe.Slice((*byte)(unsafe.Pointer(&r)), unsafe.Sizeof(r)))
+	return b
+}
+
+// RecordEncoder encodes Record records into a single reusable buffer.
+type RecordEncoder struct {
+	buf []byte
+}
+
+// NewRecordEncoder returns an encoder with an empty buffer.
+func NewRecordEncoder() *RecordEncoder {
+	return &RecordEncoder{}
+}
+
+// Append appends the encoding of o to the buffer.
+func (e *RecordEncoder) Append(o *Record) {
+	e.buf = o.AppendEncode(e.buf)
+}
+
+// Bytes returns the records encoded since the last reset.
+func (e *RecordEncoder) Bytes() []byte { return e.buf }
+
+// Reset empties the buffer, keeping its memory for reuse.
+func (e *RecordEncoder) Reset() { e.buf = e.buf[:0] }
+
+// EncodeTo writes the encoding of o to w. Returns the number of bytes written.
+func (o *Record) EncodeTo(w io.Writer) (int, error) {
+	var r record
+	off := int(unsafe.Sizeof(r))
+	r.myInt = int64(o.MyInt)
+	raw.CheckOffset(off, len(o.MyString1), 16)
+	r.myString1.Offset, r.myString1.Length = uint16(off), uint16(len(o.MyString1))
+	off += len(o.MyString1)
+	raw.CheckOffset(off, len(o.MyString2), 16)
+	r.myString2.Offset, r.myString2.Length = uint16(off), uint16(len(o.MyString2))
+	off += len(o.MyString2)
+	n, err := w.Write(unsafe.Slice((*byte)(unsafe.Pointer(&r)), unsafe.Sizeof(r)))
+	if err != nil {
+		return n, err
+	}
+	var m int
+	m, err = io.WriteString(w, o.MyString1)
+	if n += m; err != nil {
+		return n, err
+	}
+	m, err = io.WriteString(w, o.MyString2)
+	if n += m; err != nil {
+		return n, err
+	}
+	return n, nil
+}
+
+func (o *Record) Decode(b []byte) error {
+	if len(b) < int(unsafe.Sizeof(record{})) {
+		return io.ErrUnexpectedEOF
+	}
+	r := (*record)(unsafe.Pointer(&b[0]))
+	if r.myString1.End() > len(b) || r.myString2.End() > len(b) {
+		return io.ErrUnexpectedEOF
+	}
+	o.MyInt = r.MyInt()
+	o.MyString1 = r.MyString1()
+	o.MyString2 = r.MyString2()
+	return nil
+}
+
+// RecordIterator iterates over Record records encoded one after another.
+type RecordIterator struct {
+	b   []byte
+	err error
+}
+
+func IterRecord(b []byte) *RecordIterator {
+	return &RecordIterator{b: b}
+}
+
+// Next decodes the next record. Returns false at the end of the records or
+// if the remaining bytes are not a valid record.
+func (it *RecordIterator) Next() (*Record, bool) {
+	if len(it.b) == 0 || it.err != nil {
+		return nil, false
+	}
+	var r record
+	if len(it.b) < int(unsafe.Sizeof(r)) {
+		it.err = io.ErrUnexpectedEOF
+		return nil, false
+	}
+	p := (*record)(unsafe.Pointer(&it.b[0]))
+	n := int(unsafe.Sizeof(r))
+	if end := p.myString1.End(); end > n {
+		n = end
+	}
+	if end := p.myString2.End(); end > n {
+		n = end
+	}
+	if n > len(it.b) {
+		it.err = io.ErrUnexpectedEOF
+		return nil, false
+	}
+	o := &Record{}
+	if err := o.Decode(it.b[:n]); err != nil {
+		it.err = err
+		return nil, false
+	}
+	it.b = it.b[n:]
+	return o, true
+}
+
+// All returns a function for ranging over the remaining records.
+func (it *RecordIterator) All() func(yield func(*Record) bool) {
+	return func(yield func(*Record) bool) {
+		for {
+			if o, ok := it.Next(); !ok || !yield(o) {
+				return
+			}
+		}
+	}
+}
+
+// Err returns the error that stopped iteration, if any.
+func (it *RecordIterator) Err() error { return it.err }
+
+// DecodeFrom reads a single record from rd and decodes it into o. Returns
+// io.EOF if there are no more records and io.ErrUnexpectedEOF if rd ends
+// partway through a record.
+func (o *Record) DecodeFrom(rd io.Reader) error {
+	var r record
+	b := make([]byte, unsafe.Sizeof(r))
+	if _, err := io.ReadFull(rd, b); err != nil {
+		return err
+	}
+	p := (*record)(unsafe.Pointer(&b[0]))
+	n := int(unsafe.Sizeof(r))
+	if end := p.myString1.End(); end > n {
+		n = end
+	}
+	if end := p.myString2.End(); end > n {
+		n = end
+	}
+	if n > len(b) {
+		b = append(b, make([]byte, n-len(b))...)
+		if _, err := io.ReadFull(rd, b[unsafe.Sizeof(r):]); err == io.EOF {
+			return io.ErrUnexpectedEOF
+		} else if err != nil {
+			return err
+		}
+	}
+	return o.Decode(b)
+}
+
+func (r *record) MyInt() int { return int(r.myInt) }
+
+func (r *record) MyString1() string {
+	return r.myString1.String(unsafe.Slice((*byte)(unsafe.Pointer(r)), r.myString1.End()))
+}
+func (r *record) MyString1Bytes() []byte {
+	return r.myString1.Bytes(unsafe.Slice((*byte)(unsafe.Pointer(r)), r.myString1.End()))
+}
+
+func (r *record) MyString2() string {
+	return r.myString2.String(unsafe.Slice((*byte)(unsafe.Pointer(r)), r.myString2.End()))
+}
+func (r *record) MyString2Bytes() []byte {
+	return r.myString2.Bytes(unsafe.Slice((*byte)(unsafe.Pointer(r)), r.myString2.End()))
+}
+
+// String returns the name and value of each field of r.
+func (r *record) String() string {
+	return fmt.Sprintf("record{MyInt: %v, MyString1: %q, MyString2: %q}", r.MyInt(), r.MyString1(), r.MyString2())
+}
+
+// PatchRecordMyInt overwrites the MyInt field of an encoded Record in place.
+func PatchRecordMyInt(b []byte, v int) error {
+	if len(b) < int(unsafe.Sizeof(record{})) {
+		return io.ErrUnexpectedEOF
+	}
+	(*record)(unsafe.Pointer(&b[0])).myInt = int64(v)
+	return nil
+}
+
+// RecordMyInt returns the MyInt field of an encoded Record, or the zero value if the
+// record is too short or corrupt.
+func RecordMyInt(b []byte) (x int) {
+	if len(b) < int(unsafe.Sizeof(record{})) {
+		return x
+	}
+	r := (*record)(unsafe.Pointer(&b[0]))
+	return r.MyInt()
+}
+
+// RecordMyString1 returns the MyString1 field of an encoded Record, or the zero value if the
+// record is too short or corrupt.
+func RecordMyString1(b []byte) (x string) {
+	if len(b) < int(unsafe.Sizeof(record{})) {
+		return x
+	}
+	r := (*record)(unsafe.Pointer(&b[0]))
+	if r.myString1.End() > len(b) {
+		return x
+	}
+	return r.MyString1()
+}
+
+// RecordMyString2 returns the MyString2 field of an encoded Record, or the zero value if the
+// record is too short or corrupt.
+func RecordMyString2(b []byte) (x string) {
+	if len(b) < int(unsafe.Sizeof(record{})) {
+		return x
+	}
+	r := (*record)(unsafe.Pointer(&b[0]))
+	if r.myString2.End() > len(b) {
+		return x
+	}
+	return r.MyString2()
+}
+
+// RecordView reads the fields of an encoded Record in place. Slices share memory
+// with the record.
+type RecordView struct {
+	b []byte
+}
+
+// ViewRecord returns a view of an encoded Record. Returns io.ErrUnexpectedEOF
+// if the record is too short or corrupt.
+func ViewRecord(b []byte) (RecordView, error) {
+	if len(b) < int(unsafe.Sizeof(record{})) {
+		return RecordView{}, io.ErrUnexpectedEOF
+	}
+	r := (*record)(unsafe.Pointer(&b[0]))
+	if r.myString1.End() > len(b) || r.myString2.End() > len(b) {
+		return RecordView{}, io.ErrUnexpectedEOF
+	}
+	return RecordView{b: b}, nil
+}
+
+func (v RecordView) MyInt() int { return (*record)(unsafe.Pointer(&v.b[0])).MyInt() }
+
+func (v RecordView) MyString1() string { return (*record)(unsafe.Pointer(&v.b[0])).MyString1() }
+
+func (v RecordView) MyString2() string { return (*record)(unsafe.Pointer(&v.b[0])).MyString2() }
+
+var _ encoding.BinaryMarshaler = (*Record)(nil)
+var _ encoding.BinaryUnmarshaler = (*Record)(nil)
+
+// MarshalBinary implements encoding.BinaryMarshaler.
+func (o *Record) MarshalBinary() ([]byte, error) { return o.Encode(), nil }
+
+// UnmarshalBinary implements encoding.BinaryUnmarshaler.
+func (o *Record) UnmarshalBinary(b []byte) error { return o.Decode(b) }
+
+// String returns the name and value of each field of o.
+func (o Record) String() string {
+	return fmt.Sprintf("Record{MyInt: %v, MyString1: %q, MyString2: %q}", o.MyInt, o.MyString1, o.MyString2)
+}
+
+// Clone returns a copy of o that shares no memory with it.
+func (o *Record) Clone() *Record {
+	c := *o
+	c.MyString1 = strings.Clone(o.MyString1)
+	c.MyString2 = strings.Clone(o.MyString2)
+	return &c
+}
+
+//raw:codegen:end
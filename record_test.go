@@ -0,0 +1,13 @@
+package raw_test
+
+import "github.com/boltdb/raw"
+
+//go:generate bolt-rawgen -arena -file record_test.go
+
+// record is a raw struct whose generated code, in record_rawgen_test.go, is
+// benchmarked alongside the hand-written encoding of O.
+type record struct {
+	myInt     int64
+	myString1 raw.String
+	myString2 raw.String
+}